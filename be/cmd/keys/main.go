@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+	"yourapp/internal/util"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Manage the JWT signing keys in JWT_KEYS_DIR.
+
+Usage:
+  keys rotate [-dir DIR] [-alg RS256|EdDSA] [-activate-after 10m]
+  keys list   [-dir DIR]
+  keys prune  [-dir DIR] [-older-than 24h]
+`
+
+func main() {
+	_ = godotenv.Load()
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	dir := flags.String("dir", os.Getenv("JWT_KEYS_DIR"), "directory holding the signing keys")
+
+	switch os.Args[1] {
+	case "rotate":
+		alg := flags.String("alg", envOr("JWT_SIGNING_ALG", util.AlgRS256), "signing algorithm of the new key")
+		activateAfter := flags.Duration("activate-after", 10*time.Minute, "publish the key this long before it starts signing")
+		flags.Parse(os.Args[2:])
+		requireDir(*dir)
+
+		info, err := util.RotateSigningKey(*dir, *alg, *activateAfter)
+		if err != nil {
+			log.Fatal("Failed to rotate signing key: ", err)
+		}
+		fmt.Printf("Created %s key %s, signing from %s\n", info.Alg, info.Kid, info.ActiveFrom.Format(time.RFC3339))
+
+	case "list":
+		flags.Parse(os.Args[2:])
+		requireDir(*dir)
+
+		keys, err := util.ListSigningKeys(*dir)
+		if err != nil {
+			log.Fatal("Failed to read signing keys: ", err)
+		}
+		for _, info := range keys {
+			fmt.Printf("%s\t%s\tcreated %s\tsigning from %s\n", info.Kid, info.Alg,
+				info.CreatedAt.Format(time.RFC3339), info.ActiveFrom.Format(time.RFC3339))
+		}
+
+	case "prune":
+		olderThan := flags.Duration("older-than", 24*time.Hour, "remove keys replaced longer ago than this (must exceed the longest token lifetime)")
+		flags.Parse(os.Args[2:])
+		requireDir(*dir)
+
+		pruned, err := util.PruneSigningKeys(*dir, *olderThan)
+		if err != nil {
+			log.Fatal("Failed to prune signing keys: ", err)
+		}
+		for _, info := range pruned {
+			fmt.Printf("Removed key %s\n", info.Kid)
+		}
+		fmt.Printf("%d key(s) removed\n", len(pruned))
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func requireDir(dir string) {
+	if dir == "" {
+		log.Fatal("Set JWT_KEYS_DIR or pass -dir")
+	}
+}
+
+func envOr(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountHandler struct {
+	accountService service.AccountService
+}
+
+func NewAccountHandler(accountService service.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+	}
+}
+
+// RequestExport handles queueing a personal data export; the link is sent by email
+// POST /api/v1/auth/me/export
+func (h *AccountHandler) RequestExport(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	export, err := h.accountService.RequestExport(userID.(string))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusAccepted, "Ekspor data sedang diproses. Link unduhan akan dikirim ke email Anda.", gin.H{"export": export})
+}
+
+// DownloadExport handles downloading an export archive with the token from the email
+// GET /api/v1/auth/exports/download?token=...
+func (h *AccountHandler) DownloadExport(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		util.BadRequest(c, "token is required")
+		return
+	}
+
+	file, export, err := h.accountService.OpenExport(token)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+	defer file.Close()
+
+	filename := fmt.Sprintf("data-export-%s.zip", export.CreatedAt.Format("2006-01-02"))
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, -1, "application/zip", file, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, filename),
+	})
+}
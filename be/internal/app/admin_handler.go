@@ -0,0 +1,271 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+	"yourapp/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	authService service.AuthService
+	roomService service.RoomService
+	chatService service.ChatService
+	hub         *websocket.Hub
+
+	auditService service.AuditService
+	emailService service.EmailService
+	emailQueue   service.EmailQueueService
+}
+
+func NewAdminHandler(authService service.AuthService, roomService service.RoomService, chatService service.ChatService, auditService service.AuditService, emailService service.EmailService, emailQueue service.EmailQueueService, hub *websocket.Hub) *AdminHandler {
+	return &AdminHandler{
+		authService: authService,
+		roomService: roomService,
+		chatService: chatService,
+		hub:         hub,
+
+		auditService: auditService,
+		emailService: emailService,
+		emailQueue:   emailQueue,
+	}
+}
+
+// ListUsers handles listing and searching users
+// GET /api/v1/admin/users?q=&role=&is_active=&limit=&offset=
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var req service.ListUsersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	users, err := h.authService.ListUsers(req)
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Users retrieved successfully", users)
+}
+
+// DeactivateUser handles disabling an account and signing it out everywhere
+// POST /api/v1/admin/users/:id/deactivate
+func (h *AdminHandler) DeactivateUser(c *gin.Context) {
+	h.setUserActive(c, false)
+}
+
+// ReactivateUser handles re-enabling a deactivated account
+// POST /api/v1/admin/users/:id/reactivate
+func (h *AdminHandler) ReactivateUser(c *gin.Context) {
+	h.setUserActive(c, true)
+}
+
+func (h *AdminHandler) setUserActive(c *gin.Context, active bool) {
+	actorID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	userID := c.Param("id")
+	if userID == "" {
+		util.BadRequest(c, "User ID is required")
+		return
+	}
+
+	user, err := h.authService.SetUserActive(actorID.(string), userID, active, clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	message := "User deactivated successfully"
+	if active {
+		message = "User reactivated successfully"
+	}
+	util.SuccessResponse(c, http.StatusOK, message, user)
+}
+
+// GetRoomParticipants handles listing everyone who has joined a room
+// GET /api/v1/admin/rooms/:id/participants
+func (h *AdminHandler) GetRoomParticipants(c *gin.Context) {
+	roomID := c.Param("id")
+	if roomID == "" {
+		util.BadRequest(c, "Room ID is required")
+		return
+	}
+
+	participants, err := h.roomService.GetParticipants(roomID)
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Participants retrieved successfully", participants)
+}
+
+// CloseRoom handles force-closing a room and disconnecting its participants
+// POST /api/v1/admin/rooms/:id/close
+func (h *AdminHandler) CloseRoom(c *gin.Context) {
+	roomID := c.Param("id")
+	if roomID == "" {
+		util.BadRequest(c, "Room ID is required")
+		return
+	}
+
+	actorID := c.GetString("userID")
+	if err := h.roomService.CloseRoom(roomID, actorID, clientInfo(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	h.hub.BroadcastMessage(roomID, &websocket.Message{
+		RoomID:  roomID,
+		UserID:  actorID,
+		Type:    "room_closed",
+		Payload: gin.H{"room_id": roomID},
+	})
+
+	util.SuccessResponse(c, http.StatusOK, "Room closed successfully", nil)
+}
+
+// DeleteMessage handles removing a chat message from any room
+// DELETE /api/v1/admin/messages/:id
+func (h *AdminHandler) DeleteMessage(c *gin.Context) {
+	messageID := c.Param("id")
+	if messageID == "" {
+		util.BadRequest(c, "Message ID is required")
+		return
+	}
+
+	actorID := c.GetString("userID")
+	message, err := h.chatService.DeleteMessage(messageID, actorID, clientInfo(c))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	h.hub.BroadcastMessage(message.RoomID, &websocket.Message{
+		RoomID:  message.RoomID,
+		UserID:  actorID,
+		Type:    "message_deleted",
+		Payload: gin.H{"id": message.ID},
+	})
+
+	util.SuccessResponse(c, http.StatusOK, "Message deleted successfully", message)
+}
+
+// GetAuditEvents handles searching the audit log
+// GET /api/v1/admin/audit-events?actor_id=&action=&target_id=&ip=&from=&to=&limit=&offset=
+func (h *AdminHandler) GetAuditEvents(c *gin.Context) {
+	var req service.AuditQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	events, err := h.auditService.Search(req)
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Audit events retrieved successfully", events)
+}
+
+// ExportAuditEvents handles downloading every matching audit event as CSV
+// GET /api/v1/admin/audit-events/export?actor_id=&action=&target_id=&ip=&from=&to=
+func (h *AdminHandler) ExportAuditEvents(c *gin.Context) {
+	var req service.AuditQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("audit-events-%s.csv", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	if err := h.auditService.ExportCSV(req, c.Writer); err != nil {
+		// Headers are already sent, so the download is just cut short
+		log.Printf("Audit export failed: %v", err)
+	}
+}
+
+// PreviewEmail handles rendering an email template with sample data
+// GET /api/v1/admin/emails/preview/:type?locale=id|en&format=html|text|json
+func (h *AdminHandler) PreviewEmail(c *gin.Context) {
+	rendered, err := h.emailService.Preview(c.Param("type"), c.Query("locale"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	switch c.DefaultQuery("format", "html") {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(rendered.HTML))
+	case "text":
+		c.String(http.StatusOK, "Subject: %s\n\n%s", rendered.Subject, rendered.Text)
+	case "json":
+		util.SuccessResponse(c, http.StatusOK, "Email preview rendered successfully", rendered)
+	default:
+		util.BadRequest(c, "format must be html, text or json")
+	}
+}
+
+// GetDeadLetters handles listing emails that failed permanently or too often
+// GET /api/v1/admin/emails/dead-letters?limit=
+func (h *AdminHandler) GetDeadLetters(c *gin.Context) {
+	var req struct {
+		Limit int `form:"limit"`
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	deadLetters, err := h.emailQueue.DeadLetters(req.Limit)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusServiceUnavailable, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Dead letters retrieved successfully", deadLetters)
+}
+
+// ReplayDeadLetters handles sending the given dead letters, or all of them,
+// back to the email queue
+// POST /api/v1/admin/emails/dead-letters/replay
+func (h *AdminHandler) ReplayDeadLetters(c *gin.Context) {
+	var req struct {
+		IDs []string `json:"ids"`
+		All bool     `json:"all"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+	if len(req.IDs) == 0 && !req.All {
+		util.BadRequest(c, "ids or all is required")
+		return
+	}
+	if req.All {
+		req.IDs = nil
+	}
+
+	replayed, err := h.emailQueue.ReplayDeadLetters(req.IDs, c.GetString("userID"), clientInfo(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusServiceUnavailable, err.Error(), gin.H{"replayed": replayed})
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Dead letters replayed successfully", gin.H{"replayed": replayed})
+}
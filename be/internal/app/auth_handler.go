@@ -2,9 +2,14 @@ package app
 
 import (
 	"errors"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
+	"yourapp/internal/model"
 	"yourapp/internal/service"
 	"yourapp/internal/util"
 
@@ -14,13 +19,19 @@ import (
 
 type AuthHandler struct {
 	authService service.AuthService
-	jwtSecret   string
+	keys        *util.KeyRing
+	clientURL   string
+
+	avatarMaxBytes int64
 }
 
-func NewAuthHandler(authService service.AuthService, jwtSecret string) *AuthHandler {
+func NewAuthHandler(authService service.AuthService, keys *util.KeyRing, clientURL string, avatarMaxBytes int64) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
-		jwtSecret:   jwtSecret,
+		keys:        keys,
+		clientURL:   strings.TrimRight(clientURL, "/"),
+
+		avatarMaxBytes: avatarMaxBytes,
 	}
 }
 
@@ -51,8 +62,11 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.Login(req)
+	resp, err := h.authService.Login(req, clientInfo(c))
 	if err != nil {
+		if rateLimited(c, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "not verified") {
 			// Return special response for unverified email with email in data
 			util.ErrorResponse(c, http.StatusUnauthorized, err.Error(), gin.H{
@@ -66,15 +80,20 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	if resp.MFARequired {
+		util.SuccessResponse(c, http.StatusOK, "Two-factor authentication required", resp)
+		return
+	}
+
 	util.SuccessResponse(c, http.StatusOK, "Login successful", resp)
 }
 
-// VerifyOTP handles OTP verification
-// POST /api/v1/auth/verify-otp
-func (h *AuthHandler) VerifyOTP(c *gin.Context) {
+// VerifyMFA handles the second step of a login with two-factor authentication
+// POST /api/v1/auth/mfa/verify
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
 	var req struct {
-		Email   string `json:"email" binding:"required,email"`
-		OTPCode string `json:"otp_code" binding:"required"`
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -82,20 +101,47 @@ func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.VerifyOTP(req.Email, req.OTPCode)
+	resp, err := h.authService.VerifyMFA(req.MFAToken, req.Code, clientInfo(c))
+	if err != nil {
+		if rateLimited(c, err) {
+			return
+		}
+		util.Unauthorized(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Login successful", resp)
+}
+
+// EnrollMFA handles starting TOTP enrollment
+// POST /api/v1/auth/mfa/enroll
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	resp, err := h.authService.EnrollMFA(userID.(string))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
-	util.SuccessResponse(c, http.StatusOK, "OTP verified successfully", resp)
+	util.SuccessResponse(c, http.StatusOK, "Scan the QR code with your authenticator app", resp)
 }
 
-// ResendOTP handles OTP resend
-// POST /api/v1/auth/resend-otp
-func (h *AuthHandler) ResendOTP(c *gin.Context) {
+// ConfirmMFA handles enabling TOTP with a first code from the authenticator
+// POST /api/v1/auth/mfa/confirm
+func (h *AuthHandler) ConfirmMFA(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
 	var req struct {
-		Email string `json:"email" binding:"required,email"`
+		Code string `json:"code" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -103,58 +149,172 @@ func (h *AuthHandler) ResendOTP(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.ResendOTP(req.Email); err != nil {
+	resp, err := h.authService.ConfirmMFA(userID.(string), req.Code)
+	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
-	util.SuccessResponse(c, http.StatusOK, "OTP sent successfully", nil)
+	util.SuccessResponse(c, http.StatusOK, "Two-factor authentication enabled. Store your recovery codes safely.", resp)
 }
 
-// GoogleOAuth handles Google OAuth login
-// POST /api/v1/auth/google-oauth
-func (h *AuthHandler) GoogleOAuth(c *gin.Context) {
-	var req service.GoogleOAuthRequest
+// DisableMFA handles turning TOTP off
+// POST /api/v1/auth/mfa/disable
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.authService.DisableMFA(userID.(string), req.Code); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Two-factor authentication disabled", nil)
+}
+
+// BeginPasskeyRegistration handles creating WebAuthn options for a new passkey
+// POST /api/v1/auth/passkeys/register/begin
+func (h *AuthHandler) BeginPasskeyRegistration(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	resp, err := h.authService.BeginPasskeyRegistration(userID.(string))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Passkey registration started", resp)
+}
+
+// FinishPasskeyRegistration handles verifying and saving a new passkey
+// POST /api/v1/auth/passkeys/register/finish
+func (h *AuthHandler) FinishPasskeyRegistration(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.PasskeyRegistrationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		util.BadRequest(c, err.Error())
 		return
 	}
 
-	resp, err := h.authService.GoogleOAuth(req)
+	passkey, err := h.authService.FinishPasskeyRegistration(userID.(string), req)
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
-	util.SuccessResponse(c, http.StatusOK, "Google OAuth successful", resp)
+	util.SuccessResponse(c, http.StatusCreated, "Passkey registered successfully", passkey)
 }
 
-// RefreshToken handles token refresh
-// POST /api/v1/auth/refresh-token
-func (h *AuthHandler) RefreshToken(c *gin.Context) {
+// BeginPasskeyLogin handles creating WebAuthn options for a passkey login
+// POST /api/v1/auth/passkeys/login/begin
+func (h *AuthHandler) BeginPasskeyLogin(c *gin.Context) {
 	var req struct {
-		RefreshToken string `json:"refresh_token" binding:"required"`
+		Email string `json:"email" binding:"omitempty,email"`
+	}
+
+	// The body is optional: without an email any discoverable passkey may be used
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			util.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	resp, err := h.authService.BeginPasskeyLogin(req.Email)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
+	util.SuccessResponse(c, http.StatusOK, "Passkey login started", resp)
+}
+
+// FinishPasskeyLogin handles verifying a passkey assertion and signing the user in
+// POST /api/v1/auth/passkeys/login/finish
+func (h *AuthHandler) FinishPasskeyLogin(c *gin.Context) {
+	var req service.PasskeyLoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		util.BadRequest(c, err.Error())
 		return
 	}
 
-	resp, err := h.authService.RefreshToken(req.RefreshToken)
+	resp, err := h.authService.FinishPasskeyLogin(req, clientInfo(c))
 	if err != nil {
 		util.Unauthorized(c, err.Error())
 		return
 	}
 
-	util.SuccessResponse(c, http.StatusOK, "Token refreshed successfully", resp)
+	util.SuccessResponse(c, http.StatusOK, "Login successful", resp)
 }
 
-// RequestResetPassword handles password reset request
-// POST /api/v1/auth/forgot-password
-func (h *AuthHandler) RequestResetPassword(c *gin.Context) {
+// GetPasskeys handles listing the current user's passkeys
+// GET /api/v1/auth/passkeys
+func (h *AuthHandler) GetPasskeys(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	passkeys, err := h.authService.GetPasskeys(userID.(string))
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Passkeys retrieved successfully", passkeys)
+}
+
+// DeletePasskey handles removing one of the current user's passkeys
+// DELETE /api/v1/auth/passkeys/:id
+func (h *AuthHandler) DeletePasskey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	passkeyID := c.Param("id")
+	if passkeyID == "" {
+		util.BadRequest(c, "Passkey ID is required")
+		return
+	}
+
+	if err := h.authService.DeletePasskey(userID.(string), passkeyID); err != nil {
+		util.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Passkey deleted successfully", nil)
+}
+
+// VerifyOTP handles OTP verification
+// POST /api/v1/auth/verify-otp
+func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 	var req struct {
-		Email string `json:"email" binding:"required,email"`
+		Email   string `json:"email" binding:"required,email"`
+		OTPCode string `json:"otp_code" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -162,75 +322,46 @@ func (h *AuthHandler) RequestResetPassword(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.RequestResetPassword(req.Email); err != nil {
-		// Return error if email doesn't exist or other error occurs
+	resp, err := h.authService.VerifyOTP(req.Email, req.OTPCode, clientInfo(c))
+	if err != nil {
+		if rateLimited(c, err) {
+			return
+		}
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
-	util.SuccessResponse(c, http.StatusOK, "Kode OTP telah dikirim ke email Anda", nil)
+	util.SuccessResponse(c, http.StatusOK, "OTP verified successfully", resp)
 }
 
-// VerifyResetPassword handles password reset with OTP verification
-// POST /api/v1/auth/verify-reset-password
-func (h *AuthHandler) VerifyResetPassword(c *gin.Context) {
+// ResendOTP handles OTP resend
+// POST /api/v1/auth/resend-otp
+func (h *AuthHandler) ResendOTP(c *gin.Context) {
 	var req struct {
-		Email       string `json:"email" binding:"required,email"`
-		OTPCode     string `json:"otp_code" binding:"required"`
-		NewPassword string `json:"new_password" binding:"required,min=8,max=128"`
+		Email string `json:"email" binding:"required,email"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		// Parse validation errors and provide user-friendly messages
-		var validationErr validator.ValidationErrors
-		if errors.As(err, &validationErr) {
-			for _, fieldErr := range validationErr {
-				switch fieldErr.Field() {
-				case "NewPassword":
-					if fieldErr.Tag() == "min" {
-						util.BadRequest(c, "Password minimal 8 karakter")
-						return
-					} else if fieldErr.Tag() == "max" {
-						util.BadRequest(c, "Password maksimal 128 karakter")
-						return
-					}
-				case "Email":
-					util.BadRequest(c, "Format email tidak valid")
-					return
-				case "OTPCode":
-					util.BadRequest(c, "Kode OTP wajib diisi")
-					return
-				}
-			}
-		}
-		// Check for specific error messages
-		errStr := err.Error()
-		if strings.Contains(errStr, "min") && strings.Contains(errStr, "NewPassword") {
-			util.BadRequest(c, "Password minimal 8 karakter")
-			return
-		}
-		if strings.Contains(errStr, "max") && strings.Contains(errStr, "NewPassword") {
-			util.BadRequest(c, "Password maksimal 128 karakter")
-			return
-		}
-		util.BadRequest(c, errStr)
+		util.BadRequest(c, err.Error())
 		return
 	}
 
-	if err := h.authService.VerifyResetPassword(req.Email, req.OTPCode, req.NewPassword); err != nil {
+	if err := h.authService.ResendOTP(req.Email); err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
-	util.SuccessResponse(c, http.StatusOK, "Password reset successfully. Please login with your new password.", nil)
+	util.SuccessResponse(c, http.StatusOK, "OTP sent successfully", nil)
 }
 
-// ResetPassword handles password reset with token
-// POST /api/v1/auth/reset-password
-func (h *AuthHandler) ResetPassword(c *gin.Context) {
+// magicLinkNonceCookie binds a magic link to the browser that requested it
+const magicLinkNonceCookie = "magic_link_nonce"
+
+// RequestMagicLink handles emailing a passwordless sign-in link
+// POST /api/v1/auth/magic-link
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
 	var req struct {
-		Token       string `json:"token" binding:"required"`
-		NewPassword string `json:"newPassword" binding:"required,min=8"`
+		Email string `json:"email" binding:"required,email"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -238,18 +369,24 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.ResetPassword(req.Token, req.NewPassword)
+	nonce, err := util.GenerateOpaqueToken()
 	if err != nil {
-		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		util.InternalServerError(c, "Failed to generate login link")
 		return
 	}
 
-	util.SuccessResponse(c, http.StatusOK, "Password reset successfully", resp)
+	if err := h.authService.RequestMagicLink(req.Email, nonce, clientInfo(c)); err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+	setMagicLinkNonce(c, nonce, 600)
+
+	util.SuccessResponse(c, http.StatusOK, "Jika email terdaftar, link login telah dikirim", nil)
 }
 
-// VerifyEmail handles email verification
-// POST /api/v1/auth/verify-email
-func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+// VerifyMagicLink handles signing in with a magic link opened in the requesting browser
+// POST /api/v1/auth/magic-link/verify
+func (h *AuthHandler) VerifyMagicLink(c *gin.Context) {
 	var req struct {
 		Token string `json:"token" binding:"required"`
 	}
@@ -259,61 +396,810 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.VerifyEmail(req.Token)
+	nonce, _ := c.Cookie(magicLinkNonceCookie)
+	resp, err := h.authService.VerifyMagicLink(req.Token, nonce, clientInfo(c))
+	if err != nil {
+		util.Unauthorized(c, err.Error())
+		return
+	}
+	setMagicLinkNonce(c, "", -1)
+
+	util.SuccessResponse(c, http.StatusOK, "Login successful", resp)
+}
+
+// setMagicLinkNonce stores the nonce in an HttpOnly cookie scoped to the magic link
+// endpoints; a negative maxAge deletes it
+func setMagicLinkNonce(c *gin.Context, nonce string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkNonceCookie, nonce, maxAge, "/api/v1/auth/magic-link", "", secure, true)
+}
+
+// GoogleOAuth handles Google OAuth login
+// POST /api/v1/auth/google-oauth
+func (h *AuthHandler) GoogleOAuth(c *gin.Context) {
+	var req service.GoogleOAuthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.authService.GoogleOAuth(req, clientInfo(c))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
-	util.SuccessResponse(c, http.StatusOK, "Email verified successfully", resp)
+	util.SuccessResponse(c, http.StatusOK, "Google OAuth successful", resp)
 }
 
-// GetMe handles getting current user info
-// GET /api/v1/auth/me
-func (h *AuthHandler) GetMe(c *gin.Context) {
-	userID, exists := c.Get("userID")
-	if !exists {
-		util.Unauthorized(c, "User not authenticated")
+// JWKS handles publishing the public keys that verify access tokens.
+// The body is a plain JWK Set, not wrapped in the usual response envelope.
+// GET /.well-known/jwks.json
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": h.keys.JWKS()})
+}
+
+// GetOIDCProviders handles listing the configured single sign-on providers
+// GET /api/v1/auth/oidc/providers
+func (h *AuthHandler) GetOIDCProviders(c *gin.Context) {
+	util.SuccessResponse(c, http.StatusOK, "Identity providers retrieved successfully", h.authService.GetOIDCProviders())
+}
+
+// oidcNonceCookie binds a single sign-on flow to the browser that started it
+const oidcNonceCookie = "oidc_nonce"
+
+// OIDCLogin handles starting a single sign-on login by redirecting to the provider
+// GET /api/v1/auth/oidc/:provider/login
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	nonce, err := util.GenerateOpaqueToken()
+	if err != nil {
+		h.redirectOIDCResult(c, url.Values{"error": {"Failed to start login"}})
 		return
 	}
 
-	user, err := h.authService.GetMe(userID.(string))
+	authURL, err := h.authService.BeginOIDCLogin(c.Param("provider"), nonce)
 	if err != nil {
-		util.NotFound(c, "User not found")
+		h.redirectOIDCResult(c, url.Values{"error": {err.Error()}})
 		return
 	}
+	setOIDCNonce(c, nonce, 600)
 
-	util.SuccessResponse(c, http.StatusOK, "User retrieved successfully", gin.H{"user": user})
+	c.Redirect(http.StatusFound, authURL)
 }
 
-// AuthMiddleware validates JWT token
-func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			util.Unauthorized(c, "Authorization header required")
-			c.Abort()
-			return
-		}
+// OIDCCallback handles the provider redirect after a single sign-on login
+// GET /api/v1/auth/oidc/:provider/callback
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	provider := c.Param("provider")
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			util.Unauthorized(c, "Invalid authorization header format")
-			c.Abort()
-			return
+	if providerErr := c.Query("error"); providerErr != "" {
+		message := c.Query("error_description")
+		if message == "" {
+			message = providerErr
 		}
+		h.redirectOIDCResult(c, url.Values{"error": {message}, "provider": {provider}})
+		return
+	}
 
-		token := parts[1]
-		claims, err := util.ValidateToken(token, h.jwtSecret)
+	nonce, _ := c.Cookie(oidcNonceCookie)
+	result, err := h.authService.FinishOIDCLogin(provider, c.Query("code"), c.Query("state"), nonce, clientInfo(c))
+	setOIDCNonce(c, "", -1)
+	if err != nil {
+		h.redirectOIDCResult(c, url.Values{"error": {err.Error()}, "provider": {provider}})
+		return
+	}
+
+	if result.Linked {
+		h.redirectOIDCResult(c, url.Values{"linked": {result.Provider}})
+		return
+	}
+
+	h.redirectOIDCResult(c, url.Values{"code": {result.Code}, "provider": {result.Provider}})
+}
+
+// setOIDCNonce stores the nonce in an HttpOnly cookie scoped to the single sign-on
+// endpoints. SameSite=Lax still sends it on the provider's top-level redirect back
+// to the callback. A negative maxAge deletes it.
+func setOIDCNonce(c *gin.Context, nonce string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcNonceCookie, nonce, maxAge, "/api/v1/auth/oidc", "", secure, true)
+}
+
+// ExchangeOIDCCode handles swapping the one-time code from the callback for tokens
+// POST /api/v1/auth/oidc/exchange
+func (h *AuthHandler) ExchangeOIDCCode(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.authService.ExchangeOIDCCode(req.Code)
+	if err != nil {
+		util.Unauthorized(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Login successful", resp)
+}
+
+// GetIdentities handles listing the external accounts linked to the current user
+// GET /api/v1/auth/identities
+func (h *AuthHandler) GetIdentities(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	identities, err := h.authService.GetIdentities(userID.(string))
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Linked accounts retrieved successfully", identities)
+}
+
+// LinkIdentity handles starting to link an external account to the current user.
+// The client navigates to the returned URL; the provider redirects back to the callback.
+// The request must be sent with credentials so the browser keeps the oidc_nonce cookie.
+// POST /api/v1/auth/identities/:provider/link
+func (h *AuthHandler) LinkIdentity(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	nonce, err := util.GenerateOpaqueToken()
+	if err != nil {
+		util.InternalServerError(c, "Failed to start linking")
+		return
+	}
+
+	authURL, err := h.authService.BeginOIDCLink(userID.(string), c.Param("provider"), nonce)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	setOIDCNonce(c, nonce, 600)
+
+	util.SuccessResponse(c, http.StatusOK, "Continue at the identity provider", gin.H{"authorization_url": authURL})
+}
+
+// UnlinkIdentity handles removing a linked external account
+// DELETE /api/v1/auth/identities/:id
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	identityID := c.Param("id")
+	if identityID == "" {
+		util.BadRequest(c, "Identity ID is required")
+		return
+	}
+
+	if err := h.authService.UnlinkIdentity(userID.(string), identityID); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Account unlinked successfully", nil)
+}
+
+// redirectOIDCResult sends the browser back to the frontend's SSO callback page
+func (h *AuthHandler) redirectOIDCResult(c *gin.Context, params url.Values) {
+	c.Redirect(http.StatusFound, h.clientURL+"/auth/sso/callback?"+params.Encode())
+}
+
+// RefreshToken handles token refresh
+// POST /api/v1/auth/refresh-token
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.authService.RefreshToken(req.RefreshToken)
+	if err != nil {
+		util.Unauthorized(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Token refreshed successfully", resp)
+}
+
+// Logout handles revoking the session of a refresh token
+// POST /api/v1/auth/logout
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.authService.Logout(req.RefreshToken); err != nil {
+		util.Unauthorized(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Logged out successfully", nil)
+}
+
+// LogoutAll handles revoking every session of the current user
+// POST /api/v1/auth/logout-all
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	if err := h.authService.LogoutAll(userID.(string)); err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Logged out from all devices successfully", nil)
+}
+
+// RequestResetPassword handles password reset request
+// POST /api/v1/auth/forgot-password
+func (h *AuthHandler) RequestResetPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.authService.RequestResetPassword(req.Email); err != nil {
+		// Return error if email doesn't exist or other error occurs
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Kode OTP telah dikirim ke email Anda", nil)
+}
+
+// VerifyResetPassword handles password reset with OTP verification
+// POST /api/v1/auth/verify-reset-password
+func (h *AuthHandler) VerifyResetPassword(c *gin.Context) {
+	var req struct {
+		Email       string `json:"email" binding:"required,email"`
+		OTPCode     string `json:"otp_code" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required,min=8,max=128"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		// Parse validation errors and provide user-friendly messages
+		var validationErr validator.ValidationErrors
+		if errors.As(err, &validationErr) {
+			for _, fieldErr := range validationErr {
+				switch fieldErr.Field() {
+				case "NewPassword":
+					if fieldErr.Tag() == "min" {
+						util.BadRequest(c, "Password minimal 8 karakter")
+						return
+					} else if fieldErr.Tag() == "max" {
+						util.BadRequest(c, "Password maksimal 128 karakter")
+						return
+					}
+				case "Email":
+					util.BadRequest(c, "Format email tidak valid")
+					return
+				case "OTPCode":
+					util.BadRequest(c, "Kode OTP wajib diisi")
+					return
+				}
+			}
+		}
+		// Check for specific error messages
+		errStr := err.Error()
+		if strings.Contains(errStr, "min") && strings.Contains(errStr, "NewPassword") {
+			util.BadRequest(c, "Password minimal 8 karakter")
+			return
+		}
+		if strings.Contains(errStr, "max") && strings.Contains(errStr, "NewPassword") {
+			util.BadRequest(c, "Password maksimal 128 karakter")
+			return
+		}
+		util.BadRequest(c, errStr)
+		return
+	}
+
+	if err := h.authService.VerifyResetPassword(req.Email, req.OTPCode, req.NewPassword, clientInfo(c)); err != nil {
+		if rateLimited(c, err) {
+			return
+		}
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Password reset successfully. Please login with your new password.", nil)
+}
+
+// ResetPassword handles password reset with OTP verification and signs the user in.
+// Accounts with 2FA get an MFA challenge instead of tokens.
+// POST /api/v1/auth/reset-password
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Email       string `json:"email" binding:"required,email"`
+		OTPCode     string `json:"otp_code" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required,min=8,max=128"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.authService.ResetPassword(req.Email, req.OTPCode, req.NewPassword, clientInfo(c))
+	if err != nil {
+		if rateLimited(c, err) {
+			return
+		}
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Password reset successfully", resp)
+}
+
+// VerifyEmail handles email verification
+// POST /api/v1/auth/verify-email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	resp, err := h.authService.VerifyEmail(req.Token, clientInfo(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Email verified successfully", resp)
+}
+
+// GetMe handles getting current user info
+// GET /api/v1/auth/me
+func (h *AuthHandler) GetMe(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	user, err := h.authService.GetMe(userID.(string))
+	if err != nil {
+		util.NotFound(c, "User not found")
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "User retrieved successfully", gin.H{"user": user})
+}
+
+// UpdateMe handles updating the current user's profile
+// PATCH /api/v1/auth/me
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	user, err := h.authService.UpdateProfile(userID.(string), req)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Profile updated successfully", gin.H{"user": user})
+}
+
+// ChangePassword handles changing the current user's password
+// POST /api/v1/auth/me/password
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.authService.ChangePassword(userID.(string), c.GetString("sessionID"), req, clientInfo(c)); err != nil {
+		if rateLimited(c, err) {
+			return
+		}
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Password changed successfully. Other devices have been signed out.", nil)
+}
+
+// RequestEmailChange handles sending a confirmation code to a new email address
+// POST /api/v1/auth/me/email
+func (h *AuthHandler) RequestEmailChange(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.authService.RequestEmailChange(userID.(string), req, clientInfo(c)); err != nil {
+		if rateLimited(c, err) {
+			return
+		}
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "OTP telah dikirim ke email baru Anda", nil)
+}
+
+// ConfirmEmailChange handles swapping the email once the code is confirmed
+// POST /api/v1/auth/me/email/confirm
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		OTPCode string `json:"otp_code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	user, err := h.authService.ConfirmEmailChange(userID.(string), c.GetString("sessionID"), req.OTPCode, clientInfo(c))
+	if err != nil {
+		if rateLimited(c, err) {
+			return
+		}
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Email changed successfully. Other devices have been signed out.", gin.H{"user": user})
+}
+
+// UploadAvatar handles uploading a profile picture (multipart field "avatar")
+// POST /api/v1/auth/me/avatar
+func (h *AuthHandler) UploadAvatar(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	// Leave room for the multipart envelope; the service checks the exact file size
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.avatarMaxBytes+1<<20)
+
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			util.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Image is too large", nil)
+			return
+		}
+		util.BadRequest(c, "avatar file is required")
+		return
+	}
+	if fileHeader.Size > h.avatarMaxBytes {
+		util.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Image is too large", nil)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		util.BadRequest(c, "failed to read avatar file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.avatarMaxBytes+1))
+	if err != nil {
+		util.BadRequest(c, "failed to read avatar file")
+		return
+	}
+
+	result, err := h.authService.UploadAvatar(userID.(string), data)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Avatar updated successfully", result)
+}
+
+// CreateAccessToken handles creating a personal access token; the token is only returned once
+// POST /api/v1/auth/tokens
+func (h *AuthHandler) CreateAccessToken(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	token, err := h.authService.CreateAccessToken(userID.(string), req)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "Access token created. Copy it now, it will not be shown again.", token)
+}
+
+// GetAccessTokens handles listing the current user's personal access tokens
+// GET /api/v1/auth/tokens
+func (h *AuthHandler) GetAccessTokens(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	tokens, err := h.authService.GetAccessTokens(userID.(string))
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Access tokens retrieved successfully", tokens)
+}
+
+// RevokeAccessToken handles revoking a personal access token
+// DELETE /api/v1/auth/tokens/:id
+func (h *AuthHandler) RevokeAccessToken(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	if err := h.authService.RevokeAccessToken(userID.(string), c.Param("id")); err != nil {
+		util.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Access token revoked successfully", nil)
+}
+
+// DeleteMe handles scheduling the current user's account for deletion
+// DELETE /api/v1/auth/me
+func (h *AuthHandler) DeleteMe(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	dueAt, err := h.authService.DeleteAccount(userID.(string), req)
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Akun Anda akan dihapus. Login kembali sebelum tanggal penghapusan untuk membatalkan.", gin.H{
+		"deletion_due_at": dueAt,
+	})
+}
+
+// AuthMiddleware validates a JWT access token or a personal access token.
+// Personal access tokens ("pat_...") only work on routes that list the scopes
+// they need, and must have all of them; routes without scopes (account
+// settings, security, token management) require a signed-in session.
+func (h *AuthHandler) AuthMiddleware(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			util.Unauthorized(c, "Authorization header required")
+			c.Abort()
+			return
+		}
+
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			util.Unauthorized(c, "Invalid authorization header format")
+			c.Abort()
+			return
+		}
+
+		token := parts[1]
+		if strings.HasPrefix(token, model.AccessTokenPrefix) {
+			h.authenticateAccessToken(c, token, scopes)
+			return
+		}
+
+		claims, err := util.ValidateTokenType(token, h.keys, util.TokenTypeAccess)
 		if err != nil {
 			util.Unauthorized(c, "Invalid or expired token")
 			c.Abort()
 			return
 		}
 
+		// Reject tokens of sessions that were logged out or revoked
+		if !h.authService.IsSessionActive(claims.SessionID) {
+			util.Unauthorized(c, "Session has been revoked")
+			c.Abort()
+			return
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("userType", claims.UserType)
+		c.Set("sessionID", claims.SessionID)
 		c.Next()
 	}
 }
+
+func (h *AuthHandler) authenticateAccessToken(c *gin.Context, token string, required []string) {
+	if len(required) == 0 {
+		util.Forbidden(c, "This endpoint cannot be used with a personal access token")
+		c.Abort()
+		return
+	}
+
+	principal, err := h.authService.AuthenticateAccessToken(token, c.ClientIP())
+	if err != nil {
+		util.Unauthorized(c, err.Error())
+		c.Abort()
+		return
+	}
+
+	granted := make(map[string]bool, len(principal.Scopes))
+	for _, scope := range principal.Scopes {
+		granted[scope] = true
+	}
+	for _, scope := range required {
+		if !granted[scope] {
+			util.Forbidden(c, "Access token is missing the "+scope+" scope")
+			c.Abort()
+			return
+		}
+	}
+
+	c.Set("userID", principal.User.ID)
+	c.Set("email", principal.User.Email)
+	c.Set("userType", principal.User.UserType)
+	c.Set("accessTokenID", principal.TokenID)
+	c.Set("scopes", principal.Scopes)
+	c.Next()
+}
+
+// GetSessions handles listing the signed-in devices of the current user
+// GET /api/v1/auth/sessions
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	sessions, err := h.authService.GetSessions(userID.(string), c.GetString("sessionID"))
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Sessions retrieved successfully", sessions)
+}
+
+// RevokeSession handles signing out a specific device
+// DELETE /api/v1/auth/sessions/:id
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		util.BadRequest(c, "Session ID is required")
+		return
+	}
+
+	if err := h.authService.RevokeSession(userID.(string), sessionID); err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Session revoked successfully", nil)
+}
+
+// RequireRole only lets users with one of roles through; admins always pass.
+// Must run after AuthMiddleware.
+func (h *AuthHandler) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userType, _ := c.Get("userType")
+		role, _ := userType.(string)
+		if !model.RoleAllowed(role, roles...) {
+			util.Forbidden(c, "You do not have permission to perform this action")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimited responds with 429 Too Many Requests if err is a lockout and reports whether it did
+func rateLimited(c *gin.Context, err error) bool {
+	var limited *service.TooManyAttemptsError
+	if !errors.As(err, &limited) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(limited.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	util.ErrorResponse(c, http.StatusTooManyRequests, err.Error(), gin.H{"retry_after": retryAfter})
+	return true
+}
+
+// clientInfo extracts the device metadata stored on a session
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		DeviceName: c.GetHeader("X-Device-Name"),
+	}
+}
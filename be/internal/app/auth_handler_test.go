@@ -0,0 +1,134 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"yourapp/internal/model"
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeAuthService answers the two calls AuthMiddleware makes; anything else panics
+type fakeAuthService struct {
+	service.AuthService
+	revoked    map[string]bool
+	principals map[string]*service.AccessTokenPrincipal
+}
+
+func (f *fakeAuthService) IsSessionActive(sessionID string) bool {
+	return !f.revoked[sessionID]
+}
+
+func (f *fakeAuthService) AuthenticateAccessToken(token, ipAddress string) (*service.AccessTokenPrincipal, error) {
+	if principal, ok := f.principals[token]; ok {
+		return principal, nil
+	}
+	return nil, errors.New("invalid access token")
+}
+
+func newTestRouter(auth *fakeAuthService, keys *util.KeyRing) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewAuthHandler(auth, keys, "", 0)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	r := gin.New()
+	admin := r.Group("/admin", h.AuthMiddleware(model.ScopeAdmin), h.RequireRole(model.RoleModerator))
+	admin.GET("/rooms", ok)
+	admin.GET("/audit-events", h.RequireRole(model.RoleAdmin), ok)
+	r.GET("/me", h.AuthMiddleware(model.ScopeProfileRead), ok)
+	r.PATCH("/me", h.AuthMiddleware(), ok)
+	return r
+}
+
+func request(r *gin.Engine, method, path, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func accessToken(t *testing.T, keys *util.KeyRing, role, sessionID string) string {
+	t.Helper()
+	token, err := util.GenerateAccessToken("user-"+role, role+"@example.org", role, sessionID, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequireRole(t *testing.T) {
+	keys := util.NewHMACKeyRing("test-secret")
+	r := newTestRouter(&fakeAuthService{}, keys)
+
+	tests := []struct {
+		role        string
+		rooms, logs int
+	}{
+		{model.RoleMember, http.StatusForbidden, http.StatusForbidden},
+		{"", http.StatusForbidden, http.StatusForbidden},
+		{model.RoleModerator, http.StatusOK, http.StatusForbidden},
+		{model.RoleAdmin, http.StatusOK, http.StatusOK},
+	}
+	for _, tt := range tests {
+		token := accessToken(t, keys, tt.role, "session-"+tt.role)
+		if got := request(r, http.MethodGet, "/admin/rooms", token); got != tt.rooms {
+			t.Errorf("%q on a moderator route: status %d, want %d", tt.role, got, tt.rooms)
+		}
+		if got := request(r, http.MethodGet, "/admin/audit-events", token); got != tt.logs {
+			t.Errorf("%q on an admin route: status %d, want %d", tt.role, got, tt.logs)
+		}
+	}
+}
+
+func TestAuthMiddlewareRejectsRevokedSessions(t *testing.T) {
+	keys := util.NewHMACKeyRing("test-secret")
+	r := newTestRouter(&fakeAuthService{revoked: map[string]bool{"revoked": true}}, keys)
+
+	if got := request(r, http.MethodGet, "/admin/rooms", ""); got != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", got)
+	}
+	if got := request(r, http.MethodGet, "/admin/rooms", "garbage"); got != http.StatusUnauthorized {
+		t.Errorf("invalid token: status %d, want 401", got)
+	}
+	token := accessToken(t, keys, model.RoleAdmin, "revoked")
+	if got := request(r, http.MethodGet, "/admin/rooms", token); got != http.StatusUnauthorized {
+		t.Errorf("revoked session: status %d, want 401", got)
+	}
+}
+
+func TestAuthMiddlewareAccessTokenScopes(t *testing.T) {
+	admin := &model.User{ID: "admin", UserType: model.RoleAdmin}
+	member := &model.User{ID: "member", UserType: model.RoleMember}
+	auth := &fakeAuthService{principals: map[string]*service.AccessTokenPrincipal{
+		"pat_admin":        {User: admin, Scopes: []string{model.ScopeAdmin}},
+		"pat_admin_read":   {User: admin, Scopes: []string{model.ScopeProfileRead}},
+		"pat_member_admin": {User: member, Scopes: []string{model.ScopeAdmin}},
+	}}
+	r := newTestRouter(auth, util.NewHMACKeyRing("test-secret"))
+
+	tests := []struct {
+		name, method, path, token string
+		want                      int
+	}{
+		{"admin scope", http.MethodGet, "/admin/audit-events", "pat_admin", http.StatusOK},
+		{"missing admin scope", http.MethodGet, "/admin/rooms", "pat_admin_read", http.StatusForbidden},
+		{"admin scope without the role", http.MethodGet, "/admin/rooms", "pat_member_admin", http.StatusForbidden},
+		{"granted scope", http.MethodGet, "/me", "pat_admin_read", http.StatusOK},
+		{"missing scope", http.MethodGet, "/me", "pat_admin", http.StatusForbidden},
+		{"endpoint without scopes", http.MethodPatch, "/me", "pat_admin_read", http.StatusForbidden},
+		{"unknown token", http.MethodGet, "/me", "pat_unknown", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := request(r, tt.method, tt.path, tt.token); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
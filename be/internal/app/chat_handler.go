@@ -14,15 +14,17 @@ import (
 
 type ChatHandler struct {
 	chatService service.ChatService
+	authService service.AuthService
 	hub         *websocket.Hub
-	jwtSecret   string
+	keys        *util.KeyRing
 }
 
-func NewChatHandler(chatService service.ChatService, hub *websocket.Hub, jwtSecret string) *ChatHandler {
+func NewChatHandler(chatService service.ChatService, authService service.AuthService, hub *websocket.Hub, keys *util.KeyRing) *ChatHandler {
 	return &ChatHandler{
 		chatService: chatService,
+		authService: authService,
 		hub:         hub,
-		jwtSecret:   jwtSecret,
+		keys:        keys,
 	}
 }
 
@@ -67,6 +69,12 @@ func (h *ChatHandler) CreateMessage(c *gin.Context) {
 // GetMessages handles getting messages for a room
 // GET /api/v1/rooms/:id/messages
 func (h *ChatHandler) GetMessages(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		util.BadRequest(c, "Room ID is required")
@@ -88,7 +96,7 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 		}
 	}
 
-	messages, err := h.chatService.GetMessages(roomID, limit, offset)
+	messages, err := h.chatService.GetMessages(roomID, userID.(string), limit, offset)
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -126,13 +134,26 @@ func (h *ChatHandler) ServeWebSocket(c *gin.Context) {
 	}
 
 	// Validate token
-	claims, err := util.ValidateToken(token, h.jwtSecret)
+	claims, err := util.ValidateTokenType(token, h.keys, util.TokenTypeAccess)
 	if err != nil {
 		log.Printf("[WS] WebSocket connection rejected: Invalid token for room %s, error: %v", roomID, err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 		return
 	}
 
+	// Same check as AuthMiddleware: tokens of logged out or revoked sessions are rejected
+	if !h.authService.IsSessionActive(claims.SessionID) {
+		log.Printf("[WS] WebSocket connection rejected: session %s of user %s has been revoked", claims.SessionID, claims.UserID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+
+	if !h.chatService.CanAccessRoom(roomID, claims.UserID) {
+		log.Printf("[WS] WebSocket connection rejected: user %s cannot access room %s", claims.UserID, roomID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
 	log.Printf("[WS] WebSocket connection accepted: room=%s, user=%s", roomID, claims.UserID)
 
 	// Serve WebSocket connection
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"net/http"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationHandler struct {
+	orgService service.OrganizationService
+}
+
+func NewOrganizationHandler(orgService service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgService: orgService,
+	}
+}
+
+type updateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// GetMyOrganizations handles listing the organizations the current user belongs to
+// GET /api/v1/organizations
+func (h *OrganizationHandler) GetMyOrganizations(c *gin.Context) {
+	orgs, err := h.orgService.GetMyOrganizations(c.GetString("userID"))
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Organizations retrieved successfully", orgs)
+}
+
+// CreateOrganization handles creating an organization owned by the current user
+// POST /api/v1/organizations
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req service.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	org, err := h.orgService.CreateOrganization(c.GetString("userID"), req, clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "Organization created successfully", org)
+}
+
+// GetOrganization handles getting an organization the current user belongs to
+// GET /api/v1/organizations/:id
+func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
+	org, err := h.orgService.GetOrganization(c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Organization retrieved successfully", org)
+}
+
+// UpdateOrganization handles renaming an organization or changing its auto-join domain
+// PATCH /api/v1/organizations/:id
+func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
+	var req service.UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	org, err := h.orgService.UpdateOrganization(c.Param("id"), c.GetString("userID"), req, clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Organization updated successfully", org)
+}
+
+// VerifyDomain handles checking the DNS TXT record that proves the organization owns its domain
+// POST /api/v1/organizations/:id/domain/verify
+func (h *OrganizationHandler) VerifyDomain(c *gin.Context) {
+	org, err := h.orgService.VerifyDomain(c.Param("id"), c.GetString("userID"), clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Domain verified successfully", org)
+}
+
+// GetMembers handles listing an organization's members
+// GET /api/v1/organizations/:id/members
+func (h *OrganizationHandler) GetMembers(c *gin.Context) {
+	members, err := h.orgService.GetMembers(c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Members retrieved successfully", members)
+}
+
+// UpdateMemberRole handles changing a member's role
+// PATCH /api/v1/organizations/:id/members/:userId
+func (h *OrganizationHandler) UpdateMemberRole(c *gin.Context) {
+	var req updateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	err := h.orgService.UpdateMemberRole(c.Param("id"), c.GetString("userID"), c.Param("userId"), req.Role, clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Member role updated successfully", nil)
+}
+
+// RemoveMember handles removing a member, or leaving when the member is the current user
+// DELETE /api/v1/organizations/:id/members/:userId
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	err := h.orgService.RemoveMember(c.Param("id"), c.GetString("userID"), c.Param("userId"), clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Member removed successfully", nil)
+}
+
+// GetInvitations handles listing an organization's pending invitations
+// GET /api/v1/organizations/:id/invitations
+func (h *OrganizationHandler) GetInvitations(c *gin.Context) {
+	invitations, err := h.orgService.GetInvitations(c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Invitations retrieved successfully", invitations)
+}
+
+// InviteMember handles emailing an invitation to join an organization
+// POST /api/v1/organizations/:id/invitations
+func (h *OrganizationHandler) InviteMember(c *gin.Context) {
+	var req service.InviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	invitation, err := h.orgService.InviteMember(c.Param("id"), c.GetString("userID"), req, clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "Invitation sent successfully", invitation)
+}
+
+// RevokeInvitation handles cancelling a pending invitation
+// DELETE /api/v1/organizations/:id/invitations/:invitationId
+func (h *OrganizationHandler) RevokeInvitation(c *gin.Context) {
+	err := h.orgService.RevokeInvitation(c.Param("id"), c.GetString("userID"), c.Param("invitationId"))
+	if err != nil {
+		util.NotFound(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Invitation revoked successfully", nil)
+}
+
+// AcceptInvitation handles joining an organization from an invitation link
+// POST /api/v1/organizations/invitations/accept
+func (h *OrganizationHandler) AcceptInvitation(c *gin.Context) {
+	var req acceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	org, err := h.orgService.AcceptInvitation(c.GetString("userID"), req.Token, clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Joined organization successfully", org)
+}
+
+// CreateSCIMToken handles issuing a new SCIM provisioning token, replacing the old one
+// POST /api/v1/organizations/:id/scim-token
+func (h *OrganizationHandler) CreateSCIMToken(c *gin.Context) {
+	token, err := h.orgService.CreateSCIMToken(c.Param("id"), c.GetString("userID"), clientInfo(c))
+	if err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusCreated, "SCIM token created, it will not be shown again", gin.H{"token": token})
+}
+
+// DisableSCIM handles revoking the SCIM provisioning token
+// DELETE /api/v1/organizations/:id/scim-token
+func (h *OrganizationHandler) DisableSCIM(c *gin.Context) {
+	if err := h.orgService.DisableSCIM(c.Param("id"), c.GetString("userID"), clientInfo(c)); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "SCIM provisioning disabled", nil)
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"yourapp/internal/service"
+	"yourapp/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionHandler struct {
+	retentionService service.RetentionService
+}
+
+func NewRetentionHandler(retentionService service.RetentionService) *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: retentionService,
+	}
+}
+
+// GetPolicies handles listing retention policies
+// GET /api/v1/admin/retention/policies
+func (h *RetentionHandler) GetPolicies(c *gin.Context) {
+	policies, err := h.retentionService.GetPolicies()
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Retention policies retrieved successfully", policies)
+}
+
+// SetPolicy handles creating or updating the global or a room retention policy
+// PUT /api/v1/admin/retention/policies
+func (h *RetentionHandler) SetPolicy(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.RetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	policy, err := h.retentionService.SetPolicy(req, userID.(string), clientInfo(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Retention policy saved successfully", policy)
+}
+
+// DeletePolicy handles removing a retention policy
+// DELETE /api/v1/admin/retention/policies/:id
+func (h *RetentionHandler) DeletePolicy(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	policyID := c.Param("id")
+	if policyID == "" {
+		util.BadRequest(c, "Policy ID is required")
+		return
+	}
+
+	if err := h.retentionService.DeletePolicy(policyID, userID.(string), clientInfo(c)); err != nil {
+		util.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Retention policy deleted successfully", nil)
+}
+
+// GetPurgeLogs handles listing the audit records of past purges
+// GET /api/v1/admin/retention/purge-logs
+func (h *RetentionHandler) GetPurgeLogs(c *gin.Context) {
+	limit := 50 // default limit
+	offset := 0
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if parsed, err := strconv.Atoi(offsetStr); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	logs, err := h.retentionService.GetPurgeLogs(limit, offset)
+	if err != nil {
+		util.InternalServerError(c, err.Error())
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Purge logs retrieved successfully", logs)
+}
+
+// RunPurge handles triggering a purge immediately instead of waiting for the scheduler
+// POST /api/v1/admin/retention/purge
+func (h *RetentionHandler) RunPurge(c *gin.Context) {
+	purged, err := h.retentionService.PurgeExpiredMessages()
+	if err != nil {
+		util.ErrorResponse(c, http.StatusInternalServerError, "Purge failed", gin.H{"purged": purged})
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Purge completed successfully", gin.H{"purged": purged})
+}
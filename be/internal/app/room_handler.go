@@ -34,7 +34,7 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 	}
 
 	// Create room with creator ID
-	room, err := h.roomService.CreateRoomWithUser(req, userID.(string))
+	room, err := h.roomService.CreateRoomWithUser(req, userID.(string), clientInfo(c))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -46,13 +46,19 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 // GetRoom handles getting room by ID
 // GET /api/v1/rooms/:id
 func (h *RoomHandler) GetRoom(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		util.BadRequest(c, "Room ID is required")
 		return
 	}
 
-	room, err := h.roomService.GetRoomByID(roomID)
+	room, err := h.roomService.GetRoomByID(roomID, userID.(string))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
 		return
@@ -61,12 +67,24 @@ func (h *RoomHandler) GetRoom(c *gin.Context) {
 	util.SuccessResponse(c, http.StatusOK, "Room retrieved successfully", room)
 }
 
-// GetRooms handles getting all rooms
-// GET /api/v1/rooms
+// GetRooms handles listing the rooms visible to the current user
+// GET /api/v1/rooms?q=&org_id=
 func (h *RoomHandler) GetRooms(c *gin.Context) {
-	rooms, err := h.roomService.GetAllRooms()
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.ListRoomsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	rooms, err := h.roomService.GetVisibleRooms(userID.(string), req)
 	if err != nil {
-		util.ErrorResponse(c, http.StatusInternalServerError, err.Error(), nil)
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
@@ -110,7 +128,7 @@ func (h *RoomHandler) JoinRoom(c *gin.Context) {
 	c.Header("X-Debug-UserID", userID.(string))
 	c.Header("X-Debug-RoomID", roomID)
 
-	response, err := h.roomService.JoinRoom(roomID, userID.(string))
+	response, err := h.roomService.JoinRoom(roomID, userID.(string), clientInfo(c))
 	if err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
@@ -134,7 +152,7 @@ func (h *RoomHandler) LeaveRoom(c *gin.Context) {
 		return
 	}
 
-	if err := h.roomService.LeaveRoom(roomID, userID.(string)); err != nil {
+	if err := h.roomService.LeaveRoom(roomID, userID.(string), clientInfo(c)); err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
@@ -157,10 +175,99 @@ func (h *RoomHandler) DeleteRoom(c *gin.Context) {
 		return
 	}
 
-	if err := h.roomService.DeleteRoom(roomID, userID.(string)); err != nil {
+	if err := h.roomService.DeleteRoom(roomID, userID.(string), clientInfo(c)); err != nil {
 		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
 
 	util.SuccessResponse(c, http.StatusOK, "Room deleted successfully", nil)
 }
+
+// KickParticipant handles removing a participant from a room
+// POST /api/v1/rooms/:id/participants/:userId/kick
+func (h *RoomHandler) KickParticipant(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	roomID := c.Param("id")
+	targetUserID := c.Param("userId")
+	if roomID == "" || targetUserID == "" {
+		util.BadRequest(c, "Room ID and user ID are required")
+		return
+	}
+
+	actor := service.Actor{UserID: userID.(string), Role: c.GetString("userType")}
+	if err := h.roomService.KickParticipant(roomID, targetUserID, actor, clientInfo(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Participant kicked successfully", nil)
+}
+
+// UpdateGuestAccess handles allowing or blocking guests without an account
+// PUT /api/v1/rooms/:id/guest-access
+func (h *RoomHandler) UpdateGuestAccess(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		util.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.GuestAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	response, err := h.roomService.UpdateGuestAccess(c.Param("id"), userID.(string), req, clientInfo(c))
+	if err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Guest access updated successfully", response)
+}
+
+// GuestJoinRoom handles joining a room as a guest with an invite or passcode
+// POST /api/v1/rooms/:id/guest/join
+func (h *RoomHandler) GuestJoinRoom(c *gin.Context) {
+	var req service.GuestJoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	response, err := h.roomService.JoinRoomAsGuest(c.Param("id"), req, clientInfo(c))
+	if err != nil {
+		if rateLimited(c, err) {
+			return
+		}
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Joined room successfully", response)
+}
+
+// GuestLeaveRoom handles a guest leaving a room
+// POST /api/v1/rooms/:id/guest/leave
+func (h *RoomHandler) GuestLeaveRoom(c *gin.Context) {
+	var req struct {
+		GuestToken string `json:"guest_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.roomService.LeaveRoomAsGuest(c.Param("id"), req.GuestToken, clientInfo(c)); err != nil {
+		util.ErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	util.SuccessResponse(c, http.StatusOK, "Left room successfully", nil)
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"log"
+	"path/filepath"
 	"time"
 	"yourapp/internal/config"
 	"yourapp/internal/model"
@@ -40,14 +41,47 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 	}
 
 	// Auto migrate
-	if err := db.AutoMigrate(&model.User{}, &model.Room{}, &model.RoomParticipant{}, &model.ChatMessage{}); err != nil {
+	if err := db.AutoMigrate(&model.User{}, &model.Room{}, &model.RoomParticipant{}, &model.RoomGuest{}, &model.ChatMessage{}, &model.RetentionPolicy{}, &model.RetentionPurgeLog{}, &model.Session{}, &model.RefreshToken{}, &model.MFARecoveryCode{}, &model.PasskeyCredential{}, &model.UserIdentity{}, &model.OneTimeCode{}, &model.DataExport{}, &model.PersonalAccessToken{}, &model.AuditEvent{}, &model.Organization{}, &model.OrganizationMember{}, &model.OrganizationInvitation{}); err != nil {
 		panic("Failed to migrate database: " + err.Error())
 	}
+	if err := migrateGoogleIdentities(db); err != nil {
+		panic("Failed to migrate Google accounts: " + err.Error())
+	}
+	if err := dropLegacyOTPColumns(db); err != nil {
+		panic("Failed to migrate OTP codes: " + err.Error())
+	}
+	if err := migratePasskeyLoginType(db); err != nil {
+		panic("Failed to migrate passkey accounts: " + err.Error())
+	}
+	if err := protectAuditEvents(db); err != nil {
+		panic("Failed to protect audit log: " + err.Error())
+	}
 
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
 	roomRepo := repository.NewRoomRepository(db)
 	chatRepo := repository.NewChatRepository(db)
+	retentionRepo := repository.NewRetentionRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	passkeyRepo := repository.NewPasskeyRepository(db)
+	identityRepo := repository.NewIdentityRepository(db)
+	codeRepo := repository.NewOneTimeCodeRepository(db)
+	accountRepo := repository.NewAccountRepository(db)
+	accessTokenRepo := repository.NewAccessTokenRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+
+	// Deleted accounts hand their messages and rooms to this placeholder
+	if err := accountRepo.EnsureDeletedUser(); err != nil {
+		panic("Failed to create deleted user placeholder: " + err.Error())
+	}
+
+	// Load JWT signing keys (HS256 with JWT_SECRET when JWT_KEYS_DIR is not set)
+	jwtKeys, err := util.LoadKeyRing(cfg.JWTKeysDir, cfg.JWTSigningAlg, cfg.JWTSecret, cfg.JWTAcceptHS256)
+	if err != nil {
+		panic("Failed to load JWT signing keys: " + err.Error())
+	}
 
 	// Initialize RabbitMQ with retry logic
 	rabbitMQ := initRabbitMQWithRetry(cfg)
@@ -58,7 +92,7 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 	// Initialize email worker if RabbitMQ is available
 	var emailWorker *service.EmailWorker
 	if rabbitMQ != nil {
-		emailWorker = service.NewEmailWorker(emailService, rabbitMQ)
+		emailWorker = service.NewEmailWorker(emailService, rabbitMQ, cfg)
 		if err := emailWorker.Start(); err != nil {
 			log.Printf("Warning: Failed to start email worker: %v", err)
 		} else {
@@ -71,18 +105,37 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 	}
 
 	// Initialize services
-	authService := service.NewAuthServiceWithConfig(userRepo, cfg.JWTSecret, rabbitMQ, cfg)
-	roomService := service.NewRoomService(roomRepo, userRepo, cfg)
-	chatService := service.NewChatService(chatRepo, roomRepo, userRepo)
+	auditService := service.NewAuditService(auditRepo)
+	authService := service.NewAuthServiceWithConfig(userRepo, sessionRepo, mfaRepo, passkeyRepo, identityRepo, codeRepo, accessTokenRepo, orgRepo, auditService, cfg.JWTSecret, jwtKeys, rabbitMQ, cfg)
+	roomService := service.NewRoomService(roomRepo, userRepo, orgRepo, auditService, cfg)
+	chatService := service.NewChatService(chatRepo, roomRepo, userRepo, orgRepo, auditService)
+	orgService := service.NewOrganizationService(orgRepo, userRepo, auditService, rabbitMQ, cfg)
+	emailQueueService := service.NewEmailQueueService(rabbitMQ, auditService)
+	scimService := service.NewSCIMService(orgRepo, userRepo, authService, roomService, auditService, cfg)
+	retentionService := service.NewRetentionService(retentionRepo, roomRepo, auditService, cfg.RetentionBatchSize)
+	accountService := service.NewAccountService(accountRepo, userRepo, identityRepo, passkeyRepo, sessionRepo, rabbitMQ, cfg)
+
+	// Start chat retention scheduler
+	retentionWorker := service.NewRetentionWorker(retentionService, cfg.RetentionPurgeInterval)
+	retentionWorker.Start()
+
+	// Start data export / account deletion worker
+	accountWorker := service.NewAccountWorker(accountService, cfg.AccountPurgeInterval)
+	accountWorker.Start()
 
 	// Initialize WebSocket hub
 	wsHub := websocket.NewHub()
 	go wsHub.Run()
 
 	// Initialize handlers
-	authHandler := NewAuthHandler(authService, cfg.JWTSecret)
+	authHandler := NewAuthHandler(authService, jwtKeys, cfg.ClientURL, cfg.AvatarMaxBytes)
 	roomHandler := NewRoomHandler(roomService)
-	chatHandler := NewChatHandler(chatService, wsHub, cfg.JWTSecret)
+	chatHandler := NewChatHandler(chatService, authService, wsHub, jwtKeys)
+	retentionHandler := NewRetentionHandler(retentionService)
+	accountHandler := NewAccountHandler(accountService)
+	orgHandler := NewOrganizationHandler(orgService)
+	scimHandler := NewSCIMHandler(scimService)
+	adminHandler := NewAdminHandler(authService, roomService, chatService, auditService, emailService, emailQueueService, wsHub)
 
 	// API routes
 	api := r.Group("/api/v1")
@@ -94,38 +147,145 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/verify-otp", authHandler.VerifyOTP)
 			auth.POST("/resend-otp", authHandler.ResendOTP)
+			auth.POST("/magic-link", authHandler.RequestMagicLink)
+			auth.POST("/magic-link/verify", authHandler.VerifyMagicLink)
 			auth.POST("/google-oauth", authHandler.GoogleOAuth)
+			auth.GET("/oidc/providers", authHandler.GetOIDCProviders)
+			auth.GET("/oidc/:provider/login", authHandler.OIDCLogin)
+			auth.GET("/oidc/:provider/callback", authHandler.OIDCCallback)
+			auth.POST("/oidc/exchange", authHandler.ExchangeOIDCCode)
 			auth.POST("/refresh-token", authHandler.RefreshToken)
+			auth.POST("/logout", authHandler.Logout)
 			auth.POST("/forgot-password", authHandler.RequestResetPassword)
 			auth.POST("/verify-reset-password", authHandler.VerifyResetPassword)
 			auth.POST("/reset-password", authHandler.ResetPassword)
 			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.GET("/exports/download", accountHandler.DownloadExport)
+			auth.POST("/mfa/verify", authHandler.VerifyMFA)
+			auth.POST("/passkeys/login/begin", authHandler.BeginPasskeyLogin)
+			auth.POST("/passkeys/login/finish", authHandler.FinishPasskeyLogin)
 
 			// Protected routes
-			auth.GET("/me", authHandler.AuthMiddleware(), authHandler.GetMe)
+			auth.GET("/me", authHandler.AuthMiddleware(model.ScopeProfileRead), authHandler.GetMe)
+			auth.PATCH("/me", authHandler.AuthMiddleware(), authHandler.UpdateMe)
+			auth.POST("/me/password", authHandler.AuthMiddleware(), authHandler.ChangePassword)
+			auth.POST("/me/email", authHandler.AuthMiddleware(), authHandler.RequestEmailChange)
+			auth.POST("/me/email/confirm", authHandler.AuthMiddleware(), authHandler.ConfirmEmailChange)
+			auth.POST("/me/avatar", authHandler.AuthMiddleware(), authHandler.UploadAvatar)
+			auth.DELETE("/me", authHandler.AuthMiddleware(), authHandler.DeleteMe)
+			auth.POST("/me/export", authHandler.AuthMiddleware(), accountHandler.RequestExport)
+			auth.POST("/logout-all", authHandler.AuthMiddleware(), authHandler.LogoutAll)
+			auth.GET("/sessions", authHandler.AuthMiddleware(), authHandler.GetSessions)
+			auth.DELETE("/sessions/:id", authHandler.AuthMiddleware(), authHandler.RevokeSession)
+			auth.POST("/mfa/enroll", authHandler.AuthMiddleware(), authHandler.EnrollMFA)
+			auth.POST("/mfa/confirm", authHandler.AuthMiddleware(), authHandler.ConfirmMFA)
+			auth.POST("/mfa/disable", authHandler.AuthMiddleware(), authHandler.DisableMFA)
+			auth.GET("/passkeys", authHandler.AuthMiddleware(), authHandler.GetPasskeys)
+			auth.POST("/passkeys/register/begin", authHandler.AuthMiddleware(), authHandler.BeginPasskeyRegistration)
+			auth.POST("/passkeys/register/finish", authHandler.AuthMiddleware(), authHandler.FinishPasskeyRegistration)
+			auth.DELETE("/passkeys/:id", authHandler.AuthMiddleware(), authHandler.DeletePasskey)
+			auth.GET("/identities", authHandler.AuthMiddleware(), authHandler.GetIdentities)
+			auth.POST("/identities/:provider/link", authHandler.AuthMiddleware(), authHandler.LinkIdentity)
+			auth.DELETE("/identities/:id", authHandler.AuthMiddleware(), authHandler.UnlinkIdentity)
+			auth.GET("/tokens", authHandler.AuthMiddleware(), authHandler.GetAccessTokens)
+			auth.POST("/tokens", authHandler.AuthMiddleware(), authHandler.CreateAccessToken)
+			auth.DELETE("/tokens/:id", authHandler.AuthMiddleware(), authHandler.RevokeAccessToken)
 		}
 
 		// Room routes
 		rooms := api.Group("/rooms")
 		{
-			// Public routes
-			rooms.GET("", roomHandler.GetRooms)
-			rooms.GET("/:id", roomHandler.GetRoom)
-
-			// Protected routes
-			rooms.POST("", authHandler.AuthMiddleware(), roomHandler.CreateRoom)
-			rooms.GET("/my", authHandler.AuthMiddleware(), roomHandler.GetMyRooms)
-			rooms.POST("/:id/join", authHandler.AuthMiddleware(), roomHandler.JoinRoom)
-			rooms.POST("/:id/leave", authHandler.AuthMiddleware(), roomHandler.LeaveRoom)
-			rooms.DELETE("/:id", authHandler.AuthMiddleware(), roomHandler.DeleteRoom)
+			rooms.GET("", authHandler.AuthMiddleware(model.ScopeRoomsRead), roomHandler.GetRooms)
+			rooms.GET("/:id", authHandler.AuthMiddleware(model.ScopeRoomsRead), roomHandler.GetRoom)
+			rooms.POST("", authHandler.AuthMiddleware(model.ScopeRoomsWrite), roomHandler.CreateRoom)
+			rooms.GET("/my", authHandler.AuthMiddleware(model.ScopeRoomsRead), roomHandler.GetMyRooms)
+			rooms.POST("/:id/join", authHandler.AuthMiddleware(model.ScopeRoomsWrite), roomHandler.JoinRoom)
+			rooms.POST("/:id/leave", authHandler.AuthMiddleware(model.ScopeRoomsWrite), roomHandler.LeaveRoom)
+			rooms.DELETE("/:id", authHandler.AuthMiddleware(model.ScopeRoomsWrite), roomHandler.DeleteRoom)
+			rooms.POST("/:id/participants/:userId/kick", authHandler.AuthMiddleware(model.ScopeRoomsWrite), roomHandler.KickParticipant)
+			rooms.PUT("/:id/guest-access", authHandler.AuthMiddleware(model.ScopeRoomsWrite), roomHandler.UpdateGuestAccess)
+			rooms.POST("/:id/guest/join", roomHandler.GuestJoinRoom)
+			rooms.POST("/:id/guest/leave", roomHandler.GuestLeaveRoom)
 
 			// Chat routes
-			rooms.GET("/:id/messages", chatHandler.GetMessages)
-			rooms.POST("/:id/messages", authHandler.AuthMiddleware(), chatHandler.CreateMessage)
+			rooms.GET("/:id/messages", authHandler.AuthMiddleware(model.ScopeChatRead), chatHandler.GetMessages)
+			rooms.POST("/:id/messages", authHandler.AuthMiddleware(model.ScopeChatWrite), chatHandler.CreateMessage)
 			rooms.GET("/:id/chat/ws", chatHandler.ServeWebSocket)
 		}
+
+		// Organization routes (signed-in users only, not personal access tokens)
+		orgs := api.Group("/organizations", authHandler.AuthMiddleware())
+		{
+			orgs.GET("", orgHandler.GetMyOrganizations)
+			orgs.POST("", orgHandler.CreateOrganization)
+			orgs.POST("/invitations/accept", orgHandler.AcceptInvitation)
+			orgs.GET("/:id", orgHandler.GetOrganization)
+			orgs.PATCH("/:id", orgHandler.UpdateOrganization)
+			orgs.POST("/:id/domain/verify", orgHandler.VerifyDomain)
+			orgs.GET("/:id/members", orgHandler.GetMembers)
+			orgs.PATCH("/:id/members/:userId", orgHandler.UpdateMemberRole)
+			orgs.DELETE("/:id/members/:userId", orgHandler.RemoveMember)
+			orgs.GET("/:id/invitations", orgHandler.GetInvitations)
+			orgs.POST("/:id/invitations", orgHandler.InviteMember)
+			orgs.DELETE("/:id/invitations/:invitationId", orgHandler.RevokeInvitation)
+			orgs.POST("/:id/scim-token", orgHandler.CreateSCIMToken)
+			orgs.DELETE("/:id/scim-token", orgHandler.DisableSCIM)
+		}
+
+		// Admin routes: moderators can moderate users' content, only admins
+		// can change accounts and retention
+		admin := api.Group("/admin", authHandler.AuthMiddleware(model.ScopeAdmin), authHandler.RequireRole(model.RoleModerator))
+		{
+			admin.GET("/users", adminHandler.ListUsers)
+			admin.POST("/users/:id/deactivate", authHandler.RequireRole(model.RoleAdmin), adminHandler.DeactivateUser)
+			admin.POST("/users/:id/reactivate", authHandler.RequireRole(model.RoleAdmin), adminHandler.ReactivateUser)
+			admin.GET("/rooms/:id/participants", adminHandler.GetRoomParticipants)
+			admin.POST("/rooms/:id/close", adminHandler.CloseRoom)
+			admin.DELETE("/messages/:id", adminHandler.DeleteMessage)
+			admin.GET("/audit-events", authHandler.RequireRole(model.RoleAdmin), adminHandler.GetAuditEvents)
+			admin.GET("/audit-events/export", authHandler.RequireRole(model.RoleAdmin), adminHandler.ExportAuditEvents)
+			admin.GET("/emails/preview/:type", authHandler.RequireRole(model.RoleAdmin), adminHandler.PreviewEmail)
+			admin.GET("/emails/dead-letters", authHandler.RequireRole(model.RoleAdmin), adminHandler.GetDeadLetters)
+			admin.POST("/emails/dead-letters/replay", authHandler.RequireRole(model.RoleAdmin), adminHandler.ReplayDeadLetters)
+
+			retention := admin.Group("/retention", authHandler.RequireRole(model.RoleAdmin))
+			retention.GET("/policies", retentionHandler.GetPolicies)
+			retention.PUT("/policies", retentionHandler.SetPolicy)
+			retention.DELETE("/policies/:id", retentionHandler.DeletePolicy)
+			retention.GET("/purge-logs", retentionHandler.GetPurgeLogs)
+			retention.POST("/purge", retentionHandler.RunPurge)
+		}
+	}
+
+	// Public uploads (avatars) when stored on local disk. Data exports live in
+	// the same directory but are only served through their download link.
+	if cfg.StorageDriver == "" || cfg.StorageDriver == "local" {
+		uploads := r.Group("/uploads", func(c *gin.Context) {
+			c.Header("X-Content-Type-Options", "nosniff")
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		})
+		uploads.Static("/avatars", filepath.Join(cfg.UploadDir, "avatars"))
 	}
 
+	// SCIM 2.0 provisioning, authenticated with an organization's SCIM token
+	scim := r.Group("/scim/v2", scimHandler.AuthMiddleware())
+	{
+		scim.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+		scim.GET("/Users", scimHandler.ListUsers)
+		scim.POST("/Users", scimHandler.CreateUser)
+		scim.GET("/Users/:id", scimHandler.GetUser)
+		scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+		scim.PATCH("/Users/:id", scimHandler.PatchUser)
+		scim.DELETE("/Users/:id", scimHandler.DeleteUser)
+		scim.GET("/Groups", scimHandler.ListGroups)
+		scim.POST("/Groups", scimHandler.CreateGroup)
+		scim.GET("/Groups/:id", scimHandler.GetGroup)
+		scim.PATCH("/Groups/:id", scimHandler.PatchGroup)
+	}
+
+	// Public keys for verifying access tokens
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
+
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -134,6 +294,89 @@ func NewRouter(cfg *config.Config) *gin.Engine {
 	return r
 }
 
+// migrateGoogleIdentities moves the old users.google_id column into user_identities
+func migrateGoogleIdentities(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&model.User{}, "google_id") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO user_identities (id, user_id, provider, subject, email, created_at)
+			SELECT gen_random_uuid(), id, ?, google_id, email, NOW() FROM users
+			WHERE google_id IS NOT NULL AND google_id <> ''
+			ON CONFLICT DO NOTHING`, model.LoginTypeGoogle).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&model.User{}, "google_id")
+	})
+}
+
+// migratePasskeyLoginType replaces the old users.passkey_enabled flag with the
+// passkey login type
+func migratePasskeyLoginType(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&model.User{}, "passkey_enabled") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).
+			Where("passkey_enabled = ?", true).
+			Update("login_type", model.LoginTypePasskey).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&model.User{}, "passkey_enabled")
+	})
+}
+
+// dropLegacyOTPColumns removes the shared users.otp_code columns replaced by
+// one_time_codes. Codes pending at upgrade time have to be requested again.
+func dropLegacyOTPColumns(db *gorm.DB) error {
+	for _, column := range []string{"otp_code", "otp_expires_at"} {
+		if db.Migrator().HasColumn(&model.User{}, column) {
+			if err := db.Migrator().DropColumn(&model.User{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// protectAuditEvents makes the audit log append-only at the database level.
+// The one exception is repository.PurgeUser, which sets
+// app.audit_pseudonymize for its transaction to hand a deleted user's rows to
+// the placeholder account and strip their PII; the event itself cannot change.
+func protectAuditEvents(db *gorm.DB) error {
+	statements := []string{
+		`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'UPDATE'
+				AND current_setting('app.audit_pseudonymize', true) = 'on'
+				AND NEW.id = OLD.id
+				AND NEW.action = OLD.action
+				AND NEW.target_type IS NOT DISTINCT FROM OLD.target_type
+				AND NEW.created_at = OLD.created_at
+				AND (NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id OR NEW.actor_id = '` + model.DeletedUserID + `')
+				AND (NEW.target_id IS NOT DISTINCT FROM OLD.target_id OR NEW.target_id = '` + model.DeletedUserID + `') THEN
+				RETURN NEW;
+			END IF;
+			RAISE EXCEPTION 'audit_events is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`,
+		`CREATE TRIGGER audit_events_append_only
+			BEFORE UPDATE OR DELETE ON audit_events
+			FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func initDB(cfg *config.Config) (*gorm.DB, error) {
 	dsn := cfg.DatabaseURL
 	if dsn == "" {
@@ -208,7 +451,7 @@ func corsMiddleware(allowedOrigins []string) gin.HandlerFunc {
 
 		// Set CORS headers for allowed origins
 		if allowed && origin != "" {
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Device-Name, accept, origin, Cache-Control, X-Requested-With")
 			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 		}
 
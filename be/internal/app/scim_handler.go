@@ -0,0 +1,254 @@
+package app
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"yourapp/internal/model"
+	"yourapp/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const scimContentType = "application/scim+json"
+
+// SCIMHandler serves the SCIM 2.0 provisioning API. SCIM clients expect the
+// protocol's own JSON format, so responses do not use the usual envelope.
+type SCIMHandler struct {
+	scimService service.SCIMService
+}
+
+func NewSCIMHandler(scimService service.SCIMService) *SCIMHandler {
+	return &SCIMHandler{
+		scimService: scimService,
+	}
+}
+
+// AuthMiddleware authenticates the organization's SCIM bearer token
+func (h *SCIMHandler) AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || token == "" {
+			h.fail(c, &service.SCIMError{Status: http.StatusUnauthorized, Detail: "Authorization header required"})
+			c.Abort()
+			return
+		}
+
+		org, err := h.scimService.Authenticate(token)
+		if err != nil {
+			h.fail(c, err)
+			c.Abort()
+			return
+		}
+
+		c.Set("organization", org)
+		c.Next()
+	}
+}
+
+// ServiceProviderConfig handles describing the supported SCIM features
+// GET /scim/v2/ServiceProviderConfig
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(http.StatusOK, gin.H{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": 200},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Organization SCIM token created by an organization owner",
+		}},
+	})
+}
+
+// ListUsers handles listing the organization's users
+// GET /scim/v2/Users?filter=userName eq "..."&startIndex=&count=
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	var req service.SCIMListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.fail(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: err.Error()})
+		return
+	}
+
+	users, err := h.scimService.ListUsers(scimOrganization(c), req)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, users)
+}
+
+// GetUser handles getting one user
+// GET /scim/v2/Users/:id
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.scimService.GetUser(scimOrganization(c), c.Param("id"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, user)
+}
+
+// CreateUser handles provisioning a user into the organization
+// POST /scim/v2/Users
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req service.SCIMUser
+	if !h.bind(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.CreateUser(scimOrganization(c), req, clientInfo(c))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusCreated, user)
+}
+
+// ReplaceUser handles replacing a user's attributes
+// PUT /scim/v2/Users/:id
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	var req service.SCIMUser
+	if !h.bind(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.ReplaceUser(scimOrganization(c), c.Param("id"), req, clientInfo(c))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, user)
+}
+
+// PatchUser handles updating or deactivating a user
+// PATCH /scim/v2/Users/:id
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	var req service.SCIMPatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.PatchUser(scimOrganization(c), c.Param("id"), req, clientInfo(c))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, user)
+}
+
+// DeleteUser handles deprovisioning a user
+// DELETE /scim/v2/Users/:id
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	if err := h.scimService.DeleteUser(scimOrganization(c), c.Param("id"), clientInfo(c)); err != nil {
+		h.fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups handles listing the organization roles as groups
+// GET /scim/v2/Groups?filter=displayName eq "..."
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	var req service.SCIMListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.fail(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: err.Error()})
+		return
+	}
+
+	groups, err := h.scimService.ListGroups(scimOrganization(c), req)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, groups)
+}
+
+// GetGroup handles getting one role group with its members
+// GET /scim/v2/Groups/:id
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.scimService.GetGroup(scimOrganization(c), c.Param("id"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, group)
+}
+
+// CreateGroup handles pushing a group named after an organization role
+// POST /scim/v2/Groups
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	var req service.SCIMGroup
+	if !h.bind(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.CreateGroup(scimOrganization(c), req, clientInfo(c))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusCreated, group)
+}
+
+// PatchGroup handles adding members to or removing them from a role group
+// PATCH /scim/v2/Groups/:id
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	var req service.SCIMPatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.PatchGroup(scimOrganization(c), c.Param("id"), req, clientInfo(c))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, group)
+}
+
+// bind decodes the request body; SCIM clients send application/scim+json,
+// which gin does not recognise as JSON
+func (h *SCIMHandler) bind(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.fail(c, &service.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()})
+		return false
+	}
+	return true
+}
+
+func (h *SCIMHandler) respond(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, body)
+}
+
+// fail writes err as a SCIM error response
+func (h *SCIMHandler) fail(c *gin.Context, err error) {
+	var scimErr *service.SCIMError
+	if !errors.As(err, &scimErr) {
+		log.Printf("SCIM request failed: %v", err)
+		scimErr = &service.SCIMError{Status: http.StatusInternalServerError, Detail: "internal server error"}
+	}
+
+	body := gin.H{
+		"schemas": []string{service.SCIMSchemaError},
+		"status":  strconv.Itoa(scimErr.Status),
+		"detail":  scimErr.Detail,
+	}
+	if scimErr.ScimType != "" {
+		body["scimType"] = scimErr.ScimType
+	}
+	h.respond(c, scimErr.Status, body)
+}
+
+func scimOrganization(c *gin.Context) *model.Organization {
+	return c.MustGet("organization").(*model.Organization)
+}
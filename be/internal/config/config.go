@@ -1,8 +1,13 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +17,7 @@ type Config struct {
 	ServerPort string
 	ServerHost string
 	ClientURL  string
+	PublicURL  string // externally reachable URL of this API, used for OAuth redirects
 
 	// Database
 	PostgresHost     string
@@ -23,17 +29,32 @@ type Config struct {
 	DatabaseURL      string
 
 	// JWT
-	JWTSecret string
+	JWTSecret      string
+	JWTKeysDir     string
+	JWTSigningAlg  string
+	JWTAcceptHS256 bool
 
 	// Google OAuth
 	GoogleClientID     string
 	GoogleClientSecret string
+	GoogleJWKSURL      string
+
+	// OpenID Connect providers (Keycloak, Azure AD, Okta, ...)
+	OIDCProviders []OIDCProviderConfig
 
 	// Redis
 	RedisHost     string
 	RedisPort     string
 	RedisPassword string
 
+	// Brute-force protection
+	LimiterStore       string // memory or redis
+	LoginMaxAttempts   int
+	LoginIPMaxAttempts int
+	LoginAttemptWindow time.Duration
+	LoginLockoutBase   time.Duration
+	LoginLockoutMax    time.Duration
+
 	// RabbitMQ
 	RabbitMQHost     string
 	RabbitMQPort     string
@@ -48,10 +69,47 @@ type Config struct {
 	SMTPUsername string
 	SMTPPassword string
 
+	// Email transport: smtp, file (maildir in EMAIL_DIR), http (JSON API) or log
+	EmailTransport   string
+	SMTPSecurity     string // starttls, tls or none; default tls on port 465, else starttls
+	SMTPPoolSize     int
+	EmailDir         string
+	EmailHTTPURL     string
+	EmailHTTPAPIKey  string
+	EmailMaxAttempts int // deliveries before a failing email goes to the dead letter queue
+
+	// DKIM signing of SMTP and maildir email, off unless configured. The
+	// public key is published at <selector>._domainkey.<domain>.
+	DKIMDomain         string
+	DKIMSelector       string
+	DKIMPrivateKeyPath string // PEM RSA key, PKCS#1 or PKCS#8
+
 	// LiveKit
 	LiveKitURL       string
 	LiveKitAPIKey    string
 	LiveKitAPISecret string
+	LiveKitAPIURL    string // HTTP(S) URL of the server API, derived from LiveKitURL if not set
+
+	// WebAuthn / passkeys
+	WebAuthnRPID    string
+	WebAuthnOrigins []string
+
+	// Chat retention
+	RetentionPurgeInterval time.Duration
+	RetentionBatchSize     int
+
+	// File uploads
+	StorageDriver      string // local
+	UploadDir          string
+	UploadURL          string // public URL uploads are served from
+	AvatarMaxBytes     int64
+	AvatarMinDimension int
+	AvatarMaxDimension int
+
+	// Personal data export and account deletion
+	DataExportTTL        time.Duration
+	AccountDeletionGrace time.Duration
+	AccountPurgeInterval time.Duration
 }
 
 func Load() (*Config, error) {
@@ -63,6 +121,7 @@ func Load() (*Config, error) {
 		ServerPort: getEnv("PORT", "5000"),
 		ServerHost: getEnv("SERVER_HOST", "0.0.0.0"),
 		ClientURL:  getEnv("CLIENT_URL", "http://localhost:3000"),
+		PublicURL:  getEnv("PUBLIC_URL", "http://localhost:5000"),
 
 		// Database
 		PostgresHost:     getEnv("POSTGRES_HOST", "localhost"),
@@ -74,17 +133,29 @@ func Load() (*Config, error) {
 		DatabaseURL:      getEnv("DATABASE_URL", ""),
 
 		// JWT
-		JWTSecret: getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		JWTSecret:      getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		JWTKeysDir:     getEnv("JWT_KEYS_DIR", ""),
+		JWTSigningAlg:  getEnv("JWT_SIGNING_ALG", "RS256"),
+		JWTAcceptHS256: getEnvBool("JWT_ACCEPT_HS256", false),
 
 		// Google OAuth
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+		GoogleJWKSURL:      getEnv("GOOGLE_JWKS_URL", "https://www.googleapis.com/oauth2/v3/certs"),
 
 		// Redis
 		RedisHost:     getEnv("REDIS_HOST", "localhost"),
 		RedisPort:     getEnv("REDIS_PORT", "6379"),
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
 
+		// Brute-force protection - lockouts double with every repeat offence, up to the max
+		LimiterStore:       getEnv("LIMITER_STORE", "memory"),
+		LoginMaxAttempts:   getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		LoginIPMaxAttempts: getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 20),
+		LoginAttemptWindow: getEnvDuration("LOGIN_ATTEMPT_WINDOW", 15*time.Minute),
+		LoginLockoutBase:   getEnvDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		LoginLockoutMax:    getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+
 		// RabbitMQ
 		RabbitMQHost:     getEnv("RABBITMQ_HOST", "localhost"),
 		RabbitMQPort:     getEnv("RABBITMQ_PORT", "5672"),
@@ -99,10 +170,44 @@ func Load() (*Config, error) {
 		SMTPUsername: getEnv("SMTP_USERNAME", ""),
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 
+		EmailTransport:   getEnv("EMAIL_TRANSPORT", ""),
+		SMTPSecurity:     getEnv("SMTP_SECURITY", ""),
+		SMTPPoolSize:     getEnvInt("SMTP_POOL_SIZE", 2),
+		EmailDir:         getEnv("EMAIL_DIR", "./mail"),
+		EmailHTTPURL:     getEnv("EMAIL_HTTP_URL", ""),
+		EmailHTTPAPIKey:  getEnv("EMAIL_HTTP_API_KEY", ""),
+		EmailMaxAttempts: getEnvInt("EMAIL_MAX_ATTEMPTS", 5),
+
+		DKIMDomain:         getEnv("DKIM_DOMAIN", ""),
+		DKIMSelector:       getEnv("DKIM_SELECTOR", ""),
+		DKIMPrivateKeyPath: getEnv("DKIM_PRIVATE_KEY_PATH", ""),
+
 		// LiveKit - gunakan wss untuk production dengan nginx proxy
 		LiveKitURL:       getEnv("LIVEKIT_URL", "wss://zoom.zacloth.com/rtc"),
 		LiveKitAPIKey:    getEnv("LIVEKIT_API_KEY", "devkey"),
 		LiveKitAPISecret: getEnv("LIVEKIT_API_SECRET", "6RfzN3B2Lqj8vzdP9XC4tFkp57YhUBsM"),
+		LiveKitAPIURL:    getEnv("LIVEKIT_API_URL", ""),
+
+		// WebAuthn - RP ID must be the site's registrable domain, origins are full URLs
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", ""),
+		WebAuthnOrigins: getEnvList("WEBAUTHN_ORIGINS", nil),
+
+		// Chat retention
+		RetentionPurgeInterval: getEnvDuration("RETENTION_PURGE_INTERVAL", time.Hour),
+		RetentionBatchSize:     getEnvInt("RETENTION_BATCH_SIZE", 500),
+
+		// File uploads - the local driver serves UPLOAD_DIR under /uploads
+		StorageDriver:      getEnv("STORAGE_DRIVER", "local"),
+		UploadDir:          getEnv("UPLOAD_DIR", "./uploads"),
+		UploadURL:          getEnv("UPLOAD_URL", ""),
+		AvatarMaxBytes:     int64(getEnvInt("AVATAR_MAX_BYTES", 5<<20)),
+		AvatarMinDimension: getEnvInt("AVATAR_MIN_DIMENSION", 128),
+		AvatarMaxDimension: getEnvInt("AVATAR_MAX_DIMENSION", 4096),
+
+		// Personal data - deleted accounts are erased once the grace period ends
+		DataExportTTL:        getEnvDuration("DATA_EXPORT_TTL", 48*time.Hour),
+		AccountDeletionGrace: getEnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		AccountPurgeInterval: getEnvDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
 	}
 
 	// Build database URL if not provided
@@ -117,10 +222,52 @@ func Load() (*Config, error) {
 		)
 	}
 
+	// Load OIDC providers from OIDC_PROVIDERS (JSON) or OIDC_PROVIDERS_FILE
+	providers, err := loadOIDCProviders()
+	if err != nil {
+		return nil, err
+	}
+	cfg.OIDCProviders = providers
+
+	// Google is an OIDC provider too; register it unless configured explicitly
+	if cfg.GoogleClientID != "" && cfg.GoogleClientSecret != "" && cfg.OIDCProvider("google") == nil {
+		cfg.OIDCProviders = append(cfg.OIDCProviders, OIDCProviderConfig{
+			Name:         "google",
+			DisplayName:  "Google",
+			Issuer:       "https://accounts.google.com",
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+		})
+	}
+
+	// Default passkeys to the frontend's host
+	if len(cfg.WebAuthnOrigins) == 0 {
+		cfg.WebAuthnOrigins = []string{cfg.ClientURL}
+	}
+	if cfg.WebAuthnRPID == "" {
+		if parsed, err := url.Parse(cfg.ClientURL); err == nil {
+			cfg.WebAuthnRPID = parsed.Hostname()
+		}
+	}
+
+	if cfg.LiveKitAPIURL == "" {
+		cfg.LiveKitAPIURL = cfg.LiveKitURL
+		if strings.HasPrefix(cfg.LiveKitURL, "ws") {
+			cfg.LiveKitAPIURL = "http" + strings.TrimPrefix(cfg.LiveKitURL, "ws") // wss:// -> https://
+		}
+	}
+
+	if cfg.UploadURL == "" {
+		cfg.UploadURL = strings.TrimSuffix(cfg.PublicURL, "/") + "/uploads"
+	}
+
 	// Validate required fields
 	if cfg.JWTSecret == "" || cfg.JWTSecret == "your-secret-key-change-in-production" {
 		return nil, fmt.Errorf("JWT_SECRET must be set")
 	}
+	if cfg.JWTSigningAlg != "RS256" && cfg.JWTSigningAlg != "EdDSA" {
+		return nil, fmt.Errorf("JWT_SIGNING_ALG must be RS256 or EdDSA")
+	}
 
 	return cfg, nil
 }
@@ -131,3 +278,86 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// OIDCProvider returns the provider with the given name, or nil
+func (c *Config) OIDCProvider(name string) *OIDCProviderConfig {
+	for i := range c.OIDCProviders {
+		if c.OIDCProviders[i].Name == name {
+			return &c.OIDCProviders[i]
+		}
+	}
+	return nil
+}
+
+func loadOIDCProviders() ([]OIDCProviderConfig, error) {
+	data := []byte(os.Getenv("OIDC_PROVIDERS"))
+	if path := os.Getenv("OIDC_PROVIDERS_FILE"); len(data) == 0 && path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read OIDC_PROVIDERS_FILE: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var providers []OIDCProviderConfig
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("invalid OIDC provider config: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, provider := range providers {
+		if provider.Name == "" || provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q requires name, issuer and client_id", provider.Name)
+		}
+		if seen[provider.Name] {
+			return nil, fmt.Errorf("duplicate OIDC provider %q", provider.Name)
+		}
+		seen[provider.Name] = true
+	}
+
+	return providers, nil
+}
+
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,36 @@
+package config
+
+// OIDCProviderConfig configures one OpenID Connect identity provider.
+//
+// Example OIDC_PROVIDERS value:
+//
+//	[{"name":"keycloak","display_name":"Company SSO","issuer":"https://sso.example.com/realms/main",
+//	  "client_id":"zoom","client_secret":"...","link_existing_accounts":true,
+//	  "allowed_domains":["example.com"]}]
+type OIDCProviderConfig struct {
+	Name         string   `json:"name"` // used in URLs and stored on linked identities
+	DisplayName  string   `json:"display_name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"` // default: openid email profile
+
+	// ClaimMapping overrides which claim fills a user field. Keys: email,
+	// email_verified, full_name, username, profile_photo, phone.
+	// Azure AD for example often needs {"email": "preferred_username"}.
+	ClaimMapping map[string]string `json:"claim_mapping"`
+
+	// TrustEmail treats the email claim as verified even without email_verified,
+	// for providers that only hand out company-managed addresses
+	TrustEmail bool `json:"trust_email"`
+
+	// LinkExistingAccounts signs a verified email into an existing account
+	// with the same email instead of rejecting the login
+	LinkExistingAccounts bool `json:"link_existing_accounts"`
+
+	// DisableSignup only lets users with an existing account or linked identity in
+	DisableSignup bool `json:"disable_signup"`
+
+	// AllowedDomains restricts logins to these email domains when set
+	AllowedDomains []string `json:"allowed_domains"`
+}
@@ -0,0 +1,222 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// dkimHeaders are the header fields covered by the signature, in signing order.
+// From is listed twice so a second From added in transit breaks the signature.
+var dkimHeaders = []string{"From", "From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"}
+
+// DKIMSigner adds a DKIM-Signature header (rsa-sha256, relaxed/relaxed) to
+// rendered messages, so receivers can check they really come from Domain
+type DKIMSigner struct {
+	domain   string
+	selector string
+	key      *rsa.PrivateKey
+}
+
+// NewDKIMSigner loads the PEM encoded RSA private key at keyPath
+func NewDKIMSigner(domain, selector, keyPath string) (*DKIMSigner, error) {
+	if domain == "" || selector == "" {
+		return nil, errors.New("DKIM domain and selector are required")
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DKIM key: %w", err)
+	}
+	key, err := parseRSAPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DKIM key: %w", err)
+	}
+	if key.N.BitLen() < 1024 {
+		return nil, errors.New("DKIM key must be at least 1024 bits")
+	}
+
+	return &DKIMSigner{domain: domain, selector: selector, key: key}, nil
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Sign returns the message with a DKIM-Signature header in front of the
+// existing headers. The message must use CRLF line endings, as Bytes does.
+func (s *DKIMSigner) Sign(message []byte) ([]byte, error) {
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, errors.New("message has no header/body separator")
+	}
+	headers := parseHeaderFields(message[:end+2])
+	body := message[end+4:]
+
+	bodyHash := sha256.Sum256(canonicalBodyRelaxed(body))
+
+	// Each name in h= takes the last not yet used instance of that field
+	var signed []string
+	var names []string
+	used := make(map[string]int)
+	for _, name := range dkimHeaders {
+		key := strings.ToLower(name)
+		names = append(names, key)
+		instances := headers[key]
+		if n := used[key]; n < len(instances) {
+			signed = append(signed, instances[len(instances)-1-n])
+			used[key] = n + 1
+		}
+	}
+
+	field := "DKIM-Signature: " + strings.Join([]string{
+		"v=1",
+		"a=rsa-sha256",
+		"c=relaxed/relaxed",
+		"d=" + s.domain,
+		"s=" + s.selector,
+		fmt.Sprintf("t=%d", time.Now().Unix()),
+		"h=" + strings.Join(names, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}, ";\r\n ")
+
+	// The signature covers the signed headers and this header with an empty
+	// b= tag, without its trailing CRLF
+	hash := sha256.New()
+	for _, header := range signed {
+		hash.Write([]byte(canonicalHeaderRelaxed(header)))
+		hash.Write([]byte("\r\n"))
+	}
+	hash.Write([]byte(canonicalHeaderRelaxed(field)))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign email: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(field)
+	out.WriteString(foldBase64(base64.StdEncoding.EncodeToString(signature)))
+	out.WriteString("\r\n")
+	out.Write(message)
+	return out.Bytes(), nil
+}
+
+// parseHeaderFields groups the raw header fields, including folded
+// continuation lines, by lowercase name in the order they appear
+func parseHeaderFields(header []byte) map[string][]string {
+	fields := make(map[string][]string)
+	var current, name string
+	flush := func() {
+		if current != "" {
+			fields[name] = append(fields[name], strings.TrimSuffix(current, "\r\n"))
+		}
+	}
+
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			current += line
+			continue
+		}
+		flush()
+		current = line
+		name = strings.ToLower(strings.TrimSpace(strings.SplitN(line, ":", 2)[0]))
+	}
+	flush()
+	return fields
+}
+
+// canonicalHeaderRelaxed applies RFC 6376 section 3.4.2: lowercase name,
+// unfolded value with runs of whitespace reduced to one space and trimmed
+func canonicalHeaderRelaxed(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.Fields(value), " ")
+}
+
+// canonicalBodyRelaxed applies RFC 6376 section 3.4.4: whitespace runs become
+// one space, trailing whitespace and trailing empty lines are removed
+func canonicalBodyRelaxed(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		lines[i] = collapseWhitespace(line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseWhitespace(line string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range line {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// foldBase64 breaks a long signature into 72 character continuation lines
+func foldBase64(value string) string {
+	var b strings.Builder
+	for len(value) > 72 {
+		b.WriteString(value[:72])
+		b.WriteString("\r\n ")
+		value = value[72:]
+	}
+	b.WriteString(value)
+	return b.String()
+}
+
+// signedBytes renders the message and signs it when a signer is configured
+func signedBytes(msg *Message, dkim *DKIMSigner) ([]byte, error) {
+	data, err := msg.Bytes()
+	if err != nil || dkim == nil {
+		return data, err
+	}
+	return dkim.Sign(data)
+}
@@ -0,0 +1,311 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func writeDKIMKey(t *testing.T, key *rsa.PrivateKey, pkcs8 bool) string {
+	t.Helper()
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if pkcs8 {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	path := filepath.Join(t.TempDir(), "dkim.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// The verifier below follows RFC 6376 on its own instead of reusing the
+// signer's helpers, so a bug shared by both cannot hide
+
+var (
+	wspRun      = regexp.MustCompile(`[ \t]+`)
+	trailingWSP = regexp.MustCompile(`[ \t]+\r\n`)
+	trailingCRL = regexp.MustCompile(`(\r\n)+$`)
+)
+
+func verifyRelaxedBody(body []byte) []byte {
+	s := wspRun.ReplaceAllString(string(body), " ")
+	s = trailingWSP.ReplaceAllString(s, "\r\n")
+	s = strings.TrimRight(s, " ")
+	s = trailingCRL.ReplaceAllString(s, "")
+	if s == "" {
+		return nil
+	}
+	return []byte(s + "\r\n")
+}
+
+func verifyRelaxedHeader(field string) string {
+	colon := strings.Index(field, ":")
+	name := strings.ToLower(strings.TrimRight(field[:colon], " \t"))
+	value := strings.ReplaceAll(field[colon+1:], "\r\n", "")
+	value = strings.Trim(wspRun.ReplaceAllString(value, " "), " ")
+	return name + ":" + value
+}
+
+type dkimResult struct {
+	tags      map[string]string
+	bodyOK    bool
+	signature error
+}
+
+// verifyDKIM checks the first DKIM-Signature of message against pub
+func verifyDKIM(t *testing.T, message []byte, pub *rsa.PublicKey) dkimResult {
+	t.Helper()
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		t.Fatal("no header/body separator")
+	}
+	body := message[end+4:]
+
+	// Split the header block into fields, keeping folded lines together
+	var fields []string
+	for _, line := range strings.SplitAfter(string(message[:end+2]), "\r\n") {
+		switch {
+		case line == "":
+		case line[0] == ' ' || line[0] == '\t':
+			fields[len(fields)-1] += line
+		default:
+			fields = append(fields, line)
+		}
+	}
+	if !strings.HasPrefix(strings.ToLower(fields[0]), "dkim-signature:") {
+		t.Fatalf("first header is not DKIM-Signature: %q", fields[0])
+	}
+	sigField := strings.TrimSuffix(fields[0], "\r\n")
+	fields = fields[1:]
+
+	tags := map[string]string{}
+	for _, tag := range strings.Split(sigField[len("DKIM-Signature:"):], ";") {
+		name, value, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(value), "")
+	}
+
+	result := dkimResult{tags: tags}
+
+	bodyHash := sha256.Sum256(verifyRelaxedBody(body))
+	result.bodyOK = tags["bh"] == base64.StdEncoding.EncodeToString(bodyHash[:])
+
+	// Header fields are taken from the bottom up; a name listed more often than
+	// it occurs contributes nothing
+	used := map[string]int{}
+	hash := sha256.New()
+	for _, name := range strings.Split(tags["h"], ":") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		seen := 0
+		for i := len(fields) - 1; i >= 0; i-- {
+			fieldName := strings.ToLower(strings.TrimSpace(strings.SplitN(fields[i], ":", 2)[0]))
+			if fieldName != name {
+				continue
+			}
+			if seen == used[name] {
+				hash.Write([]byte(verifyRelaxedHeader(strings.TrimSuffix(fields[i], "\r\n")) + "\r\n"))
+				break
+			}
+			seen++
+		}
+		used[name]++
+	}
+
+	// The signature header itself with an empty b= value and no trailing CRLF
+	unsigned := regexp.MustCompile(`(b=)[^;]*$`).ReplaceAllString(sigField, "$1")
+	hash.Write([]byte(verifyRelaxedHeader(unsigned)))
+
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatalf("b= is not base64: %v", err)
+	}
+	result.signature = rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash.Sum(nil), signature)
+	return result
+}
+
+func TestDKIMSignVerifies(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pkcs8 := range []bool{false, true} {
+		signer, err := NewDKIMSigner("example.com", "mail2024", writeDKIMKey(t, key, pkcs8))
+		if err != nil {
+			t.Fatalf("NewDKIMSigner (pkcs8=%v): %v", pkcs8, err)
+		}
+
+		msg := goldenMessage()
+		msg.Subject = "Kode verifikasi Anda — berlaku 10 menit ✓, subjek panjang yang harus dilipat"
+		msg.Text = "Kode:  123456 \t\n\n\n"
+		msg.HTML = "<p>Kode: <b>123456</b></p>"
+
+		signed, err := signedBytes(msg, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := verifyDKIM(t, signed, &key.PublicKey)
+		if !result.bodyOK {
+			t.Error("bh= does not match the body")
+		}
+		if result.signature != nil {
+			t.Errorf("b= does not verify: %v", result.signature)
+		}
+
+		wantTags := map[string]string{
+			"v": "1", "a": "rsa-sha256", "c": "relaxed/relaxed",
+			"d": "example.com", "s": "mail2024",
+			"h": "from:from:to:subject:date:message-id:mime-version:content-type",
+		}
+		for tag, want := range wantTags {
+			if got := result.tags[tag]; got != want {
+				t.Errorf("%s= is %q, want %q", tag, got, want)
+			}
+		}
+		if result.tags["t"] == "" {
+			t.Error("t= is missing")
+		}
+	}
+}
+
+func TestDKIMSignatureDetectsTampering(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewDKIMSigner("example.com", "mail2024", writeDKIMKey(t, key, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := goldenMessage()
+	msg.Subject = "Reset password"
+	msg.Text = "Kode: 123456"
+	msg.HTML = "<p>Kode: 123456</p>"
+	signed, err := signedBytes(msg, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerEnd := bytes.Index(signed, []byte("\r\n\r\n"))
+
+	tests := []struct {
+		name        string
+		tamper      func([]byte) []byte
+		bodyOK      bool
+		signatureOK bool
+	}{
+		{
+			name:        "untouched",
+			tamper:      func(m []byte) []byte { return m },
+			bodyOK:      true,
+			signatureOK: true,
+		},
+		{
+			name: "whitespace changed in transit",
+			tamper: func(m []byte) []byte {
+				m = bytes.Replace(m, []byte("Subject: Reset password"), []byte("Subject:   Reset \t password  "), 1)
+				return append(m, "\r\n\r\n"...)
+			},
+			bodyOK:      true,
+			signatureOK: true,
+		},
+		{
+			name: "body changed",
+			tamper: func(m []byte) []byte {
+				body := bytes.Replace(m[headerEnd:], []byte("Kode: 123456"), []byte("Kode: 654321"), 1)
+				return append(m[:headerEnd], body...)
+			},
+			bodyOK:      false,
+			signatureOK: true,
+		},
+		{
+			name: "subject changed",
+			tamper: func(m []byte) []byte {
+				return bytes.Replace(m, []byte("Subject: Reset password"), []byte("Subject: Reset passw0rd"), 1)
+			},
+			bodyOK:      true,
+			signatureOK: false,
+		},
+		{
+			name: "second From added",
+			tamper: func(m []byte) []byte {
+				out := append([]byte{}, m[:headerEnd+2]...)
+				out = append(out, "From: attacker@example.net\r\n"...)
+				return append(out, m[headerEnd+2:]...)
+			},
+			bodyOK:      true,
+			signatureOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := verifyDKIM(t, tt.tamper(append([]byte{}, signed...)), &key.PublicKey)
+			if result.bodyOK != tt.bodyOK {
+				t.Errorf("body hash ok = %v, want %v", result.bodyOK, tt.bodyOK)
+			}
+			if (result.signature == nil) != tt.signatureOK {
+				t.Errorf("signature error = %v, want ok %v", result.signature, tt.signatureOK)
+			}
+		})
+	}
+}
+
+func TestDKIMCanonicalizationExamples(t *testing.T) {
+	// RFC 6376 section 3.4.5
+	header := "A: X\r\nB : Y\t\r\n\tZ  \r\n"
+	fields := parseHeaderFields([]byte(header))
+	if got := canonicalHeaderRelaxed(fields["a"][0]); got != "a:X" {
+		t.Errorf("header A = %q, want %q", got, "a:X")
+	}
+	if got := canonicalHeaderRelaxed(fields["b"][0]); got != "b:Y Z" {
+		t.Errorf("header B = %q, want %q", got, "b:Y Z")
+	}
+
+	body := " C \r\nD \t E\r\n\r\n\r\n"
+	if got := string(canonicalBodyRelaxed([]byte(body))); got != " C\r\nD E\r\n" {
+		t.Errorf("body = %q, want %q", got, " C\r\nD E\r\n")
+	}
+	if got := canonicalBodyRelaxed([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Errorf("empty body = %q, want nothing", got)
+	}
+}
+
+func TestNewDKIMSignerRejectsBadKeys(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	os.WriteFile(garbage, []byte("not a key"), 0o600)
+
+	tests := []struct {
+		name, domain, selector, path string
+	}{
+		{"missing domain", "", "mail", writeDKIMKey(t, small, false)},
+		{"missing selector", "example.com", "", writeDKIMKey(t, small, false)},
+		{"missing file", "example.com", "mail", filepath.Join(t.TempDir(), "nope.pem")},
+		{"not PEM", "example.com", "mail", garbage},
+		{"key too small", "example.com", "mail", writeDKIMKey(t, small, false)},
+	}
+	for _, tt := range tests {
+		if _, err := NewDKIMSigner(tt.domain, tt.selector, tt.path); err == nil {
+			t.Errorf("%s: NewDKIMSigner succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import "errors"
+
+// PermanentError marks a failure that retrying will not fix, such as an
+// invalid address or a message the receiving server rejected outright
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err as a PermanentError; nil stays nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err or an error it wraps is permanent. All
+// other errors, like timeouts and refused connections, are worth retrying.
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
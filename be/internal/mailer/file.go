@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// fileTransport delivers messages into a maildir (tmp/, new/, cur/) that mail
+// clients such as mutt can open, so emails can be read without an SMTP server
+type fileTransport struct {
+	dir      string
+	hostname string
+	dkim     *DKIMSigner
+	seq      atomic.Uint64
+}
+
+// NewFileTransport writes every message as a file below dir/new, signed when
+// dkim is not nil so signatures can be checked locally
+func NewFileTransport(dir string, dkim *DKIMSigner) (Transport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return &fileTransport{dir: dir, hostname: hostname, dkim: dkim}, nil
+}
+
+func (t *fileTransport) Send(ctx context.Context, msg *Message) error {
+	data, err := signedBytes(msg, t.dkim)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), t.seq.Add(1), t.hostname)
+
+	// Maildir readers only look in new/, so a message appears there complete or not at all
+	tmp := filepath.Join(t.dir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(t.dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
+
+func (t *fileTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type httpAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// httpPayload is the JSON body posted to the provider. Most email APIs
+// (SendGrid, Mailgun, Postmark, ...) accept this shape directly or through a
+// small proxy.
+type httpPayload struct {
+	From    httpAddress   `json:"from"`
+	To      []httpAddress `json:"to"`
+	Subject string        `json:"subject"`
+	Text    string        `json:"text,omitempty"`
+	HTML    string        `json:"html,omitempty"`
+}
+
+// httpTransport sends messages through an email provider's HTTP JSON API
+type httpTransport struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+// NewHTTPTransport posts messages to endpoint with the API key as a bearer
+// token. client may be nil to use a client with a 30 second timeout.
+func NewHTTPTransport(endpoint, apiKey string, client *http.Client) (Transport, error) {
+	if endpoint == "" {
+		return nil, errors.New("email API URL is required")
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &httpTransport{endpoint: endpoint, apiKey: apiKey, client: client}, nil
+}
+
+func (t *httpTransport) Send(ctx context.Context, msg *Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	payload := httpPayload{
+		From:    httpAddress{Email: msg.From, Name: msg.FromName},
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+	}
+	for _, to := range msg.To {
+		payload.To = append(payload.To, httpAddress{Email: to})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("email API returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+		// Other 4xx responses mean the provider will never accept this request
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return Permanent(err)
+		}
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (t *httpTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+)
+
+// Message is one email with a plain text and an HTML version
+type Message struct {
+	From     string // bare address
+	FromName string
+	To       []string
+	Subject  string
+	Text     string
+	HTML     string
+
+	// Set when the message is rendered unless given, e.g. to keep a resend's ID
+	Date      time.Time
+	MessageID string // including angle brackets
+}
+
+// Transport delivers messages. SMTP is the default; the file transport writes
+// a maildir for local development and the HTTP transport posts JSON to an
+// email API provider.
+type Transport interface {
+	Send(ctx context.Context, msg *Message) error
+	// Close releases pooled connections
+	Close() error
+}
+
+// New creates the transport selected by EMAIL_TRANSPORT. Without a setting it
+// uses SMTP when credentials are configured and otherwise only logs emails.
+func New(cfg *config.Config) (Transport, error) {
+	transport := cfg.EmailTransport
+	if transport == "" {
+		transport = "log"
+		if cfg.SMTPUsername != "" && cfg.SMTPPassword != "" {
+			transport = "smtp"
+		}
+	}
+
+	var dkim *DKIMSigner
+	if cfg.DKIMDomain != "" || cfg.DKIMSelector != "" || cfg.DKIMPrivateKeyPath != "" {
+		signer, err := NewDKIMSigner(cfg.DKIMDomain, cfg.DKIMSelector, cfg.DKIMPrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		dkim = signer
+	}
+
+	switch transport {
+	case "smtp":
+		return NewSMTPTransport(SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			Security: cfg.SMTPSecurity,
+			PoolSize: cfg.SMTPPoolSize,
+			DKIM:     dkim,
+		})
+	case "file":
+		return NewFileTransport(cfg.EmailDir, dkim)
+	case "http":
+		return NewHTTPTransport(cfg.EmailHTTPURL, cfg.EmailHTTPAPIKey, nil)
+	case "log":
+		return NewLogTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown email transport %q", transport)
+	}
+}
+
+type logTransport struct{}
+
+// NewLogTransport prints emails to stdout instead of sending them, for development
+func NewLogTransport() Transport {
+	return logTransport{}
+}
+
+func (logTransport) Send(ctx context.Context, msg *Message) error {
+	fmt.Printf("[EMAIL] To: %s, Subject: %s\nBody: %s\n", strings.Join(msg.To, ", "), msg.Subject, msg.Text)
+	return nil
+}
+
+func (logTransport) Close() error {
+	return nil
+}
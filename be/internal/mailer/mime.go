@@ -0,0 +1,158 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Validate checks that every address is a single bare address and that no
+// header value can start a new header line. Errors are permanent.
+func (m *Message) Validate() error {
+	return Permanent(m.validate())
+}
+
+func (m *Message) validate() error {
+	if err := validateAddress(m.From); err != nil {
+		return fmt.Errorf("invalid sender: %w", err)
+	}
+	if len(m.To) == 0 {
+		return errors.New("no recipients")
+	}
+	for _, to := range m.To {
+		if err := validateAddress(to); err != nil {
+			return fmt.Errorf("invalid recipient: %w", err)
+		}
+	}
+	if strings.ContainsAny(m.FromName, "\r\n") {
+		return errors.New("sender name must not contain line breaks")
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return errors.New("subject must not contain line breaks")
+	}
+	if strings.ContainsAny(m.MessageID, "\r\n") {
+		return errors.New("message ID must not contain line breaks")
+	}
+	return nil
+}
+
+// validateAddress accepts only an address like "user@example.com", without a
+// display name, comments or a list
+func validateAddress(address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	if parsed.Name != "" || parsed.Address != address {
+		return fmt.Errorf("%q is not a bare email address", address)
+	}
+	return nil
+}
+
+// Bytes renders the message as a multipart/alternative email. Header values
+// are RFC 2047 encoded and both bodies are quoted-printable, so non-ASCII text
+// survives 7-bit relays. Date and MessageID are filled in when empty.
+func (m *Message) Bytes() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		id, err := newMessageID(m.From)
+		if err != nil {
+			return nil, err
+		}
+		m.MessageID = id
+	}
+
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	to := make([]string, len(m.To))
+	for i, address := range m.To {
+		to[i] = (&mail.Address{Address: address}).String()
+	}
+
+	header := &headerWriter{buf: &buf}
+	header.add("From", (&mail.Address{Name: m.FromName, Address: m.From}).String())
+	header.add("To", strings.Join(to, ", "))
+	header.add("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header.add("Date", m.Date.Format(time.RFC1123Z))
+	header.add("Message-ID", m.MessageID)
+	header.add("MIME-Version", "1.0")
+	header.add("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": body.Boundary()}))
+	buf.WriteString("\r\n")
+
+	// Clients show the last part they can display, so HTML goes after plain text
+	if err := writeQuotedPrintable(body, "text/plain", m.Text); err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(body, "text/html", m.HTML); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(body *multipart.Writer, contentType, content string) error {
+	part, err := body.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"charset": "utf-8"})},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The writer turns every line break into CRLF and wraps lines at 76 characters
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// headerWriter writes header fields, folding long values at spaces so no
+// line exceeds 78 characters where possible
+type headerWriter struct {
+	buf *bytes.Buffer
+}
+
+func (h *headerWriter) add(name, value string) {
+	line := name + ":"
+	for _, word := range strings.Split(value, " ") {
+		if len(line)+1+len(word) > 78 && strings.TrimSpace(line) != name+":" {
+			h.buf.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += " " + word
+	}
+	h.buf.WriteString(line + "\r\n")
+}
+
+// newMessageID creates a unique Message-ID in the sender's domain
+func newMessageID(from string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	return fmt.Sprintf("<%s.%s@%s>", time.Now().UTC().Format("20060102150405"), hex.EncodeToString(random), domain), nil
+}
@@ -0,0 +1,240 @@
+package mailer
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// normalizeBoundary replaces the random multipart boundary with a fixed one of
+// the same length, so the rendered message can be compared byte for byte
+func normalizeBoundary(t *testing.T, data []byte) []byte {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("rendered message does not parse: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		t.Fatalf("no multipart boundary in %q", msg.Header.Get("Content-Type"))
+	}
+	boundary := params["boundary"]
+	return bytes.ReplaceAll(data, []byte(boundary), bytes.Repeat([]byte("B"), len(boundary)))
+}
+
+func goldenMessage() *Message {
+	return &Message{
+		From:      "noreply@example.com",
+		FromName:  "BeRealTime",
+		To:        []string{"user@example.org"},
+		Date:      time.Date(2024, 5, 1, 9, 30, 0, 0, time.FixedZone("WIB", 7*60*60)),
+		MessageID: "<20240501023000.0123456789abcdef@example.com>",
+	}
+}
+
+func TestMessageBytesGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *Message)
+	}{
+		{
+			name: "ascii",
+			modify: func(m *Message) {
+				m.Subject = "Your verification code"
+				m.Text = "Your code is 123456.\nIt expires in 10 minutes."
+				m.HTML = "<p>Your code is <b>123456</b>.</p>"
+			},
+		},
+		{
+			name: "non_ascii_subject",
+			modify: func(m *Message) {
+				m.FromName = "Tim Dukungan Ñandú"
+				m.Subject = "Kode verifikasi Anda — berlaku 10 menit ✓"
+				m.Text = "Halo"
+				m.HTML = "<p>Halo</p>"
+			},
+		},
+		{
+			name: "quoted_printable",
+			modify: func(m *Message) {
+				m.To = []string{"first@example.org", "second@example.net"}
+				m.Subject = "Ekspor data siap diunduh, klik tautan di bawah ini sebelum kedaluwarsa dalam tujuh hari"
+				m.Text = "Tautan: https://app.example.com/exports/download?token=abcdefghijklmnopqrstuvwxyz0123456789&format=zip\n" +
+					"Harga: 100% = gratis, café ☕ \n" +
+					".dot at line start\n"
+				m.HTML = `<a href="https://app.example.com/exports/download?token=abcdefghijklmnopqrstuvwxyz0123456789">Unduh</a>` +
+					"\n<p style=\"color: #333\">Terima kasih — tim kami</p>"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := goldenMessage()
+			tt.modify(msg)
+
+			data, err := msg.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes failed: %v", err)
+			}
+			got := normalizeBoundary(t, data)
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("rendered message differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestMessageBytesRoundTrip(t *testing.T) {
+	msg := goldenMessage()
+	msg.FromName = "Tim Dukungan Ñandú"
+	msg.Subject = "Kode verifikasi Anda — berlaku 10 menit ✓ dan subjek yang cukup panjang untuk dilipat"
+	msg.Text = "Baris pertama dengan spasi di akhir \nHarga: 100% = gratis, café ☕\n" + strings.Repeat("panjang ", 30)
+	msg.HTML = "<p>Terima kasih — tim kami</p>"
+
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range strings.Split(string(data), "\r\n") {
+		// An RFC 2047 encoded word may be up to 75 characters and is never split,
+		// so a header line holding one may go past 78, but never past 998
+		limit := 78
+		if strings.Contains(line, "=?utf-8?") {
+			limit = 998
+			for _, word := range strings.Fields(line) {
+				if strings.HasPrefix(word, "=?") && len(word) > 75 {
+					t.Errorf("line %d has a %d character encoded word: %q", i+1, len(word), word)
+				}
+			}
+		}
+		if len(line) > limit {
+			t.Errorf("line %d is %d characters long: %q", i+1, len(line), line)
+		}
+		for _, c := range []byte(line) {
+			if c >= 0x80 {
+				t.Fatalf("line %d is not 7-bit: %q", i+1, line)
+			}
+		}
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := new(mime.WordDecoder)
+	if subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject")); err != nil || subject != msg.Subject {
+		t.Errorf("Subject decodes to %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if from, err := parsed.Header.AddressList("From"); err != nil || from[0].Name != msg.FromName || from[0].Address != msg.From {
+		t.Errorf("From = %v (%v)", from, err)
+	}
+	if parsed.Header.Get("Date") != "Wed, 01 May 2024 09:30:00 +0700" || parsed.Header.Get("Message-ID") != msg.MessageID {
+		t.Errorf("Date = %q, Message-ID = %q", parsed.Header.Get("Date"), parsed.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", parsed.Header.Get("Content-Type"))
+	}
+
+	// Plain text first, HTML last, both decoding back to the original text
+	wantParts := []struct{ contentType, body string }{
+		{"text/plain", strings.ReplaceAll(msg.Text, "\n", "\r\n")},
+		{"text/html", msg.HTML},
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range wantParts {
+		part, err := reader.NextPart() // decodes quoted-printable transparently
+		if err != nil {
+			t.Fatalf("reading %s part: %v", want.contentType, err)
+		}
+		if mediaType, params, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mediaType != want.contentType || params["charset"] != "utf-8" {
+			t.Errorf("part Content-Type = %q, want %s", part.Header.Get("Content-Type"), want.contentType)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != want.body {
+			t.Errorf("%s body = %q, want %q", want.contentType, body, want.body)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("extra part after text/html: %v", err)
+	}
+}
+
+func TestMessageBytesFillsDateAndMessageID(t *testing.T) {
+	msg := goldenMessage()
+	msg.Date = time.Time{}
+	msg.MessageID = ""
+	msg.Subject, msg.Text, msg.HTML = "Hi", "Hi", "<p>Hi</p>"
+
+	if _, err := msg.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Date.IsZero() {
+		t.Error("Date was not set")
+	}
+	if !strings.HasPrefix(msg.MessageID, "<") || !strings.HasSuffix(msg.MessageID, "@example.com>") {
+		t.Errorf("MessageID = %q", msg.MessageID)
+	}
+}
+
+func TestMessageRejectsHeaderInjection(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *Message)
+	}{
+		{"CRLF in To", func(m *Message) { m.To = []string{"user@example.org\r\nBcc: victim@example.net"} }},
+		{"LF in To", func(m *Message) { m.To = []string{"user@example.org\nBcc: victim@example.net"} }},
+		{"CR in To", func(m *Message) { m.To = []string{"user@example.org\rBcc: victim@example.net"} }},
+		{"second recipient smuggled into To", func(m *Message) { m.To = []string{"user@example.org, victim@example.net"} }},
+		{"display name in To", func(m *Message) { m.To = []string{"Victim <victim@example.net>"} }},
+		{"CRLF in Subject", func(m *Message) { m.Subject = "Hello\r\nBcc: victim@example.net" }},
+		{"LF in Subject", func(m *Message) { m.Subject = "Hello\nBcc: victim@example.net" }},
+		{"CR in Subject", func(m *Message) { m.Subject = "Hello\rBcc: victim@example.net" }},
+		{"CRLF in sender name", func(m *Message) { m.FromName = "Support\r\nBcc: victim@example.net" }},
+		{"CRLF in sender", func(m *Message) { m.From = "noreply@example.com\r\nBcc: victim@example.net" }},
+		{"CRLF in Message-ID", func(m *Message) { m.MessageID = "<id@example.com>\r\nBcc: victim@example.net" }},
+		{"no recipients", func(m *Message) { m.To = nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := goldenMessage()
+			msg.Subject, msg.Text, msg.HTML = "Hello", "Hello", "<p>Hello</p>"
+			tt.modify(msg)
+
+			data, err := msg.Bytes()
+			if err == nil {
+				t.Fatalf("Bytes succeeded:\n%s", data)
+			}
+			if !IsPermanent(err) {
+				t.Errorf("error %v is not permanent", err)
+			}
+		})
+	}
+}
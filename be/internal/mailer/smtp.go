@@ -0,0 +1,223 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// SMTP connection security
+const (
+	SecurityStartTLS = "starttls" // plain connection upgraded with STARTTLS, usually port 587
+	SecurityTLS      = "tls"      // implicit TLS, usually port 465
+	SecurityNone     = "none"     // unencrypted, only for local relays
+)
+
+const (
+	smtpTimeout     = 30 * time.Second
+	smtpIdleTimeout = time.Minute
+)
+
+// SMTPConfig configures the SMTP transport. Security defaults to implicit TLS
+// on port 465 and STARTTLS otherwise. Messages are DKIM signed when DKIM is set.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Security string
+	PoolSize int
+	DKIM     *DKIMSigner
+}
+
+type smtpConn struct {
+	client   *smtp.Client
+	conn     net.Conn
+	lastUsed time.Time
+}
+
+// smtpTransport keeps up to PoolSize authenticated connections open and reuses
+// them across messages instead of dialing and logging in for every email
+type smtpTransport struct {
+	cfg   SMTPConfig
+	addr  string
+	slots chan struct{}
+	idle  chan *smtpConn
+}
+
+func NewSMTPTransport(cfg SMTPConfig) (Transport, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("SMTP host is required")
+	}
+	if cfg.Security == "" {
+		cfg.Security = SecurityStartTLS
+		if cfg.Port == "465" {
+			cfg.Security = SecurityTLS
+		}
+	}
+	switch cfg.Security {
+	case SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP security %q", cfg.Security)
+	}
+	if cfg.PoolSize < 1 {
+		cfg.PoolSize = 1
+	}
+
+	return &smtpTransport{
+		cfg:   cfg,
+		addr:  net.JoinHostPort(cfg.Host, cfg.Port),
+		slots: make(chan struct{}, cfg.PoolSize),
+		idle:  make(chan *smtpConn, cfg.PoolSize),
+	}, nil
+}
+
+func (t *smtpTransport) Send(ctx context.Context, msg *Message) error {
+	data, err := signedBytes(msg, t.cfg.DKIM)
+	if err != nil {
+		return err
+	}
+
+	// At most PoolSize messages are sent at the same time
+	select {
+	case t.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-t.slots }()
+
+	c, err := t.conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	if err := t.deliver(ctx, c, msg, data); err != nil {
+		c.client.Close()
+		err = fmt.Errorf("failed to send email: %w", err)
+		// 5xx replies to MAIL, RCPT or DATA reject this message, e.g. an unknown mailbox
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	c.lastUsed = time.Now()
+	select {
+	case t.idle <- c:
+	default:
+		c.client.Quit()
+	}
+	return nil
+}
+
+// Close logs out of all idle connections
+func (t *smtpTransport) Close() error {
+	for {
+		select {
+		case c := <-t.idle:
+			c.client.Quit()
+		default:
+			return nil
+		}
+	}
+}
+
+// conn returns an idle connection that is still alive, or dials a new one
+func (t *smtpTransport) conn(ctx context.Context) (*smtpConn, error) {
+	for {
+		select {
+		case c := <-t.idle:
+			if time.Since(c.lastUsed) < smtpIdleTimeout {
+				t.setDeadline(ctx, c.conn)
+				if c.client.Reset() == nil {
+					return c, nil
+				}
+			}
+			c.client.Close()
+		default:
+			return t.dial(ctx)
+		}
+	}
+}
+
+func (t *smtpTransport) dial(ctx context.Context) (*smtpConn, error) {
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	tlsConfig := &tls.Config{ServerName: t.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if t.cfg.Security == SecurityTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", t.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", t.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.setDeadline(ctx, conn)
+
+	client, err := smtp.NewClient(conn, t.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if t.cfg.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	if t.cfg.Username != "" {
+		auth := smtp.PlainAuth("", t.cfg.Username, t.cfg.Password, t.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return &smtpConn{client: client, conn: conn}, nil
+}
+
+func (t *smtpTransport) deliver(ctx context.Context, c *smtpConn, msg *Message, data []byte) error {
+	t.setDeadline(ctx, c.conn)
+
+	if err := c.client.Mail(msg.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// setDeadline bounds the next SMTP commands by the context deadline or the default timeout
+func (t *smtpTransport) setDeadline(ctx context.Context, conn net.Conn) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	conn.SetDeadline(deadline)
+}
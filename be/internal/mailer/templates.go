@@ -0,0 +1,185 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// DefaultLocale is used for recipients without a locale or with one that has no templates
+const DefaultLocale = "id"
+
+// Locales lists the languages that have a full set of email templates
+var Locales = []string{"id", "en"}
+
+// Types lists every email that can be rendered. Each type has a .html file
+// defining "title" and "content" and a .txt file defining "subject" and
+// "content" in every locale directory.
+var Types = []string{
+	"otp",
+	"email_change",
+	"email_changed",
+	"reset_password",
+	"verification",
+	"welcome",
+	"data_export",
+	"account_deletion",
+	"org_invitation",
+	"magic_link",
+}
+
+// TemplateData holds the values an email template can use. Only the fields
+// the template needs have to be set.
+type TemplateData struct {
+	AppName      string
+	Year         int
+	Locale       string
+	Name         string
+	Code         string
+	Link         string
+	Organization string
+	Inviter      string
+	Date         string
+	Email        string
+}
+
+// Rendered is a template executed for one recipient
+type Rendered struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+type localizedTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Templates renders the embedded email templates. Every locale and type is
+// parsed up front so a broken template fails at startup instead of when the
+// email is sent.
+type Templates struct {
+	templates map[string]map[string]*localizedTemplate // locale -> type
+}
+
+// LoadTemplates parses the shared layout together with each locale's common
+// blocks and email files
+func LoadTemplates() (*Templates, error) {
+	t := &Templates{templates: make(map[string]map[string]*localizedTemplate)}
+
+	for _, locale := range Locales {
+		t.templates[locale] = make(map[string]*localizedTemplate)
+		for _, emailType := range Types {
+			htmlTmpl, err := htmltemplate.ParseFS(templateFS,
+				"templates/layout.html",
+				"templates/"+locale+"/common.html",
+				"templates/"+locale+"/"+emailType+".html")
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s/%s.html: %w", locale, emailType, err)
+			}
+			textTmpl, err := texttemplate.ParseFS(templateFS,
+				"templates/layout.txt",
+				"templates/"+locale+"/common.txt",
+				"templates/"+locale+"/"+emailType+".txt")
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s/%s.txt: %w", locale, emailType, err)
+			}
+			t.templates[locale][emailType] = &localizedTemplate{html: htmlTmpl, text: textTmpl}
+		}
+	}
+
+	return t, nil
+}
+
+// HasType reports whether emailType has templates
+func (t *Templates) HasType(emailType string) bool {
+	_, ok := t.templates[DefaultLocale][emailType]
+	return ok
+}
+
+// Render executes the templates of emailType in the given locale, falling
+// back to DefaultLocale for unknown locales
+func (t *Templates) Render(emailType, locale string, data TemplateData) (*Rendered, error) {
+	locale = NormalizeLocale(locale)
+	tmpl, ok := t.templates[locale][emailType]
+	if !ok {
+		return nil, fmt.Errorf("unknown email type %q", emailType)
+	}
+
+	data.Locale = locale
+	if data.Year == 0 {
+		data.Year = time.Now().Year()
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s subject: %w", emailType, err)
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "layout", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s text: %w", emailType, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s html: %w", emailType, err)
+	}
+
+	return &Rendered{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+// NormalizeLocale returns the supported locale matching tag, e.g. "en-US" -> "en"
+func NormalizeLocale(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, locale := range Locales {
+		if tag == locale {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
+
+var indonesianMonths = [...]string{
+	"Januari", "Februari", "Maret", "April", "Mei", "Juni",
+	"Juli", "Agustus", "September", "Oktober", "November", "Desember",
+}
+
+// FormatDate writes a date the way readers of the locale expect, e.g.
+// "2 Januari 2006" or "January 2, 2006"
+func FormatDate(t time.Time, locale string) string {
+	switch NormalizeLocale(locale) {
+	case "en":
+		return t.Format("January 2, 2006")
+	default:
+		return fmt.Sprintf("%d %s %d", t.Day(), indonesianMonths[t.Month()-1], t.Year())
+	}
+}
+
+// SampleData returns placeholder values for previewing emailType
+func SampleData(emailType, locale string) TemplateData {
+	data := TemplateData{
+		Name:         "Budi Santoso",
+		Code:         "123456",
+		Link:         "https://example.com/" + emailType + "?token=sample-token",
+		Organization: "Acme Corp",
+		Inviter:      "Siti Rahma",
+		Date:         FormatDate(time.Now().AddDate(0, 0, 30), locale),
+		Email:        "budi.baru@example.com",
+	}
+	if NormalizeLocale(locale) == "en" {
+		data.Name = "Jane Doe"
+		data.Inviter = "John Smith"
+	}
+	return data
+}
@@ -0,0 +1,379 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testMessage() *Message {
+	return &Message{
+		From:      "noreply@example.com",
+		FromName:  "BeRealTime",
+		To:        []string{"user@example.org"},
+		Subject:   "Kode OTP",
+		Text:      "Kode Anda: 123456",
+		HTML:      "<p>Kode Anda: <b>123456</b></p>",
+		Date:      time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC),
+		MessageID: "<test.1@example.com>",
+	}
+}
+
+func TestHTTPTransportSend(t *testing.T) {
+	var got httpPayload
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding payload: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	transport, err := NewHTTPTransport(server.URL, "secret-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	if err := transport.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if auth != "Bearer secret-key" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if got.From.Email != "noreply@example.com" || got.From.Name != "BeRealTime" || len(got.To) != 1 ||
+		got.To[0].Email != "user@example.org" || got.Subject != "Kode OTP" || got.Text == "" || got.HTML == "" {
+		t.Errorf("payload = %+v", got)
+	}
+}
+
+func TestHTTPTransportClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusUnauthorized, true},
+		{http.StatusForbidden, true},
+		{http.StatusNotFound, true},
+		{http.StatusUnprocessableEntity, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, false},
+		{http.StatusServiceUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "provider says no", tt.status)
+			}))
+			defer server.Close()
+
+			transport, err := NewHTTPTransport(server.URL, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = transport.Send(context.Background(), testMessage())
+			if err == nil {
+				t.Fatal("Send succeeded")
+			}
+			if IsPermanent(err) != tt.permanent {
+				t.Errorf("IsPermanent = %v, want %v (%v)", IsPermanent(err), tt.permanent, err)
+			}
+			if !strings.Contains(err.Error(), "provider says no") {
+				t.Errorf("error %q does not include the response body", err)
+			}
+		})
+	}
+}
+
+func TestHTTPTransportConnectionErrorIsRetried(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	transport, err := NewHTTPTransport(server.URL, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transport.Send(context.Background(), testMessage())
+	if err == nil || IsPermanent(err) {
+		t.Errorf("error = %v, want a retryable error", err)
+	}
+}
+
+func TestHTTPTransportRejectsInvalidMessage(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	transport, err := NewHTTPTransport(server.URL, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := testMessage()
+	msg.To = []string{"Victim <victim@example.org>"}
+	if err := transport.Send(context.Background(), msg); !IsPermanent(err) {
+		t.Errorf("error = %v, want a permanent error", err)
+	}
+	if called {
+		t.Error("invalid message was posted")
+	}
+}
+
+func TestFileTransportDeliversToMaildir(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewFileTransport(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := transport.Send(context.Background(), testMessage()); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	for _, sub := range []string{"tmp", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("%s/ has %d files, want none", sub, len(entries))
+		}
+	}
+
+	delivered, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 2 || delivered[0].Name() == delivered[1].Name() {
+		t.Fatalf("new/ has %v, want two distinct messages", delivered)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "new", delivered[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := testMessage().Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "From: ") || len(data) != len(want) {
+		t.Errorf("delivered message:\n%s", data)
+	}
+}
+
+func TestFileTransportKeepsNothingWhenMessageIsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewFileTransport(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := testMessage()
+	msg.Subject = "Hello\r\nBcc: victim@example.org"
+	if err := transport.Send(context.Background(), msg); !IsPermanent(err) {
+		t.Errorf("error = %v, want a permanent error", err)
+	}
+	for _, sub := range []string{"tmp", "new"} {
+		if entries, _ := os.ReadDir(filepath.Join(dir, sub)); len(entries) != 0 {
+			t.Errorf("%s/ has %d files, want none", sub, len(entries))
+		}
+	}
+}
+
+// fakeSMTPServer speaks just enough SMTP for net/smtp. replies overrides the
+// reply to a command (MAIL, RCPT, DATA) with a fixed line such as "550 ...".
+type fakeSMTPServer struct {
+	listener net.Listener
+	replies  map[string]string
+
+	mu       sync.Mutex
+	messages []string
+	conns    int
+}
+
+func newFakeSMTPServer(t *testing.T, replies map[string]string) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: listener, replies: replies}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake.example.com ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.Fields(line + " x")[0])
+		if reply, ok := s.replies[command]; ok {
+			text.PrintfLine("%s", reply)
+			continue
+		}
+
+		switch command {
+		case "EHLO":
+			text.PrintfLine("250-fake.example.com")
+			text.PrintfLine("250 8BITMIME")
+		case "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) transport(t *testing.T) Transport {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	transport, err := NewSMTPTransport(SMTPConfig{Host: host, Port: port, Security: SecurityNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { transport.Close() })
+	return transport
+}
+
+func TestSMTPTransportSendsAndReusesConnections(t *testing.T) {
+	server := newFakeSMTPServer(t, nil)
+	transport := server.transport(t)
+
+	for i := 0; i < 3; i++ {
+		if err := transport.Send(context.Background(), testMessage()); err != nil {
+			t.Fatalf("Send %d failed: %v", i+1, err)
+		}
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.messages) != 3 {
+		t.Fatalf("server received %d messages, want 3", len(server.messages))
+	}
+	if !strings.Contains(server.messages[0], "Subject: Kode OTP") {
+		t.Errorf("message:\n%s", server.messages[0])
+	}
+	if server.conns != 1 {
+		t.Errorf("transport opened %d connections, want 1", server.conns)
+	}
+}
+
+func TestSMTPTransportClassifiesReplies(t *testing.T) {
+	tests := []struct {
+		name      string
+		replies   map[string]string
+		permanent bool
+	}{
+		{"unknown mailbox", map[string]string{"RCPT": "550 5.1.1 no such user"}, true},
+		{"sender rejected", map[string]string{"MAIL": "553 5.7.1 sender not allowed"}, true},
+		{"message rejected", map[string]string{"DATA": "554 5.6.0 message refused"}, true},
+		{"greylisted", map[string]string{"RCPT": "451 4.7.1 try again later"}, false},
+		{"mailbox full", map[string]string{"RCPT": "452 4.2.2 mailbox full"}, false},
+		{"server busy", map[string]string{"MAIL": "421 4.3.2 service not available"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSMTPServer(t, tt.replies)
+			err := server.transport(t).Send(context.Background(), testMessage())
+			if err == nil {
+				t.Fatal("Send succeeded")
+			}
+			if IsPermanent(err) != tt.permanent {
+				t.Errorf("IsPermanent = %v, want %v (%v)", IsPermanent(err), tt.permanent, err)
+			}
+			var reply *textproto.Error
+			if !errors.As(err, &reply) {
+				t.Errorf("error %v does not wrap the SMTP reply", err)
+			}
+		})
+	}
+}
+
+func TestSMTPTransportConnectionErrorIsRetried(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	transport, err := NewSMTPTransport(SMTPConfig{Host: host, Port: port, Security: SecurityNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transport.Send(context.Background(), testMessage())
+	if err == nil || IsPermanent(err) {
+		t.Errorf("error = %v, want a retryable error", err)
+	}
+}
+
+func TestSMTPTransportRequiresStartTLS(t *testing.T) {
+	server := newFakeSMTPServer(t, nil)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	transport, err := NewSMTPTransport(SMTPConfig{Host: host, Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake server does not offer STARTTLS, so nothing may be sent in the clear
+	if err := transport.Send(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("error = %v, want a STARTTLS error", err)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.messages) != 0 {
+		t.Error("message was sent without TLS")
+	}
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart from JWTs
+const AccessTokenPrefix = "pat_"
+
+// Personal access token scopes
+const (
+	ScopeProfileRead = "profile:read"
+	ScopeRoomsRead   = "rooms:read"
+	ScopeRoomsWrite  = "rooms:write"
+	ScopeChatRead    = "chat:read"
+	ScopeChatWrite   = "chat:write"
+	ScopeAdmin       = "admin"
+)
+
+// AccessTokenScopes lists every scope a personal access token can be granted
+var AccessTokenScopes = []string{ScopeProfileRead, ScopeRoomsRead, ScopeRoomsWrite, ScopeChatRead, ScopeChatWrite, ScopeAdmin}
+
+// PersonalAccessToken lets scripts and bots call the API without a password.
+// Only the SHA-256 hash is stored; the token itself is shown once on creation.
+type PersonalAccessToken struct {
+	ID          string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      string     `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name        string     `gorm:"type:varchar(100);not null" json:"name"`
+	TokenHash   string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	TokenPrefix string     `gorm:"type:varchar(16);not null" json:"token_prefix"` // first characters, to recognise the token in lists
+	Scopes      string     `gorm:"type:text;not null" json:"-"`                   // space separated
+	ExpiresAt   *time.Time `gorm:"type:timestamp" json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `gorm:"type:timestamp" json:"last_used_at,omitempty"`
+	LastUsedIP  *string    `gorm:"type:varchar(45)" json:"last_used_ip,omitempty"`
+	RevokedAt   *time.Time `gorm:"type:timestamp" json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// ScopeList returns the granted scopes
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// IsUsable reports whether the token is neither revoked nor expired
+func (t *PersonalAccessToken) IsUsable() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || t.ExpiresAt.After(time.Now()))
+}
+
+// TableName specifies the table name
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// BeforeCreate hook to generate UUID
+func (t *PersonalAccessToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Audit actions
+const (
+	AuditLoginSucceeded  = "auth.login.succeeded"
+	AuditLoginFailed     = "auth.login.failed"
+	AuditPasswordChanged = "auth.password.changed"
+	AuditPasswordReset   = "auth.password.reset"
+	AuditEmailChanged    = "auth.email.changed"
+	AuditOTPVerified     = "auth.otp.verified"
+	AuditOTPFailed       = "auth.otp.failed"
+
+	AuditRoomCreated       = "room.created"
+	AuditRoomDeleted       = "room.deleted"
+	AuditRoomJoined        = "room.joined"
+	AuditRoomLeft          = "room.left"
+	AuditParticipantKicked = "room.participant_kicked"
+	AuditRoomGuestJoined   = "room.guest_joined"
+	AuditRoomGuestAccess   = "room.guest_access_changed"
+
+	AuditUserDeactivated = "admin.user.deactivated"
+	AuditUserReactivated = "admin.user.reactivated"
+	AuditRoomClosed      = "admin.room.closed"
+	AuditMessageDeleted  = "admin.message.deleted"
+	AuditEmailsReplayed  = "admin.emails.replayed"
+
+	AuditRetentionPolicySet     = "admin.retention_policy.set"
+	AuditRetentionPolicyDeleted = "admin.retention_policy.deleted"
+
+	AuditOrgCreated        = "org.created"
+	AuditOrgUpdated        = "org.updated"
+	AuditOrgDomainVerified = "org.domain.verified"
+	AuditOrgMemberJoined   = "org.member.joined"
+	AuditOrgMemberRemoved  = "org.member.removed"
+	AuditOrgRoleChanged    = "org.member.role_changed"
+	AuditOrgInvitationSent = "org.invitation.sent"
+	AuditOrgSCIMEnabled    = "org.scim.enabled"
+	AuditOrgSCIMDisabled   = "org.scim.disabled"
+
+	AuditSCIMUserProvisioned   = "scim.user.provisioned"
+	AuditSCIMUserUpdated       = "scim.user.updated"
+	AuditSCIMUserDeprovisioned = "scim.user.deprovisioned"
+)
+
+// Audit target types
+const (
+	AuditTargetUser    = "user"
+	AuditTargetRoom    = "room"
+	AuditTargetMessage = "message"
+	AuditTargetOrg     = "organization"
+
+	AuditTargetRetentionPolicy = "retention_policy"
+)
+
+// AuditEvent is one entry of the append-only audit log. Rows are never
+// updated or deleted; a database trigger rejects both.
+type AuditEvent struct {
+	ID         string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ActorID    *string   `gorm:"type:uuid;index" json:"actor_id,omitempty"` // empty for anonymous attempts, e.g. a login with an unknown email
+	Action     string    `gorm:"type:varchar(100);not null;index" json:"action"`
+	TargetType *string   `gorm:"type:varchar(50)" json:"target_type,omitempty"`
+	TargetID   *string   `gorm:"type:varchar(100);index" json:"target_id,omitempty"`
+	IPAddress  string    `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent  string    `gorm:"type:text" json:"user_agent"`
+	Metadata   JSONMap   `gorm:"type:jsonb" json:"metadata,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName specifies the table name
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// BeforeCreate hook to generate UUID
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// JSONMap is a JSON object stored in a jsonb column
+type JSONMap map[string]interface{}
+
+// Value implements driver.Valuer
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (m *JSONMap) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for JSONMap")
+	}
+	return json.Unmarshal(data, m)
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Data export statuses
+const (
+	ExportStatusPending    = "pending"
+	ExportStatusProcessing = "processing"
+	ExportStatusReady      = "ready"
+	ExportStatusFailed     = "failed"
+	ExportStatusExpired    = "expired"
+)
+
+// DataExport is a personal data export requested by a user. The worker builds
+// the archive and emails a download link that works until ExpiresAt.
+type DataExport struct {
+	ID          string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      string     `gorm:"type:uuid;not null;index" json:"user_id"`
+	Status      string     `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	FileKey     *string    `gorm:"type:varchar(255)" json:"-"`
+	TokenHash   *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	Error       *string    `gorm:"type:text" json:"-"`
+	ExpiresAt   *time.Time `gorm:"type:timestamp" json:"expires_at,omitempty"`
+	CompletedAt *time.Time `gorm:"type:timestamp" json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (DataExport) TableName() string {
+	return "data_exports"
+}
+
+// BeforeCreate hook to generate UUID
+func (e *DataExport) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return nil
+}
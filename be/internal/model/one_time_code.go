@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// One-time code purposes. A code only works for the flow it was issued for.
+const (
+	CodePurposeVerifyEmail   = "verify_email"
+	CodePurposeResetPassword = "reset_password"
+	CodePurposeEmailChange   = "email_change"
+	CodePurposeLogin         = "login" // magic link sign-in
+)
+
+// OneTimeCode is a hashed code sent to the user by email. Issuing a new code
+// replaces older unused codes of the same purpose only.
+type OneTimeCode struct {
+	ID         string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     string     `gorm:"type:uuid;not null;index:idx_one_time_codes_user_purpose" json:"user_id"`
+	Purpose    string     `gorm:"type:varchar(32);not null;index:idx_one_time_codes_user_purpose" json:"purpose"`
+	CodeHash   string     `gorm:"type:varchar(64);not null" json:"-"`
+	Target     *string    `gorm:"type:varchar(255)" json:"-"` // e.g. the new address for email_change, the browser nonce hash for login
+	Attempts   int        `gorm:"not null;default:0" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	ConsumedAt *time.Time `gorm:"type:timestamp" json:"-"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name
+func (OneTimeCode) TableName() string {
+	return "one_time_codes"
+}
+
+// BeforeCreate hook to generate UUID
+func (c *OneTimeCode) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
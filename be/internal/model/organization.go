@@ -0,0 +1,103 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Organization roles. Owners can do everything admins can, plus manage owners.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// OrgRoles lists every role an organization member can have
+var OrgRoles = []string{OrgRoleOwner, OrgRoleAdmin, OrgRoleMember}
+
+// SCIMTokenPrefix marks organization SCIM tokens so they can be told apart from other tokens
+const SCIMTokenPrefix = "scim_"
+
+// Organization is a workspace that owns rooms. Only its members can see and
+// chat in those rooms.
+type Organization struct {
+	ID          string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string    `gorm:"type:varchar(255);not null" json:"name"`
+	Slug        string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"slug"`
+	Domain      *string   `gorm:"type:varchar(255);uniqueIndex" json:"domain,omitempty"` // once verified, users with a verified email at this domain join automatically
+	CreatedByID string    `gorm:"type:uuid;not null" json:"created_by_id"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Proof of domain ownership: the record has to be published as a DNS TXT record on Domain
+	DomainVerificationRecord *string    `gorm:"type:varchar(255)" json:"domain_verification_record,omitempty"`
+	DomainVerifiedAt         *time.Time `gorm:"type:timestamp" json:"domain_verified_at,omitempty"`
+
+	// SCIM provisioning from the organization's identity provider; only the token hash is stored
+	SCIMTokenHash      *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	SCIMTokenCreatedAt *time.Time `gorm:"type:timestamp" json:"scim_token_created_at,omitempty"`
+}
+
+// OrganizationMember links a user to an organization with a role
+type OrganizationMember struct {
+	OrganizationID string    `gorm:"type:uuid;primaryKey" json:"organization_id"`
+	UserID         string    `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	User           User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Role           string    `gorm:"type:varchar(20);not null;default:'member'" json:"role"`
+	JoinedAt       time.Time `gorm:"autoCreateTime" json:"joined_at"`
+	ExternalID     *string   `gorm:"type:varchar(255)" json:"external_id,omitempty"` // id of the user in the identity provider
+	Managed        bool      `gorm:"default:false" json:"managed"`                   // membership managed through SCIM
+	Provisioned    bool      `gorm:"default:false" json:"provisioned"`               // account created by this organization's SCIM, not adopted
+}
+
+// OrganizationInvitation invites an email address to join an organization.
+// Only the hash of the token from the invitation email is stored.
+type OrganizationInvitation struct {
+	ID             string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	OrganizationID string     `gorm:"type:uuid;not null;index" json:"organization_id"`
+	Email          string     `gorm:"type:varchar(255);not null;index" json:"email"`
+	Role           string     `gorm:"type:varchar(20);not null;default:'member'" json:"role"`
+	TokenHash      string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	InvitedByID    string     `gorm:"type:uuid;not null" json:"invited_by_id"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt     *time.Time `gorm:"type:timestamp" json:"accepted_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// DomainVerified reports whether the organization proved it owns Domain
+func (o *Organization) DomainVerified() bool {
+	return o.Domain != nil && o.DomainVerifiedAt != nil
+}
+
+// TableName specifies the table name
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// TableName specifies the table name for OrganizationMember
+func (OrganizationMember) TableName() string {
+	return "organization_members"
+}
+
+// TableName specifies the table name for OrganizationInvitation
+func (OrganizationInvitation) TableName() string {
+	return "organization_invitations"
+}
+
+// BeforeCreate hook to generate UUID
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == "" {
+		o.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (i *OrganizationInvitation) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasskeyCredential is a WebAuthn public key credential registered by a user
+type PasskeyCredential struct {
+	ID           string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID       string     `gorm:"type:uuid;not null;index" json:"user_id"`
+	CredentialID string     `gorm:"type:varchar(1024);uniqueIndex;not null" json:"credential_id"` // base64url
+	PublicKey    []byte     `gorm:"type:bytea;not null" json:"-"`                                 // COSE_Key
+	SignCount    int64      `gorm:"not null;default:0" json:"-"`
+	AAGUID       *string    `gorm:"type:varchar(36)" json:"aaguid,omitempty"`
+	Transports   *string    `gorm:"type:varchar(255)" json:"transports,omitempty"`
+	Name         string     `gorm:"type:varchar(100);not null" json:"name"`
+	LastUsedAt   *time.Time `gorm:"type:timestamp" json:"last_used_at,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name
+func (PasskeyCredential) TableName() string {
+	return "passkey_credentials"
+}
+
+// BeforeCreate hook to generate UUID
+func (p *PasskeyCredential) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RetentionPolicy defines how long chat messages are kept.
+// A policy without RoomID is the global default; a room policy overrides it.
+type RetentionPolicy struct {
+	ID              string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	RoomID          *string   `gorm:"type:uuid;uniqueIndex" json:"room_id,omitempty"`
+	RetentionDays   int       `gorm:"not null;default:0" json:"retention_days"` // 0 = keep forever
+	LegalHold       bool      `gorm:"default:false" json:"legal_hold"`
+	LegalHoldReason *string   `gorm:"type:text" json:"legal_hold_reason,omitempty"`
+	UpdatedByID     string    `gorm:"type:uuid;not null" json:"updated_by_id"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// RetentionPurgeLog records what a purge run deleted for a single room
+type RetentionPurgeLog struct {
+	ID              string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	PolicyID        string     `gorm:"type:uuid;not null;index" json:"policy_id"`
+	RoomID          string     `gorm:"type:uuid;not null;index" json:"room_id"`
+	RetentionDays   int        `gorm:"not null" json:"retention_days"`
+	Cutoff          time.Time  `gorm:"not null" json:"cutoff"`
+	PurgedCount     int64      `gorm:"not null" json:"purged_count"`
+	OldestMessageAt *time.Time `gorm:"type:timestamp" json:"oldest_message_at,omitempty"`
+	NewestMessageAt *time.Time `gorm:"type:timestamp" json:"newest_message_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName specifies the table name
+func (RetentionPolicy) TableName() string {
+	return "retention_policies"
+}
+
+// TableName specifies the table name for RetentionPurgeLog
+func (RetentionPurgeLog) TableName() string {
+	return "retention_purge_logs"
+}
+
+// BeforeCreate hook to generate UUID
+func (p *RetentionPolicy) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (l *RetentionPurgeLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == "" {
+		l.ID = uuid.New().String()
+	}
+	return nil
+}
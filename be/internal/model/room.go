@@ -14,12 +14,18 @@ type Room struct {
 	Description     *string        `gorm:"type:text" json:"description,omitempty"`
 	CreatedByID     string         `gorm:"type:uuid;not null" json:"created_by_id"`
 	CreatedBy       User           `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+	OrganizationID  *string        `gorm:"type:uuid;index" json:"organization_id,omitempty"` // nil for personal rooms
 	IsActive        bool           `gorm:"default:true" json:"is_active"`
 	MaxParticipants *int           `gorm:"type:integer" json:"max_participants,omitempty"`
 	Participants    []User         `gorm:"many2many:room_participants;" json:"participants,omitempty"`
 	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Guest access lets people without an account join with the invite link or passcode
+	AllowGuests       bool    `gorm:"not null;default:false" json:"allow_guests"`
+	GuestInviteHash   *string `gorm:"type:varchar(64)" json:"-"`
+	GuestPasscodeHash *string `gorm:"type:varchar(255)" json:"-"`
 }
 
 // RoomParticipant represents the many-to-many relationship between Room and User
@@ -31,6 +37,28 @@ type RoomParticipant struct {
 	IsActive bool       `gorm:"default:true" json:"is_active"`
 }
 
+// GuestIdentityPrefix starts the LiveKit identity of every guest, so clients can
+// tell guests apart from signed-in users
+const GuestIdentityPrefix = "guest:"
+
+// RoomGuest is a short-lived identity for someone who joined a room without an account
+type RoomGuest struct {
+	ID          string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	RoomID      string     `gorm:"type:uuid;not null;index" json:"room_id"`
+	DisplayName string     `gorm:"type:varchar(64);not null" json:"display_name"`
+	TokenHash   string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	IPAddress   string     `gorm:"type:varchar(45)" json:"-"`
+	JoinedAt    time.Time  `gorm:"autoCreateTime" json:"joined_at"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	LeftAt      *time.Time `gorm:"type:timestamp" json:"left_at,omitempty"`
+	IsActive    bool       `gorm:"default:true" json:"is_active"`
+}
+
+// Identity is the participant identity the guest joins the call with
+func (g *RoomGuest) Identity() string {
+	return GuestIdentityPrefix + g.ID
+}
+
 // TableName specifies the table name
 func (Room) TableName() string {
 	return "rooms"
@@ -41,6 +69,11 @@ func (RoomParticipant) TableName() string {
 	return "room_participants"
 }
 
+// TableName specifies the table name for RoomGuest
+func (RoomGuest) TableName() string {
+	return "room_guests"
+}
+
 // BeforeCreate hook to generate UUID
 func (r *Room) BeforeCreate(tx *gorm.DB) error {
 	if r.ID == "" {
@@ -48,3 +81,11 @@ func (r *Room) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// BeforeCreate hook to generate UUID
+func (g *RoomGuest) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == "" {
+		g.ID = uuid.New().String()
+	}
+	return nil
+}
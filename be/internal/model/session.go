@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session represents one signed-in device. All refresh tokens rotated from the
+// same login belong to the same session (token family).
+type Session struct {
+	ID            string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID        string     `gorm:"type:uuid;not null;index" json:"user_id"`
+	DeviceName    *string    `gorm:"type:varchar(255)" json:"device_name,omitempty"`
+	IPAddress     string     `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent     string     `gorm:"type:text" json:"user_agent"`
+	LastUsedAt    time.Time  `gorm:"not null" json:"last_used_at"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt     *time.Time `gorm:"type:timestamp" json:"revoked_at,omitempty"`
+	RevokedReason *string    `gorm:"type:varchar(50)" json:"revoked_reason,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// RefreshToken is a hashed, single-use opaque refresh token
+type RefreshToken struct {
+	ID        string     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	SessionID string     `gorm:"type:uuid;not null;index" json:"session_id"`
+	Session   Session    `gorm:"foreignKey:SessionID" json:"-"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"type:timestamp" json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// IsRevoked reports whether the session can no longer be used
+func (s *Session) IsRevoked() bool {
+	return s.RevokedAt != nil || s.ExpiresAt.Before(time.Now())
+}
+
+// TableName specifies the table name
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// TableName specifies the table name for RefreshToken
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// BeforeCreate hook to generate UUID
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return nil
+}
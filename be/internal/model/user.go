@@ -7,6 +7,41 @@ import (
 	"gorm.io/gorm"
 )
 
+// Login types: how an account signs in. Accounts created through an external
+// identity provider use the provider name (google, keycloak, ...). An account
+// becomes passkey once it registers a passkey and falls back when the last one
+// is removed. A password and further identities can be added to any account,
+// see User.HasPassword and UserIdentity.
+const (
+	LoginTypeCredential = "credential"
+	LoginTypeGoogle     = "google"
+	LoginTypeSCIM       = "scim"    // provisioned by an organization's identity provider
+	LoginTypePasskey    = "passkey" // has at least one passkey
+)
+
+// Roles, stored in User.UserType. Admins can do everything moderators can.
+const (
+	RoleMember    = "member"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role a user can be given
+var Roles = []string{RoleMember, RoleModerator, RoleAdmin}
+
+// Locales for emails and other user facing text, stored in User.Locale
+const (
+	LocaleID = "id"
+	LocaleEN = "en"
+)
+
+// Locales lists every locale a user can choose
+var Locales = []string{LocaleID, LocaleEN}
+
+// DeletedUserID is a placeholder account that takes over the chat messages and
+// rooms of deleted users, so their content stays readable without naming them.
+const DeletedUserID = "00000000-0000-0000-0000-000000000000"
+
 type User struct {
 	ID             string         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	Email          string         `gorm:"type:varchar(255);uniqueIndex;not null" json:"email"`
@@ -18,15 +53,18 @@ type User struct {
 	ProfilePhoto   *string        `gorm:"type:text" json:"profile_photo,omitempty"`
 	DateOfBirth    *time.Time     `gorm:"type:date" json:"date_of_birth,omitempty"`
 	Gender         *string        `gorm:"type:varchar(20)" json:"gender,omitempty"`
+	Locale         string         `gorm:"type:varchar(8);not null;default:'id'" json:"locale"` // language of emails sent to the user
 	IsActive       bool           `gorm:"default:true" json:"is_active"`
+	DeactivatedBy  *string        `gorm:"type:varchar(100)" json:"deactivated_by,omitempty"` // see DeactivatedByAdmin and DeactivatedBySCIM
 	IsVerified     bool           `gorm:"default:false" json:"is_verified"`
 	LastLogin      *time.Time     `gorm:"type:timestamp" json:"last_login,omitempty"`
-	LoginType      string         `gorm:"type:varchar(50);default:'credential'" json:"login_type"` // credential, google
-	GoogleID       *string        `gorm:"type:varchar(255);uniqueIndex" json:"-"`
-	OTPCode        *string        `gorm:"type:varchar(6)" json:"-"`
-	OTPExpiresAt   *time.Time     `gorm:"type:timestamp" json:"-"`
+	LoginType      string         `gorm:"type:varchar(50);default:'credential'" json:"login_type"` // credential, passkey or provider name
 	ResetToken     *string        `gorm:"type:text" json:"-"`
 	ResetExpiresAt *time.Time     `gorm:"type:timestamp" json:"-"`
+	MFAEnabled     bool           `gorm:"default:false" json:"mfa_enabled"`
+	MFASecret      *string        `gorm:"type:varchar(64)" json:"-"`
+	MFALastStep    int64          `gorm:"default:0" json:"-"` // last accepted TOTP step, prevents code replay
+	DeletionDueAt  *time.Time     `gorm:"type:timestamp;index" json:"deletion_due_at,omitempty"`
 	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
@@ -40,6 +78,41 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// HasPassword reports whether the user can sign in with a password. Accounts
+// created through Google or SSO have none until the user sets one.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// DeactivatedByAdmin is the User.DeactivatedBy of an account a platform admin deactivated
+func DeactivatedByAdmin(adminID string) string {
+	return "admin:" + adminID
+}
+
+// DeactivatedBySCIM is the User.DeactivatedBy of an account an organization's
+// identity provider deactivated; only that provider may reactivate it
+func DeactivatedBySCIM(orgID string) string {
+	return "scim:" + orgID
+}
+
+// HasRole reports whether the user has one of roles. Admins have every role.
+func (u *User) HasRole(roles ...string) bool {
+	return RoleAllowed(u.UserType, roles...)
+}
+
+// RoleAllowed reports whether role is one of roles, treating admin as every role
+func RoleAllowed(role string, roles ...string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	for _, allowed := range roles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
+
 // TableName specifies the table name
 func (User) TableName() string {
 	return "users"
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type AccessTokenRepository interface {
+	Create(token *model.PersonalAccessToken) error
+	FindByHash(tokenHash string) (*model.PersonalAccessToken, error)
+	FindByUserID(userID string) ([]model.PersonalAccessToken, error)
+	Revoke(id, userID string) (bool, error)
+	RevokeAllByUserID(userID string) error
+	TouchLastUsed(id, ipAddress string) error
+}
+
+type accessTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenRepository(db *gorm.DB) AccessTokenRepository {
+	return &accessTokenRepository{db: db}
+}
+
+func (r *accessTokenRepository) Create(token *model.PersonalAccessToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *accessTokenRepository) FindByHash(tokenHash string) (*model.PersonalAccessToken, error) {
+	var token model.PersonalAccessToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *accessTokenRepository) FindByUserID(userID string) ([]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke revokes one of the user's tokens and reports whether it existed
+func (r *accessTokenRepository) Revoke(id, userID string) (bool, error) {
+	result := r.db.Model(&model.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *accessTokenRepository) RevokeAllByUserID(userID string) error {
+	return r.db.Model(&model.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *accessTokenRepository) TouchLastUsed(id, ipAddress string) error {
+	return r.db.Model(&model.PersonalAccessToken{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_used_at": time.Now(),
+			"last_used_ip": ipAddress,
+		}).Error
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ParticipationRecord is one room a user has joined, for their data export
+type ParticipationRecord struct {
+	RoomID   string     `json:"room_id"`
+	RoomName string     `json:"room_name"`
+	JoinedAt time.Time  `json:"joined_at"`
+	LeftAt   *time.Time `json:"left_at,omitempty"`
+	IsActive bool       `json:"is_active"`
+}
+
+// MessageRecord is one chat message a user has sent, for their data export
+type MessageRecord struct {
+	ID        string    `json:"id"`
+	RoomID    string    `json:"room_id"`
+	RoomName  string    `json:"room_name"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountRepository covers personal data exports and permanent account deletion
+type AccountRepository interface {
+	CreateExport(export *model.DataExport) error
+	UpdateExport(export *model.DataExport) error
+	FindExportByID(id string) (*model.DataExport, error)
+	FindExportByTokenHash(tokenHash string) (*model.DataExport, error)
+	FindLatestExport(userID string) (*model.DataExport, error)
+	FindExportsByStatus(status string) ([]model.DataExport, error)
+	FindExpiredExports(now time.Time) ([]model.DataExport, error)
+	FindExportsByUserID(userID string) ([]model.DataExport, error)
+	FindRoomsCreatedBy(userID string) ([]model.Room, error)
+	FindParticipation(userID string) ([]ParticipationRecord, error)
+	FindMessagesByUser(userID string) ([]MessageRecord, error)
+	FindUsersDueForDeletion(now time.Time, limit int) ([]model.User, error)
+	EnsureDeletedUser() error
+	PurgeUser(userID string) error
+}
+
+type accountRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountRepository(db *gorm.DB) AccountRepository {
+	return &accountRepository{db: db}
+}
+
+func (r *accountRepository) CreateExport(export *model.DataExport) error {
+	return r.db.Create(export).Error
+}
+
+func (r *accountRepository) UpdateExport(export *model.DataExport) error {
+	return r.db.Save(export).Error
+}
+
+func (r *accountRepository) FindExportByID(id string) (*model.DataExport, error) {
+	var export model.DataExport
+	err := r.db.Where("id = ?", id).First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *accountRepository) FindExportByTokenHash(tokenHash string) (*model.DataExport, error) {
+	var export model.DataExport
+	err := r.db.Where("token_hash = ?", tokenHash).First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *accountRepository) FindLatestExport(userID string) (*model.DataExport, error) {
+	var export model.DataExport
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *accountRepository) FindExportsByStatus(status string) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := r.db.Where("status = ?", status).Order("created_at").Find(&exports).Error
+	return exports, err
+}
+
+func (r *accountRepository) FindExpiredExports(now time.Time) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := r.db.Where("status = ? AND expires_at < ?", model.ExportStatusReady, now).Find(&exports).Error
+	return exports, err
+}
+
+func (r *accountRepository) FindExportsByUserID(userID string) ([]model.DataExport, error) {
+	var exports []model.DataExport
+	err := r.db.Where("user_id = ?", userID).Find(&exports).Error
+	return exports, err
+}
+
+func (r *accountRepository) FindRoomsCreatedBy(userID string) ([]model.Room, error) {
+	var rooms []model.Room
+	err := r.db.Unscoped().Where("created_by_id = ?", userID).Order("created_at").Find(&rooms).Error
+	return rooms, err
+}
+
+func (r *accountRepository) FindParticipation(userID string) ([]ParticipationRecord, error) {
+	var records []ParticipationRecord
+	err := r.db.Table("room_participants").
+		Select("room_participants.room_id, rooms.name AS room_name, room_participants.joined_at, room_participants.left_at, room_participants.is_active").
+		Joins("LEFT JOIN rooms ON rooms.id = room_participants.room_id").
+		Where("room_participants.user_id = ?", userID).
+		Order("room_participants.joined_at").
+		Scan(&records).Error
+	return records, err
+}
+
+func (r *accountRepository) FindMessagesByUser(userID string) ([]MessageRecord, error) {
+	var records []MessageRecord
+	err := r.db.Table("chat_messages").
+		Select("chat_messages.id, chat_messages.room_id, rooms.name AS room_name, chat_messages.message, chat_messages.created_at").
+		Joins("LEFT JOIN rooms ON rooms.id = chat_messages.room_id").
+		Where("chat_messages.user_id = ?", userID).
+		Order("chat_messages.created_at").
+		Scan(&records).Error
+	return records, err
+}
+
+func (r *accountRepository) FindUsersDueForDeletion(now time.Time, limit int) ([]model.User, error) {
+	var users []model.User
+	err := r.db.Unscoped().
+		Where("deletion_due_at IS NOT NULL AND deletion_due_at <= ? AND id <> ?", now, model.DeletedUserID).
+		Order("deletion_due_at").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// EnsureDeletedUser creates the placeholder account deleted users' content is moved to
+func (r *accountRepository) EnsureDeletedUser() error {
+	placeholder := model.User{
+		ID:        model.DeletedUserID,
+		Email:     "deleted-user@invalid",
+		FullName:  "Deleted user",
+		LoginType: "deleted",
+	}
+	if err := r.db.Unscoped().Where("id = ?", placeholder.ID).FirstOrCreate(&placeholder).Error; err != nil {
+		return err
+	}
+	// is_active has a database default, so it cannot be set to false on create
+	return r.db.Model(&model.User{}).Where("id = ?", placeholder.ID).Update("is_active", false).Error
+}
+
+// PurgeUser hands the user's messages and rooms to the placeholder account,
+// pseudonymizes their audit events, then hard-deletes the user row and
+// everything else that belongs to it
+func (r *accountRepository) PurgeUser(userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := pseudonymizeAuditEvents(tx, userID); err != nil {
+			return err
+		}
+
+		reassign := []struct {
+			table  string
+			column string
+		}{
+			{"chat_messages", "user_id"},
+			{"rooms", "created_by_id"},
+			{"retention_policies", "updated_by_id"},
+			{"organizations", "created_by_id"},
+			{"organization_invitations", "invited_by_id"},
+		}
+		for _, ref := range reassign {
+			err := tx.Table(ref.table).Where(ref.column+" = ?", userID).Update(ref.column, model.DeletedUserID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.Where("session_id IN (?)", tx.Model(&model.Session{}).Select("id").Where("user_id = ?", userID)).
+			Delete(&model.RefreshToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		owned := []interface{}{
+			&model.Session{},
+			&model.MFARecoveryCode{},
+			&model.PasskeyCredential{},
+			&model.UserIdentity{},
+			&model.OneTimeCode{},
+			&model.DataExport{},
+			&model.PersonalAccessToken{},
+			&model.RoomParticipant{},
+			&model.OrganizationMember{},
+		}
+		for _, table := range owned {
+			if err := tx.Where("user_id = ?", userID).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Where("id = ?", userID).Delete(&model.User{}).Error
+	})
+}
+
+// pseudonymizeAuditEvents keeps the user's audit events but moves them to the
+// placeholder account and removes their email, name, IP address and user
+// agent. The audit_events trigger only allows this while
+// app.audit_pseudonymize is set, which SET LOCAL limits to this transaction.
+func pseudonymizeAuditEvents(tx *gorm.DB, userID string) error {
+	var user model.User
+	if err := tx.Unscoped().Select("id", "email").Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Exec("SET LOCAL app.audit_pseudonymize = 'on'").Error; err != nil {
+		return err
+	}
+
+	// Failed logins with an unknown account have no actor but carry the email.
+	// The IP address of events the user was only the target of belongs to
+	// whoever acted, so it stays.
+	return tx.Exec(`UPDATE audit_events SET
+			actor_id = CASE WHEN actor_id = @user THEN @deleted ELSE actor_id END,
+			target_id = CASE WHEN target_type = @target AND target_id = @user THEN @deleted ELSE target_id END,
+			ip_address = CASE WHEN actor_id = @user OR (actor_id IS NULL AND lower(metadata->>'email') = @email) THEN '' ELSE ip_address END,
+			user_agent = CASE WHEN actor_id = @user OR (actor_id IS NULL AND lower(metadata->>'email') = @email) THEN '' ELSE user_agent END,
+			metadata = metadata - 'email' - 'full_name'
+		WHERE actor_id = @user
+			OR (target_type = @target AND target_id = @user)
+			OR lower(metadata->>'email') = @email`,
+		map[string]interface{}{
+			"user":    userID,
+			"deleted": model.DeletedUserID,
+			"target":  model.AuditTargetUser,
+			"email":   strings.ToLower(user.Email),
+		}).Error
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// AuditFilter narrows an audit log query. Zero values match everything.
+type AuditFilter struct {
+	ActorID  string
+	Action   string // exact action, or a prefix ending in "." such as "auth."
+	TargetID string
+	IP       string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	Offset   int
+}
+
+// AuditRepository appends to and reads the audit log. There is deliberately
+// no way to update or delete events.
+type AuditRepository interface {
+	Create(event *model.AuditEvent) error
+	Search(filter AuditFilter) ([]model.AuditEvent, int64, error)
+	Each(filter AuditFilter, batchSize int, fn func([]model.AuditEvent) error) error
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(event *model.AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+// Search returns one page of matching events, newest first, with the total number of matches
+func (r *auditRepository) Search(filter AuditFilter) ([]model.AuditEvent, int64, error) {
+	query := r.filtered(filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []model.AuditEvent
+	err := query.Order("created_at DESC, id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&events).Error
+	return events, total, err
+}
+
+// Each walks every matching event, newest first, in batches so exports never load the whole log
+func (r *auditRepository) Each(filter AuditFilter, batchSize int, fn func([]model.AuditEvent) error) error {
+	var before *model.AuditEvent
+	for {
+		query := r.filtered(filter)
+		if before != nil {
+			query = query.Where("(created_at, id) < (?, ?)", before.CreatedAt, before.ID)
+		}
+
+		var events []model.AuditEvent
+		if err := query.Order("created_at DESC, id DESC").Limit(batchSize).Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		if err := fn(events); err != nil {
+			return err
+		}
+		if len(events) < batchSize {
+			return nil
+		}
+		before = &events[len(events)-1]
+	}
+}
+
+func (r *auditRepository) filtered(filter AuditFilter) *gorm.DB {
+	query := r.db.Model(&model.AuditEvent{})
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		if filter.Action[len(filter.Action)-1] == '.' {
+			query = query.Where("action LIKE ?", filter.Action+"%")
+		} else {
+			query = query.Where("action = ?", filter.Action)
+		}
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip_address = ?", filter.IP)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
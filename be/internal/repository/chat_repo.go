@@ -11,6 +11,7 @@ type ChatRepository interface {
 	FindByRoomID(roomID string, limit, offset int) ([]model.ChatMessage, error)
 	FindByID(id string) (*model.ChatMessage, error)
 	GetMessageCount(roomID string) (int64, error)
+	Delete(id string) error
 }
 
 type chatRepository struct {
@@ -63,3 +64,6 @@ func (r *chatRepository) GetMessageCount(roomID string) (int64, error) {
 	return count, err
 }
 
+func (r *chatRepository) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(&model.ChatMessage{}).Error
+}
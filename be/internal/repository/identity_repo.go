@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type IdentityRepository interface {
+	Create(identity *model.UserIdentity) error
+	FindByProviderSubject(provider, subject string) (*model.UserIdentity, error)
+	FindByUserID(userID string) ([]model.UserIdentity, error)
+	FindByUserAndProvider(userID, provider string) (*model.UserIdentity, error)
+	TouchLogin(id string) error
+	Delete(id, userID string) (bool, error)
+	CountByUserID(userID string) (int64, error)
+}
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) Create(identity *model.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *identityRepository) FindByProviderSubject(provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) FindByUserID(userID string) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+func (r *identityRepository) FindByUserAndProvider(userID, provider string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := r.db.Where("user_id = ? AND provider = ?", userID, provider).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *identityRepository) TouchLogin(id string) error {
+	return r.db.Model(&model.UserIdentity{}).
+		Where("id = ?", id).
+		Update("last_login_at", time.Now()).Error
+}
+
+// Delete removes an identity owned by the user. It returns false if none matched.
+func (r *identityRepository) Delete(id, userID string) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.UserIdentity{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *identityRepository) CountByUserID(userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.UserIdentity{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type MFARepository interface {
+	UpdateSecret(userID string, secret *string, enabled bool) error
+	UpdateLastStep(userID string, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID string, codeHashes []string) error
+	UseRecoveryCode(userID string, codeHash string) (bool, error)
+	DeleteRecoveryCodes(userID string) error
+}
+
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) MFARepository {
+	return &mfaRepository{db: db}
+}
+
+func (r *mfaRepository) UpdateSecret(userID string, secret *string, enabled bool) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"mfa_secret":    secret,
+			"mfa_enabled":   enabled,
+			"mfa_last_step": 0,
+		}).Error
+}
+
+// UpdateLastStep records the accepted TOTP step. It returns false if the step
+// (or a later one) was already used, so the same code cannot be replayed.
+func (r *mfaRepository) UpdateLastStep(userID string, step int64) (bool, error) {
+	result := r.db.Model(&model.User{}).
+		Where("id = ? AND mfa_last_step < ?", userID, step).
+		Update("mfa_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]model.MFARecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = model.MFARecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marks a matching unused recovery code as used
+func (r *mfaRepository) UseRecoveryCode(userID string, codeHash string) (bool, error) {
+	result := r.db.Model(&model.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *mfaRepository) DeleteRecoveryCodes(userID string) error {
+	return r.db.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error
+}
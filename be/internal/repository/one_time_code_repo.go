@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type OneTimeCodeRepository interface {
+	Replace(code *model.OneTimeCode) error
+	FindActive(userID, purpose string) (*model.OneTimeCode, error)
+	IncrementAttempts(id string) error
+	Consume(id string) (bool, error)
+}
+
+type oneTimeCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewOneTimeCodeRepository(db *gorm.DB) OneTimeCodeRepository {
+	return &oneTimeCodeRepository{db: db}
+}
+
+// Replace invalidates the user's unused codes of the same purpose and stores the new one
+func (r *oneTimeCodeRepository) Replace(code *model.OneTimeCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.OneTimeCode{}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", code.UserID, code.Purpose).
+			Update("consumed_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(code).Error
+	})
+}
+
+func (r *oneTimeCodeRepository) FindActive(userID, purpose string) (*model.OneTimeCode, error) {
+	var code model.OneTimeCode
+	err := r.db.Where("user_id = ? AND purpose = ? AND consumed_at IS NULL AND expires_at > ?", userID, purpose, time.Now()).
+		Order("created_at DESC").
+		First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r *oneTimeCodeRepository) IncrementAttempts(id string) error {
+	return r.db.Model(&model.OneTimeCode{}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+// Consume atomically marks a code as used. It returns false if it was already used.
+func (r *oneTimeCodeRepository) Consume(id string) (bool, error) {
+	result := r.db.Model(&model.OneTimeCode{}).
+		Where("id = ? AND consumed_at IS NULL", id).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MembershipRecord is an organization the user belongs to, with their role in it
+type MembershipRecord struct {
+	model.Organization
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// MemberFilter narrows an organization's member list for SCIM queries
+type MemberFilter struct {
+	Email      string
+	ExternalID string
+	Role       string
+	Limit      int
+	Offset     int
+}
+
+type OrganizationRepository interface {
+	CreateWithOwner(org *model.Organization, ownerID string) error
+	FindByID(id string) (*model.Organization, error)
+	FindBySlug(slug string) (*model.Organization, error)
+	FindByDomain(domain string) (*model.Organization, error)
+	Update(org *model.Organization) error
+	FindBySCIMTokenHash(tokenHash string) (*model.Organization, error)
+	SetSCIMToken(orgID string, tokenHash *string) error
+	FindMemberships(userID string) ([]MembershipRecord, error)
+	FindOrganizationIDs(userID string) ([]string, error)
+	FindMember(orgID, userID string) (*model.OrganizationMember, error)
+	FindMembers(orgID string) ([]model.OrganizationMember, error)
+	SearchMembers(orgID string, filter MemberFilter) ([]model.OrganizationMember, int64, error)
+	AddMember(member *model.OrganizationMember) (bool, error)
+	UpdateMember(member *model.OrganizationMember) error
+	UpdateMemberRole(orgID, userID, role string) error
+	RemoveMember(orgID, userID string) error
+	CountOwners(orgID string) (int64, error)
+	CreateInvitation(invitation *model.OrganizationInvitation) error
+	FindInvitationByID(id string) (*model.OrganizationInvitation, error)
+	FindInvitationByTokenHash(tokenHash string) (*model.OrganizationInvitation, error)
+	FindPendingInvitations(orgID string) ([]model.OrganizationInvitation, error)
+	AcceptInvitation(invitation *model.OrganizationInvitation, userID string) error
+	DeleteInvitation(id string) error
+}
+
+type organizationRepository struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+// CreateWithOwner creates the organization and makes ownerID its first owner
+func (r *organizationRepository) CreateWithOwner(org *model.Organization, ownerID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.OrganizationMember{
+			OrganizationID: org.ID,
+			UserID:         ownerID,
+			Role:           model.OrgRoleOwner,
+		}).Error
+	})
+}
+
+func (r *organizationRepository) FindByID(id string) (*model.Organization, error) {
+	var org model.Organization
+	err := r.db.Where("id = ?", id).First(&org).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) FindBySlug(slug string) (*model.Organization, error) {
+	var org model.Organization
+	err := r.db.Where("slug = ?", slug).First(&org).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) FindByDomain(domain string) (*model.Organization, error) {
+	var org model.Organization
+	err := r.db.Where("domain = ?", domain).First(&org).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *organizationRepository) Update(org *model.Organization) error {
+	return r.db.Model(org).Select("name", "domain", "domain_verification_record", "domain_verified_at").Updates(org).Error
+}
+
+func (r *organizationRepository) FindBySCIMTokenHash(tokenHash string) (*model.Organization, error) {
+	var org model.Organization
+	err := r.db.Where("scim_token_hash = ?", tokenHash).First(&org).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// SetSCIMToken replaces the organization's SCIM token; nil turns provisioning off
+func (r *organizationRepository) SetSCIMToken(orgID string, tokenHash *string) error {
+	var createdAt *time.Time
+	if tokenHash != nil {
+		now := time.Now()
+		createdAt = &now
+	}
+	return r.db.Model(&model.Organization{}).Where("id = ?", orgID).Updates(map[string]interface{}{
+		"scim_token_hash":       tokenHash,
+		"scim_token_created_at": createdAt,
+	}).Error
+}
+
+func (r *organizationRepository) FindMemberships(userID string) ([]MembershipRecord, error) {
+	var records []MembershipRecord
+	err := r.db.Table("organizations").
+		Select("organizations.*, organization_members.role, organization_members.joined_at").
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", userID).
+		Order("organizations.name").
+		Scan(&records).Error
+	return records, err
+}
+
+func (r *organizationRepository) FindOrganizationIDs(userID string) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&model.OrganizationMember{}).
+		Where("user_id = ?", userID).
+		Pluck("organization_id", &ids).Error
+	return ids, err
+}
+
+func (r *organizationRepository) FindMember(orgID, userID string) (*model.OrganizationMember, error) {
+	var member model.OrganizationMember
+	err := r.db.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *organizationRepository) FindMembers(orgID string) ([]model.OrganizationMember, error) {
+	var members []model.OrganizationMember
+	err := r.db.Preload("User").Where("organization_id = ?", orgID).Order("joined_at").Find(&members).Error
+	return members, err
+}
+
+func (r *organizationRepository) SearchMembers(orgID string, filter MemberFilter) ([]model.OrganizationMember, int64, error) {
+	query := r.db.Model(&model.OrganizationMember{}).Where("organization_members.organization_id = ?", orgID)
+	if filter.Email != "" {
+		query = query.Joins("JOIN users ON users.id = organization_members.user_id").
+			Where("LOWER(users.email) = ?", strings.ToLower(filter.Email))
+	}
+	if filter.ExternalID != "" {
+		query = query.Where("organization_members.external_id = ?", filter.ExternalID)
+	}
+	if filter.Role != "" {
+		query = query.Where("organization_members.role = ?", filter.Role)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var members []model.OrganizationMember
+	err := query.Preload("User").Order("organization_members.joined_at").Limit(filter.Limit).Offset(filter.Offset).Find(&members).Error
+	return members, total, err
+}
+
+// AddMember adds the user unless they are already a member and reports whether they were added
+func (r *organizationRepository) AddMember(member *model.OrganizationMember) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(member)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateMember saves the member's role and provisioning fields
+func (r *organizationRepository) UpdateMember(member *model.OrganizationMember) error {
+	return r.db.Model(&model.OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", member.OrganizationID, member.UserID).
+		Updates(map[string]interface{}{
+			"role":        member.Role,
+			"external_id": member.ExternalID,
+			"managed":     member.Managed,
+			"provisioned": member.Provisioned,
+		}).Error
+}
+
+func (r *organizationRepository) UpdateMemberRole(orgID, userID, role string) error {
+	return r.db.Model(&model.OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Update("role", role).Error
+}
+
+func (r *organizationRepository) RemoveMember(orgID, userID string) error {
+	return r.db.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&model.OrganizationMember{}).Error
+}
+
+func (r *organizationRepository) CountOwners(orgID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.OrganizationMember{}).
+		Where("organization_id = ? AND role = ?", orgID, model.OrgRoleOwner).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *organizationRepository) CreateInvitation(invitation *model.OrganizationInvitation) error {
+	return r.db.Create(invitation).Error
+}
+
+func (r *organizationRepository) FindInvitationByID(id string) (*model.OrganizationInvitation, error) {
+	var invitation model.OrganizationInvitation
+	err := r.db.Where("id = ?", id).First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *organizationRepository) FindInvitationByTokenHash(tokenHash string) (*model.OrganizationInvitation, error) {
+	var invitation model.OrganizationInvitation
+	err := r.db.Where("token_hash = ?", tokenHash).First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *organizationRepository) FindPendingInvitations(orgID string) ([]model.OrganizationInvitation, error) {
+	var invitations []model.OrganizationInvitation
+	err := r.db.Where("organization_id = ? AND accepted_at IS NULL AND expires_at > ?", orgID, time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+// AcceptInvitation marks the invitation used and adds the user with the invited role
+func (r *organizationRepository) AcceptInvitation(invitation *model.OrganizationInvitation, userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&model.OrganizationInvitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		invitation.AcceptedAt = &now
+
+		// Existing members keep their current role
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.OrganizationMember{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         userID,
+			Role:           invitation.Role,
+		}).Error
+	})
+}
+
+func (r *organizationRepository) DeleteInvitation(id string) error {
+	return r.db.Where("id = ?", id).Delete(&model.OrganizationInvitation{}).Error
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type PasskeyRepository interface {
+	Create(credential *model.PasskeyCredential) error
+	FindByCredentialID(credentialID string) (*model.PasskeyCredential, error)
+	FindByUserID(userID string) ([]model.PasskeyCredential, error)
+	UpdateSignCount(id string, signCount int64) error
+	Delete(id, userID string) (bool, error)
+	CountByUserID(userID string) (int64, error)
+}
+
+type passkeyRepository struct {
+	db *gorm.DB
+}
+
+func NewPasskeyRepository(db *gorm.DB) PasskeyRepository {
+	return &passkeyRepository{db: db}
+}
+
+func (r *passkeyRepository) Create(credential *model.PasskeyCredential) error {
+	return r.db.Create(credential).Error
+}
+
+func (r *passkeyRepository) FindByCredentialID(credentialID string) (*model.PasskeyCredential, error) {
+	var credential model.PasskeyCredential
+	err := r.db.Where("credential_id = ?", credentialID).First(&credential).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *passkeyRepository) FindByUserID(userID string) ([]model.PasskeyCredential, error) {
+	var credentials []model.PasskeyCredential
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *passkeyRepository) UpdateSignCount(id string, signCount int64) error {
+	return r.db.Model(&model.PasskeyCredential{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"sign_count":   signCount,
+			"last_used_at": time.Now(),
+		}).Error
+}
+
+func (r *passkeyRepository) Delete(id, userID string) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.PasskeyCredential{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *passkeyRepository) CountByUserID(userID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.PasskeyCredential{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"time"
+
+	"yourapp/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RetentionRepository interface {
+	FindAllPolicies() ([]model.RetentionPolicy, error)
+	FindPolicyByID(id string) (*model.RetentionPolicy, error)
+	FindGlobalPolicy() (*model.RetentionPolicy, error)
+	FindPolicyByRoomID(roomID string) (*model.RetentionPolicy, error)
+	SavePolicy(policy *model.RetentionPolicy) error
+	DeletePolicy(id string) error
+	PurgeRoomMessages(roomID string, before time.Time, limit int) ([]model.ChatMessage, error)
+	PurgeUnscopedMessages(before time.Time, limit int) ([]model.ChatMessage, error)
+	CreatePurgeLog(log *model.RetentionPurgeLog) error
+	FindPurgeLogs(limit, offset int) ([]model.RetentionPurgeLog, error)
+}
+
+type retentionRepository struct {
+	db *gorm.DB
+}
+
+func NewRetentionRepository(db *gorm.DB) RetentionRepository {
+	return &retentionRepository{db: db}
+}
+
+func (r *retentionRepository) FindAllPolicies() ([]model.RetentionPolicy, error) {
+	var policies []model.RetentionPolicy
+	err := r.db.Order("room_id NULLS FIRST, created_at").Find(&policies).Error
+	return policies, err
+}
+
+func (r *retentionRepository) FindPolicyByID(id string) (*model.RetentionPolicy, error) {
+	var policy model.RetentionPolicy
+	err := r.db.Where("id = ?", id).First(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *retentionRepository) FindGlobalPolicy() (*model.RetentionPolicy, error) {
+	var policy model.RetentionPolicy
+	err := r.db.Where("room_id IS NULL").First(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *retentionRepository) FindPolicyByRoomID(roomID string) (*model.RetentionPolicy, error) {
+	var policy model.RetentionPolicy
+	err := r.db.Where("room_id = ?", roomID).First(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *retentionRepository) SavePolicy(policy *model.RetentionPolicy) error {
+	return r.db.Save(policy).Error
+}
+
+func (r *retentionRepository) DeletePolicy(id string) error {
+	return r.db.Where("id = ?", id).Delete(&model.RetentionPolicy{}).Error
+}
+
+// PurgeRoomMessages deletes up to limit messages of a room created before the cutoff
+// and returns the deleted rows
+func (r *retentionRepository) PurgeRoomMessages(roomID string, before time.Time, limit int) ([]model.ChatMessage, error) {
+	batch := r.db.Model(&model.ChatMessage{}).
+		Select("id").
+		Where("room_id = ? AND created_at < ?", roomID, before).
+		Order("created_at").
+		Limit(limit)
+
+	return r.deleteReturning(batch)
+}
+
+// PurgeUnscopedMessages deletes up to limit messages created before the cutoff in rooms
+// that have no room-level policy of their own (those are governed by the global policy)
+func (r *retentionRepository) PurgeUnscopedMessages(before time.Time, limit int) ([]model.ChatMessage, error) {
+	scoped := r.db.Model(&model.RetentionPolicy{}).
+		Select("room_id").
+		Where("room_id IS NOT NULL")
+
+	batch := r.db.Model(&model.ChatMessage{}).
+		Select("id").
+		Where("created_at < ? AND room_id NOT IN (?)", before, scoped).
+		Order("created_at").
+		Limit(limit)
+
+	return r.deleteReturning(batch)
+}
+
+func (r *retentionRepository) deleteReturning(batch *gorm.DB) ([]model.ChatMessage, error) {
+	var deleted []model.ChatMessage
+	err := r.db.Clauses(clause.Returning{Columns: []clause.Column{
+		{Name: "id"}, {Name: "room_id"}, {Name: "created_at"},
+	}}).
+		Where("id IN (?)", batch).
+		Delete(&deleted).Error
+	return deleted, err
+}
+
+func (r *retentionRepository) CreatePurgeLog(log *model.RetentionPurgeLog) error {
+	return r.db.Create(log).Error
+}
+
+func (r *retentionRepository) FindPurgeLogs(limit, offset int) ([]model.RetentionPurgeLog, error) {
+	var logs []model.RetentionPurgeLog
+	err := r.db.Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&logs).Error
+	return logs, err
+}
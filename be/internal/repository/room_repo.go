@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"strings"
 	"time"
 	"yourapp/internal/model"
 
@@ -13,12 +14,34 @@ type RoomRepository interface {
 	FindByIDWithParticipants(id string) (*model.Room, error)
 	FindByCreatedBy(userID string) ([]model.Room, error)
 	FindAll() ([]model.Room, error)
+	FindVisible(userID string, orgIDs []string, query string) ([]model.Room, error)
 	Update(room *model.Room) error
 	Delete(id string) error
 	AddParticipant(roomID, userID string) error
 	RemoveParticipant(roomID, userID string) error
 	IsParticipant(roomID, userID string) (bool, error)
+	FindJoinedRoomIDs(userID string) ([]string, error)
 	GetParticipantCount(roomID string) (int64, error)
+	FindParticipants(roomID string) ([]RoomParticipantRecord, error)
+	Close(roomID string) error
+	CreateGuest(guest *model.RoomGuest) error
+	FindGuest(roomID, guestID string) (*model.RoomGuest, error)
+	FindGuestByTokenHash(tokenHash string) (*model.RoomGuest, error)
+	FindActiveGuests(roomID string) ([]model.RoomGuest, error)
+	RemoveGuest(guestID string) error
+	RemoveGuests(roomID string) error
+}
+
+// RoomParticipantRecord is one user or guest who has joined a room, for moderators
+type RoomParticipantRecord struct {
+	UserID   string     `json:"user_id"`
+	FullName string     `json:"full_name"`
+	Email    string     `json:"email"`
+	Username *string    `json:"username,omitempty"`
+	JoinedAt time.Time  `json:"joined_at"`
+	LeftAt   *time.Time `json:"left_at,omitempty"`
+	IsActive bool       `json:"is_active"`
+	IsGuest  bool       `json:"is_guest"` // UserID is then the guest ID
 }
 
 type roomRepository struct {
@@ -63,6 +86,31 @@ func (r *roomRepository) FindAll() ([]model.Room, error) {
 	return rooms, err
 }
 
+// FindVisible lists rooms of the given organizations plus, if userID is set,
+// the user's own personal rooms, optionally filtered by a name search
+func (r *roomRepository) FindVisible(userID string, orgIDs []string, query string) ([]model.Room, error) {
+	if userID == "" && len(orgIDs) == 0 {
+		return []model.Room{}, nil
+	}
+
+	scope := r.db
+	if userID != "" {
+		scope = scope.Or("organization_id IS NULL AND created_by_id = ?", userID)
+	}
+	if len(orgIDs) > 0 {
+		scope = scope.Or("organization_id IN ?", orgIDs)
+	}
+
+	db := r.db.Preload("CreatedBy").Where(scope)
+	if query != "" {
+		db = db.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(query)+"%")
+	}
+
+	var rooms []model.Room
+	err := db.Order("created_at DESC").Find(&rooms).Error
+	return rooms, err
+}
+
 func (r *roomRepository) Update(room *model.Room) error {
 	return r.db.Save(room).Error
 }
@@ -111,10 +159,130 @@ func (r *roomRepository) IsParticipant(roomID, userID string) (bool, error) {
 	return count > 0, err
 }
 
+// FindJoinedRoomIDs returns the rooms the user is currently in
+func (r *roomRepository) FindJoinedRoomIDs(userID string) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&model.RoomParticipant{}).
+		Where("user_id = ? AND is_active = ?", userID, true).
+		Pluck("room_id", &ids).Error
+	return ids, err
+}
+
+// GetParticipantCount counts the users and unexpired guests currently in the room
 func (r *roomRepository) GetParticipantCount(roomID string) (int64, error) {
 	var count int64
 	err := r.db.Model(&model.RoomParticipant{}).
 		Where("room_id = ? AND is_active = ?", roomID, true).
 		Count(&count).Error
-	return count, err
+	if err != nil {
+		return 0, err
+	}
+
+	var guests int64
+	err = r.activeGuests(roomID).Count(&guests).Error
+	return count + guests, err
+}
+
+// FindParticipants lists everyone who has joined the room, users and guests,
+// current participants first
+func (r *roomRepository) FindParticipants(roomID string) ([]RoomParticipantRecord, error) {
+	var records []RoomParticipantRecord
+	err := r.db.Raw(`
+SELECT room_participants.user_id, users.full_name, users.email, users.username,
+       room_participants.joined_at, room_participants.left_at, room_participants.is_active, false AS is_guest
+FROM room_participants
+LEFT JOIN users ON users.id = room_participants.user_id
+WHERE room_participants.room_id = ?
+UNION ALL
+SELECT room_guests.id, room_guests.display_name, '', NULL,
+       room_guests.joined_at, room_guests.left_at, room_guests.is_active AND room_guests.expires_at > ?, true
+FROM room_guests
+WHERE room_guests.room_id = ?
+ORDER BY is_active DESC, joined_at`, roomID, time.Now(), roomID).
+		Scan(&records).Error
+	return records, err
+}
+
+// Close deactivates the room and marks every current participant as having left
+func (r *roomRepository) Close(roomID string) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.Room{}).Where("id = ?", roomID).Update("is_active", false).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&model.RoomParticipant{}).
+			Where("room_id = ? AND is_active = ?", roomID, true).
+			Updates(map[string]interface{}{
+				"is_active": false,
+				"left_at":   &now,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&model.RoomGuest{}).
+			Where("room_id = ? AND is_active = ?", roomID, true).
+			Updates(map[string]interface{}{
+				"is_active": false,
+				"left_at":   &now,
+			}).Error
+	})
+}
+
+func (r *roomRepository) CreateGuest(guest *model.RoomGuest) error {
+	return r.db.Create(guest).Error
+}
+
+func (r *roomRepository) FindGuest(roomID, guestID string) (*model.RoomGuest, error) {
+	var guest model.RoomGuest
+	err := r.db.Where("room_id = ? AND id = ?", roomID, guestID).First(&guest).Error
+	if err != nil {
+		return nil, err
+	}
+	return &guest, nil
+}
+
+// FindGuestByTokenHash finds an unexpired guest still in the room by the hash of their guest token
+func (r *roomRepository) FindGuestByTokenHash(tokenHash string) (*model.RoomGuest, error) {
+	var guest model.RoomGuest
+	err := r.db.Where("token_hash = ? AND is_active = ? AND expires_at > ?", tokenHash, true, time.Now()).
+		First(&guest).Error
+	if err != nil {
+		return nil, err
+	}
+	return &guest, nil
+}
+
+// FindActiveGuests lists the unexpired guests currently in the room
+func (r *roomRepository) FindActiveGuests(roomID string) ([]model.RoomGuest, error) {
+	var guests []model.RoomGuest
+	err := r.activeGuests(roomID).Order("joined_at").Find(&guests).Error
+	return guests, err
+}
+
+func (r *roomRepository) RemoveGuest(guestID string) error {
+	now := time.Now()
+	return r.db.Model(&model.RoomGuest{}).
+		Where("id = ?", guestID).
+		Updates(map[string]interface{}{
+			"is_active": false,
+			"left_at":   &now,
+		}).Error
+}
+
+// RemoveGuests marks every guest still in the room as having left
+func (r *roomRepository) RemoveGuests(roomID string) error {
+	now := time.Now()
+	return r.db.Model(&model.RoomGuest{}).
+		Where("room_id = ? AND is_active = ?", roomID, true).
+		Updates(map[string]interface{}{
+			"is_active": false,
+			"left_at":   &now,
+		}).Error
+}
+
+// activeGuests scopes to the room's guests that have not left and whose identity has not expired
+func (r *roomRepository) activeGuests(roomID string) *gorm.DB {
+	return r.db.Model(&model.RoomGuest{}).
+		Where("room_id = ? AND is_active = ? AND expires_at > ?", roomID, true, time.Now())
 }
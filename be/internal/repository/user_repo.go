@@ -2,6 +2,7 @@ package repository
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"yourapp/internal/model"
@@ -14,14 +15,23 @@ type UserRepository interface {
 	FindByID(id string) (*model.User, error)
 	FindByEmail(email string) (*model.User, error)
 	FindByUsername(username string) (*model.User, error)
-	FindByGoogleID(googleID string) (*model.User, error)
 	Update(user *model.User) error
-	UpdateOTP(email string, otpCode string, expiresAt time.Time) error
-	VerifyOTP(email string, otpCode string) (*model.User, error)
+	UpdateFields(userID string, fields map[string]interface{}) error
+	MarkVerified(userID string) error
 	UpdateResetToken(email string, token string, expiresAt time.Time) error
 	FindByResetToken(token string) (*model.User, error)
 	UpdatePassword(userID string, passwordHash string) error
 	UpdateLastLogin(userID string) error
+	Search(filter UserFilter) ([]model.User, int64, error)
+}
+
+// UserFilter narrows the admin user list. Query matches email, username or name.
+type UserFilter struct {
+	Query    string
+	Role     string
+	IsActive *bool
+	Limit    int
+	Offset   int
 }
 
 type userRepository struct {
@@ -63,45 +73,21 @@ func (r *userRepository) FindByUsername(username string) (*model.User, error) {
 	return &user, nil
 }
 
-func (r *userRepository) FindByGoogleID(googleID string) (*model.User, error) {
-	var user model.User
-	err := r.db.Where("google_id = ?", googleID).First(&user).Error
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
 func (r *userRepository) Update(user *model.User) error {
 	return r.db.Save(user).Error
 }
 
-func (r *userRepository) UpdateOTP(email string, otpCode string, expiresAt time.Time) error {
+// UpdateFields updates only the given columns, leaving concurrent changes to others intact
+func (r *userRepository) UpdateFields(userID string, fields map[string]interface{}) error {
 	return r.db.Model(&model.User{}).
-		Where("email = ?", email).
-		Updates(map[string]interface{}{
-			"otp_code":       otpCode,
-			"otp_expires_at": expiresAt,
-		}).Error
+		Where("id = ?", userID).
+		Updates(fields).Error
 }
 
-func (r *userRepository) VerifyOTP(email string, otpCode string) (*model.User, error) {
-	var user model.User
-	err := r.db.Where("email = ? AND otp_code = ? AND otp_expires_at > ?", email, otpCode, time.Now()).First(&user).Error
-	if err != nil {
-		return nil, errors.New("invalid or expired OTP")
-	}
-
-	// Clear OTP after verification
-	user.OTPCode = nil
-	user.OTPExpiresAt = nil
-	user.IsVerified = true
-
-	if err := r.db.Save(&user).Error; err != nil {
-		return nil, err
-	}
-
-	return &user, nil
+func (r *userRepository) MarkVerified(userID string) error {
+	return r.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		Update("is_verified", true).Error
 }
 
 func (r *userRepository) UpdateResetToken(email string, token string, expiresAt time.Time) error {
@@ -138,3 +124,27 @@ func (r *userRepository) UpdateLastLogin(userID string) error {
 		Where("id = ?", userID).
 		Update("last_login", now).Error
 }
+
+// Search lists users matching filter, newest first, with the total number of matches
+func (r *userRepository) Search(filter UserFilter) ([]model.User, int64, error) {
+	query := r.db.Model(&model.User{}).Where("id <> ?", model.DeletedUserID)
+	if filter.Query != "" {
+		pattern := "%" + strings.ToLower(filter.Query) + "%"
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(username) LIKE ? OR LOWER(full_name) LIKE ?", pattern, pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("user_type = ?", filter.Role)
+	}
+	if filter.IsActive != nil {
+		query = query.Where("is_active = ?", *filter.IsActive)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []model.User
+	err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&users).Error
+	return users, total, err
+}
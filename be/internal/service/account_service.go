@@ -0,0 +1,351 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/storage"
+	"yourapp/internal/util"
+)
+
+const (
+	exportCooldown     = time.Hour
+	exportQueueSize    = 100
+	accountPurgeBatch  = 100
+	defaultExportTTL   = 48 * time.Hour
+	exportDownloadPath = "/api/v1/auth/exports/download"
+)
+
+// AccountService builds personal data exports and erases accounts whose deletion grace period has ended
+type AccountService interface {
+	RequestExport(userID string) (*model.DataExport, error)
+	ProcessExport(exportID string) error
+	ProcessPendingExports() int
+	ExportQueue() <-chan string
+	OpenExport(token string) (io.ReadCloser, *model.DataExport, error)
+	ExpireExports() (int, error)
+	PurgeDeletedAccounts() (int, error)
+}
+
+type accountService struct {
+	accountRepo  repository.AccountRepository
+	userRepo     repository.UserRepository
+	identityRepo repository.IdentityRepository
+	passkeyRepo  repository.PasskeyRepository
+	sessionRepo  repository.SessionRepository
+	rabbitMQ     *util.RabbitMQClient
+	config       *config.Config
+	files        storage.Storage
+	queue        chan string
+}
+
+func NewAccountService(accountRepo repository.AccountRepository, userRepo repository.UserRepository, identityRepo repository.IdentityRepository, passkeyRepo repository.PasskeyRepository, sessionRepo repository.SessionRepository, rabbitMQ *util.RabbitMQClient, cfg *config.Config) AccountService {
+	return &accountService{
+		accountRepo:  accountRepo,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		passkeyRepo:  passkeyRepo,
+		sessionRepo:  sessionRepo,
+		rabbitMQ:     rabbitMQ,
+		config:       cfg,
+		files:        newFileStorage(cfg),
+		queue:        make(chan string, exportQueueSize),
+	}
+}
+
+// RequestExport queues a new data export for the user
+func (s *accountService) RequestExport(userID string) (*model.DataExport, error) {
+	if s.files == nil {
+		return nil, errors.New("data export is not available")
+	}
+
+	if latest, err := s.accountRepo.FindLatestExport(userID); err == nil {
+		if latest.Status == model.ExportStatusPending || latest.Status == model.ExportStatusProcessing {
+			return nil, errors.New("an export is already being prepared")
+		}
+		if time.Since(latest.CreatedAt) < exportCooldown {
+			return nil, errors.New("please wait before requesting another export")
+		}
+	}
+
+	export := &model.DataExport{
+		UserID: userID,
+		Status: model.ExportStatusPending,
+	}
+	if err := s.accountRepo.CreateExport(export); err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	select {
+	case s.queue <- export.ID:
+	default:
+		// Queue is full; the worker picks pending exports up on its next run
+	}
+
+	return export, nil
+}
+
+// ExportQueue delivers the IDs of newly requested exports to the worker
+func (s *accountService) ExportQueue() <-chan string {
+	return s.queue
+}
+
+// ProcessPendingExports builds exports left pending, e.g. by a restart
+func (s *accountService) ProcessPendingExports() int {
+	exports, err := s.accountRepo.FindExportsByStatus(model.ExportStatusPending)
+	if err != nil {
+		log.Printf("Failed to fetch pending exports: %v", err)
+		return 0
+	}
+
+	processed := 0
+	for _, export := range exports {
+		if err := s.ProcessExport(export.ID); err != nil {
+			log.Printf("Data export %s failed: %v", export.ID, err)
+			continue
+		}
+		processed++
+	}
+	return processed
+}
+
+// ProcessExport builds the archive for one export and emails the download link
+func (s *accountService) ProcessExport(exportID string) error {
+	export, err := s.accountRepo.FindExportByID(exportID)
+	if err != nil {
+		return fmt.Errorf("export not found: %w", err)
+	}
+	if export.Status != model.ExportStatusPending {
+		return nil
+	}
+
+	export.Status = model.ExportStatusProcessing
+	if err := s.accountRepo.UpdateExport(export); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByID(export.UserID)
+	if err != nil {
+		return s.failExport(export, fmt.Errorf("user not found: %w", err))
+	}
+
+	archive, err := s.buildArchive(user)
+	if err != nil {
+		return s.failExport(export, err)
+	}
+
+	key := fmt.Sprintf("exports/%s/%s.zip", user.ID, export.ID)
+	if err := s.files.Put(key, bytes.NewReader(archive), "application/zip"); err != nil {
+		return s.failExport(export, fmt.Errorf("failed to store export: %w", err))
+	}
+
+	token, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return s.failExport(export, err)
+	}
+	tokenHash := util.HashToken(token)
+	now := time.Now()
+	expiresAt := now.Add(s.exportTTL())
+
+	export.Status = model.ExportStatusReady
+	export.FileKey = &key
+	export.TokenHash = &tokenHash
+	export.ExpiresAt = &expiresAt
+	export.CompletedAt = &now
+	if err := s.accountRepo.UpdateExport(export); err != nil {
+		return err
+	}
+
+	s.queueEmail(util.EmailMessage{
+		To:     user.Email,
+		Body:   s.downloadURL(token),
+		Type:   "data_export",
+		Locale: user.Locale,
+	})
+
+	return nil
+}
+
+func (s *accountService) failExport(export *model.DataExport, cause error) error {
+	message := cause.Error()
+	export.Status = model.ExportStatusFailed
+	export.Error = &message
+	if err := s.accountRepo.UpdateExport(export); err != nil {
+		log.Printf("Failed to mark export %s as failed: %v", export.ID, err)
+	}
+	return cause
+}
+
+// buildArchive collects everything stored about the user into a zip of JSON files
+func (s *accountService) buildArchive(user *model.User) ([]byte, error) {
+	identities, err := s.identityRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identities: %w", err)
+	}
+	passkeys, err := s.passkeyRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passkeys: %w", err)
+	}
+	sessions, err := s.sessionRepo.FindActiveByUserID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sessions: %w", err)
+	}
+	rooms, err := s.accountRepo.FindRoomsCreatedBy(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rooms: %w", err)
+	}
+	participation, err := s.accountRepo.FindParticipation(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load participation history: %w", err)
+	}
+	messages, err := s.accountRepo.FindMessagesByUser(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat messages: %w", err)
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", map[string]interface{}{
+			"user":        user,
+			"identities":  identities,
+			"passkeys":    passkeys,
+			"sessions":    sessions,
+			"exported_at": time.Now(),
+		}},
+		{"rooms_created.json", rooms},
+		{"participation_history.json", participation},
+		{"chat_messages.json", messages},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// OpenExport returns the archive for a download token from the export email
+func (s *accountService) OpenExport(token string) (io.ReadCloser, *model.DataExport, error) {
+	export, err := s.accountRepo.FindExportByTokenHash(util.HashToken(token))
+	if err != nil || export.Status != model.ExportStatusReady || export.FileKey == nil {
+		return nil, nil, errors.New("invalid or expired download link")
+	}
+	if export.ExpiresAt != nil && export.ExpiresAt.Before(time.Now()) {
+		return nil, nil, errors.New("invalid or expired download link")
+	}
+
+	file, err := s.files.Open(*export.FileKey)
+	if err != nil {
+		return nil, nil, errors.New("invalid or expired download link")
+	}
+	return file, export, nil
+}
+
+// ExpireExports deletes archives whose download link has expired
+func (s *accountService) ExpireExports() (int, error) {
+	exports, err := s.accountRepo.FindExpiredExports(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range exports {
+		export := &exports[i]
+		if export.FileKey != nil {
+			deleteFiles(s.files, []string{*export.FileKey})
+		}
+		export.Status = model.ExportStatusExpired
+		export.FileKey = nil
+		export.TokenHash = nil
+		if err := s.accountRepo.UpdateExport(export); err != nil {
+			return i, err
+		}
+	}
+	return len(exports), nil
+}
+
+// PurgeDeletedAccounts erases accounts whose deletion grace period has ended.
+// Chat messages and rooms move to the placeholder "Deleted user"; all personal data is removed.
+func (s *accountService) PurgeDeletedAccounts() (int, error) {
+	users, err := s.accountRepo.FindUsersDueForDeletion(time.Now(), accountPurgeBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		exports, err := s.accountRepo.FindExportsByUserID(user.ID)
+		if err != nil {
+			return purged, err
+		}
+		for _, export := range exports {
+			if export.FileKey != nil {
+				deleteFiles(s.files, []string{*export.FileKey})
+			}
+		}
+		if user.ProfilePhoto != nil {
+			deleteStoredAvatar(s.files, user.ID, *user.ProfilePhoto)
+		}
+
+		if err := s.accountRepo.PurgeUser(user.ID); err != nil {
+			return purged, fmt.Errorf("failed to purge account %s: %w", user.ID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *accountService) exportTTL() time.Duration {
+	if s.config != nil && s.config.DataExportTTL > 0 {
+		return s.config.DataExportTTL
+	}
+	return defaultExportTTL
+}
+
+func (s *accountService) downloadURL(token string) string {
+	baseURL := "http://localhost:5000"
+	if s.config != nil {
+		baseURL = strings.TrimSuffix(s.config.PublicURL, "/")
+	}
+	return baseURL + exportDownloadPath + "?token=" + token
+}
+
+// queueEmail publishes an email to RabbitMQ, connecting first if the server started without it
+func (s *accountService) queueEmail(msg util.EmailMessage) {
+	if s.rabbitMQ == nil && s.config != nil {
+		if client, err := util.NewRabbitMQClient(s.config); err == nil {
+			s.rabbitMQ = client
+		}
+	}
+	if s.rabbitMQ == nil {
+		log.Printf("Warning: RabbitMQ not available, %s email not sent for %s", msg.Type, msg.To)
+		return
+	}
+	if err := s.rabbitMQ.PublishEmail(msg); err != nil {
+		log.Printf("Failed to publish %s email to %s: %v", msg.Type, msg.To, err)
+	}
+}
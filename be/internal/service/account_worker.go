@@ -0,0 +1,76 @@
+package service
+
+import (
+	"log"
+	"time"
+)
+
+type AccountWorker struct {
+	accountService AccountService
+	interval       time.Duration
+	stop           chan struct{}
+}
+
+func NewAccountWorker(accountService AccountService, interval time.Duration) *AccountWorker {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &AccountWorker{
+		accountService: accountService,
+		interval:       interval,
+		stop:           make(chan struct{}),
+	}
+}
+
+// Start builds data exports as they are requested and, on every interval,
+// expires old exports and erases accounts past their deletion grace period
+func (w *AccountWorker) Start() {
+	log.Printf("Account worker started, purging every %v", w.interval)
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		w.run()
+		for {
+			select {
+			case exportID := <-w.accountService.ExportQueue():
+				if err := w.accountService.ProcessExport(exportID); err != nil {
+					log.Printf("Data export %s failed: %v", exportID, err)
+				}
+			case <-ticker.C:
+				w.run()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (w *AccountWorker) run() {
+	if processed := w.accountService.ProcessPendingExports(); processed > 0 {
+		log.Printf("Account worker built %d pending data exports", processed)
+	}
+
+	expired, err := w.accountService.ExpireExports()
+	if err != nil {
+		log.Printf("Expiring data exports failed after %d exports: %v", expired, err)
+	} else if expired > 0 {
+		log.Printf("Account worker expired %d data exports", expired)
+	}
+
+	purged, err := w.accountService.PurgeDeletedAccounts()
+	if err != nil {
+		log.Printf("Account purge failed after erasing %d accounts: %v", purged, err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("Account worker erased %d deleted accounts", purged)
+	}
+}
+
+// Stop stops the account worker
+func (w *AccountWorker) Stop() {
+	log.Println("Stopping account worker...")
+	close(w.stop)
+}
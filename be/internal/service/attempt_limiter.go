@@ -0,0 +1,149 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/util"
+)
+
+// Actions protected against brute force. Each has its own counters.
+const (
+	attemptLogin       = "login"
+	attemptVerifyOTP   = "verify_otp"
+	attemptResetOTP    = "reset_otp"
+	attemptMFA         = "mfa"
+	strikeWindow       = 24 * time.Hour
+	defaultMaxAttempts = 5
+)
+
+// TooManyAttemptsError is returned while an account or IP is locked out
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many attempts, try again in %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// attemptLimiter counts failed attempts per account and per IP. Reaching the
+// limit locks the key out; every further lockout within a day doubles in length.
+type attemptLimiter struct {
+	store        util.LimiterStore
+	accountLimit int64
+	ipLimit      int64
+	window       time.Duration
+	baseLockout  time.Duration
+	maxLockout   time.Duration
+}
+
+func newAttemptLimiter(cfg *config.Config) *attemptLimiter {
+	limiter := &attemptLimiter{
+		store:        util.NewMemoryLimiterStore(),
+		accountLimit: defaultMaxAttempts,
+		ipLimit:      4 * defaultMaxAttempts,
+		window:       15 * time.Minute,
+		baseLockout:  time.Minute,
+		maxLockout:   time.Hour,
+	}
+	if cfg == nil {
+		return limiter
+	}
+
+	limiter.accountLimit = int64(cfg.LoginMaxAttempts)
+	limiter.ipLimit = int64(cfg.LoginIPMaxAttempts)
+	limiter.window = cfg.LoginAttemptWindow
+	limiter.baseLockout = cfg.LoginLockoutBase
+	limiter.maxLockout = cfg.LoginLockoutMax
+
+	if cfg.LimiterStore == "redis" {
+		store, err := util.NewRedisLimiterStore(cfg)
+		if err != nil {
+			log.Printf("Warning: %v, using in-memory attempt limiter", err)
+		} else {
+			limiter.store = store
+		}
+	}
+
+	return limiter
+}
+
+// check returns a TooManyAttemptsError if the account or IP is locked out
+func (l *attemptLimiter) check(action, account, ip string) error {
+	var retryAfter time.Duration
+	for _, key := range l.keys(action, account, ip) {
+		locked, err := l.store.LockedFor(key)
+		if err != nil {
+			// Fail open: a limiter outage must not lock everybody out
+			log.Printf("Attempt limiter unavailable: %v", err)
+			return nil
+		}
+		if locked > retryAfter {
+			retryAfter = locked
+		}
+	}
+
+	if retryAfter > 0 {
+		return &TooManyAttemptsError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// fail records a failed attempt and locks the account or IP when it hits its limit
+func (l *attemptLimiter) fail(action, account, ip string) {
+	for i, key := range l.keys(action, account, ip) {
+		limit := l.accountLimit
+		if i == 1 {
+			limit = l.ipLimit
+		}
+
+		count, err := l.store.Increment("fail:"+key, l.window)
+		if err != nil {
+			log.Printf("Attempt limiter unavailable: %v", err)
+			return
+		}
+		if count < limit {
+			continue
+		}
+
+		strikes, err := l.store.Increment("strikes:"+key, strikeWindow)
+		if err != nil {
+			log.Printf("Attempt limiter unavailable: %v", err)
+			return
+		}
+
+		l.store.Reset("fail:" + key)
+		l.store.Lock(key, l.lockoutFor(strikes))
+	}
+}
+
+// succeed clears the account's counters after a successful attempt
+func (l *attemptLimiter) succeed(action, account string) {
+	key := action + ":account:" + strings.ToLower(account)
+	l.store.Reset("fail:" + key)
+	l.store.Reset("strikes:" + key)
+}
+
+func (l *attemptLimiter) lockoutFor(strikes int64) time.Duration {
+	lockout := l.baseLockout
+	for i := int64(1); i < strikes && lockout < l.maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.maxLockout {
+		lockout = l.maxLockout
+	}
+	return lockout
+}
+
+// keys returns the account key and, if known, the IP key
+func (l *attemptLimiter) keys(action, account, ip string) []string {
+	keys := []string{action + ":account:" + strings.ToLower(account)}
+	if ip != "" {
+		keys = append(keys, action+":ip:"+ip)
+	}
+	return keys
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+func testLimiter() *attemptLimiter {
+	return &attemptLimiter{
+		store:        util.NewMemoryLimiterStore(),
+		accountLimit: 3,
+		ipLimit:      5,
+		window:       time.Minute,
+		baseLockout:  time.Minute,
+		maxLockout:   5 * time.Minute,
+	}
+}
+
+func retryAfter(t *testing.T, err error) time.Duration {
+	t.Helper()
+	var tooMany *TooManyAttemptsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("error = %v, want TooManyAttemptsError", err)
+	}
+	return tooMany.RetryAfter
+}
+
+func TestAttemptLimiterLocksAccount(t *testing.T) {
+	limiter := testLimiter()
+
+	for i := 0; i < 2; i++ {
+		limiter.fail(attemptLogin, "User@Example.org", "203.0.113.1")
+	}
+	if err := limiter.check(attemptLogin, "user@example.org", "203.0.113.1"); err != nil {
+		t.Fatalf("locked out below the limit: %v", err)
+	}
+
+	limiter.fail(attemptLogin, "user@example.org", "203.0.113.2")
+	err := limiter.check(attemptLogin, "user@example.org", "198.51.100.7")
+	if wait := retryAfter(t, err); wait <= 0 || wait > time.Minute {
+		t.Errorf("retry after %v, want up to a minute", wait)
+	}
+
+	// Other accounts and other actions keep their own counters
+	if err := limiter.check(attemptLogin, "other@example.org", "198.51.100.7"); err != nil {
+		t.Errorf("other account locked out: %v", err)
+	}
+	if err := limiter.check(attemptVerifyOTP, "user@example.org", "198.51.100.7"); err != nil {
+		t.Errorf("other action locked out: %v", err)
+	}
+}
+
+func TestAttemptLimiterLocksIPAcrossAccounts(t *testing.T) {
+	limiter := testLimiter()
+
+	// Password spraying: one guess per account, all from one address
+	for _, account := range []string{"a@example.org", "b@example.org", "c@example.org", "d@example.org", "e@example.org"} {
+		limiter.fail(attemptLogin, account, "203.0.113.1")
+	}
+	retryAfter(t, limiter.check(attemptLogin, "f@example.org", "203.0.113.1"))
+
+	if err := limiter.check(attemptLogin, "f@example.org", "203.0.113.2"); err != nil {
+		t.Errorf("another address is locked out: %v", err)
+	}
+}
+
+func TestAttemptLimiterLockoutDoubles(t *testing.T) {
+	limiter := testLimiter()
+
+	var lockouts []time.Duration
+	for strikes := int64(1); strikes <= 5; strikes++ {
+		lockouts = append(lockouts, limiter.lockoutFor(strikes))
+	}
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i := range want {
+		if lockouts[i] != want[i] {
+			t.Errorf("lockout after %d strikes = %v, want %v", i+1, lockouts[i], want[i])
+		}
+	}
+}
+
+func TestAttemptLimiterSuccessResetsAccount(t *testing.T) {
+	limiter := testLimiter()
+
+	limiter.fail(attemptLogin, "user@example.org", "")
+	limiter.fail(attemptLogin, "user@example.org", "")
+	limiter.succeed(attemptLogin, "user@example.org")
+	limiter.fail(attemptLogin, "user@example.org", "")
+	limiter.fail(attemptLogin, "user@example.org", "")
+
+	if err := limiter.check(attemptLogin, "user@example.org", ""); err != nil {
+		t.Errorf("failures before a success still count: %v", err)
+	}
+}
+
+func TestLoginIsLockedOutAfterFailures(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+	auth.limiter = testLimiter()
+	client := ClientInfo{IPAddress: "203.0.113.1"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := auth.Login(LoginRequest{Email: user.Email, Password: "wrong"}, client); err == nil {
+			t.Fatal("wrong password accepted")
+		}
+	}
+
+	// Even the right password is refused while locked out
+	_, err := auth.Login(LoginRequest{Email: user.Email, Password: "correct horse"}, client)
+	retryAfter(t, err)
+	if entry := auth.auditLog.last(model.AuditLoginFailed); entry == nil || entry.Metadata["reason"] != "locked_out" {
+		t.Errorf("lockout was not audited: %+v", entry)
+	}
+}
+
+func TestVerifyOTPIsLockedOutAfterFailures(t *testing.T) {
+	user := activeUser("user@example.org")
+	user.IsVerified = false
+	auth := newTestAuth(user)
+	auth.limiter = testLimiter()
+
+	for i := 0; i < 3; i++ {
+		auth.VerifyOTP(user.Email, "000000", ClientInfo{})
+	}
+	_, err := auth.VerifyOTP(user.Email, "000000", ClientInfo{})
+	retryAfter(t, err)
+}
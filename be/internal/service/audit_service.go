@@ -0,0 +1,205 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+	auditExportBatch     = 1000
+)
+
+// AuditService records security and moderation events and lets admins search them
+type AuditService interface {
+	Record(entry AuditEntry)
+	Search(req AuditQuery) (*AuditEventList, error)
+	ExportCSV(req AuditQuery, w io.Writer) error
+}
+
+// AuditEntry describes something that happened: who did what to which target, and from where
+type AuditEntry struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Client     ClientInfo
+	Metadata   map[string]interface{}
+}
+
+// AuditQuery filters the audit log. Action may be a prefix ending in ".", e.g. "room.".
+// From and To are RFC 3339 timestamps.
+type AuditQuery struct {
+	ActorID  string `form:"actor_id"`
+	Action   string `form:"action"`
+	TargetID string `form:"target_id"`
+	IP       string `form:"ip"`
+	From     string `form:"from"`
+	To       string `form:"to"`
+	Limit    int    `form:"limit"`
+	Offset   int    `form:"offset"`
+}
+
+type AuditEventList struct {
+	Events []model.AuditEvent `json:"events"`
+	Total  int64              `json:"total"`
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+}
+
+type auditService struct {
+	auditRepo repository.AuditRepository
+}
+
+func NewAuditService(auditRepo repository.AuditRepository) AuditService {
+	return &auditService{
+		auditRepo: auditRepo,
+	}
+}
+
+// Record appends an event. Failing to audit never fails the action itself, so errors are only logged.
+func (s *auditService) Record(entry AuditEntry) {
+	event := &model.AuditEvent{
+		Action:    entry.Action,
+		IPAddress: entry.Client.IPAddress,
+		UserAgent: entry.Client.UserAgent,
+		Metadata:  entry.Metadata,
+	}
+	if entry.ActorID != "" {
+		event.ActorID = &entry.ActorID
+	}
+	if entry.TargetType != "" {
+		event.TargetType = &entry.TargetType
+	}
+	if entry.TargetID != "" {
+		event.TargetID = &entry.TargetID
+	}
+
+	if err := s.auditRepo.Create(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", entry.Action, err)
+	}
+}
+
+// Search returns one page of matching events, newest first
+func (s *auditService) Search(req AuditQuery) (*AuditEventList, error) {
+	filter, err := req.filter()
+	if err != nil {
+		return nil, err
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	events, total, err := s.auditRepo.Search(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch audit events: %w", err)
+	}
+
+	return &AuditEventList{
+		Events: events,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
+
+// ExportCSV writes every matching event as CSV, ignoring Limit and Offset
+func (s *auditService) ExportCSV(req AuditQuery, w io.Writer) error {
+	filter, err := req.filter()
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "ip_address", "user_agent", "metadata"}); err != nil {
+		return err
+	}
+
+	err = s.auditRepo.Each(filter, auditExportBatch, func(events []model.AuditEvent) error {
+		for _, event := range events {
+			metadata := ""
+			if len(event.Metadata) > 0 {
+				data, _ := json.Marshal(event.Metadata)
+				metadata = string(data)
+			}
+			record := []string{
+				event.ID,
+				event.CreatedAt.UTC().Format(time.RFC3339),
+				stringValue(event.ActorID),
+				event.Action,
+				stringValue(event.TargetType),
+				stringValue(event.TargetID),
+				event.IPAddress,
+				csvSafe(event.UserAgent),
+				metadata,
+			}
+			if err := out.Write(record); err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		return out.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func (q AuditQuery) filter() (repository.AuditFilter, error) {
+	filter := repository.AuditFilter{
+		ActorID:  q.ActorID,
+		Action:   q.Action,
+		TargetID: q.TargetID,
+		IP:       q.IP,
+		Limit:    q.Limit,
+		Offset:   q.Offset,
+	}
+	if q.From != "" {
+		from, err := time.Parse(time.RFC3339, q.From)
+		if err != nil {
+			return filter, errors.New("from must be an RFC 3339 timestamp")
+		}
+		filter.From = &from
+	}
+	if q.To != "" {
+		to, err := time.Parse(time.RFC3339, q.To)
+		if err != nil {
+			return filter, errors.New("to must be an RFC 3339 timestamp")
+		}
+		filter.To = &to
+	}
+	return filter, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// csvSafe stops spreadsheet apps from running client-supplied text such as the user agent as a formula
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@') {
+		return "'" + value
+	}
+	return value
+}
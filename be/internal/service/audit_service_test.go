@@ -0,0 +1,115 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+)
+
+type fakeAuditRepo struct {
+	repository.AuditRepository
+	events  []model.AuditEvent
+	filters []repository.AuditFilter
+}
+
+func (r *fakeAuditRepo) Create(event *model.AuditEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *fakeAuditRepo) Search(filter repository.AuditFilter) ([]model.AuditEvent, int64, error) {
+	r.filters = append(r.filters, filter)
+	return r.events, int64(len(r.events)), nil
+}
+
+func (r *fakeAuditRepo) Each(filter repository.AuditFilter, batchSize int, fn func([]model.AuditEvent) error) error {
+	r.filters = append(r.filters, filter)
+	return fn(r.events)
+}
+
+func TestAuditRecordLeavesEmptyFieldsNull(t *testing.T) {
+	repo := &fakeAuditRepo{}
+	audit := NewAuditService(repo)
+
+	audit.Record(AuditEntry{Action: model.AuditLoginFailed, Client: ClientInfo{IPAddress: "203.0.113.1", UserAgent: "curl"}})
+	audit.Record(AuditEntry{ActorID: "admin", Action: model.AuditRoomClosed, TargetType: model.AuditTargetRoom, TargetID: "room"})
+
+	anonymous, closed := repo.events[0], repo.events[1]
+	if anonymous.ActorID != nil || anonymous.TargetType != nil || anonymous.TargetID != nil {
+		t.Errorf("anonymous event = %+v, want no actor or target", anonymous)
+	}
+	if anonymous.IPAddress != "203.0.113.1" || anonymous.UserAgent != "curl" {
+		t.Errorf("client of the anonymous event = %q, %q", anonymous.IPAddress, anonymous.UserAgent)
+	}
+	if stringValue(closed.ActorID) != "admin" || stringValue(closed.TargetType) != model.AuditTargetRoom || stringValue(closed.TargetID) != "room" {
+		t.Errorf("event = %+v", closed)
+	}
+}
+
+func TestAuditSearchFilters(t *testing.T) {
+	repo := &fakeAuditRepo{}
+	audit := NewAuditService(repo)
+
+	if _, err := audit.Search(AuditQuery{From: "yesterday"}); err == nil {
+		t.Error("invalid from was accepted")
+	}
+	if _, err := audit.Search(AuditQuery{To: "2026-13-01"}); err == nil {
+		t.Error("invalid to was accepted")
+	}
+
+	list, err := audit.Search(AuditQuery{Action: "room.", From: "2026-01-01T00:00:00Z", Limit: 10000, Offset: -5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Limit != maxAuditPageSize || list.Offset != 0 {
+		t.Errorf("page = %d/%d, want %d/0", list.Limit, list.Offset, maxAuditPageSize)
+	}
+	filter := repo.filters[len(repo.filters)-1]
+	want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if filter.Action != "room." || filter.From == nil || !filter.From.Equal(want) || filter.To != nil {
+		t.Errorf("filter = %+v", filter)
+	}
+
+	if list, _ := audit.Search(AuditQuery{}); list.Limit != defaultAuditPageSize {
+		t.Errorf("default page size = %d, want %d", list.Limit, defaultAuditPageSize)
+	}
+}
+
+func TestAuditExportCSVNeutralizesFormulas(t *testing.T) {
+	actor := "admin"
+	repo := &fakeAuditRepo{events: []model.AuditEvent{{
+		ID:        "event",
+		ActorID:   &actor,
+		Action:    model.AuditLoginSucceeded,
+		UserAgent: "=HYPERLINK(\"http://evil.example\")",
+		Metadata:  model.JSONMap{"method": "password"},
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}}
+	audit := NewAuditService(repo)
+
+	var buf bytes.Buffer
+	if err := audit.ExportCSV(AuditQuery{Limit: 1}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want a header and one event", len(rows))
+	}
+	row := rows[1]
+	if row[0] != "event" || row[1] != "2026-01-02T03:04:05Z" || row[2] != "admin" || row[3] != model.AuditLoginSucceeded {
+		t.Errorf("row = %q", row)
+	}
+	if row[7][0] == '=' {
+		t.Errorf("user agent %q is exported as a formula", row[7])
+	}
+	if row[8] != `{"method":"password"}` {
+		t.Errorf("metadata = %q", row[8])
+	}
+}
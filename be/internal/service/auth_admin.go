@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// ListUsersRequest filters the admin user list. Query matches email, username or name.
+type ListUsersRequest struct {
+	Query    string `form:"q"`
+	Role     string `form:"role"`
+	IsActive *bool  `form:"is_active"`
+	Limit    int    `form:"limit"`
+	Offset   int    `form:"offset"`
+}
+
+type UserListResponse struct {
+	Users  []model.User `json:"users"`
+	Total  int64        `json:"total"`
+	Limit  int          `json:"limit"`
+	Offset int          `json:"offset"`
+}
+
+// ListUsers searches all accounts for admins and moderators
+func (s *authService) ListUsers(req ListUsersRequest) (*UserListResponse, error) {
+	if req.Role != "" && !isKnownRole(req.Role) {
+		return nil, fmt.Errorf("role must be one of: %s", strings.Join(model.Roles, ", "))
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultUserPageSize
+	}
+	if req.Limit > maxUserPageSize {
+		req.Limit = maxUserPageSize
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	users, total, err := s.userRepo.Search(repository.UserFilter{
+		Query:    strings.TrimSpace(req.Query),
+		Role:     req.Role,
+		IsActive: req.IsActive,
+		Limit:    req.Limit,
+		Offset:   req.Offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	return &UserListResponse{
+		Users:  users,
+		Total:  total,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	}, nil
+}
+
+// SetUserActive deactivates or reactivates an account. A deactivated user is
+// signed out everywhere and their access tokens stop working.
+func (s *authService) SetUserActive(actorID, userID string, active bool, client ClientInfo) (*model.User, error) {
+	if userID == actorID {
+		return nil, errors.New("you cannot change the status of your own account")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user.ID == model.DeletedUserID {
+		return nil, errors.New("user not found")
+	}
+
+	if err := s.applyUserActive(user, active, model.DeactivatedByAdmin(actorID), AuditEntry{
+		ActorID:  actorID,
+		Client:   client,
+		Metadata: map[string]interface{}{"email": user.Email},
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// errDeactivatedElsewhere is returned when an identity provider tries to
+// reactivate an account that an admin or another organization deactivated
+var errDeactivatedElsewhere = errors.New("account was not deactivated by this organization")
+
+// SetProvisionedUserActive deactivates or reactivates an account on behalf of
+// an organization's identity provider (SCIM). It can only reactivate accounts
+// it deactivated itself.
+func (s *authService) SetProvisionedUserActive(orgID, userID string, active bool, client ClientInfo) (*model.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user.ID == model.DeletedUserID {
+		return nil, errors.New("user not found")
+	}
+
+	source := model.DeactivatedBySCIM(orgID)
+	if active && !user.IsActive && stringValue(user.DeactivatedBy) != source {
+		return nil, errDeactivatedElsewhere
+	}
+
+	if err := s.applyUserActive(user, active, source, AuditEntry{
+		Client:   client,
+		Metadata: map[string]interface{}{"email": user.Email, "via": "scim", "organization_id": orgID},
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// applyUserActive stores the new status together with who deactivated the
+// account, signs a deactivated user out and records entry with the matching action
+func (s *authService) applyUserActive(user *model.User, active bool, source string, entry AuditEntry) error {
+	if user.IsActive == active {
+		return nil
+	}
+
+	var deactivatedBy *string
+	if !active {
+		deactivatedBy = &source
+	}
+	if err := s.userRepo.UpdateFields(user.ID, map[string]interface{}{
+		"is_active":      active,
+		"deactivated_by": deactivatedBy,
+	}); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	user.IsActive = active
+	user.DeactivatedBy = deactivatedBy
+
+	entry.Action = model.AuditUserReactivated
+	if !active {
+		entry.Action = model.AuditUserDeactivated
+		if err := s.revokeAllSessions(user.ID, "account_deactivated"); err != nil {
+			log.Printf("Failed to sign out deactivated account %s: %v", user.ID, err)
+		}
+	}
+
+	entry.TargetType = model.AuditTargetUser
+	entry.TargetID = user.ID
+	s.audit.Record(entry)
+	return nil
+}
+
+func isKnownRole(role string) bool {
+	for _, known := range model.Roles {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
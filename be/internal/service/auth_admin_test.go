@@ -0,0 +1,72 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/model"
+)
+
+func TestSetUserActive(t *testing.T) {
+	admin := activeUser("admin@example.org")
+	admin.UserType = model.RoleAdmin
+	user := activeUser("user@example.org")
+	auth := newTestAuth(admin, user)
+
+	if _, err := auth.SetUserActive(admin.ID, admin.ID, false, ClientInfo{}); err == nil {
+		t.Error("admin deactivated their own account")
+	}
+	if _, err := auth.SetUserActive(admin.ID, model.DeletedUserID, true, ClientInfo{}); err == nil {
+		t.Error("deleted user placeholder was reactivated")
+	}
+
+	tokens, err := auth.issueTokens(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := auth.SetUserActive(admin.ID, user.ID, false, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.IsActive || auth.users.users[user.ID].IsActive {
+		t.Fatal("account is still active")
+	}
+	if by := stringValue(auth.users.users[user.ID].DeactivatedBy); by != model.DeactivatedByAdmin(admin.ID) {
+		t.Errorf("deactivated by %q, want the admin", by)
+	}
+	if auth.sessionDB.activeSessions(user.ID) != 0 {
+		t.Error("deactivated account is still signed in")
+	}
+	if _, err := auth.RefreshToken(tokens.RefreshToken); err == nil {
+		t.Error("refresh token of a deactivated account was accepted")
+	}
+	if _, err := auth.Login(LoginRequest{Email: user.Email, Password: "correct horse"}, ClientInfo{}); err == nil {
+		t.Error("deactivated account signed in")
+	}
+	entry := auth.auditLog.last(model.AuditUserDeactivated)
+	if entry == nil || entry.ActorID != admin.ID || entry.TargetID != user.ID {
+		t.Errorf("audit entry = %+v", entry)
+	}
+
+	// Deactivating again changes nothing and records nothing
+	before := len(auth.auditLog.actions())
+	if _, err := auth.SetUserActive(admin.ID, user.ID, false, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(auth.auditLog.actions()) != before {
+		t.Error("no-op deactivation was audited")
+	}
+
+	if _, err := auth.SetUserActive(admin.ID, user.ID, true, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Login(LoginRequest{Email: user.Email, Password: "correct horse"}, ClientInfo{}); err != nil {
+		t.Errorf("reactivated account cannot sign in: %v", err)
+	}
+	if auth.users.users[user.ID].DeactivatedBy != nil {
+		t.Error("reactivated account still records who deactivated it")
+	}
+	if auth.auditLog.last(model.AuditUserReactivated) == nil {
+		t.Error("reactivation was not audited")
+	}
+}
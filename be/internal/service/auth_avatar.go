@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/storage"
+	"yourapp/internal/util"
+
+	"github.com/google/uuid"
+)
+
+// avatarSizes are the square thumbnails generated for every upload; the
+// largest one becomes the user's ProfilePhoto
+var avatarSizes = []int{64, 128, 256, 512}
+
+const avatarQuality = 85
+
+type AvatarResponse struct {
+	User    *model.User       `json:"user"`
+	Avatars map[string]string `json:"avatars"` // size in pixels -> URL
+}
+
+// newFileStorage opens the configured upload storage, falling back to ./uploads
+func newFileStorage(cfg *config.Config) storage.Storage {
+	if cfg != nil {
+		files, err := storage.New(cfg)
+		if err == nil {
+			return files
+		}
+		log.Printf("Failed to open %s upload storage, falling back to local disk: %v", cfg.StorageDriver, err)
+	}
+
+	files, err := storage.NewLocalStorage("./uploads", "/uploads")
+	if err != nil {
+		log.Printf("Failed to open local upload storage: %v", err)
+		return nil
+	}
+	return files
+}
+
+// UploadAvatar validates an uploaded image, stores square thumbnails without
+// metadata and points the user's ProfilePhoto at the largest one
+func (s *authService) UploadAvatar(userID string, data []byte) (*AvatarResponse, error) {
+	if s.files == nil {
+		return nil, errors.New("file uploads are not available")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	maxBytes, minDimension, maxDimension := s.avatarLimits()
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("image must be at most %d KB", maxBytes>>10)
+	}
+
+	img, err := util.DecodeImage(data, minDimension, maxDimension)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new name per upload so browsers and CDNs never serve a stale avatar
+	version := uuid.New().String()
+	avatars := make(map[string]string, len(avatarSizes))
+	var stored []string
+	for size, thumb := range util.SquareThumbnails(img, avatarSizes) {
+		encoded, err := util.EncodeJPEG(thumb, avatarQuality)
+		if err != nil {
+			deleteFiles(s.files, stored)
+			return nil, fmt.Errorf("failed to encode avatar: %w", err)
+		}
+
+		key := avatarKey(user.ID, version, size)
+		if err := s.files.Put(key, bytes.NewReader(encoded), "image/jpeg"); err != nil {
+			deleteFiles(s.files, stored)
+			return nil, fmt.Errorf("failed to store avatar: %w", err)
+		}
+		stored = append(stored, key)
+		avatars[strconv.Itoa(size)] = s.files.URL(key)
+	}
+
+	photo := s.files.URL(avatarKey(user.ID, version, avatarSizes[len(avatarSizes)-1]))
+	if err := s.userRepo.UpdateFields(user.ID, map[string]interface{}{"profile_photo": photo}); err != nil {
+		deleteFiles(s.files, stored)
+		return nil, fmt.Errorf("failed to update profile photo: %w", err)
+	}
+
+	// The previous upload is no longer referenced
+	if user.ProfilePhoto != nil {
+		deleteStoredAvatar(s.files, user.ID, *user.ProfilePhoto)
+	}
+	user.ProfilePhoto = &photo
+
+	return &AvatarResponse{User: user, Avatars: avatars}, nil
+}
+
+func (s *authService) avatarLimits() (int64, int, int) {
+	if s.config == nil {
+		return 5 << 20, 128, 4096
+	}
+	return s.config.AvatarMaxBytes, s.config.AvatarMinDimension, s.config.AvatarMaxDimension
+}
+
+// deleteStoredAvatar removes all thumbnails of an avatar we stored; external URLs are left alone
+func deleteStoredAvatar(files storage.Storage, userID, photoURL string) {
+	if files == nil {
+		return
+	}
+
+	prefix := files.URL("avatars/"+userID) + "/"
+	if !strings.HasPrefix(photoURL, prefix) {
+		return
+	}
+
+	name := strings.TrimPrefix(photoURL, prefix)
+	version, _, found := strings.Cut(name, "_")
+	if !found {
+		return
+	}
+
+	keys := make([]string, len(avatarSizes))
+	for i, size := range avatarSizes {
+		keys[i] = avatarKey(userID, version, size)
+	}
+	deleteFiles(files, keys)
+}
+
+func deleteFiles(files storage.Storage, keys []string) {
+	for _, key := range keys {
+		if err := files.Delete(key); err != nil {
+			log.Printf("Failed to delete %s: %v", key, err)
+		}
+	}
+}
+
+func avatarKey(userID, version string, size int) string {
+	return fmt.Sprintf("avatars/%s/%s_%d.jpg", userID, version, size)
+}
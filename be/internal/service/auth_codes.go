@@ -0,0 +1,82 @@
+package service
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+const (
+	oneTimeCodeTTL         = 10 * time.Minute
+	oneTimeCodeMaxAttempts = 5
+)
+
+var errInvalidCode = errors.New("invalid or expired OTP")
+
+// issueCode creates a one-time code for purpose, replacing the user's previous
+// unused code of that purpose, and returns the plain code to send by email
+func (s *authService) issueCode(userID, purpose string, target *string) (string, error) {
+	code, err := util.GenerateOTP()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate OTP: %w", err)
+	}
+
+	if err := s.storeCode(userID, purpose, code, target); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// storeCode saves the hash of code as the user's only unused code of purpose
+func (s *authService) storeCode(userID, purpose, code string, target *string) error {
+	record := &model.OneTimeCode{
+		UserID:    userID,
+		Purpose:   purpose,
+		CodeHash:  s.hashCode(userID, purpose, code),
+		Target:    target,
+		ExpiresAt: time.Now().Add(oneTimeCodeTTL),
+	}
+	if err := s.codeRepo.Replace(record); err != nil {
+		return fmt.Errorf("failed to save OTP: %w", err)
+	}
+
+	return nil
+}
+
+// consumeCode checks a code for purpose and marks it used. A code is burned
+// after too many wrong guesses, so the user has to request a new one.
+func (s *authService) consumeCode(userID, purpose, code string) (*model.OneTimeCode, error) {
+	record, err := s.codeRepo.FindActive(userID, purpose)
+	if err != nil {
+		return nil, errInvalidCode
+	}
+
+	if record.Attempts >= oneTimeCodeMaxAttempts {
+		s.codeRepo.Consume(record.ID)
+		return nil, errInvalidCode
+	}
+
+	if !hmac.Equal([]byte(record.CodeHash), []byte(s.hashCode(userID, purpose, code))) {
+		s.codeRepo.IncrementAttempts(record.ID)
+		return nil, errInvalidCode
+	}
+
+	consumed, err := s.codeRepo.Consume(record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify OTP: %w", err)
+	}
+	if !consumed {
+		return nil, errInvalidCode
+	}
+
+	return record, nil
+}
+
+func (s *authService) hashCode(userID, purpose, code string) string {
+	return util.HashOTP(s.jwtSecret, purpose+":"+userID, code)
+}
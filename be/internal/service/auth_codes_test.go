@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/model"
+)
+
+func TestConsumeCodeChecksPurpose(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	code, err := auth.issueCode(user.ID, model.CodePurposeVerifyEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, purpose := range []string{model.CodePurposeResetPassword, model.CodePurposeEmailChange} {
+		if _, err := auth.consumeCode(user.ID, purpose, code); err == nil {
+			t.Errorf("verification code accepted for %s", purpose)
+		}
+	}
+	if _, err := auth.consumeCode(user.ID, model.CodePurposeVerifyEmail, code); err != nil {
+		t.Errorf("code rejected for its own purpose: %v", err)
+	}
+	if _, err := auth.consumeCode(user.ID, model.CodePurposeVerifyEmail, code); err == nil {
+		t.Error("code accepted twice")
+	}
+}
+
+func TestConsumeCodeIsBoundToUser(t *testing.T) {
+	user := activeUser("user@example.org")
+	other := activeUser("other@example.org")
+	auth := newTestAuth(user, other)
+
+	code, err := auth.issueCode(user.ID, model.CodePurposeResetPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Give the other user the same code: the stored hashes still differ
+	if err := auth.storeCode(other.ID, model.CodePurposeResetPassword, code, nil); err != nil {
+		t.Fatal(err)
+	}
+	if auth.codes.codes[0].CodeHash == auth.codes.codes[1].CodeHash {
+		t.Error("the same code hashes the same for two users")
+	}
+}
+
+func TestIssueCodeReplacesPreviousCode(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	first, err := auth.issueCode(user.ID, model.CodePurposeResetPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.issueCode(user.ID, model.CodePurposeResetPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		if _, err := auth.consumeCode(user.ID, model.CodePurposeResetPassword, first); err == nil {
+			t.Error("replaced code was accepted")
+		}
+	}
+
+	// A code of another purpose is not replaced
+	verify, err := auth.issueCode(user.ID, model.CodePurposeVerifyEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.consumeCode(user.ID, model.CodePurposeResetPassword, second); err != nil {
+		t.Errorf("code replaced by one of another purpose: %v", err)
+	}
+	if _, err := auth.consumeCode(user.ID, model.CodePurposeVerifyEmail, verify); err != nil {
+		t.Errorf("verification code rejected: %v", err)
+	}
+}
+
+func TestConsumeCodeBurnsAfterTooManyGuesses(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	code, err := auth.issueCode(user.ID, model.CodePurposeEmailChange, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < oneTimeCodeMaxAttempts; i++ {
+		auth.consumeCode(user.ID, model.CodePurposeEmailChange, wrong)
+	}
+	if _, err := auth.consumeCode(user.ID, model.CodePurposeEmailChange, code); err == nil {
+		t.Error("code still accepted after too many wrong guesses")
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+const defaultDeletionGrace = 30 * 24 * time.Hour
+
+// DeleteAccountRequest confirms an account deletion. Users with a password
+// confirm with it; accounts without one (single sign-on) retype their email.
+type DeleteAccountRequest struct {
+	Password     string `json:"password"`
+	ConfirmEmail string `json:"confirm_email"`
+}
+
+// DeleteAccount schedules the account for permanent deletion after the grace
+// period and signs it out everywhere. Signing in again before then cancels it.
+func (s *authService) DeleteAccount(userID string, req DeleteAccountRequest) (*time.Time, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.PasswordHash != "" {
+		if !util.CheckPasswordHash(req.Password, user.PasswordHash) {
+			return nil, errors.New("password is incorrect")
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(req.ConfirmEmail), user.Email) {
+		return nil, errors.New("please confirm your email address to delete your account")
+	}
+
+	if user.DeletionDueAt != nil {
+		return user.DeletionDueAt, nil
+	}
+
+	grace := defaultDeletionGrace
+	if s.config != nil && s.config.AccountDeletionGrace > 0 {
+		grace = s.config.AccountDeletionGrace
+	}
+	dueAt := time.Now().Add(grace)
+
+	if err := s.userRepo.UpdateFields(user.ID, map[string]interface{}{"deletion_due_at": dueAt}); err != nil {
+		return nil, fmt.Errorf("failed to schedule account deletion: %w", err)
+	}
+	if err := s.revokeAllSessions(user.ID, "account_deleted"); err != nil {
+		log.Printf("Failed to sign out account %s after deletion request: %v", user.ID, err)
+	}
+	if err := s.accessTokenRepo.RevokeAllByUserID(user.ID); err != nil {
+		log.Printf("Failed to revoke access tokens of account %s: %v", user.ID, err)
+	}
+
+	s.queueEmail(util.EmailMessage{
+		To:     user.Email,
+		Body:   dueAt.Format(time.RFC3339),
+		Type:   "account_deletion",
+		Locale: user.Locale,
+	})
+
+	return &dueAt, nil
+}
+
+// restoreAccount cancels a scheduled deletion when the user signs in during the grace period
+func (s *authService) restoreAccount(user *model.User) {
+	if user.DeletionDueAt == nil {
+		return
+	}
+
+	if err := s.userRepo.UpdateFields(user.ID, map[string]interface{}{"deletion_due_at": nil}); err != nil {
+		log.Printf("Failed to cancel deletion of account %s: %v", user.ID, err)
+		return
+	}
+	user.DeletionDueAt = nil
+	log.Printf("Account %s signed in during the grace period, deletion cancelled", user.ID)
+}
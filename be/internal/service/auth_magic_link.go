@@ -0,0 +1,117 @@
+package service
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+var errInvalidMagicLink = errors.New("invalid or expired login link")
+
+// RequestMagicLink emails a single-use sign-in link to an existing, active account.
+// nonce is the random value the handler stored in the requesting browser; the link
+// only works when it is opened in that same browser. Unknown or deactivated emails
+// get no email but the same result, so the endpoint cannot be used to find accounts.
+func (s *authService) RequestMagicLink(email, nonce string, client ClientInfo) error {
+	if nonce == "" {
+		return errors.New("browser nonce required")
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		s.auditLoginFailed("", email, "magic_link_unknown_email", client)
+		return nil
+	}
+	if !user.IsActive {
+		s.auditLoginFailed(user.ID, email, "account_deactivated", client)
+		return nil
+	}
+
+	secret, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate login link: %w", err)
+	}
+	nonceHash := util.HashToken(nonce)
+	if err := s.storeCode(user.ID, model.CodePurposeLogin, secret, &nonceHash); err != nil {
+		return err
+	}
+
+	token, err := util.GenerateMagicLinkToken(user.ID, user.Email, secret, s.keys)
+	if err != nil {
+		return fmt.Errorf("failed to generate login link: %w", err)
+	}
+
+	s.queueEmail(util.EmailMessage{
+		To:     user.Email,
+		Body:   s.magicLinkURL(token),
+		Type:   "magic_link",
+		Locale: user.Locale,
+	})
+
+	return nil
+}
+
+// VerifyMagicLink exchanges a login link for tokens. The link is consumed only
+// when nonce matches the browser that requested it, so a forwarded email cannot
+// be used elsewhere and does not burn the link for its owner.
+func (s *authService) VerifyMagicLink(token, nonce string, client ClientInfo) (*AuthResponse, error) {
+	claims, err := util.ValidateTokenType(token, s.keys, util.TokenTypeMagic)
+	if err != nil || claims.ID == "" {
+		return nil, errInvalidMagicLink
+	}
+
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil || !strings.EqualFold(user.Email, claims.Email) {
+		return nil, errInvalidMagicLink
+	}
+
+	record, err := s.codeRepo.FindActive(user.ID, model.CodePurposeLogin)
+	if err != nil || !hmac.Equal([]byte(record.CodeHash), []byte(s.hashCode(user.ID, model.CodePurposeLogin, claims.ID))) {
+		s.auditOTP(user.ID, model.CodePurposeLogin, false, client)
+		return nil, errInvalidMagicLink
+	}
+
+	if nonce == "" || record.Target == nil || !hmac.Equal([]byte(*record.Target), []byte(util.HashToken(nonce))) {
+		s.auditLoginFailed(user.ID, user.Email, "magic_link_other_browser", client)
+		return nil, errors.New("login link must be opened in the browser that requested it")
+	}
+
+	consumed, err := s.codeRepo.Consume(record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify login link: %w", err)
+	}
+	if !consumed {
+		return nil, errInvalidMagicLink
+	}
+	s.auditOTP(user.ID, model.CodePurposeLogin, true, client)
+
+	if !user.IsActive {
+		s.auditLoginFailed(user.ID, user.Email, "account_deactivated", client)
+		return nil, errors.New("account is deactivated")
+	}
+
+	// Opening the link proves the user owns the address
+	if !user.IsVerified {
+		if err := s.userRepo.MarkVerified(user.ID); err != nil {
+			return nil, fmt.Errorf("failed to verify user: %w", err)
+		}
+		user.IsVerified = true
+		s.autoJoinOrganizations(user)
+	}
+
+	return s.completeLogin(user, client)
+}
+
+// magicLinkURL returns the frontend page that posts the token back to /auth/magic-link/verify
+func (s *authService) magicLinkURL(token string) string {
+	baseURL := ""
+	if s.config != nil {
+		baseURL = strings.TrimSuffix(s.config.ClientURL, "/")
+	}
+	return baseURL + "/auth/magic-link?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+// magicLink issues a login link for user bound to nonce, as RequestMagicLink
+// does, and returns the token the email would carry
+func (t *testAuth) magicLink(user *model.User, nonce string) string {
+	secret, err := util.GenerateOpaqueToken()
+	if err != nil {
+		panic(err)
+	}
+	nonceHash := util.HashToken(nonce)
+	if err := t.storeCode(user.ID, model.CodePurposeLogin, secret, &nonceHash); err != nil {
+		panic(err)
+	}
+	token, err := util.GenerateMagicLinkToken(user.ID, user.Email, secret, t.keys)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+func TestRequestMagicLinkDoesNotRevealAccounts(t *testing.T) {
+	user := activeUser("user@example.org")
+	deactivated := activeUser("deactivated@example.org")
+	deactivated.IsActive = false
+	auth := newTestAuth(user, deactivated)
+
+	if err := auth.RequestMagicLink(user.Email, "", ClientInfo{}); err == nil {
+		t.Error("link requested without a browser nonce")
+	}
+	for _, email := range []string{"unknown@example.org", deactivated.Email} {
+		if err := auth.RequestMagicLink(email, "nonce", ClientInfo{}); err != nil {
+			t.Errorf("%s: %v, want the same result as for an account", email, err)
+		}
+	}
+	if len(auth.codes.codes) != 0 {
+		t.Errorf("%d links issued for unknown or deactivated accounts", len(auth.codes.codes))
+	}
+
+	if err := auth.RequestMagicLink(user.Email, "nonce", ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(auth.codes.codes) != 1 {
+		t.Fatalf("%d links issued, want 1", len(auth.codes.codes))
+	}
+	code := auth.codes.codes[0]
+	if code.UserID != user.ID || code.Purpose != model.CodePurposeLogin || stringValue(code.Target) != util.HashToken("nonce") {
+		t.Errorf("stored link = %+v, want a login code bound to the nonce", code)
+	}
+}
+
+func TestVerifyMagicLinkOnlyInTheRequestingBrowser(t *testing.T) {
+	user := activeUser("user@example.org")
+	user.IsVerified = false
+	auth := newTestAuth(user)
+	token := auth.magicLink(user, "browser")
+
+	if _, err := auth.VerifyMagicLink(token, "other-browser", ClientInfo{}); err == nil {
+		t.Fatal("link was accepted in another browser")
+	}
+	if _, err := auth.VerifyMagicLink(token, "", ClientInfo{}); err == nil {
+		t.Fatal("link was accepted without a nonce")
+	}
+	if entry := auth.auditLog.last(model.AuditLoginFailed); entry == nil || entry.Metadata["reason"] != "magic_link_other_browser" {
+		t.Errorf("audit entry = %+v", entry)
+	}
+
+	// The forwarded link did not burn it for its owner
+	resp, err := auth.VerifyMagicLink(token, "browser", ClientInfo{})
+	if err != nil {
+		t.Fatalf("link rejected in the requesting browser: %v", err)
+	}
+	if resp.AccessToken == "" || resp.User.ID != user.ID {
+		t.Errorf("response = %+v", resp)
+	}
+	if !auth.users.users[user.ID].IsVerified {
+		t.Error("opening the link did not verify the email")
+	}
+
+	if _, err := auth.VerifyMagicLink(token, "browser", ClientInfo{}); err == nil {
+		t.Error("link was accepted twice")
+	}
+}
+
+func TestVerifyMagicLinkRejectsStaleLinks(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	if _, err := auth.VerifyMagicLink("garbage", "browser", ClientInfo{}); err == nil {
+		t.Error("invalid token was accepted")
+	}
+
+	// A newer link replaces the older one
+	first := auth.magicLink(user, "browser")
+	second := auth.magicLink(user, "browser")
+	if _, err := auth.VerifyMagicLink(first, "browser", ClientInfo{}); err == nil {
+		t.Error("replaced link was accepted")
+	}
+
+	// A link sent to the old address stops working once the email changes
+	auth.users.users[user.ID].Email = "new@example.org"
+	if _, err := auth.VerifyMagicLink(second, "browser", ClientInfo{}); err == nil {
+		t.Error("link for the previous email was accepted")
+	}
+	auth.users.users[user.ID].Email = user.Email
+
+	// Deactivating the account after the request also blocks the link
+	auth.users.users[user.ID].IsActive = false
+	if _, err := auth.VerifyMagicLink(auth.magicLink(user, "browser"), "browser", ClientInfo{}); err == nil {
+		t.Error("deactivated account signed in with a link")
+	}
+	if auth.sessionDB.activeSessions(user.ID) != 0 {
+		t.Error("a session was created for a rejected link")
+	}
+}
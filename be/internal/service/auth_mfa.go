@@ -0,0 +1,219 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+const recoveryCodeCount = 10
+
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type MFAConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// EnrollMFA generates a new TOTP secret. It is not enforced until ConfirmMFA succeeds.
+func (s *authService) EnrollMFA(userID string) (*MFAEnrollResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.MFAEnabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	if err := s.mfaRepo.UpdateSecret(user.ID, &secret, false); err != nil {
+		return nil, fmt.Errorf("failed to save secret: %w", err)
+	}
+
+	return &MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: util.TOTPURI(s.appName(), user.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA enables 2FA once the user proves their authenticator works and returns fresh recovery codes
+func (s *authService) ConfirmMFA(userID, code string) (*MFAConfirmResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if user.MFAEnabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+	if user.MFASecret == nil {
+		return nil, errors.New("two-factor authentication enrollment not started")
+	}
+
+	step, ok := util.ValidateTOTP(*user.MFASecret, code, time.Now())
+	if !ok {
+		return nil, errors.New("invalid authentication code")
+	}
+
+	if err := s.mfaRepo.UpdateSecret(user.ID, user.MFASecret, true); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	s.mfaRepo.UpdateLastStep(user.ID, step)
+
+	codes, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAConfirmResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA turns 2FA off after checking a current TOTP or recovery code
+func (s *authService) DisableMFA(userID, code string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if !user.MFAEnabled {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	if err := s.checkMFACode(user, code); err != nil {
+		return err
+	}
+
+	if err := s.mfaRepo.UpdateSecret(user.ID, nil, false); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+
+	return s.mfaRepo.DeleteRecoveryCodes(user.ID)
+}
+
+// VerifyMFA completes a login that returned an MFA challenge
+func (s *authService) VerifyMFA(mfaToken, code string, client ClientInfo) (*AuthResponse, error) {
+	claims, err := util.ValidateTokenType(mfaToken, s.keys, util.TokenTypeMFA)
+	if err != nil {
+		return nil, errors.New("invalid or expired MFA token")
+	}
+
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("account is deactivated")
+	}
+	if !user.MFAEnabled {
+		return nil, errors.New("two-factor authentication is not enabled")
+	}
+
+	if err := s.limiter.check(attemptMFA, user.ID, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkMFACode(user, code); err != nil {
+		s.limiter.fail(attemptMFA, user.ID, client.IPAddress)
+		s.auditLoginFailed(user.ID, user.Email, "invalid_mfa_code", client)
+		return nil, err
+	}
+	s.limiter.succeed(attemptMFA, user.ID)
+
+	// Update last login
+	s.userRepo.UpdateLastLogin(user.ID)
+
+	return s.issueTokens(user, client)
+}
+
+// completeLogin finishes a successful first factor: users with 2FA get a challenge instead of tokens
+func (s *authService) completeLogin(user *model.User, client ClientInfo) (*AuthResponse, error) {
+	if user.MFAEnabled {
+		mfaToken, err := util.GenerateMFAChallengeToken(user.ID, user.Email, s.keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate MFA token: %w", err)
+		}
+
+		return &AuthResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		}, nil
+	}
+
+	// Update last login
+	s.userRepo.UpdateLastLogin(user.ID)
+
+	return s.issueTokens(user, client)
+}
+
+// checkMFACode accepts either a TOTP code (each step only once) or an unused recovery code
+func (s *authService) checkMFACode(user *model.User, code string) error {
+	if user.MFASecret != nil {
+		if step, ok := util.ValidateTOTP(*user.MFASecret, code, time.Now()); ok {
+			fresh, err := s.mfaRepo.UpdateLastStep(user.ID, step)
+			if err != nil {
+				return fmt.Errorf("failed to verify code: %w", err)
+			}
+			if !fresh {
+				return errors.New("authentication code already used")
+			}
+			return nil
+		}
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(user.ID, util.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("failed to verify code: %w", err)
+	}
+	if !used {
+		return errors.New("invalid authentication code")
+	}
+
+	return nil
+}
+
+func (s *authService) generateRecoveryCodes(userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := util.GenerateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+		}
+		codes[i] = code
+		hashes[i] = util.HashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes the user may type differently
+func normalizeRecoveryCode(code string) string {
+	normalized := make([]byte, 0, len(code))
+	for i := 0; i < len(code); i++ {
+		ch := code[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z':
+			normalized = append(normalized, ch+('a'-'A'))
+		case ch == '-' || ch == ' ':
+			continue
+		default:
+			normalized = append(normalized, ch)
+		}
+	}
+	return string(normalized)
+}
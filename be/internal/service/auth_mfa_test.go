@@ -0,0 +1,168 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := util.TOTPCode(secret, util.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestCompleteLoginWithoutMFAIssuesTokens(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	resp, err := auth.completeLogin(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.MFARequired || resp.AccessToken == "" || resp.RefreshToken == "" {
+		t.Errorf("response = %+v, want tokens", resp)
+	}
+	if auth.sessionDB.activeSessions(user.ID) != 1 {
+		t.Error("no session was created")
+	}
+}
+
+func TestCompleteLoginWithMFAReturnsChallenge(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+	secret := auth.enableMFA(user.ID)
+	user, _ = auth.users.FindByID(user.ID)
+
+	resp, err := auth.completeLogin(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.MFARequired || resp.MFAToken == "" || resp.AccessToken != "" || resp.RefreshToken != "" {
+		t.Fatalf("response = %+v, want only an MFA challenge", resp)
+	}
+	if auth.sessionDB.activeSessions(user.ID) != 0 {
+		t.Fatal("a session was created before the second factor")
+	}
+
+	// The challenge is not an access token and cannot be used as one
+	if _, err := util.ValidateTokenType(resp.MFAToken, auth.keys, util.TokenTypeAccess); err == nil {
+		t.Error("MFA challenge is accepted as an access token")
+	}
+
+	if _, err := auth.VerifyMFA(resp.MFAToken, "000000", ClientInfo{}); err == nil {
+		t.Error("wrong TOTP code was accepted")
+	}
+
+	code := currentTOTP(t, secret)
+	tokens, err := auth.VerifyMFA(resp.MFAToken, code, ClientInfo{})
+	if err != nil {
+		t.Fatalf("VerifyMFA failed: %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Errorf("VerifyMFA response = %+v", tokens)
+	}
+
+	// Each TOTP step is accepted only once
+	if _, err := auth.VerifyMFA(resp.MFAToken, code, ClientInfo{}); err == nil {
+		t.Error("TOTP code was accepted twice")
+	}
+}
+
+func TestVerifyMFARecoveryCodeIsSingleUse(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+	auth.enableMFA(user.ID)
+	codes, err := auth.generateRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := util.GenerateMFAChallengeToken(user.ID, user.Email, auth.keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.VerifyMFA(challenge, codes[0], ClientInfo{}); err != nil {
+		t.Fatalf("recovery code rejected: %v", err)
+	}
+	if _, err := auth.VerifyMFA(challenge, codes[0], ClientInfo{}); err == nil {
+		t.Error("recovery code was accepted twice")
+	}
+}
+
+func TestFirstFactorsGoThroughMFA(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+	auth.enableMFA(user.ID)
+
+	login, err := auth.Login(LoginRequest{Email: user.Email, Password: "correct horse"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !login.MFARequired || login.AccessToken != "" {
+		t.Errorf("password login skipped 2FA: %+v", login)
+	}
+
+	code, err := auth.issueCode(user.ID, model.CodePurposeResetPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, err := auth.ResetPassword(user.Email, code, "new password 123", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reset.MFARequired || reset.AccessToken != "" {
+		t.Errorf("password reset skipped 2FA: %+v", reset)
+	}
+	if auth.sessionDB.activeSessions(user.ID) != 0 {
+		t.Error("a session was created before the second factor")
+	}
+}
+
+func TestResetPasswordSignsIn(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+	old, err := auth.issueTokens(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.ResetPassword(user.Email, "123456", "new password 123", ClientInfo{}); err == nil {
+		t.Fatal("reset without a code was accepted")
+	}
+
+	// A code for another purpose does not reset the password
+	verify, err := auth.issueCode(user.ID, model.CodePurposeVerifyEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ResetPassword(user.Email, verify, "new password 123", ClientInfo{}); err == nil {
+		t.Fatal("email verification code reset the password")
+	}
+
+	code, err := auth.issueCode(user.ID, model.CodePurposeResetPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := auth.ResetPassword(user.Email, code, "new password 123", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AccessToken == "" || resp.MFARequired {
+		t.Errorf("response = %+v, want tokens", resp)
+	}
+	if _, err := auth.RefreshToken(old.RefreshToken); err == nil {
+		t.Error("session from before the reset still works")
+	}
+	if !util.CheckPasswordHash("new password 123", auth.users.users[user.ID].PasswordHash) {
+		t.Error("password was not changed")
+	}
+	if _, err := auth.ResetPassword(user.Email, code, "another password", ClientInfo{}); err == nil {
+		t.Error("reset code was accepted twice")
+	}
+}
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcLoginTTL   = 10 * time.Minute
+	oidcHandoffTTL = time.Minute
+)
+
+// Default claim for each user field, overridable per provider via claim_mapping
+var defaultOIDCClaims = map[string]string{
+	"email":          "email",
+	"email_verified": "email_verified",
+	"full_name":      "name",
+	"username":       "preferred_username",
+	"profile_photo":  "picture",
+	"phone":          "phone_number",
+}
+
+type oidcProvider struct {
+	settings config.OIDCProviderConfig
+	client   *util.OIDCProvider
+}
+
+type oidcLoginState struct {
+	provider     string
+	nonce        string
+	codeVerifier string
+	browserHash  string // hash of the nonce cookie of the browser that started the flow
+	linkUserID   string // set when a signed-in user links a new identity
+}
+
+// externalIdentity is a provider login mapped onto our user fields
+type externalIdentity struct {
+	provider      string
+	subject       string
+	email         string
+	emailVerified bool
+	fullName      string
+	username      string
+	profilePhoto  string
+	phone         string
+}
+
+type OIDCProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type OIDCCallbackResult struct {
+	Code     string // one-time code the frontend exchanges for tokens
+	Provider string
+	Linked   bool
+}
+
+func newOIDCProviders(cfg *config.Config) map[string]*oidcProvider {
+	providers := make(map[string]*oidcProvider)
+	if cfg == nil {
+		return providers
+	}
+
+	publicURL := strings.TrimRight(cfg.PublicURL, "/")
+	for _, settings := range cfg.OIDCProviders {
+		redirectURL := publicURL + "/api/v1/auth/oidc/" + settings.Name + "/callback"
+		providers[settings.Name] = &oidcProvider{
+			settings: settings,
+			client:   util.NewOIDCProvider(settings.Issuer, settings.ClientID, settings.ClientSecret, settings.Scopes, redirectURL),
+		}
+	}
+	return providers
+}
+
+func (s *authService) GetOIDCProviders() []OIDCProviderInfo {
+	providers := []OIDCProviderInfo{}
+	if s.config == nil {
+		return providers
+	}
+
+	// Keep the configured order
+	for _, settings := range s.config.OIDCProviders {
+		providers = append(providers, OIDCProviderInfo{Name: settings.Name, DisplayName: providerDisplayName(settings)})
+	}
+	return providers
+}
+
+// BeginOIDCLogin returns the provider's authorization URL for a login.
+// browserNonce is the random value the handler stored in the browser's cookie;
+// the callback is only accepted from that same browser.
+func (s *authService) BeginOIDCLogin(providerName, browserNonce string) (string, error) {
+	return s.beginOIDC(providerName, "", browserNonce)
+}
+
+// BeginOIDCLink returns the provider's authorization URL for linking an identity to a signed-in user
+func (s *authService) BeginOIDCLink(userID, providerName, browserNonce string) (string, error) {
+	return s.beginOIDC(providerName, userID, browserNonce)
+}
+
+func (s *authService) beginOIDC(providerName, linkUserID, browserNonce string) (string, error) {
+	if browserNonce == "" {
+		return "", errors.New("browser nonce required")
+	}
+
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return "", errors.New("unknown identity provider")
+	}
+
+	state, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	nonce, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	codeVerifier, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+
+	authURL, err := provider.client.AuthCodeURL(state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("OIDC provider %s unavailable: %v", providerName, err)
+		return "", errors.New("identity provider is unavailable")
+	}
+
+	s.oidcStates.put(state, oidcLoginState{
+		provider:     providerName,
+		nonce:        nonce,
+		codeVerifier: codeVerifier,
+		browserHash:  util.HashToken(browserNonce),
+		linkUserID:   linkUserID,
+	})
+
+	return authURL, nil
+}
+
+// FinishOIDCLogin handles the provider callback: it redeems the code, verifies the
+// ID token and signs the user in (or links the identity for a link request).
+// The callback must arrive in the browser that started the flow, otherwise an
+// attacker could get a victim's browser to finish the attacker's login or link.
+func (s *authService) FinishOIDCLogin(providerName, code, state, browserNonce string, client ClientInfo) (*OIDCCallbackResult, error) {
+	pending, ok := s.oidcStates.take(state)
+	if !ok || pending.provider != providerName {
+		return nil, errors.New("login expired, please try again")
+	}
+	if browserNonce == "" || !hmac.Equal([]byte(pending.browserHash), []byte(util.HashToken(browserNonce))) {
+		s.auditLoginFailed(pending.linkUserID, "", "oidc_other_browser", client)
+		return nil, errors.New("login must be finished in the browser that started it")
+	}
+
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return nil, errors.New("unknown identity provider")
+	}
+
+	tokens, err := provider.client.Exchange(code, pending.codeVerifier)
+	if err != nil {
+		log.Printf("OIDC code exchange with %s failed: %v", providerName, err)
+		return nil, errors.New("failed to sign in with identity provider")
+	}
+
+	claims, err := provider.client.VerifyIDToken(tokens.IDToken, pending.nonce)
+	if err != nil {
+		log.Printf("OIDC ID token from %s rejected: %v", providerName, err)
+		return nil, errors.New("failed to sign in with identity provider")
+	}
+
+	// Fill in profile claims that some providers only return from userinfo
+	if tokens.AccessToken != "" && claimString(claims, provider.claim("email")) == "" {
+		if userInfo, err := provider.client.UserInfo(tokens.AccessToken); err == nil {
+			for key, value := range userInfo {
+				if _, exists := claims[key]; !exists {
+					claims[key] = value
+				}
+			}
+		}
+	}
+
+	identity := provider.mapClaims(claims)
+
+	if pending.linkUserID != "" {
+		if err := s.linkIdentity(pending.linkUserID, provider.settings, identity); err != nil {
+			return nil, err
+		}
+		return &OIDCCallbackResult{Provider: providerName, Linked: true}, nil
+	}
+
+	resp, err := s.signInWithIdentity(provider.settings, identity, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens never go into the redirect URL; the frontend swaps this code for them
+	handoff, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate code: %w", err)
+	}
+	s.oidcHandoffs.put(handoff, resp)
+
+	return &OIDCCallbackResult{Code: handoff, Provider: providerName}, nil
+}
+
+// ExchangeOIDCCode swaps the one-time code from the callback redirect for tokens
+func (s *authService) ExchangeOIDCCode(code string) (*AuthResponse, error) {
+	resp, ok := s.oidcHandoffs.take(code)
+	if !ok {
+		return nil, errors.New("invalid or expired code")
+	}
+	return resp, nil
+}
+
+func (s *authService) GetIdentities(userID string) ([]model.UserIdentity, error) {
+	identities, err := s.identityRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, errors.New("failed to fetch linked accounts")
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity removes a linked identity unless it is the user's only way to sign in
+func (s *authService) UnlinkIdentity(userID, identityID string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	count, err := s.identityRepo.CountByUserID(userID)
+	if err != nil {
+		return errors.New("failed to fetch linked accounts")
+	}
+	if !user.HasPassword() && user.LoginType != model.LoginTypePasskey && count <= 1 {
+		return errors.New("cannot unlink your only sign-in method, set a password first")
+	}
+
+	deleted, err := s.identityRepo.Delete(identityID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unlink account: %w", err)
+	}
+	if !deleted {
+		return errors.New("linked account not found")
+	}
+	return nil
+}
+
+// signInWithIdentity applies the account linking rules to an external login:
+//  1. a known identity signs in its user
+//  2. an email that belongs to an existing account is linked only if the provider
+//     allows it and the email is verified, otherwise the login is rejected
+//  3. otherwise a new account is created unless signup is disabled
+func (s *authService) signInWithIdentity(settings config.OIDCProviderConfig, identity externalIdentity, client ClientInfo) (*AuthResponse, error) {
+	if err := checkIdentityDomain(settings, identity); err != nil {
+		return nil, err
+	}
+
+	if linked, err := s.identityRepo.FindByProviderSubject(identity.provider, identity.subject); err == nil {
+		user, err := s.userRepo.FindByID(linked.UserID)
+		if err != nil {
+			return nil, errors.New("user not found")
+		}
+		if !user.IsActive {
+			return nil, errors.New("account is deactivated")
+		}
+
+		s.identityRepo.TouchLogin(linked.ID)
+		return s.completeLogin(user, client)
+	}
+
+	if identity.email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+
+	displayName := providerDisplayName(settings)
+
+	existingUser, _ := s.userRepo.FindByEmail(identity.email)
+	if existingUser != nil {
+		if _, err := s.identityRepo.FindByUserAndProvider(existingUser.ID, identity.provider); err == nil {
+			return nil, fmt.Errorf("email already registered with different %s account", displayName)
+		}
+		if !settings.LinkExistingAccounts || !identity.emailVerified {
+			if existingUser.LoginType == model.LoginTypeCredential {
+				return nil, errors.New("email sudah terdaftar dengan email dan password. Silakan login dengan email dan password")
+			}
+			return nil, fmt.Errorf("email already registered with another sign-in method. Sign in and link your %s account from your account settings", displayName)
+		}
+		if !existingUser.IsActive {
+			return nil, errors.New("account is deactivated")
+		}
+
+		if err := s.createIdentity(existingUser.ID, identity); err != nil {
+			return nil, err
+		}
+		return s.completeLogin(existingUser, client)
+	}
+
+	if settings.DisableSignup {
+		return nil, fmt.Errorf("sign up with %s is disabled, ask an administrator for an account", displayName)
+	}
+
+	fullName := identity.fullName
+	if fullName == "" {
+		fullName = strings.Split(identity.email, "@")[0]
+	}
+
+	// Create new user
+	user := &model.User{
+		Email:      identity.email,
+		FullName:   fullName,
+		UserType:   model.RoleMember,
+		IsActive:   true,
+		IsVerified: identity.emailVerified,
+		LoginType:  identity.provider,
+	}
+	if identity.profilePhoto != "" {
+		user.ProfilePhoto = &identity.profilePhoto
+	}
+	if identity.phone != "" {
+		user.Phone = &identity.phone
+	}
+	if identity.username != "" {
+		if taken, _ := s.userRepo.FindByUsername(identity.username); taken == nil {
+			user.Username = &identity.username
+		}
+	}
+
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := s.createIdentity(user.ID, identity); err != nil {
+		return nil, err
+	}
+	if user.IsVerified {
+		s.autoJoinOrganizations(user)
+	}
+
+	return s.completeLogin(user, client)
+}
+
+func (s *authService) linkIdentity(userID string, settings config.OIDCProviderConfig, identity externalIdentity) error {
+	if err := checkIdentityDomain(settings, identity); err != nil {
+		return err
+	}
+
+	if linked, err := s.identityRepo.FindByProviderSubject(identity.provider, identity.subject); err == nil {
+		if linked.UserID == userID {
+			return nil
+		}
+		return fmt.Errorf("this %s account is already linked to another user", providerDisplayName(settings))
+	}
+
+	return s.createIdentity(userID, identity)
+}
+
+func (s *authService) createIdentity(userID string, identity externalIdentity) error {
+	now := time.Now()
+	record := &model.UserIdentity{
+		UserID:      userID,
+		Provider:    identity.provider,
+		Subject:     identity.subject,
+		LastLoginAt: &now,
+	}
+	if identity.email != "" {
+		record.Email = &identity.email
+	}
+
+	if err := s.identityRepo.Create(record); err != nil {
+		return fmt.Errorf("failed to link account: %w", err)
+	}
+	return nil
+}
+
+func (p *oidcProvider) claim(field string) string {
+	if name, ok := p.settings.ClaimMapping[field]; ok && name != "" {
+		return name
+	}
+	return defaultOIDCClaims[field]
+}
+
+func (p *oidcProvider) mapClaims(claims jwt.MapClaims) externalIdentity {
+	identity := externalIdentity{
+		provider:     p.settings.Name,
+		subject:      claimString(claims, "sub"),
+		email:        strings.ToLower(claimString(claims, p.claim("email"))),
+		fullName:     claimString(claims, p.claim("full_name")),
+		username:     claimString(claims, p.claim("username")),
+		profilePhoto: claimString(claims, p.claim("profile_photo")),
+		phone:        claimString(claims, p.claim("phone")),
+	}
+
+	switch verified := claims[p.claim("email_verified")].(type) {
+	case bool:
+		identity.emailVerified = verified
+	case string:
+		identity.emailVerified = verified == "true"
+	}
+	if p.settings.TrustEmail && identity.email != "" {
+		identity.emailVerified = true
+	}
+
+	return identity
+}
+
+func checkIdentityDomain(settings config.OIDCProviderConfig, identity externalIdentity) error {
+	if len(settings.AllowedDomains) == 0 {
+		return nil
+	}
+
+	if at := strings.LastIndex(identity.email, "@"); at >= 0 {
+		domain := identity.email[at+1:]
+		for _, allowed := range settings.AllowedDomains {
+			if strings.EqualFold(domain, allowed) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("your account is not allowed to sign in with %s", providerDisplayName(settings))
+}
+
+func providerDisplayName(settings config.OIDCProviderConfig) string {
+	if settings.DisplayName != "" {
+		return settings.DisplayName
+	}
+	return settings.Name
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return strings.TrimSpace(value)
+}
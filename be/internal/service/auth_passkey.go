@@ -0,0 +1,389 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+
+	"github.com/google/uuid"
+)
+
+const passkeyCeremonyTTL = 5 * time.Minute
+
+type passkeyChallenge struct {
+	challenge string
+	userID    string // empty for discoverable (username-less) login
+}
+
+type PasskeyCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type PasskeyCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int64                         `json:"timeout"`
+	Attestation            string                        `json:"attestation"`
+	AuthenticatorSelection map[string]string             `json:"authenticatorSelection"`
+	ExcludeCredentials     []PasskeyCredentialDescriptor `json:"excludeCredentials"`
+}
+
+type PasskeyRequestOptions struct {
+	Challenge        string                        `json:"challenge"`
+	RPID             string                        `json:"rpId"`
+	Timeout          int64                         `json:"timeout"`
+	UserVerification string                        `json:"userVerification"`
+	AllowCredentials []PasskeyCredentialDescriptor `json:"allowCredentials"`
+}
+
+type PasskeyRegistrationBeginResponse struct {
+	SessionID string                 `json:"session_id"`
+	PublicKey PasskeyCreationOptions `json:"publicKey"`
+}
+
+type PasskeyLoginBeginResponse struct {
+	SessionID string                `json:"session_id"`
+	PublicKey PasskeyRequestOptions `json:"publicKey"`
+}
+
+type PasskeyAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject" binding:"required"`
+	Transports        []string `json:"transports"`
+}
+
+type PasskeyRegistrationCredential struct {
+	ID       string                     `json:"id" binding:"required"`
+	Type     string                     `json:"type"`
+	Response PasskeyAttestationResponse `json:"response"`
+}
+
+type PasskeyRegistrationRequest struct {
+	SessionID  string                        `json:"session_id" binding:"required"`
+	Name       string                        `json:"name"`
+	Credential PasskeyRegistrationCredential `json:"credential"`
+}
+
+type PasskeyAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+type PasskeyLoginCredential struct {
+	ID       string                   `json:"id" binding:"required"`
+	Type     string                   `json:"type"`
+	Response PasskeyAssertionResponse `json:"response"`
+}
+
+type PasskeyLoginRequest struct {
+	SessionID  string                 `json:"session_id" binding:"required"`
+	Credential PasskeyLoginCredential `json:"credential"`
+}
+
+// BeginPasskeyRegistration starts registering a new passkey for a signed-in user
+func (s *authService) BeginPasskeyRegistration(userID string) (*PasskeyRegistrationBeginResponse, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	existing, err := s.passkeyRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, errors.New("failed to fetch passkeys")
+	}
+
+	challenge, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	options := PasskeyCreationOptions{
+		Challenge:   challenge,
+		Timeout:     passkeyCeremonyTTL.Milliseconds(),
+		Attestation: "none",
+		AuthenticatorSelection: map[string]string{
+			"residentKey":      "preferred",
+			"userVerification": "required",
+		},
+		ExcludeCredentials: passkeyDescriptors(existing),
+	}
+	options.RP.ID = rp.ID
+	options.RP.Name = s.appName()
+	options.User.ID = base64.RawURLEncoding.EncodeToString([]byte(user.ID))
+	options.User.Name = user.Email
+	options.User.DisplayName = user.FullName
+	for _, alg := range []int{util.COSEAlgES256, util.COSEAlgEdDSA, util.COSEAlgRS256} {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+
+	sessionID := uuid.New().String()
+	s.passkeyChallenges.put(sessionID, passkeyChallenge{challenge: challenge, userID: user.ID})
+
+	return &PasskeyRegistrationBeginResponse{SessionID: sessionID, PublicKey: options}, nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator response and stores the credential
+func (s *authService) FinishPasskeyRegistration(userID string, req PasskeyRegistrationRequest) (*model.PasskeyCredential, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	pending, ok := s.passkeyChallenges.take(req.SessionID)
+	if !ok || pending.userID != userID {
+		return nil, errors.New("passkey registration expired, please try again")
+	}
+
+	clientDataJSON, err := util.DecodeBase64URL(req.Credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.New("invalid client data")
+	}
+	attestationObject, err := util.DecodeBase64URL(req.Credential.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.New("invalid attestation object")
+	}
+
+	verified, err := util.VerifyWebAuthnRegistration(rp, pending.challenge, clientDataJSON, attestationObject, true)
+	if err != nil {
+		return nil, fmt.Errorf("passkey verification failed: %w", err)
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(verified.ID)
+	if existing, _ := s.passkeyRepo.FindByCredentialID(credentialID); existing != nil {
+		return nil, errors.New("passkey already registered")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	credential := &model.PasskeyCredential{
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    int64(verified.SignCount),
+		Name:         name,
+	}
+	if aaguid, err := uuid.FromBytes(verified.AAGUID); err == nil {
+		value := aaguid.String()
+		credential.AAGUID = &value
+	}
+	if len(req.Credential.Response.Transports) > 0 {
+		transports := strings.Join(req.Credential.Response.Transports, ",")
+		credential.Transports = &transports
+	}
+
+	if err := s.passkeyRepo.Create(credential); err != nil {
+		return nil, fmt.Errorf("failed to save passkey: %w", err)
+	}
+
+	if err := s.userRepo.UpdateFields(userID, map[string]interface{}{"login_type": model.LoginTypePasskey}); err != nil {
+		log.Printf("Failed to set login type of user %s to passkey: %v", userID, err)
+	}
+
+	return credential, nil
+}
+
+// BeginPasskeyLogin starts a passkey login. Without an email the browser offers
+// any discoverable passkey for this site.
+func (s *authService) BeginPasskeyLogin(email string) (*PasskeyLoginBeginResponse, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := passkeyChallenge{}
+	options := PasskeyRequestOptions{
+		RPID:             rp.ID,
+		Timeout:          passkeyCeremonyTTL.Milliseconds(),
+		UserVerification: "required",
+		AllowCredentials: []PasskeyCredentialDescriptor{},
+	}
+
+	if email != "" {
+		// Don't reveal whether the account exists: unknown emails simply get no credentials
+		if user, err := s.userRepo.FindByEmail(email); err == nil {
+			credentials, _ := s.passkeyRepo.FindByUserID(user.ID)
+			options.AllowCredentials = passkeyDescriptors(credentials)
+			pending.userID = user.ID
+		}
+	}
+
+	challenge, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	options.Challenge = challenge
+	pending.challenge = challenge
+
+	sessionID := uuid.New().String()
+	s.passkeyChallenges.put(sessionID, pending)
+
+	return &PasskeyLoginBeginResponse{SessionID: sessionID, PublicKey: options}, nil
+}
+
+// FinishPasskeyLogin verifies the assertion and signs the user in.
+// Passkeys require user verification, so they satisfy two-factor authentication on their own.
+func (s *authService) FinishPasskeyLogin(req PasskeyLoginRequest, client ClientInfo) (*AuthResponse, error) {
+	credential, err := s.verifyPasskeyAssertion(req)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(credential.UserID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("account is deactivated")
+	}
+
+	// Update last login
+	s.userRepo.UpdateLastLogin(user.ID)
+
+	return s.issueTokens(user, client)
+}
+
+// verifyPasskeyAssertion checks an assertion for a challenge from
+// BeginPasskeyLogin and returns the credential that signed it
+func (s *authService) verifyPasskeyAssertion(req PasskeyLoginRequest) (*model.PasskeyCredential, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	pending, ok := s.passkeyChallenges.take(req.SessionID)
+	if !ok {
+		return nil, errors.New("passkey login expired, please try again")
+	}
+
+	rawID, err := util.DecodeBase64URL(req.Credential.ID)
+	if err != nil {
+		return nil, errors.New("invalid passkey")
+	}
+
+	credential, err := s.passkeyRepo.FindByCredentialID(base64.RawURLEncoding.EncodeToString(rawID))
+	if err != nil {
+		return nil, errors.New("invalid passkey")
+	}
+	if pending.userID != "" && credential.UserID != pending.userID {
+		return nil, errors.New("invalid passkey")
+	}
+
+	clientDataJSON, err := util.DecodeBase64URL(req.Credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.New("invalid client data")
+	}
+	authData, err := util.DecodeBase64URL(req.Credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errors.New("invalid authenticator data")
+	}
+	signature, err := util.DecodeBase64URL(req.Credential.Response.Signature)
+	if err != nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	signCount, err := util.VerifyWebAuthnAssertion(rp, pending.challenge, credential.PublicKey, uint32(credential.SignCount), clientDataJSON, authData, signature, true)
+	if err != nil {
+		log.Printf("Passkey assertion failed for credential %s: %v", credential.ID, err)
+		return nil, errors.New("invalid passkey")
+	}
+
+	if err := s.passkeyRepo.UpdateSignCount(credential.ID, int64(signCount)); err != nil {
+		return nil, fmt.Errorf("failed to update passkey: %w", err)
+	}
+
+	return credential, nil
+}
+
+func (s *authService) GetPasskeys(userID string) ([]model.PasskeyCredential, error) {
+	credentials, err := s.passkeyRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, errors.New("failed to fetch passkeys")
+	}
+	return credentials, nil
+}
+
+func (s *authService) DeletePasskey(userID, passkeyID string) error {
+	deleted, err := s.passkeyRepo.Delete(passkeyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if !deleted {
+		return errors.New("passkey not found")
+	}
+
+	if count, err := s.passkeyRepo.CountByUserID(userID); err == nil && count == 0 {
+		if user, err := s.userRepo.FindByID(userID); err == nil && user.LoginType == model.LoginTypePasskey {
+			s.userRepo.UpdateFields(userID, map[string]interface{}{"login_type": s.loginTypeWithoutPasskey(user)})
+		}
+	}
+
+	return nil
+}
+
+// loginTypeWithoutPasskey is the login type an account falls back to when its
+// last passkey is removed: its password, else its oldest linked identity.
+// Accounts with neither can only have been provisioned through SCIM.
+func (s *authService) loginTypeWithoutPasskey(user *model.User) string {
+	if user.HasPassword() {
+		return model.LoginTypeCredential
+	}
+	if identities, err := s.identityRepo.FindByUserID(user.ID); err == nil && len(identities) > 0 {
+		return identities[0].Provider
+	}
+	return model.LoginTypeSCIM
+}
+
+func (s *authService) relyingParty() (util.WebAuthnRelyingParty, error) {
+	if s.config == nil || s.config.WebAuthnRPID == "" {
+		return util.WebAuthnRelyingParty{}, errors.New("passkeys are not configured")
+	}
+	return util.WebAuthnRelyingParty{
+		ID:      s.config.WebAuthnRPID,
+		Origins: s.config.WebAuthnOrigins,
+	}, nil
+}
+
+func passkeyDescriptors(credentials []model.PasskeyCredential) []PasskeyCredentialDescriptor {
+	descriptors := make([]PasskeyCredentialDescriptor, len(credentials))
+	for i, credential := range credentials {
+		descriptors[i] = PasskeyCredentialDescriptor{Type: "public-key", ID: credential.CredentialID}
+		if credential.Transports != nil {
+			descriptors[i].Transports = strings.Split(*credential.Transports, ",")
+		}
+	}
+	return descriptors
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/model"
+)
+
+func TestDeletePasskeyRestoresLoginType(t *testing.T) {
+	withPassword := activeUser("password@example.org")
+	withPassword.LoginType = model.LoginTypePasskey
+
+	withIdentity := activeUser("sso@example.org")
+	withIdentity.PasswordHash = ""
+	withIdentity.LoginType = model.LoginTypePasskey
+
+	provisioned := activeUser("scim@example.org")
+	provisioned.PasswordHash = ""
+	provisioned.LoginType = model.LoginTypePasskey
+
+	auth := newTestAuth(withPassword, withIdentity, provisioned)
+	auth.identity.identities = []model.UserIdentity{
+		{ID: "identity-1", UserID: withIdentity.ID, Provider: "keycloak"},
+		{ID: "identity-2", UserID: withIdentity.ID, Provider: model.LoginTypeGoogle},
+	}
+
+	tests := []struct {
+		user *model.User
+		want string
+	}{
+		{withPassword, model.LoginTypeCredential},
+		{withIdentity, "keycloak"},
+		{provisioned, model.LoginTypeSCIM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user.Email, func(t *testing.T) {
+			auth.passkeys.credentials = []model.PasskeyCredential{
+				{ID: "first", UserID: tt.user.ID},
+				{ID: "second", UserID: tt.user.ID},
+			}
+
+			if err := auth.DeletePasskey(tt.user.ID, "first"); err != nil {
+				t.Fatal(err)
+			}
+			if got := auth.users.users[tt.user.ID].LoginType; got != model.LoginTypePasskey {
+				t.Errorf("login type with a passkey left = %q, want passkey", got)
+			}
+
+			if err := auth.DeletePasskey(tt.user.ID, "second"); err != nil {
+				t.Fatal(err)
+			}
+			if got := auth.users.users[tt.user.ID].LoginType; got != tt.want {
+				t.Errorf("login type without passkeys = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeletePasskeyChecksOwner(t *testing.T) {
+	owner := activeUser("owner@example.org")
+	owner.LoginType = model.LoginTypePasskey
+	other := activeUser("other@example.org")
+	auth := newTestAuth(owner, other)
+	auth.passkeys.credentials = []model.PasskeyCredential{{ID: "key", UserID: owner.ID}}
+
+	if err := auth.DeletePasskey(other.ID, "key"); err == nil {
+		t.Error("another user deleted the passkey")
+	}
+	if auth.users.users[owner.ID].LoginType != model.LoginTypePasskey {
+		t.Error("login type changed although the passkey was not deleted")
+	}
+}
+
+func TestUnlinkIdentityKeepsPasskeyOnlyAccountsReachable(t *testing.T) {
+	user := activeUser("sso@example.org")
+	user.PasswordHash = ""
+	user.LoginType = "keycloak"
+	auth := newTestAuth(user)
+	auth.identity.identities = []model.UserIdentity{{ID: "identity-1", UserID: user.ID, Provider: "keycloak"}}
+
+	if err := auth.UnlinkIdentity(user.ID, "identity-1"); err == nil {
+		t.Fatal("unlinked the only sign-in method")
+	}
+
+	// With a passkey the identity is no longer the only way in
+	auth.users.users[user.ID].LoginType = model.LoginTypePasskey
+	if err := auth.UnlinkIdentity(user.ID, "identity-1"); err != nil {
+		t.Errorf("UnlinkIdentity failed: %v", err)
+	}
+}
+
+func TestPasswordLoginPointsPasskeyAccountsToPasskeys(t *testing.T) {
+	user := activeUser("user@example.org")
+	user.PasswordHash = ""
+	user.LoginType = model.LoginTypePasskey
+	auth := newTestAuth(user)
+
+	_, err := auth.Login(LoginRequest{Email: user.Email, Password: "whatever"}, ClientInfo{})
+	if err == nil || err.Error() != "email sudah terdaftar dengan passkey. Silakan login dengan passkey" {
+		t.Errorf("Login error = %v", err)
+	}
+	if _, err := auth.Register(RegisterRequest{FullName: "X", Email: user.Email, Password: "password123"}); err == nil {
+		t.Error("registered an email that belongs to a passkey account")
+	}
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+const attemptEmailChange = "email_change"
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.]{3,30}$`)
+	phonePattern    = regexp.MustCompile(`^\+?[0-9 ()-]{6,20}$`)
+	validGenders    = map[string]bool{"male": true, "female": true, "other": true}
+)
+
+// UpdateProfileRequest holds the fields a user may change. Omitted fields are
+// left alone; an empty string clears an optional field.
+type UpdateProfileRequest struct {
+	FullName     *string `json:"full_name" binding:"omitempty,max=255"`
+	Username     *string `json:"username"`
+	Phone        *string `json:"phone"`
+	Gender       *string `json:"gender"`
+	DateOfBirth  *string `json:"date_of_birth"`
+	ProfilePhoto *string `json:"profile_photo" binding:"omitempty,url"`
+	Locale       *string `json:"locale"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,max=128"`
+	Reauthentication
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password"`
+	Reauthentication
+}
+
+// Reauthentication proves that a request of an account without a password
+// comes from its owner and not just from someone holding an access token: a
+// TOTP or recovery code when 2FA is on, otherwise a passkey assertion for a
+// challenge from BeginPasskeyLogin
+type Reauthentication struct {
+	MFACode string               `json:"mfa_code"`
+	Passkey *PasskeyLoginRequest `json:"passkey"`
+}
+
+// UpdateProfile applies a partial profile update
+func (s *authService) UpdateProfile(userID string, req UpdateProfileRequest) (*model.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	fields := make(map[string]interface{})
+
+	if req.FullName != nil {
+		fullName := strings.TrimSpace(*req.FullName)
+		if fullName == "" {
+			return nil, errors.New("full name is required")
+		}
+		fields["full_name"] = fullName
+	}
+
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if username == "" {
+			fields["username"] = nil
+		} else {
+			if !usernamePattern.MatchString(username) {
+				return nil, errors.New("username must be 3-30 characters of letters, numbers, dots or underscores")
+			}
+			if existing, _ := s.userRepo.FindByUsername(username); existing != nil && existing.ID != user.ID {
+				return nil, errors.New("username already taken")
+			}
+			fields["username"] = username
+		}
+	}
+
+	if req.Phone != nil {
+		phone := strings.TrimSpace(*req.Phone)
+		if phone == "" {
+			fields["phone"] = nil
+		} else {
+			if !phonePattern.MatchString(phone) {
+				return nil, errors.New("invalid phone number")
+			}
+			fields["phone"] = phone
+		}
+	}
+
+	if req.Gender != nil {
+		gender := strings.ToLower(strings.TrimSpace(*req.Gender))
+		if gender == "" {
+			fields["gender"] = nil
+		} else {
+			if !validGenders[gender] {
+				return nil, errors.New("gender must be male, female or other")
+			}
+			fields["gender"] = gender
+		}
+	}
+
+	if req.DateOfBirth != nil {
+		if *req.DateOfBirth == "" {
+			fields["date_of_birth"] = nil
+		} else {
+			dob, err := time.Parse("2006-01-02", *req.DateOfBirth)
+			if err != nil {
+				return nil, errors.New("date of birth must be in YYYY-MM-DD format")
+			}
+			if dob.After(time.Now()) || dob.Year() < 1900 {
+				return nil, errors.New("invalid date of birth")
+			}
+			fields["date_of_birth"] = dob
+		}
+	}
+
+	if req.ProfilePhoto != nil {
+		if *req.ProfilePhoto == "" {
+			fields["profile_photo"] = nil
+		} else {
+			fields["profile_photo"] = *req.ProfilePhoto
+		}
+	}
+
+	if req.Locale != nil {
+		locale := strings.ToLower(strings.TrimSpace(*req.Locale))
+		if !slices.Contains(model.Locales, locale) {
+			return nil, fmt.Errorf("locale must be one of: %s", strings.Join(model.Locales, ", "))
+		}
+		fields["locale"] = locale
+	}
+
+	if len(fields) == 0 {
+		return user, nil
+	}
+
+	if err := s.userRepo.UpdateFields(user.ID, fields); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, errors.New("username already taken")
+		}
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	// Drop an uploaded avatar once the photo is replaced or cleared
+	if _, changed := fields["profile_photo"]; changed && user.ProfilePhoto != nil {
+		deleteStoredAvatar(s.files, user.ID, *user.ProfilePhoto)
+	}
+
+	return s.userRepo.FindByID(user.ID)
+}
+
+// ChangePassword sets a new password and signs out every other device.
+// Accounts without a password re-authenticate before setting their first one.
+func (s *authService) ChangePassword(userID, currentSessionID string, req ChangePasswordRequest, client ClientInfo) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.PasswordHash != "" {
+		if req.CurrentPassword == "" || !util.CheckPasswordHash(req.CurrentPassword, user.PasswordHash) {
+			return errors.New("current password is incorrect")
+		}
+		if req.CurrentPassword == req.NewPassword {
+			return errors.New("new password must be different from the current password")
+		}
+	} else if err := s.reauthenticate(user, req.Reauthentication, client); err != nil {
+		return err
+	}
+
+	passwordHash, err := util.HashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := s.userRepo.UpdatePassword(user.ID, passwordHash); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	s.audit.Record(AuditEntry{
+		ActorID: user.ID,
+		Action:  model.AuditPasswordChanged,
+		Client:  client,
+	})
+
+	return s.revokeOtherSessions(user.ID, currentSessionID, "password_changed")
+}
+
+// RequestEmailChange sends a code to the new address. The email is only
+// swapped once that code is confirmed.
+func (s *authService) RequestEmailChange(userID string, req ChangeEmailRequest, client ClientInfo) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.PasswordHash != "" {
+		if !util.CheckPasswordHash(req.Password, user.PasswordHash) {
+			return errors.New("password is incorrect")
+		}
+	} else if err := s.reauthenticate(user, req.Reauthentication, client); err != nil {
+		return err
+	}
+
+	newEmail := strings.ToLower(strings.TrimSpace(req.NewEmail))
+	if newEmail == strings.ToLower(user.Email) {
+		return errors.New("new email is the same as the current email")
+	}
+	if existing, _ := s.userRepo.FindByEmail(newEmail); existing != nil {
+		return errors.New("email already registered")
+	}
+
+	otpCode, err := s.issueCode(user.ID, model.CodePurposeEmailChange, &newEmail)
+	if err != nil {
+		return err
+	}
+
+	s.queueEmail(util.EmailMessage{
+		To:     newEmail,
+		Body:   otpCode,
+		Type:   "email_change",
+		Locale: user.Locale,
+	})
+
+	return nil
+}
+
+// ConfirmEmailChange swaps the email after checking the code sent to the new
+// address. The old address is told about the change and every other device is
+// signed out, so a stolen session cannot quietly keep the account.
+func (s *authService) ConfirmEmailChange(userID, currentSessionID, code string, client ClientInfo) (*model.User, error) {
+	if err := s.limiter.check(attemptEmailChange, userID, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	record, err := s.consumeCode(userID, model.CodePurposeEmailChange, code)
+	if err != nil {
+		s.limiter.fail(attemptEmailChange, userID, client.IPAddress)
+		s.auditOTP(userID, model.CodePurposeEmailChange, false, client)
+		return nil, err
+	}
+	s.limiter.succeed(attemptEmailChange, userID)
+	s.auditOTP(userID, model.CodePurposeEmailChange, true, client)
+
+	if record.Target == nil {
+		return nil, errInvalidCode
+	}
+	newEmail := *record.Target
+
+	// The address may have been taken since the code was sent
+	if existing, _ := s.userRepo.FindByEmail(newEmail); existing != nil {
+		return nil, errors.New("email already registered")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	oldEmail := user.Email
+
+	if err := s.userRepo.UpdateFields(userID, map[string]interface{}{
+		"email":       newEmail,
+		"is_verified": true,
+	}); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, errors.New("email already registered")
+		}
+		return nil, fmt.Errorf("failed to update email: %w", err)
+	}
+
+	s.queueEmail(util.EmailMessage{
+		To:     oldEmail,
+		Body:   newEmail,
+		Type:   "email_changed",
+		Locale: user.Locale,
+	})
+	s.revokeOtherSessions(userID, currentSessionID, "email_changed")
+	s.audit.Record(AuditEntry{
+		ActorID: userID,
+		Action:  model.AuditEmailChanged,
+		Client:  client,
+	})
+
+	user, err = s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	s.autoJoinOrganizations(user)
+	return user, nil
+}
+
+// reauthenticate checks the proof an account without a password gives for a
+// sensitive change. Accounts with neither 2FA nor a passkey have nothing to
+// prove it with and have to set up one of them first.
+func (s *authService) reauthenticate(user *model.User, reauth Reauthentication, client ClientInfo) error {
+	switch {
+	case user.MFAEnabled && reauth.MFACode != "":
+		if err := s.limiter.check(attemptMFA, user.ID, client.IPAddress); err != nil {
+			return err
+		}
+		if err := s.checkMFACode(user, reauth.MFACode); err != nil {
+			s.limiter.fail(attemptMFA, user.ID, client.IPAddress)
+			return err
+		}
+		s.limiter.succeed(attemptMFA, user.ID)
+		return nil
+	case reauth.Passkey != nil:
+		credential, err := s.verifyPasskeyAssertion(*reauth.Passkey)
+		if err != nil {
+			return err
+		}
+		if credential.UserID != user.ID {
+			return errors.New("invalid passkey")
+		}
+		return nil
+	case user.MFAEnabled:
+		return errors.New("authentication code is required to confirm this change")
+	case user.LoginType == model.LoginTypePasskey:
+		return errors.New("passkey confirmation is required to confirm this change")
+	default:
+		return errors.New("set up two-factor authentication or a passkey before making this change")
+	}
+}
+
+// queueEmail publishes an email to RabbitMQ without blocking the request
+func (s *authService) queueEmail(msg util.EmailMessage) {
+	go func() {
+		s.ensureRabbitMQ() // Try to reconnect if needed
+		if s.rabbitMQ == nil {
+			log.Printf("Warning: RabbitMQ not available, %s email not sent for %s", msg.Type, msg.To)
+			return
+		}
+		if err := s.rabbitMQ.PublishEmail(msg); err != nil {
+			log.Printf("Failed to publish %s email: %v", msg.Type, err)
+			return
+		}
+		log.Printf("%s email queued successfully for %s", msg.Type, msg.To)
+	}()
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+// ssoUser returns an account that signs in through Google and has no password
+func ssoUser(email string) *model.User {
+	user := activeUser(email)
+	user.PasswordHash = ""
+	user.LoginType = model.LoginTypeGoogle
+	return user
+}
+
+func TestRequestEmailChangeChecksPassword(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	req := ChangeEmailRequest{NewEmail: "new@example.org", Password: "wrong"}
+	if err := auth.RequestEmailChange(user.ID, req, ClientInfo{}); err == nil {
+		t.Error("email change with a wrong password was accepted")
+	}
+
+	req.Password = "correct horse"
+	if err := auth.RequestEmailChange(user.ID, req, ClientInfo{}); err != nil {
+		t.Errorf("email change with the right password failed: %v", err)
+	}
+}
+
+func TestRequestEmailChangeReauthenticatesPasswordlessAccounts(t *testing.T) {
+	user := ssoUser("user@example.org")
+	auth := newTestAuth(user)
+
+	// An access token alone is not enough without a second factor to check
+	req := ChangeEmailRequest{NewEmail: "new@example.org"}
+	if err := auth.RequestEmailChange(user.ID, req, ClientInfo{}); err == nil {
+		t.Fatal("passwordless account changed its email with only an access token")
+	}
+	if len(auth.codes.codes) != 0 {
+		t.Error("a code was sent to the new address")
+	}
+
+	secret := auth.enableMFA(user.ID)
+	if err := auth.RequestEmailChange(user.ID, req, ClientInfo{}); err == nil {
+		t.Error("email change without the authentication code was accepted")
+	}
+	req.MFACode = "000000"
+	if err := auth.RequestEmailChange(user.ID, req, ClientInfo{}); err == nil {
+		t.Error("email change with a wrong authentication code was accepted")
+	}
+	req.MFACode = currentTOTP(t, secret)
+	if err := auth.RequestEmailChange(user.ID, req, ClientInfo{}); err != nil {
+		t.Errorf("email change with the authentication code failed: %v", err)
+	}
+}
+
+func TestChangePasswordReauthenticatesPasswordlessAccounts(t *testing.T) {
+	user := ssoUser("user@example.org")
+	auth := newTestAuth(user)
+
+	// Setting a first password would otherwise get around the email change check
+	req := ChangePasswordRequest{NewPassword: "new password 123"}
+	if err := auth.ChangePassword(user.ID, "", req, ClientInfo{}); err == nil {
+		t.Fatal("passwordless account set a password with only an access token")
+	}
+	if auth.users.users[user.ID].PasswordHash != "" {
+		t.Fatal("password was set")
+	}
+
+	secret := auth.enableMFA(user.ID)
+	req.MFACode = currentTOTP(t, secret)
+	if err := auth.ChangePassword(user.ID, "", req, ClientInfo{}); err != nil {
+		t.Fatalf("setting a first password failed: %v", err)
+	}
+	if !util.CheckPasswordHash("new password 123", auth.users.users[user.ID].PasswordHash) {
+		t.Error("password was not set")
+	}
+}
+
+func TestConfirmEmailChangeSignsOutOtherDevices(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	current, err := auth.issueTokens(user, ClientInfo{DeviceName: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := auth.issueTokens(user, ClientInfo{DeviceName: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := util.ValidateTokenType(current.AccessToken, auth.keys, util.TokenTypeAccess)
+
+	newEmail := "new@example.org"
+	code, err := auth.issueCode(user.ID, model.CodePurposeEmailChange, &newEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ConfirmEmailChange(user.ID, claims.SessionID, "000000", ClientInfo{}); err == nil {
+		t.Fatal("wrong code was accepted")
+	}
+
+	updated, err := auth.ConfirmEmailChange(user.ID, claims.SessionID, code, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Email != newEmail {
+		t.Errorf("email = %q, want %q", updated.Email, newEmail)
+	}
+	if !auth.IsSessionActive(claims.SessionID) {
+		t.Error("the device that confirmed the change was signed out")
+	}
+	if _, err := auth.RefreshToken(other.RefreshToken); err == nil {
+		t.Error("another device is still signed in after the email change")
+	}
+	if auth.auditLog.last(model.AuditEmailChanged) == nil {
+		t.Error("email change was not audited")
+	}
+}
@@ -4,45 +4,114 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"strings"
 	"time"
 
 	"yourapp/internal/config"
 	"yourapp/internal/model"
 	"yourapp/internal/repository"
+	"yourapp/internal/storage"
 	"yourapp/internal/util"
 )
 
 type AuthService interface {
 	Register(req RegisterRequest) (*RegisterResponse, error)
-	Login(req LoginRequest) (*AuthResponse, error)
-	VerifyOTP(email, otpCode string) (*AuthResponse, error)
+	Login(req LoginRequest, client ClientInfo) (*AuthResponse, error)
+	VerifyOTP(email, otpCode string, client ClientInfo) (*AuthResponse, error)
 	ResendOTP(email string) error
-	GoogleOAuth(req GoogleOAuthRequest) (*AuthResponse, error)
+	RequestMagicLink(email, nonce string, client ClientInfo) error
+	VerifyMagicLink(token, nonce string, client ClientInfo) (*AuthResponse, error)
+	GoogleOAuth(req GoogleOAuthRequest, client ClientInfo) (*AuthResponse, error)
+	GetOIDCProviders() []OIDCProviderInfo
+	BeginOIDCLogin(provider, nonce string) (string, error)
+	BeginOIDCLink(userID, provider, nonce string) (string, error)
+	FinishOIDCLogin(provider, code, state, nonce string, client ClientInfo) (*OIDCCallbackResult, error)
+	ExchangeOIDCCode(code string) (*AuthResponse, error)
+	GetIdentities(userID string) ([]model.UserIdentity, error)
+	UnlinkIdentity(userID, identityID string) error
 	RefreshToken(refreshToken string) (*AuthResponse, error)
+	Logout(refreshToken string) error
+	LogoutAll(userID string) error
+	GetSessions(userID, currentSessionID string) ([]SessionResponse, error)
+	RevokeSession(userID, sessionID string) error
+	IsSessionActive(sessionID string) bool
+	EnrollMFA(userID string) (*MFAEnrollResponse, error)
+	ConfirmMFA(userID, code string) (*MFAConfirmResponse, error)
+	DisableMFA(userID, code string) error
+	VerifyMFA(mfaToken, code string, client ClientInfo) (*AuthResponse, error)
+	BeginPasskeyRegistration(userID string) (*PasskeyRegistrationBeginResponse, error)
+	FinishPasskeyRegistration(userID string, req PasskeyRegistrationRequest) (*model.PasskeyCredential, error)
+	BeginPasskeyLogin(email string) (*PasskeyLoginBeginResponse, error)
+	FinishPasskeyLogin(req PasskeyLoginRequest, client ClientInfo) (*AuthResponse, error)
+	GetPasskeys(userID string) ([]model.PasskeyCredential, error)
+	DeletePasskey(userID, passkeyID string) error
 	RequestResetPassword(email string) error
-	VerifyResetPassword(email, otpCode, newPassword string) error
-	ResetPassword(token, newPassword string) (*AuthResponse, error)
-	VerifyEmail(token string) (*AuthResponse, error)
+	VerifyResetPassword(email, otpCode, newPassword string, client ClientInfo) error
+	ResetPassword(email, otpCode, newPassword string, client ClientInfo) (*AuthResponse, error)
+	VerifyEmail(token string, client ClientInfo) (*AuthResponse, error)
 	GetMe(userID string) (*model.User, error)
+	UpdateProfile(userID string, req UpdateProfileRequest) (*model.User, error)
+	ChangePassword(userID, currentSessionID string, req ChangePasswordRequest, client ClientInfo) error
+	RequestEmailChange(userID string, req ChangeEmailRequest, client ClientInfo) error
+	ConfirmEmailChange(userID, currentSessionID, code string, client ClientInfo) (*model.User, error)
+	UploadAvatar(userID string, data []byte) (*AvatarResponse, error)
+	DeleteAccount(userID string, req DeleteAccountRequest) (*time.Time, error)
+	CreateAccessToken(userID string, req CreateAccessTokenRequest) (*CreateAccessTokenResponse, error)
+	GetAccessTokens(userID string) ([]AccessTokenResponse, error)
+	RevokeAccessToken(userID, tokenID string) error
+	AuthenticateAccessToken(token, ipAddress string) (*AccessTokenPrincipal, error)
+	ListUsers(req ListUsersRequest) (*UserListResponse, error)
+	SetUserActive(actorID, userID string, active bool, client ClientInfo) (*model.User, error)
+	SetProvisionedUserActive(orgID, userID string, active bool, client ClientInfo) (*model.User, error)
 }
 
 type authService struct {
-	userRepo  repository.UserRepository
-	jwtSecret string
-	rabbitMQ  *util.RabbitMQClient
-	config    *config.Config
+	userRepo     repository.UserRepository
+	sessionRepo  repository.SessionRepository
+	mfaRepo      repository.MFARepository
+	passkeyRepo  repository.PasskeyRepository
+	identityRepo repository.IdentityRepository
+	jwtSecret    string
+	keys         *util.KeyRing
+	rabbitMQ     *util.RabbitMQClient
+	config       *config.Config
+	sessions     *sessionCache
+	google       *util.GoogleIDTokenVerifier
+	limiter      *attemptLimiter
+	codeRepo     repository.OneTimeCodeRepository
+	files        storage.Storage
+	audit        AuditService
+
+	accessTokenRepo   repository.AccessTokenRepository
+	orgRepo           repository.OrganizationRepository
+	passkeyChallenges *pendingStore[passkeyChallenge]
+	oidcProviders     map[string]*oidcProvider
+	oidcStates        *pendingStore[oidcLoginState]
+	oidcHandoffs      *pendingStore[*AuthResponse]
 }
 
+// ClientInfo describes the device a request came from, recorded on the session
+type ClientInfo struct {
+	IPAddress  string
+	UserAgent  string
+	DeviceName string
+}
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+	sessionCacheTTL = 30 * time.Second
+)
+
 type RegisterRequest struct {
 	FullName    string  `json:"full_name" binding:"required"`
 	Email       string  `json:"email" binding:"required,email"`
 	Username    *string `json:"username,omitempty"`
 	Phone       *string `json:"phone,omitempty"`
 	Password    string  `json:"password" binding:"required,min=8"`
-	UserType    string  `json:"user_type"`
 	Gender      *string `json:"gender,omitempty"`
 	DateOfBirth *string `json:"date_of_birth,omitempty"`
+	Locale      string  `json:"locale,omitempty" binding:"omitempty,oneof=id en"`
 }
 
 type LoginRequest struct {
@@ -51,10 +120,7 @@ type LoginRequest struct {
 }
 
 type GoogleOAuthRequest struct {
-	Email        string `json:"email" binding:"required,email"`
-	FullName     string `json:"full_name" binding:"required"`
-	ProfilePhoto string `json:"profile_photo"`
-	GoogleID     string `json:"google_id" binding:"required"`
+	IDToken string `json:"id_token" binding:"required"`
 }
 
 type RegisterResponse struct {
@@ -64,29 +130,77 @@ type RegisterResponse struct {
 	VerificationToken    *string     `json:"verification_token,omitempty"`
 }
 
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	DeviceName *string   `json:"device_name,omitempty"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
 type AuthResponse struct {
-	User         *model.User `json:"user"`
-	AccessToken  string      `json:"access_token"`
-	RefreshToken string      `json:"refresh_token"`
-	ExpiresIn    int         `json:"expires_in"`
+	User         *model.User `json:"user,omitempty"`
+	AccessToken  string      `json:"access_token,omitempty"`
+	RefreshToken string      `json:"refresh_token,omitempty"`
+	ExpiresIn    int         `json:"expires_in,omitempty"`
+	MFARequired  bool        `json:"mfa_required,omitempty"`
+	MFAToken     string      `json:"mfa_token,omitempty"`
 }
 
-func NewAuthService(userRepo repository.UserRepository, jwtSecret string, rabbitMQ *util.RabbitMQClient) AuthService {
+func NewAuthService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, mfaRepo repository.MFARepository, passkeyRepo repository.PasskeyRepository, identityRepo repository.IdentityRepository, codeRepo repository.OneTimeCodeRepository, accessTokenRepo repository.AccessTokenRepository, orgRepo repository.OrganizationRepository, audit AuditService, jwtSecret string, rabbitMQ *util.RabbitMQClient) AuthService {
 	return &authService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
-		rabbitMQ:  rabbitMQ,
-		config:    nil, // Will be set if needed
+		userRepo:     userRepo,
+		sessionRepo:  sessionRepo,
+		mfaRepo:      mfaRepo,
+		passkeyRepo:  passkeyRepo,
+		identityRepo: identityRepo,
+		codeRepo:     codeRepo,
+		audit:        audit,
+		jwtSecret:    jwtSecret,
+		keys:         util.NewHMACKeyRing(jwtSecret),
+		rabbitMQ:     rabbitMQ,
+		config:       nil, // Will be set if needed
+		sessions:     newSessionCache(sessionCacheTTL),
+		limiter:      newAttemptLimiter(nil),
+		files:        newFileStorage(nil),
+
+		accessTokenRepo:   accessTokenRepo,
+		orgRepo:           orgRepo,
+		passkeyChallenges: newPendingStore[passkeyChallenge](passkeyCeremonyTTL),
+		oidcProviders:     newOIDCProviders(nil),
+		oidcStates:        newPendingStore[oidcLoginState](oidcLoginTTL),
+		oidcHandoffs:      newPendingStore[*AuthResponse](oidcHandoffTTL),
 	}
 }
 
 // NewAuthServiceWithConfig creates auth service with config for RabbitMQ reconnection
-func NewAuthServiceWithConfig(userRepo repository.UserRepository, jwtSecret string, rabbitMQ *util.RabbitMQClient, cfg *config.Config) AuthService {
+func NewAuthServiceWithConfig(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, mfaRepo repository.MFARepository, passkeyRepo repository.PasskeyRepository, identityRepo repository.IdentityRepository, codeRepo repository.OneTimeCodeRepository, accessTokenRepo repository.AccessTokenRepository, orgRepo repository.OrganizationRepository, audit AuditService, jwtSecret string, keys *util.KeyRing, rabbitMQ *util.RabbitMQClient, cfg *config.Config) AuthService {
 	return &authService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
-		rabbitMQ:  rabbitMQ,
-		config:    cfg,
+		userRepo:     userRepo,
+		sessionRepo:  sessionRepo,
+		mfaRepo:      mfaRepo,
+		passkeyRepo:  passkeyRepo,
+		identityRepo: identityRepo,
+		codeRepo:     codeRepo,
+		audit:        audit,
+		jwtSecret:    jwtSecret,
+		keys:         keys,
+		rabbitMQ:     rabbitMQ,
+		config:       cfg,
+		sessions:     newSessionCache(sessionCacheTTL),
+		google:       util.NewGoogleIDTokenVerifier(cfg.GoogleClientID, cfg.GoogleJWKSURL),
+		limiter:      newAttemptLimiter(cfg),
+		files:        newFileStorage(cfg),
+
+		accessTokenRepo:   accessTokenRepo,
+		orgRepo:           orgRepo,
+		passkeyChallenges: newPendingStore[passkeyChallenge](passkeyCeremonyTTL),
+		oidcProviders:     newOIDCProviders(cfg),
+		oidcStates:        newPendingStore[oidcLoginState](oidcLoginTTL),
+		oidcHandoffs:      newPendingStore[*AuthResponse](oidcHandoffTTL),
 	}
 }
 
@@ -116,9 +230,15 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 	// Check if email already exists
 	existingUser, _ := s.userRepo.FindByEmail(req.Email)
 	if existingUser != nil {
-		if existingUser.LoginType == "google" {
+		if existingUser.LoginType == model.LoginTypeGoogle {
 			return nil, errors.New("email already registered with Google. Please use Google Sign In")
 		}
+		if existingUser.LoginType == model.LoginTypePasskey {
+			return nil, errors.New("email already registered with a passkey. Please sign in with your passkey")
+		}
+		if existingUser.LoginType != model.LoginTypeCredential {
+			return nil, errors.New("email already registered with single sign-on. Please sign in with your identity provider")
+		}
 		return nil, errors.New("email already registered with password. Please login with email and password")
 	}
 
@@ -136,10 +256,6 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Generate OTP
-	otpCode := generateOTP()
-	otpExpiresAt := time.Now().Add(10 * time.Minute)
-
 	// Parse date of birth if provided
 	var dob *time.Time
 	if req.DateOfBirth != nil && *req.DateOfBirth != "" {
@@ -149,11 +265,6 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 		}
 	}
 
-	userType := req.UserType
-	if userType == "" {
-		userType = "member"
-	}
-
 	// Create user
 	user := &model.User{
 		Email:        req.Email,
@@ -161,30 +272,35 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 		Phone:        req.Phone,
 		FullName:     req.FullName,
 		PasswordHash: passwordHash,
-		UserType:     userType,
+		UserType:     model.RoleMember,
 		Gender:       req.Gender,
 		DateOfBirth:  dob,
+		Locale:       req.Locale,
 		IsActive:     true,
 		IsVerified:   false,
-		LoginType:    "credential",
-		OTPCode:      &otpCode,
-		OTPExpiresAt: &otpExpiresAt,
+		LoginType:    model.LoginTypeCredential,
 	}
 
 	if err := s.userRepo.Create(user); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	// Generate OTP
+	otpCode, err := s.issueCode(user.ID, model.CodePurposeVerifyEmail, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	// Send OTP email via RabbitMQ asynchronously (non-blocking)
 	// Same logic as reset password - send to queue immediately without waiting
 	go func() {
 		s.ensureRabbitMQ() // Try to reconnect if needed
 		if s.rabbitMQ != nil {
 			emailMsg := util.EmailMessage{
-				To:      req.Email,
-				Subject: "Kode Verifikasi Email",
-				Body:    otpCode,
-				Type:    "otp",
+				To:     req.Email,
+				Body:   otpCode,
+				Type:   "otp",
+				Locale: user.Locale,
 			}
 			if err := s.rabbitMQ.PublishEmail(emailMsg); err != nil {
 				// Log error but don't fail registration
@@ -205,48 +321,62 @@ func (s *authService) Register(req RegisterRequest) (*RegisterResponse, error) {
 	}, nil
 }
 
-func (s *authService) Login(req LoginRequest) (*AuthResponse, error) {
+func (s *authService) Login(req LoginRequest, client ClientInfo) (*AuthResponse, error) {
+	if err := s.limiter.check(attemptLogin, req.Email, client.IPAddress); err != nil {
+		s.auditLoginFailed("", req.Email, "locked_out", client)
+		return nil, err
+	}
+
 	user, err := s.userRepo.FindByEmail(req.Email)
 	if err != nil {
+		s.limiter.fail(attemptLogin, req.Email, client.IPAddress)
+		s.auditLoginFailed("", req.Email, "unknown_email", client)
 		return nil, errors.New("invalid email or password")
 	}
 
-	// Check if user registered with Google instead of credential
-	if user.LoginType == "google" {
-		return nil, errors.New("email sudah terdaftar dengan Google. Silakan login dengan Google")
-	}
-
-	// Check if user registered with credential
-	if user.LoginType != "credential" {
+	// Accounts created with Google or SSO have no password unless they set one
+	if !user.HasPassword() {
+		s.auditLoginFailed(user.ID, req.Email, "no_password", client)
+		if user.LoginType == model.LoginTypeGoogle {
+			return nil, errors.New("email sudah terdaftar dengan Google. Silakan login dengan Google")
+		}
+		if user.LoginType == model.LoginTypePasskey {
+			return nil, errors.New("email sudah terdaftar dengan passkey. Silakan login dengan passkey")
+		}
 		return nil, errors.New("invalid email or password")
 	}
 
 	// Check password
 	if !util.CheckPasswordHash(req.Password, user.PasswordHash) {
+		s.limiter.fail(attemptLogin, req.Email, client.IPAddress)
+		s.auditLoginFailed(user.ID, req.Email, "invalid_password", client)
 		return nil, errors.New("invalid email or password")
 	}
+	s.limiter.succeed(attemptLogin, req.Email)
 
 	// Check if user is active
 	if !user.IsActive {
+		s.auditLoginFailed(user.ID, req.Email, "account_deactivated", client)
 		return nil, errors.New("account is deactivated")
 	}
 
 	// Check if email is verified
 	if !user.IsVerified {
 		// Generate new OTP
-		otpCode := generateOTP()
-		otpExpiresAt := time.Now().Add(10 * time.Minute)
-		s.userRepo.UpdateOTP(req.Email, otpCode, otpExpiresAt)
+		otpCode, err := s.issueCode(user.ID, model.CodePurposeVerifyEmail, nil)
+		if err != nil {
+			return nil, err
+		}
 
 		// Send OTP email via RabbitMQ asynchronously (non-blocking)
 		go func() {
 			s.ensureRabbitMQ() // Try to reconnect if needed
 			if s.rabbitMQ != nil {
 				emailMsg := util.EmailMessage{
-					To:      req.Email,
-					Subject: "Kode Verifikasi Email",
-					Body:    otpCode,
-					Type:    "otp",
+					To:     req.Email,
+					Body:   otpCode,
+					Type:   "otp",
+					Locale: user.Locale,
 				}
 				if err := s.rabbitMQ.PublishEmail(emailMsg); err != nil {
 					log.Printf("Failed to publish OTP email: %v\n", err)
@@ -261,68 +391,55 @@ func (s *authService) Login(req LoginRequest) (*AuthResponse, error) {
 		return nil, errors.New("email not verified. Please verify your email first")
 	}
 
-	// Update last login
-	s.userRepo.UpdateLastLogin(user.ID)
+	return s.completeLogin(user, client)
+}
 
-	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+func (s *authService) VerifyOTP(email, otpCode string, client ClientInfo) (*AuthResponse, error) {
+	if err := s.limiter.check(attemptVerifyOTP, email, client.IPAddress); err != nil {
+		return nil, err
 	}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		s.limiter.fail(attemptVerifyOTP, email, client.IPAddress)
+		return nil, errInvalidCode
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900, // 15 minutes in seconds
-	}, nil
-}
-
-func (s *authService) VerifyOTP(email, otpCode string) (*AuthResponse, error) {
-	user, err := s.userRepo.VerifyOTP(email, otpCode)
-	if err != nil {
+	if _, err := s.consumeCode(user.ID, model.CodePurposeVerifyEmail, otpCode); err != nil {
+		s.limiter.fail(attemptVerifyOTP, email, client.IPAddress)
+		s.auditOTP(user.ID, model.CodePurposeVerifyEmail, false, client)
 		return nil, err
 	}
+	s.limiter.succeed(attemptVerifyOTP, email)
+	s.auditOTP(user.ID, model.CodePurposeVerifyEmail, true, client)
 
-	// Update last login
-	s.userRepo.UpdateLastLogin(user.ID)
-
-	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
-	}
-
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	if err := s.userRepo.MarkVerified(user.ID); err != nil {
+		return nil, fmt.Errorf("failed to verify user: %w", err)
 	}
+	user.IsVerified = true
+	s.autoJoinOrganizations(user)
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900,
-	}, nil
+	return s.completeLogin(user, client)
 }
 
 func (s *authService) ResendOTP(email string) error {
-	_, err := s.userRepo.FindByEmail(email)
+	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
 		return errors.New("user not found")
 	}
 
-	// Generate new OTP
-	otpCode := generateOTP()
-	otpExpiresAt := time.Now().Add(10 * time.Minute)
+	// Verification codes also sign the user in, so verified accounts never get one
+	if user.IsVerified {
+		return errors.New("email already verified. Please login instead")
+	}
+	if !user.IsActive {
+		return errors.New("account is deactivated")
+	}
 
-	if err := s.userRepo.UpdateOTP(email, otpCode, otpExpiresAt); err != nil {
-		return fmt.Errorf("failed to update OTP: %w", err)
+	// Generate new OTP
+	otpCode, err := s.issueCode(user.ID, model.CodePurposeVerifyEmail, nil)
+	if err != nil {
+		return err
 	}
 
 	// Send OTP email via RabbitMQ asynchronously (non-blocking)
@@ -331,10 +448,10 @@ func (s *authService) ResendOTP(email string) error {
 		s.ensureRabbitMQ() // Try to reconnect if needed
 		if s.rabbitMQ != nil {
 			emailMsg := util.EmailMessage{
-				To:      email,
-				Subject: "Kode Verifikasi Email",
-				Body:    otpCode,
-				Type:    "otp",
+				To:     email,
+				Body:   otpCode,
+				Type:   "otp",
+				Locale: user.Locale,
 			}
 			if err := s.rabbitMQ.PublishEmail(emailMsg); err != nil {
 				log.Printf("Failed to publish OTP email: %v\n", err)
@@ -350,100 +467,131 @@ func (s *authService) ResendOTP(email string) error {
 	return nil
 }
 
-func (s *authService) GoogleOAuth(req GoogleOAuthRequest) (*AuthResponse, error) {
-	// Check if user exists by Google ID
-	user, err := s.userRepo.FindByGoogleID(req.GoogleID)
-	if err == nil {
-		// User exists, update and return tokens
-		user.LastLogin = &[]time.Time{time.Now()}[0]
-		s.userRepo.UpdateLastLogin(user.ID)
-
-		accessToken, _ := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-		refreshToken, _ := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+func (s *authService) GoogleOAuth(req GoogleOAuthRequest, client ClientInfo) (*AuthResponse, error) {
+	if s.google == nil {
+		return nil, errors.New("google sign-in is not configured")
+	}
 
-		return &AuthResponse{
-			User:         user,
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-			ExpiresIn:    900,
-		}, nil
+	// Only trust identity claims from a token signed by Google for our client ID
+	claims, err := s.google.Verify(req.IDToken)
+	if err != nil {
+		log.Printf("Google ID token rejected: %v", err)
+		return nil, errors.New("invalid google credentials")
+	}
+	identity := externalIdentity{
+		provider:      model.LoginTypeGoogle,
+		subject:       claims.Subject,
+		email:         strings.ToLower(claims.Email),
+		emailVerified: claims.EmailVerified,
+		fullName:      claims.Name,
+		profilePhoto:  claims.Picture,
 	}
 
-	// Check if email already exists
-	existingUser, _ := s.userRepo.FindByEmail(req.Email)
-	if existingUser != nil {
-		// Check if user registered with credential instead of Google
-		if existingUser.LoginType == "credential" {
-			return nil, errors.New("email sudah terdaftar dengan email dan password. Silakan login dengan email dan password")
-		}
-		if existingUser.GoogleID != nil && *existingUser.GoogleID != req.GoogleID {
-			return nil, errors.New("email already registered with different Google account")
+	settings := config.OIDCProviderConfig{Name: model.LoginTypeGoogle, DisplayName: "Google"}
+	if s.config != nil {
+		if configured := s.config.OIDCProvider(model.LoginTypeGoogle); configured != nil {
+			settings = *configured
 		}
 	}
 
-	// Create new user
-	user = &model.User{
-		Email:        req.Email,
-		FullName:     req.FullName,
-		ProfilePhoto: &req.ProfilePhoto,
-		UserType:     "member",
-		IsActive:     true,
-		IsVerified:   true, // Google users are auto-verified
-		LoginType:    "google",
-		GoogleID:     &req.GoogleID,
+	return s.signInWithIdentity(settings, identity, client)
+}
+
+func (s *authService) RefreshToken(refreshToken string) (*AuthResponse, error) {
+	stored, err := s.sessionRepo.FindRefreshTokenByHash(util.HashToken(refreshToken))
+	if err != nil {
+		return nil, errors.New("invalid refresh token")
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+	session := &stored.Session
+	if session.IsRevoked() || stored.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("invalid refresh token")
 	}
 
-	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	// Refresh tokens are single use. Seeing one twice means it leaked,
+	// so revoke the whole session (every token rotated from the same login).
+	fresh, err := s.sessionRepo.MarkRefreshTokenUsed(stored.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if !fresh {
+		log.Printf("Refresh token reuse detected for session %s, revoking session", session.ID)
+		s.revokeSession(session.ID, "refresh_token_reuse")
+		return nil, errors.New("invalid refresh token")
 	}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	user, err := s.userRepo.FindByID(session.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, errors.New("user not found")
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900,
-	}, nil
+	if !user.IsActive {
+		s.revokeSession(session.ID, "account_deactivated")
+		return nil, errors.New("account is deactivated")
+	}
+
+	return s.rotateTokens(user, session)
 }
 
-func (s *authService) RefreshToken(refreshToken string) (*AuthResponse, error) {
-	claims, err := util.ValidateToken(refreshToken, s.jwtSecret)
+func (s *authService) Logout(refreshToken string) error {
+	stored, err := s.sessionRepo.FindRefreshTokenByHash(util.HashToken(refreshToken))
 	if err != nil {
-		return nil, errors.New("invalid refresh token")
+		return errors.New("invalid refresh token")
 	}
 
-	user, err := s.userRepo.FindByID(claims.UserID)
+	return s.revokeSession(stored.SessionID, "logout")
+}
+
+func (s *authService) LogoutAll(userID string) error {
+	return s.revokeAllSessions(userID, "logout_all")
+}
+
+func (s *authService) GetSessions(userID, currentSessionID string) ([]SessionResponse, error) {
+	sessions, err := s.sessionRepo.FindActiveByUserID(userID)
 	if err != nil {
-		return nil, errors.New("user not found")
+		return nil, errors.New("failed to fetch sessions")
+	}
+
+	responses := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		responses[i] = SessionResponse{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		}
 	}
 
-	// Generate new tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	return responses, nil
+}
+
+func (s *authService) RevokeSession(userID, sessionID string) error {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil || session.UserID != userID {
+		return errors.New("session not found")
 	}
 
-	newRefreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	return s.revokeSession(session.ID, "revoked_by_user")
+}
+
+// IsSessionActive reports whether access tokens of the session may still be used
+func (s *authService) IsSessionActive(sessionID string) bool {
+	if revoked, ok := s.sessions.get(sessionID); ok {
+		return !revoked
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-		ExpiresIn:    900,
-	}, nil
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil || session.IsRevoked() {
+		s.sessions.setRevoked(sessionID)
+		return false
+	}
+
+	s.sessions.setActive(sessionID)
+	return true
 }
 
 func (s *authService) RequestResetPassword(email string) error {
@@ -454,18 +602,21 @@ func (s *authService) RequestResetPassword(email string) error {
 		return errors.New("email tidak terdaftar di sistem")
 	}
 
-	// Check if user registered with credential (not Google) - must be credential to reset password
-	if user.LoginType != "credential" {
-		return errors.New("reset password hanya tersedia untuk akun yang terdaftar dengan email dan password")
+	// Only accounts that sign in with a password can reset it, whatever their login type
+	if !user.HasPassword() {
+		return errors.New("reset password hanya tersedia untuk akun yang login dengan email dan password")
 	}
 
-	// User exists and has credential login type - proceed with OTP generation
-	// Generate OTP for reset password
-	otpCode := generateOTP()
-	otpExpiresAt := time.Now().Add(10 * time.Minute)
+	// The code would go to an address nobody has proven to own yet
+	if !user.IsVerified {
+		return errors.New("email belum terverifikasi, silakan verifikasi email terlebih dahulu")
+	}
 
-	if err := s.userRepo.UpdateOTP(email, otpCode, otpExpiresAt); err != nil {
-		return fmt.Errorf("failed to update OTP: %w", err)
+	// User exists, has a password and a verified email - proceed with OTP generation
+	// Generate OTP for reset password
+	otpCode, err := s.issueCode(user.ID, model.CodePurposeResetPassword, nil)
+	if err != nil {
+		return err
 	}
 
 	// Send OTP email via RabbitMQ asynchronously (non-blocking)
@@ -474,10 +625,10 @@ func (s *authService) RequestResetPassword(email string) error {
 		s.ensureRabbitMQ() // Try to reconnect if needed
 		if s.rabbitMQ != nil {
 			emailMsg := util.EmailMessage{
-				To:      email,
-				Subject: "Kode Reset Password",
-				Body:    otpCode,
-				Type:    "reset_password",
+				To:     email,
+				Body:   otpCode,
+				Type:   "reset_password",
+				Locale: user.Locale,
 			}
 			if err := s.rabbitMQ.PublishEmail(emailMsg); err != nil {
 				log.Printf("Failed to publish reset password OTP email: %v\n", err)
@@ -493,147 +644,253 @@ func (s *authService) RequestResetPassword(email string) error {
 	return nil
 }
 
-func (s *authService) VerifyResetPassword(email, otpCode, newPassword string) error {
+func (s *authService) VerifyResetPassword(email, otpCode, newPassword string, client ClientInfo) error {
+	_, err := s.resetPasswordWithCode(email, otpCode, newPassword, client)
+	return err
+}
+
+// ResetPassword is VerifyResetPassword that also signs the user in. It goes
+// through completeLogin, so accounts with 2FA still get the MFA challenge.
+func (s *authService) ResetPassword(email, otpCode, newPassword string, client ClientInfo) (*AuthResponse, error) {
+	user, err := s.resetPasswordWithCode(email, otpCode, newPassword, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(user, client)
+}
+
+// resetPasswordWithCode sets a new password after checking a password reset
+// code and signs out every existing session
+func (s *authService) resetPasswordWithCode(email, otpCode, newPassword string, client ClientInfo) (*model.User, error) {
+	if err := s.limiter.check(attemptResetOTP, email, client.IPAddress); err != nil {
+		return nil, err
+	}
+
 	// First, verify that email exists in database and check login type before OTP verification
-	existingUser, err := s.userRepo.FindByEmail(email)
-	if err != nil || existingUser == nil {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil || user == nil {
 		// Email doesn't exist in database - return error
-		return errors.New("invalid or expired OTP")
+		return nil, errInvalidCode
 	}
 
-	// Check if user registered with credential (not Google) - must be credential to reset password
-	if existingUser.LoginType != "credential" {
-		return errors.New("reset password hanya tersedia untuk akun yang terdaftar dengan email dan password")
+	// Only accounts that sign in with a password can reset it, whatever their login type
+	if !user.HasPassword() {
+		return nil, errors.New("reset password hanya tersedia untuk akun yang login dengan email dan password")
 	}
 
-	// Verify OTP code - this will also validate email, OTP, and expiry
-	user, err := s.userRepo.VerifyOTP(email, otpCode)
-	if err != nil {
-		return errors.New("invalid or expired OTP")
+	// Verify OTP code - only a code issued for password reset is accepted
+	if _, err := s.consumeCode(user.ID, model.CodePurposeResetPassword, otpCode); err != nil {
+		s.limiter.fail(attemptResetOTP, email, client.IPAddress)
+		s.auditOTP(user.ID, model.CodePurposeResetPassword, false, client)
+		return nil, err
 	}
+	s.limiter.succeed(attemptResetOTP, email)
+	s.auditOTP(user.ID, model.CodePurposeResetPassword, true, client)
 
-	// Double check login type after OTP verification (should be same, but extra security)
-	if user.LoginType != "credential" {
-		return errors.New("reset password hanya tersedia untuk akun yang terdaftar dengan email dan password")
+	// The code was delivered by email, which also proves the address
+	if !user.IsVerified {
+		s.userRepo.MarkVerified(user.ID)
+		user.IsVerified = true
 	}
 
 	// Hash new password
 	passwordHash, err := util.HashPassword(newPassword)
 	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
+		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Update password and clear OTP (OTP already cleared by VerifyOTP)
+	// Update password
 	if err := s.userRepo.UpdatePassword(user.ID, passwordHash); err != nil {
-		return fmt.Errorf("failed to update password: %w", err)
+		return nil, fmt.Errorf("failed to update password: %w", err)
 	}
+	user.PasswordHash = passwordHash
 
-	return nil
+	// Sign out every device that knew the old password
+	s.revokeAllSessions(user.ID, "password_reset")
+
+	s.audit.Record(AuditEntry{
+		ActorID:  user.ID,
+		Action:   model.AuditPasswordReset,
+		Client:   client,
+		Metadata: map[string]interface{}{"method": "otp"},
+	})
+
+	return user, nil
 }
 
-func (s *authService) ResetPassword(token, newPassword string) (*AuthResponse, error) {
-	// Validate JWT token first
-	claims, err := util.ValidateToken(token, s.jwtSecret)
+func (s *authService) VerifyEmail(token string, client ClientInfo) (*AuthResponse, error) {
+	// Only verification link tokens are accepted; MFA challenges, magic links and
+	// other tokens must not be exchangeable for a session here
+	claims, err := util.ValidateTokenType(token, s.keys, util.TokenTypeVerify)
 	if err != nil {
-		return nil, errors.New("invalid or expired reset token")
-	}
-
-	// Verify token is for reset password (userType should be "reset")
-	if claims.UserType != "reset" {
-		return nil, errors.New("invalid reset token")
+		return nil, errors.New("invalid verification token")
 	}
 
-	// Find user by ID from token
 	user, err := s.userRepo.FindByID(claims.UserID)
-	if err != nil {
-		return nil, errors.New("user not found")
+	if err != nil || !strings.EqualFold(user.Email, claims.Email) {
+		return nil, errors.New("invalid verification token")
 	}
 
-	// Verify reset token matches database
-	if user.ResetToken == nil || *user.ResetToken != token {
-		return nil, errors.New("invalid reset token")
+	if !user.IsVerified {
+		if err := s.userRepo.MarkVerified(user.ID); err != nil {
+			return nil, fmt.Errorf("failed to verify user: %w", err)
+		}
+		user.IsVerified = true
+		s.autoJoinOrganizations(user)
 	}
 
-	// Check if token is expired
-	if user.ResetExpiresAt == nil || user.ResetExpiresAt.Before(time.Now()) {
-		return nil, errors.New("reset token has expired")
+	return s.completeLogin(user, client)
+}
+
+func (s *authService) GetMe(userID string) (*model.User, error) {
+	return s.userRepo.FindByID(userID)
+}
+
+// issueTokens starts a new session for the user and returns its first token pair
+func (s *authService) issueTokens(user *model.User, client ClientInfo) (*AuthResponse, error) {
+	// Every sign-in path ends here, so a deactivated account never gets a
+	// session even if an earlier check was missed
+	if !user.IsActive {
+		s.auditLoginFailed(user.ID, user.Email, "account_deactivated", client)
+		return nil, errors.New("account is deactivated")
 	}
 
-	// Hash new password
-	passwordHash, err := util.HashPassword(newPassword)
-	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+	s.restoreAccount(user)
+
+	now := time.Now()
+	session := &model.Session{
+		UserID:     user.ID,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(refreshTokenTTL),
+	}
+	if client.DeviceName != "" {
+		session.DeviceName = &client.DeviceName
 	}
 
-	// Update password and clear reset token
-	if err := s.userRepo.UpdatePassword(user.ID, passwordHash); err != nil {
-		return nil, fmt.Errorf("failed to update password: %w", err)
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
-	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	s.audit.Record(AuditEntry{
+		ActorID:  user.ID,
+		Action:   model.AuditLoginSucceeded,
+		Client:   client,
+		Metadata: map[string]interface{}{"session_id": session.ID},
+	})
+
+	return s.rotateTokens(user, session)
+}
+
+// rotateTokens issues a new access token and single-use refresh token for an existing session
+func (s *authService) rotateTokens(user *model.User, session *model.Session) (*AuthResponse, error) {
+	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, session.ID, s.keys)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+	refreshToken, err := util.GenerateOpaqueToken()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
+	expiresAt := time.Now().Add(refreshTokenTTL)
+	if err := s.sessionRepo.CreateRefreshToken(&model.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: util.HashToken(refreshToken),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	// Sliding expiry: the session lives as long as its newest refresh token
+	s.sessionRepo.Touch(session.ID, expiresAt)
+
 	return &AuthResponse{
 		User:         user,
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    900,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
 	}, nil
 }
 
-func (s *authService) VerifyEmail(token string) (*AuthResponse, error) {
-	// For now, treat token as OTP code
-	// In production, you might want to use JWT token
-	claims, err := util.ValidateToken(token, s.jwtSecret)
-	if err != nil {
-		// If token validation fails, try as OTP
-		// This is a simplified approach - in production, use proper email verification tokens
-		return nil, errors.New("invalid verification token")
+func (s *authService) revokeSession(sessionID, reason string) error {
+	if err := s.sessionRepo.Revoke(sessionID, reason); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
 	}
+	s.sessions.setRevoked(sessionID)
+	return nil
+}
 
-	user, err := s.userRepo.FindByID(claims.UserID)
+func (s *authService) revokeAllSessions(userID, reason string) error {
+	sessions, err := s.sessionRepo.FindActiveByUserID(userID)
 	if err != nil {
-		return nil, errors.New("user not found")
+		return fmt.Errorf("failed to fetch sessions: %w", err)
 	}
 
-	user.IsVerified = true
-	if err := s.userRepo.Update(user); err != nil {
-		return nil, fmt.Errorf("failed to verify user: %w", err)
+	if err := s.sessionRepo.RevokeAllByUserID(userID, reason); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
 	}
 
-	// Generate tokens
-	accessToken, err := util.GenerateAccessToken(user.ID, user.Email, user.UserType, s.jwtSecret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	for _, session := range sessions {
+		s.sessions.setRevoked(session.ID)
 	}
+	return nil
+}
 
-	refreshToken, err := util.GenerateRefreshToken(user.ID, user.Email, user.UserType, s.jwtSecret)
+// revokeOtherSessions signs out every device except the current one
+func (s *authService) revokeOtherSessions(userID, currentSessionID, reason string) error {
+	if currentSessionID == "" {
+		return s.revokeAllSessions(userID, reason)
+	}
+
+	sessions, err := s.sessionRepo.FindActiveByUserID(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return fmt.Errorf("failed to fetch sessions: %w", err)
 	}
 
-	return &AuthResponse{
-		User:         user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    900,
-	}, nil
+	if err := s.sessionRepo.RevokeOthersByUserID(userID, currentSessionID, reason); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		if session.ID != currentSessionID {
+			s.sessions.setRevoked(session.ID)
+		}
+	}
+	return nil
 }
 
-func (s *authService) GetMe(userID string) (*model.User, error) {
-	return s.userRepo.FindByID(userID)
+// appName returns the product name shown in emails and authenticator apps
+func (s *authService) appName() string {
+	if s.config != nil && s.config.EmailName != "" {
+		return s.config.EmailName
+	}
+	return "BeRealTime"
 }
 
-// generateOTP generates a 6-digit OTP
-func generateOTP() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
-}
\ No newline at end of file
+// auditLoginFailed records a rejected sign-in. userID is empty when the email is unknown.
+func (s *authService) auditLoginFailed(userID, email, reason string, client ClientInfo) {
+	s.audit.Record(AuditEntry{
+		ActorID:  userID,
+		Action:   model.AuditLoginFailed,
+		Client:   client,
+		Metadata: map[string]interface{}{"email": email, "reason": reason},
+	})
+}
+
+// auditOTP records a one-time code check for the given purpose
+func (s *authService) auditOTP(userID, purpose string, ok bool, client ClientInfo) {
+	action := model.AuditOTPVerified
+	if !ok {
+		action = model.AuditOTPFailed
+	}
+	s.audit.Record(AuditEntry{
+		ActorID:  userID,
+		Action:   action,
+		Client:   client,
+		Metadata: map[string]interface{}{"purpose": purpose},
+	})
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"testing"
+
+	"yourapp/internal/util"
+)
+
+func TestRefreshTokenRotates(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	first, err := auth.issueTokens(user, ClientInfo{IPAddress: "203.0.113.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.RefreshToken(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Errorf("refresh did not rotate the token pair: %+v", second)
+	}
+
+	// The rotated token belongs to the same session as the first one
+	firstClaims, _ := util.ValidateTokenType(first.AccessToken, auth.keys, util.TokenTypeAccess)
+	secondClaims, _ := util.ValidateTokenType(second.AccessToken, auth.keys, util.TokenTypeAccess)
+	if firstClaims == nil || secondClaims == nil || firstClaims.SessionID != secondClaims.SessionID {
+		t.Errorf("session changed on refresh: %+v, %+v", firstClaims, secondClaims)
+	}
+
+	if _, err := auth.RefreshToken(second.RefreshToken); err != nil {
+		t.Errorf("rotated refresh token rejected: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	first, err := auth.issueTokens(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.RefreshToken(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := util.ValidateTokenType(second.AccessToken, auth.keys, util.TokenTypeAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying the first token means it leaked: the whole session goes,
+	// including the token the legitimate client holds now
+	if _, err := auth.RefreshToken(first.RefreshToken); err == nil {
+		t.Fatal("reused refresh token was accepted")
+	}
+	if _, err := auth.RefreshToken(second.RefreshToken); err == nil {
+		t.Error("refresh token of a revoked session was accepted")
+	}
+	if auth.IsSessionActive(claims.SessionID) {
+		t.Error("session is still active after refresh token reuse")
+	}
+	session := auth.sessionDB.sessions[claims.SessionID]
+	if session.RevokedReason == nil || *session.RevokedReason != "refresh_token_reuse" {
+		t.Errorf("revoked reason = %v", session.RevokedReason)
+	}
+}
+
+func TestRefreshTokenRejectsUnknownAndDeactivated(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	if _, err := auth.RefreshToken("not-a-token"); err == nil {
+		t.Error("unknown refresh token was accepted")
+	}
+
+	tokens, err := auth.issueTokens(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.users.users[user.ID].IsActive = false
+	if _, err := auth.RefreshToken(tokens.RefreshToken); err == nil {
+		t.Error("refresh token of a deactivated account was accepted")
+	}
+	if auth.sessionDB.activeSessions(user.ID) != 0 {
+		t.Error("session of a deactivated account was not revoked")
+	}
+}
+
+func TestLogoutRevokesOnlyThatSession(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	phone, err := auth.issueTokens(user, ClientInfo{DeviceName: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	laptop, err := auth.issueTokens(user, ClientInfo{DeviceName: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := auth.Logout(phone.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.RefreshToken(phone.RefreshToken); err == nil {
+		t.Error("refresh token still works after logout")
+	}
+	if _, err := auth.RefreshToken(laptop.RefreshToken); err != nil {
+		t.Errorf("logout signed out another device: %v", err)
+	}
+
+	if err := auth.LogoutAll(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if auth.sessionDB.activeSessions(user.ID) != 0 {
+		t.Error("LogoutAll left sessions active")
+	}
+}
+
+func TestSessionsListAndRevoke(t *testing.T) {
+	user := activeUser("user@example.org")
+	other := activeUser("other@example.org")
+	auth := newTestAuth(user, other)
+
+	current, err := auth.issueTokens(user, ClientInfo{DeviceName: "laptop", IPAddress: "203.0.113.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone, err := auth.issueTokens(user, ClientInfo{DeviceName: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.issueTokens(other, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	currentClaims, _ := util.ValidateTokenType(current.AccessToken, auth.keys, util.TokenTypeAccess)
+	phoneClaims, _ := util.ValidateTokenType(phone.AccessToken, auth.keys, util.TokenTypeAccess)
+
+	sessions, err := auth.GetSessions(user.ID, currentClaims.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("GetSessions returned %d sessions, want 2", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.Current != (session.ID == currentClaims.SessionID) {
+			t.Errorf("session %s current = %v", session.ID, session.Current)
+		}
+	}
+
+	// Another user cannot revoke the session, not even by guessing its ID
+	if err := auth.RevokeSession(other.ID, phoneClaims.SessionID); err == nil {
+		t.Error("another user revoked the session")
+	}
+	if !auth.IsSessionActive(phoneClaims.SessionID) {
+		t.Fatal("session was revoked by another user")
+	}
+
+	if err := auth.RevokeSession(user.ID, phoneClaims.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if auth.IsSessionActive(phoneClaims.SessionID) {
+		t.Error("revoked session is still active")
+	}
+	if _, err := auth.RefreshToken(phone.RefreshToken); err == nil {
+		t.Error("refresh token of a revoked session was accepted")
+	}
+	if !auth.IsSessionActive(currentClaims.SessionID) {
+		t.Error("revoking one device signed out another")
+	}
+}
+
+func TestIsSessionActiveSeesRevocationFromDatabase(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	tokens, err := auth.issueTokens(user, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := util.ValidateTokenType(tokens.AccessToken, auth.keys, util.TokenTypeAccess)
+
+	if !auth.IsSessionActive(claims.SessionID) {
+		t.Fatal("new session is not active")
+	}
+	if auth.IsSessionActive("00000000-0000-0000-0000-000000000001") {
+		t.Error("unknown session is active")
+	}
+
+	// Revoked by another instance: visible once the cached state expires
+	auth.sessionDB.Revoke(claims.SessionID, "revoked_elsewhere")
+	auth.authService.sessions = newSessionCache(sessionCacheTTL)
+	if auth.IsSessionActive(claims.SessionID) {
+		t.Error("session revoked in the database is still active")
+	}
+}
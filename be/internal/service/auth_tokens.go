@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+const (
+	maxAccessTokensPerUser = 50
+	accessTokenTouchEvery  = time.Minute
+)
+
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays *int     `json:"expires_in_days" binding:"omitempty,min=1,max=365"` // omit for a token that never expires
+}
+
+type AccessTokenResponse struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP  *string    `json:"last_used_ip,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// CreateAccessTokenResponse carries the token itself, which is never shown again
+type CreateAccessTokenResponse struct {
+	Token string `json:"token"`
+	AccessTokenResponse
+}
+
+// AccessTokenPrincipal is the user a personal access token acts for, limited to its scopes
+type AccessTokenPrincipal struct {
+	User    *model.User
+	TokenID string
+	Scopes  []string
+}
+
+// CreateAccessToken issues a new personal access token with the requested scopes
+func (s *authService) CreateAccessToken(userID string, req CreateAccessTokenRequest) (*CreateAccessTokenResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		if scope == model.ScopeAdmin && !user.HasRole(model.RoleModerator) {
+			return nil, errors.New("only admins and moderators can create tokens with the admin scope")
+		}
+	}
+
+	existing, err := s.accessTokenRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch access tokens: %w", err)
+	}
+	if len(existing) >= maxAccessTokensPerUser {
+		return nil, fmt.Errorf("you can have at most %d access tokens", maxAccessTokensPerUser)
+	}
+
+	secret, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := model.AccessTokenPrefix + secret
+
+	record := &model.PersonalAccessToken{
+		UserID:      user.ID,
+		Name:        strings.TrimSpace(req.Name),
+		TokenHash:   util.HashToken(token),
+		TokenPrefix: token[:len(model.AccessTokenPrefix)+6],
+		Scopes:      strings.Join(scopes, " "),
+	}
+	if req.ExpiresInDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		record.ExpiresAt = &expiresAt
+	}
+
+	if err := s.accessTokenRepo.Create(record); err != nil {
+		return nil, fmt.Errorf("failed to save access token: %w", err)
+	}
+
+	return &CreateAccessTokenResponse{
+		Token:               token,
+		AccessTokenResponse: toAccessTokenResponse(record),
+	}, nil
+}
+
+// GetAccessTokens lists the user's active personal access tokens
+func (s *authService) GetAccessTokens(userID string) ([]AccessTokenResponse, error) {
+	tokens, err := s.accessTokenRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch access tokens: %w", err)
+	}
+
+	response := make([]AccessTokenResponse, len(tokens))
+	for i := range tokens {
+		response[i] = toAccessTokenResponse(&tokens[i])
+	}
+	return response, nil
+}
+
+// RevokeAccessToken revokes one of the user's personal access tokens
+func (s *authService) RevokeAccessToken(userID, tokenID string) error {
+	revoked, err := s.accessTokenRepo.Revoke(tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	if !revoked {
+		return errors.New("access token not found")
+	}
+	return nil
+}
+
+// AuthenticateAccessToken resolves a "pat_..." bearer token to its user and scopes
+func (s *authService) AuthenticateAccessToken(token, ipAddress string) (*AccessTokenPrincipal, error) {
+	if !strings.HasPrefix(token, model.AccessTokenPrefix) {
+		return nil, errors.New("invalid access token")
+	}
+
+	record, err := s.accessTokenRepo.FindByHash(util.HashToken(token))
+	if err != nil {
+		return nil, errors.New("invalid access token")
+	}
+	if !record.IsUsable() {
+		return nil, errors.New("access token has expired or was revoked")
+	}
+
+	user, err := s.userRepo.FindByID(record.UserID)
+	if err != nil || !user.IsActive || user.DeletionDueAt != nil {
+		return nil, errors.New("invalid access token")
+	}
+
+	// Record usage, but not on every single request
+	if record.LastUsedAt == nil || time.Since(*record.LastUsedAt) > accessTokenTouchEvery {
+		s.accessTokenRepo.TouchLastUsed(record.ID, ipAddress)
+	}
+
+	return &AccessTokenPrincipal{
+		User:    user,
+		TokenID: record.ID,
+		Scopes:  record.ScopeList(),
+	}, nil
+}
+
+// normalizeScopes validates and de-duplicates requested scopes
+func normalizeScopes(requested []string) ([]string, error) {
+	valid := make(map[string]bool, len(model.AccessTokenScopes))
+	for _, scope := range model.AccessTokenScopes {
+		valid[scope] = true
+	}
+
+	seen := make(map[string]bool, len(requested))
+	scopes := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		scope = strings.TrimSpace(scope)
+		if !valid[scope] {
+			return nil, fmt.Errorf("unknown scope %q, valid scopes are: %s", scope, strings.Join(model.AccessTokenScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func toAccessTokenResponse(token *model.PersonalAccessToken) AccessTokenResponse {
+	return AccessTokenResponse{
+		ID:          token.ID,
+		Name:        token.Name,
+		TokenPrefix: token.TokenPrefix,
+		Scopes:      token.ScopeList(),
+		ExpiresAt:   token.ExpiresAt,
+		LastUsedAt:  token.LastUsedAt,
+		LastUsedIP:  token.LastUsedIP,
+		CreatedAt:   token.CreatedAt,
+	}
+}
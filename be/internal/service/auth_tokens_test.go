@@ -0,0 +1,131 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+)
+
+func TestCreateAccessTokenScopes(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	if _, err := auth.CreateAccessToken(user.ID, CreateAccessTokenRequest{Name: "bot", Scopes: []string{"rooms:delete"}}); err == nil {
+		t.Error("unknown scope was accepted")
+	}
+
+	created, err := auth.CreateAccessToken(user.ID, CreateAccessTokenRequest{
+		Name:   " bot ",
+		Scopes: []string{model.ScopeChatRead, model.ScopeChatRead, model.ScopeRoomsRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Token, model.AccessTokenPrefix) || !strings.HasPrefix(created.Token, created.TokenPrefix) {
+		t.Errorf("token %q does not start with its prefix %q", created.Token, created.TokenPrefix)
+	}
+	if created.Name != "bot" || len(created.Scopes) != 2 {
+		t.Errorf("created = %+v, want a trimmed name and de-duplicated scopes", created.AccessTokenResponse)
+	}
+
+	// Only the hash is stored
+	if stored := auth.tokens.tokens[0]; strings.Contains(stored.TokenHash, created.Token) {
+		t.Error("token is stored in plain text")
+	}
+}
+
+func TestCreateAccessTokenAdminScopeNeedsRole(t *testing.T) {
+	member := activeUser("member@example.org")
+	moderator := activeUser("moderator@example.org")
+	moderator.UserType = model.RoleModerator
+	auth := newTestAuth(member, moderator)
+
+	req := CreateAccessTokenRequest{Name: "admin bot", Scopes: []string{model.ScopeAdmin}}
+	if _, err := auth.CreateAccessToken(member.ID, req); err == nil {
+		t.Error("member created a token with the admin scope")
+	}
+	if _, err := auth.CreateAccessToken(moderator.ID, req); err != nil {
+		t.Errorf("moderator could not create a token with the admin scope: %v", err)
+	}
+}
+
+func TestAuthenticateAccessToken(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+
+	created, err := auth.CreateAccessToken(user.ID, CreateAccessTokenRequest{Name: "bot", Scopes: []string{model.ScopeChatWrite}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principal, err := auth.AuthenticateAccessToken(created.Token, "203.0.113.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.User.ID != user.ID || principal.TokenID != created.ID {
+		t.Errorf("principal = %+v", principal)
+	}
+	if len(principal.Scopes) != 1 || principal.Scopes[0] != model.ScopeChatWrite {
+		t.Errorf("scopes = %v, want only %s", principal.Scopes, model.ScopeChatWrite)
+	}
+	if ip := auth.tokens.tokens[0].LastUsedIP; ip == nil || *ip != "203.0.113.1" {
+		t.Errorf("last used IP = %v", ip)
+	}
+
+	for _, token := range []string{"", "not-a-token", model.AccessTokenPrefix + "unknown", created.Token + "x"} {
+		if _, err := auth.AuthenticateAccessToken(token, ""); err == nil {
+			t.Errorf("token %q was accepted", token)
+		}
+	}
+}
+
+func TestAuthenticateAccessTokenRejectsUnusableTokens(t *testing.T) {
+	user := activeUser("user@example.org")
+	auth := newTestAuth(user)
+	req := CreateAccessTokenRequest{Name: "bot", Scopes: []string{model.ScopeProfileRead}}
+
+	revoked, _ := auth.CreateAccessToken(user.ID, req)
+	if err := auth.RevokeAccessToken(user.ID, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.AuthenticateAccessToken(revoked.Token, ""); err == nil {
+		t.Error("revoked token was accepted")
+	}
+
+	expired, _ := auth.CreateAccessToken(user.ID, req)
+	past := time.Now().Add(-time.Minute)
+	auth.tokens.tokens[1].ExpiresAt = &past
+	if _, err := auth.AuthenticateAccessToken(expired.Token, ""); err == nil {
+		t.Error("expired token was accepted")
+	}
+
+	active, _ := auth.CreateAccessToken(user.ID, req)
+	auth.users.users[user.ID].IsActive = false
+	if _, err := auth.AuthenticateAccessToken(active.Token, ""); err == nil {
+		t.Error("token of a deactivated account was accepted")
+	}
+	auth.users.users[user.ID].IsActive = true
+	auth.users.users[user.ID].DeletionDueAt = &past
+	if _, err := auth.AuthenticateAccessToken(active.Token, ""); err == nil {
+		t.Error("token of an account scheduled for deletion was accepted")
+	}
+}
+
+func TestRevokeAccessTokenChecksOwner(t *testing.T) {
+	user := activeUser("user@example.org")
+	other := activeUser("other@example.org")
+	auth := newTestAuth(user, other)
+
+	created, err := auth.CreateAccessToken(user.ID, CreateAccessTokenRequest{Name: "bot", Scopes: []string{model.ScopeRoomsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.RevokeAccessToken(other.ID, created.ID); err == nil {
+		t.Error("another user revoked the token")
+	}
+	if _, err := auth.AuthenticateAccessToken(created.Token, ""); err != nil {
+		t.Errorf("token stopped working after a failed revoke: %v", err)
+	}
+}
@@ -1,29 +1,38 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
+	"unicode/utf8"
 	"yourapp/internal/model"
 	"yourapp/internal/repository"
 )
 
 type ChatService interface {
 	CreateMessage(roomID, userID, message string) (*ChatMessageResponse, error)
-	GetMessages(roomID string, limit, offset int) ([]ChatMessageResponse, error)
+	GetMessages(roomID, userID string, limit, offset int) ([]ChatMessageResponse, error)
 	GetMessageCount(roomID string) (int64, error)
+	DeleteMessage(messageID, actorID string, client ClientInfo) (*ChatMessageResponse, error)
+	CanAccessRoom(roomID, userID string) bool
 }
 
 type chatService struct {
 	chatRepo repository.ChatRepository
 	roomRepo repository.RoomRepository
 	userRepo repository.UserRepository
+	orgRepo  repository.OrganizationRepository
+	audit    AuditService
 }
 
-func NewChatService(chatRepo repository.ChatRepository, roomRepo repository.RoomRepository, userRepo repository.UserRepository) ChatService {
+func NewChatService(chatRepo repository.ChatRepository, roomRepo repository.RoomRepository, userRepo repository.UserRepository, orgRepo repository.OrganizationRepository, audit AuditService) ChatService {
 	return &chatService{
 		chatRepo: chatRepo,
 		roomRepo: roomRepo,
 		userRepo: userRepo,
+		orgRepo:  orgRepo,
+		audit:    audit,
 	}
 }
 
@@ -42,9 +51,8 @@ type CreateChatMessageRequest struct {
 }
 
 func (s *chatService) CreateMessage(roomID, userID, message string) (*ChatMessageResponse, error) {
-	// Verify room exists
-	_, err := s.roomRepo.FindByID(roomID)
-	if err != nil {
+	// Verify room exists and the user may chat in it
+	if !s.CanAccessRoom(roomID, userID) {
 		return nil, errors.New("room not found")
 	}
 
@@ -79,10 +87,9 @@ func (s *chatService) CreateMessage(roomID, userID, message string) (*ChatMessag
 	return s.chatMessageToResponse(createdMessage, user), nil
 }
 
-func (s *chatService) GetMessages(roomID string, limit, offset int) ([]ChatMessageResponse, error) {
-	// Verify room exists
-	_, err := s.roomRepo.FindByID(roomID)
-	if err != nil {
+func (s *chatService) GetMessages(roomID, userID string, limit, offset int) ([]ChatMessageResponse, error) {
+	// Verify room exists and the user may read it
+	if !s.CanAccessRoom(roomID, userID) {
 		return nil, errors.New("room not found")
 	}
 
@@ -118,6 +125,45 @@ func (s *chatService) GetMessageCount(roomID string) (int64, error) {
 	return s.chatRepo.GetMessageCount(roomID)
 }
 
+// DeleteMessage removes a message on behalf of a moderator and returns it
+func (s *chatService) DeleteMessage(messageID, actorID string, client ClientInfo) (*ChatMessageResponse, error) {
+	msg, err := s.chatRepo.FindByID(messageID)
+	if err != nil {
+		return nil, errors.New("message not found")
+	}
+
+	if err := s.chatRepo.Delete(msg.ID); err != nil {
+		return nil, errors.New("failed to delete message")
+	}
+
+	// The audit log outlives retention and account deletion, so it keeps only
+	// a hash of the text: enough to match a copy someone reports, not to read it
+	sum := sha256.Sum256([]byte(msg.Message))
+	s.audit.Record(AuditEntry{
+		ActorID:    actorID,
+		Action:     model.AuditMessageDeleted,
+		TargetType: model.AuditTargetMessage,
+		TargetID:   msg.ID,
+		Client:     client,
+		Metadata: map[string]interface{}{
+			"room_id": msg.RoomID,
+			"length":  utf8.RuneCountInString(msg.Message),
+			"sha256":  hex.EncodeToString(sum[:]),
+		},
+	})
+
+	return s.chatMessageToResponse(msg, &msg.User), nil
+}
+
+// CanAccessRoom reports whether the room exists and the user may read and send its messages
+func (s *chatService) CanAccessRoom(roomID, userID string) bool {
+	room, err := s.roomRepo.FindByID(roomID)
+	if err != nil {
+		return false
+	}
+	return canAccessRoom(s.orgRepo, room, userID)
+}
+
 func (s *chatService) chatMessageToResponse(msg *model.ChatMessage, user *model.User) *ChatMessageResponse {
 	userName := user.FullName
 	if user.Username != nil && *user.Username != "" {
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+type fakeChatRepo struct {
+	repository.ChatRepository
+	messages map[string]*model.ChatMessage
+}
+
+func (r *fakeChatRepo) FindByID(id string) (*model.ChatMessage, error) {
+	msg, ok := r.messages[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *msg
+	return &found, nil
+}
+
+func (r *fakeChatRepo) Delete(id string) error {
+	delete(r.messages, id)
+	return nil
+}
+
+func TestDeleteMessageAuditsOnlyAHash(t *testing.T) {
+	author := activeUser("author@example.org")
+	text := "my phone number is 0812-3456-7890"
+	repo := &fakeChatRepo{messages: map[string]*model.ChatMessage{
+		"message": {ID: "message", RoomID: "room", UserID: author.ID, User: *author, Message: text},
+	}}
+	audit := &fakeAudit{}
+	chat := NewChatService(repo, nil, nil, nil, audit)
+
+	if _, err := chat.DeleteMessage("unknown", "moderator", ClientInfo{}); err == nil {
+		t.Error("deleting an unknown message succeeded")
+	}
+
+	deleted, err := chat.DeleteMessage("message", "moderator", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.Message != text {
+		t.Errorf("deleted message = %q, want the removed text", deleted.Message)
+	}
+	if _, ok := repo.messages["message"]; ok {
+		t.Error("message was not deleted")
+	}
+
+	entry := audit.last(model.AuditMessageDeleted)
+	if entry == nil {
+		t.Fatal("deletion was not audited")
+	}
+	if entry.ActorID != "moderator" || entry.TargetID != "message" {
+		t.Errorf("audit entry = %+v", entry)
+	}
+	sum := sha256.Sum256([]byte(text))
+	if entry.Metadata["room_id"] != "room" || entry.Metadata["sha256"] != hex.EncodeToString(sum[:]) || entry.Metadata["length"] != len(text) {
+		t.Errorf("metadata = %v", entry.Metadata)
+	}
+	for key, value := range entry.Metadata {
+		if s, ok := value.(string); (ok && strings.Contains(s, "0812")) || key == "message" || key == "author_id" {
+			t.Errorf("metadata %q keeps the message or its author", key)
+		}
+	}
+}
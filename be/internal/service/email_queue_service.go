@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+var errEmailQueueUnavailable = errors.New("email queue is not available")
+
+// EmailQueueService lets admins look into emails that could not be sent and
+// send them again, e.g. after fixing the SMTP settings
+type EmailQueueService interface {
+	DeadLetters(limit int) (*util.DeadLetterList, error)
+	ReplayDeadLetters(ids []string, actorID string, client ClientInfo) (int, error)
+}
+
+type emailQueueService struct {
+	rabbitMQ     *util.RabbitMQClient
+	auditService AuditService
+}
+
+// NewEmailQueueService creates the service; rabbitMQ may be nil when the
+// broker was unreachable at startup
+func NewEmailQueueService(rabbitMQ *util.RabbitMQClient, auditService AuditService) EmailQueueService {
+	return &emailQueueService{
+		rabbitMQ:     rabbitMQ,
+		auditService: auditService,
+	}
+}
+
+func (s *emailQueueService) DeadLetters(limit int) (*util.DeadLetterList, error) {
+	if s.rabbitMQ == nil {
+		return nil, errEmailQueueUnavailable
+	}
+	if limit <= 0 {
+		limit = defaultDeadLetterLimit
+	}
+	if limit > maxDeadLetterLimit {
+		limit = maxDeadLetterLimit
+	}
+	return s.rabbitMQ.DeadLetters(limit)
+}
+
+// ReplayDeadLetters sends the given dead letters, or all when ids is empty,
+// back to the email queue
+func (s *emailQueueService) ReplayDeadLetters(ids []string, actorID string, client ClientInfo) (int, error) {
+	if s.rabbitMQ == nil {
+		return 0, errEmailQueueUnavailable
+	}
+
+	replayed, err := s.rabbitMQ.ReplayDeadLetters(ids)
+	if replayed > 0 {
+		s.auditService.Record(AuditEntry{
+			ActorID:  actorID,
+			Action:   model.AuditEmailsReplayed,
+			Client:   client,
+			Metadata: map[string]interface{}{"count": replayed, "ids": ids},
+		})
+	}
+	return replayed, err
+}
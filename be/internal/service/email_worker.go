@@ -3,20 +3,39 @@ package service
 import (
 	"encoding/json"
 	"log"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/mailer"
 	"yourapp/internal/util"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// Backoff before an email that could not be moved to a retry or dead letter
+// queue goes back to the email queue
+const (
+	rescheduleBackoffBase = time.Second
+	rescheduleBackoffMax  = 30 * time.Second
+)
+
 type EmailWorker struct {
 	emailService EmailService
 	rabbitMQ     *util.RabbitMQClient
+	maxAttempts  int
+
+	rescheduleFailures int // consecutive failed reschedules, only touched by the consumer goroutine
 }
 
-func NewEmailWorker(emailService EmailService, rabbitMQ *util.RabbitMQClient) *EmailWorker {
+func NewEmailWorker(emailService EmailService, rabbitMQ *util.RabbitMQClient, cfg *config.Config) *EmailWorker {
+	maxAttempts := cfg.EmailMaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
 	return &EmailWorker{
 		emailService: emailService,
 		rabbitMQ:     rabbitMQ,
+		maxAttempts:  maxAttempts,
 	}
 }
 
@@ -43,43 +62,69 @@ func (w *EmailWorker) Start() error {
 	// Process messages in a goroutine
 	go func() {
 		for msg := range msgs {
-			if err := w.processEmailMessage(msg); err != nil {
-				log.Printf("Error processing email message: %v", err)
-				// Reject and requeue on error
-				msg.Nack(false, true)
-			} else {
-				// Acknowledge message on success
-				msg.Ack(false)
-			}
+			w.handleDelivery(msg)
 		}
 	}()
 
 	return nil
 }
 
+// handleDelivery acknowledges a sent email. A failed one moves to a retry
+// queue with a growing delay, or to the dead letter queue once the error is
+// permanent or it has failed maxAttempts times. If even that publish fails the
+// message is requeued after a backoff, so it is never redelivered in a tight loop.
+func (w *EmailWorker) handleDelivery(msg amqp.Delivery) {
+	err := w.processEmailMessage(msg)
+	if err == nil {
+		msg.Ack(false)
+		return
+	}
+
+	attempts := util.EmailAttempts(msg) + 1
+	permanent := mailer.IsPermanent(err)
+
+	var publishErr error
+	if permanent || attempts >= w.maxAttempts {
+		log.Printf("Email message %s failed after %d attempt(s), moving to dead letter queue: %v", msg.MessageId, attempts, err)
+		publishErr = w.rabbitMQ.DeadLetterEmail(msg, attempts, err, permanent)
+	} else {
+		delay, retryErr := w.rabbitMQ.RetryEmail(msg, attempts, err)
+		log.Printf("Email message %s failed (attempt %d), retrying in %s: %v", msg.MessageId, attempts, delay, err)
+		publishErr = retryErr
+	}
+
+	if publishErr != nil {
+		// Keep the message in the email queue rather than losing it, but hold
+		// the consumer back: a broker that refused this publish refuses the next
+		w.rescheduleFailures++
+		backoff := rescheduleBackoff(w.rescheduleFailures)
+		log.Printf("Failed to reschedule email message %s, requeueing in %s: %v", msg.MessageId, backoff, publishErr)
+		time.Sleep(backoff)
+		msg.Nack(false, true)
+		return
+	}
+	w.rescheduleFailures = 0
+	msg.Ack(false)
+}
+
+// rescheduleBackoff doubles with every consecutive failed reschedule, up to rescheduleBackoffMax
+func rescheduleBackoff(failures int) time.Duration {
+	backoff := rescheduleBackoffBase
+	for i := 1; i < failures && backoff < rescheduleBackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, rescheduleBackoffMax)
+}
+
 func (w *EmailWorker) processEmailMessage(msg amqp.Delivery) error {
 	var emailMsg util.EmailMessage
 	if err := json.Unmarshal(msg.Body, &emailMsg); err != nil {
-		return err
+		return mailer.Permanent(err)
 	}
 
 	log.Printf("Processing email: Type=%s, To=%s", emailMsg.Type, emailMsg.To)
 
-	switch emailMsg.Type {
-	case "otp":
-		// Extract OTP from body (simplified - in production, use structured data)
-		return w.emailService.SendOTPEmail(emailMsg.To, emailMsg.Body)
-	case "reset_password":
-		// Body contains the reset password link
-		return w.emailService.SendResetPasswordEmail(emailMsg.To, emailMsg.Body)
-	case "verification":
-		return w.emailService.SendVerificationEmail(emailMsg.To, emailMsg.Body)
-	case "welcome":
-		return w.emailService.SendWelcomeEmail(emailMsg.To, emailMsg.Subject) // Using Subject as name
-	default:
-		// Generic email
-		return w.emailService.SendOTPEmail(emailMsg.To, emailMsg.Body)
-	}
+	return w.emailService.Send(emailMsg)
 }
 
 // Stop stops the email worker
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRescheduleBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{6, rescheduleBackoffMax},
+		{100, rescheduleBackoffMax},
+	}
+	for _, tt := range tests {
+		if got := rescheduleBackoff(tt.failures); got != tt.want {
+			t.Errorf("rescheduleBackoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,769 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// The fakes below keep their rows in memory. They embed the repository
+// interface, so a method a test did not expect panics instead of silently
+// doing nothing. Finders return copies, like rows loaded from a database.
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[string]*model.User
+}
+
+func newFakeUserRepo(users ...*model.User) *fakeUserRepo {
+	r := &fakeUserRepo{users: make(map[string]*model.User)}
+	for _, user := range users {
+		r.Create(user)
+	}
+	return r
+}
+
+func (r *fakeUserRepo) Create(user *model.User) error {
+	if user.ID == "" {
+		user.ID = uuid.NewString()
+	}
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return errors.New("duplicate email")
+		}
+	}
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *fakeUserRepo) FindByID(id string) (*model.User, error) {
+	if user, ok := r.users[id]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) FindByEmail(email string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) FindByUsername(username string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Username != nil && *user.Username == username {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) Update(user *model.User) error {
+	if _, ok := r.users[user.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateFields(userID string, fields map[string]interface{}) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	for column, value := range fields {
+		switch column {
+		case "email":
+			user.Email = value.(string)
+		case "is_active":
+			user.IsActive = value.(bool)
+		case "is_verified":
+			user.IsVerified = value.(bool)
+		case "full_name":
+			user.FullName = value.(string)
+		case "login_type":
+			user.LoginType = value.(string)
+		case "deletion_due_at":
+			user.DeletionDueAt, _ = value.(*time.Time)
+		case "deactivated_by":
+			user.DeactivatedBy, _ = value.(*string)
+		default:
+			panic("fakeUserRepo.UpdateFields: unexpected column " + column)
+		}
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) MarkVerified(userID string) error {
+	if user, ok := r.users[userID]; ok {
+		user.IsVerified = true
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) UpdatePassword(userID, passwordHash string) error {
+	if user, ok := r.users[userID]; ok {
+		user.PasswordHash = passwordHash
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateLastLogin(userID string) error {
+	if user, ok := r.users[userID]; ok {
+		now := time.Now()
+		user.LastLogin = &now
+	}
+	return nil
+}
+
+// Search matches Query against the email, like the real repository's ILIKE
+func (r *fakeUserRepo) Search(filter repository.UserFilter) ([]model.User, int64, error) {
+	var users []model.User
+	for _, user := range r.users {
+		if strings.Contains(strings.ToLower(user.Email), strings.ToLower(filter.Query)) {
+			users = append(users, *user)
+		}
+	}
+	return users, int64(len(users)), nil
+}
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	sessions      map[string]*model.Session
+	refreshTokens map[string]*model.RefreshToken
+}
+
+func newFakeSessionRepo() *fakeSessionRepo {
+	return &fakeSessionRepo{
+		sessions:      make(map[string]*model.Session),
+		refreshTokens: make(map[string]*model.RefreshToken),
+	}
+}
+
+func (r *fakeSessionRepo) Create(session *model.Session) error {
+	if session.ID == "" {
+		session.ID = uuid.NewString()
+	}
+	session.CreatedAt = time.Now()
+	copied := *session
+	r.sessions[session.ID] = &copied
+	return nil
+}
+
+func (r *fakeSessionRepo) FindByID(id string) (*model.Session, error) {
+	if session, ok := r.sessions[id]; ok {
+		copied := *session
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeSessionRepo) FindActiveByUserID(userID string) ([]model.Session, error) {
+	var sessions []model.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && !session.IsRevoked() {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeSessionRepo) Touch(id string, expiresAt time.Time) error {
+	if session, ok := r.sessions[id]; ok {
+		session.LastUsedAt = time.Now()
+		session.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) Revoke(id, reason string) error {
+	if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+		session.RevokedReason = &reason
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) RevokeAllByUserID(userID, reason string) error {
+	return r.RevokeOthersByUserID(userID, "", reason)
+}
+
+func (r *fakeSessionRepo) RevokeOthersByUserID(userID, keepSessionID, reason string) error {
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.ID != keepSessionID {
+			r.Revoke(session.ID, reason)
+		}
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) CreateRefreshToken(token *model.RefreshToken) error {
+	if token.ID == "" {
+		token.ID = uuid.NewString()
+	}
+	copied := *token
+	r.refreshTokens[token.ID] = &copied
+	return nil
+}
+
+func (r *fakeSessionRepo) FindRefreshTokenByHash(tokenHash string) (*model.RefreshToken, error) {
+	for _, token := range r.refreshTokens {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			copied.Session = *r.sessions[token.SessionID]
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeSessionRepo) MarkRefreshTokenUsed(id string) (bool, error) {
+	token, ok := r.refreshTokens[id]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return true, nil
+}
+
+// activeSessions counts the user's sessions that are not revoked
+func (r *fakeSessionRepo) activeSessions(userID string) int {
+	sessions, _ := r.FindActiveByUserID(userID)
+	return len(sessions)
+}
+
+type fakeCodeRepo struct {
+	repository.OneTimeCodeRepository
+	codes []*model.OneTimeCode
+}
+
+func (r *fakeCodeRepo) Replace(code *model.OneTimeCode) error {
+	now := time.Now()
+	for _, existing := range r.codes {
+		if existing.UserID == code.UserID && existing.Purpose == code.Purpose && existing.ConsumedAt == nil {
+			existing.ConsumedAt = &now
+		}
+	}
+	if code.ID == "" {
+		code.ID = uuid.NewString()
+	}
+	copied := *code
+	r.codes = append(r.codes, &copied)
+	return nil
+}
+
+func (r *fakeCodeRepo) FindActive(userID, purpose string) (*model.OneTimeCode, error) {
+	for i := len(r.codes) - 1; i >= 0; i-- {
+		code := r.codes[i]
+		if code.UserID == userID && code.Purpose == purpose && code.ConsumedAt == nil && code.ExpiresAt.After(time.Now()) {
+			copied := *code
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeCodeRepo) IncrementAttempts(id string) error {
+	for _, code := range r.codes {
+		if code.ID == id {
+			code.Attempts++
+		}
+	}
+	return nil
+}
+
+func (r *fakeCodeRepo) Consume(id string) (bool, error) {
+	for _, code := range r.codes {
+		if code.ID == id && code.ConsumedAt == nil {
+			now := time.Now()
+			code.ConsumedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fakeMFARepo stores the TOTP state on the users of a fakeUserRepo
+type fakeMFARepo struct {
+	repository.MFARepository
+	users         *fakeUserRepo
+	recoveryCodes map[string][]string
+}
+
+func (r *fakeMFARepo) UpdateSecret(userID string, secret *string, enabled bool) error {
+	user := r.users.users[userID]
+	user.MFASecret = secret
+	user.MFAEnabled = enabled
+	return nil
+}
+
+func (r *fakeMFARepo) UpdateLastStep(userID string, step int64) (bool, error) {
+	user := r.users.users[userID]
+	if step <= user.MFALastStep {
+		return false, nil
+	}
+	user.MFALastStep = step
+	return true, nil
+}
+
+func (r *fakeMFARepo) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+	r.recoveryCodes[userID] = codeHashes
+	return nil
+}
+
+func (r *fakeMFARepo) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	for i, hash := range r.recoveryCodes[userID] {
+		if hash == codeHash {
+			r.recoveryCodes[userID] = append(r.recoveryCodes[userID][:i], r.recoveryCodes[userID][i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeMFARepo) DeleteRecoveryCodes(userID string) error {
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+type fakePasskeyRepo struct {
+	repository.PasskeyRepository
+	credentials []model.PasskeyCredential
+}
+
+func (r *fakePasskeyRepo) Delete(id, userID string) (bool, error) {
+	for i, credential := range r.credentials {
+		if credential.ID == id && credential.UserID == userID {
+			r.credentials = append(r.credentials[:i], r.credentials[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakePasskeyRepo) CountByUserID(userID string) (int64, error) {
+	var count int64
+	for _, credential := range r.credentials {
+		if credential.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type fakeIdentityRepo struct {
+	repository.IdentityRepository
+	identities []model.UserIdentity
+}
+
+func (r *fakeIdentityRepo) FindByUserID(userID string) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *fakeIdentityRepo) CountByUserID(userID string) (int64, error) {
+	identities, _ := r.FindByUserID(userID)
+	return int64(len(identities)), nil
+}
+
+func (r *fakeIdentityRepo) Delete(id, userID string) (bool, error) {
+	for i, identity := range r.identities {
+		if identity.ID == id && identity.UserID == userID {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeAccessTokenRepo struct {
+	repository.AccessTokenRepository
+	tokens []*model.PersonalAccessToken
+}
+
+func (r *fakeAccessTokenRepo) Create(token *model.PersonalAccessToken) error {
+	if token.ID == "" {
+		token.ID = uuid.NewString()
+	}
+	token.CreatedAt = time.Now()
+	stored := *token
+	r.tokens = append(r.tokens, &stored)
+	return nil
+}
+
+func (r *fakeAccessTokenRepo) FindByHash(tokenHash string) (*model.PersonalAccessToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeAccessTokenRepo) FindByUserID(userID string) ([]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.IsUsable() {
+			tokens = append(tokens, *token)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *fakeAccessTokenRepo) Revoke(id, userID string) (bool, error) {
+	for _, token := range r.tokens {
+		if token.ID == id && token.UserID == userID && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeAccessTokenRepo) TouchLastUsed(id, ipAddress string) error {
+	for _, token := range r.tokens {
+		if token.ID == id {
+			now := time.Now()
+			token.LastUsedAt = &now
+			token.LastUsedIP = &ipAddress
+		}
+	}
+	return nil
+}
+
+type fakeOrgRepo struct {
+	repository.OrganizationRepository
+	users       *fakeUserRepo
+	orgs        map[string]*model.Organization
+	members     []*model.OrganizationMember
+	invitations []*model.OrganizationInvitation
+}
+
+func newFakeOrgRepo(users *fakeUserRepo) *fakeOrgRepo {
+	return &fakeOrgRepo{users: users, orgs: make(map[string]*model.Organization)}
+}
+
+func (r *fakeOrgRepo) CreateWithOwner(org *model.Organization, ownerID string) error {
+	if org.ID == "" {
+		org.ID = uuid.NewString()
+	}
+	for _, existing := range r.orgs {
+		if existing.Slug == org.Slug {
+			return errors.New("duplicate slug")
+		}
+	}
+	stored := *org
+	r.orgs[org.ID] = &stored
+	_, err := r.AddMember(&model.OrganizationMember{OrganizationID: org.ID, UserID: ownerID, Role: model.OrgRoleOwner})
+	return err
+}
+
+func (r *fakeOrgRepo) FindByID(id string) (*model.Organization, error) {
+	if org, ok := r.orgs[id]; ok {
+		found := *org
+		return &found, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeOrgRepo) FindBySlug(slug string) (*model.Organization, error) {
+	for _, org := range r.orgs {
+		if org.Slug == slug {
+			return r.FindByID(org.ID)
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeOrgRepo) FindByDomain(domain string) (*model.Organization, error) {
+	for _, org := range r.orgs {
+		if org.Domain != nil && *org.Domain == domain {
+			return r.FindByID(org.ID)
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeOrgRepo) Update(org *model.Organization) error {
+	stored := *org
+	r.orgs[org.ID] = &stored
+	return nil
+}
+
+// member returns the stored membership, not a copy
+func (r *fakeOrgRepo) member(orgID, userID string) *model.OrganizationMember {
+	for _, member := range r.members {
+		if member.OrganizationID == orgID && member.UserID == userID {
+			return member
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrgRepo) FindMember(orgID, userID string) (*model.OrganizationMember, error) {
+	member := r.member(orgID, userID)
+	if member == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *member
+	return &found, nil
+}
+
+func (r *fakeOrgRepo) FindMembers(orgID string) ([]model.OrganizationMember, error) {
+	members, _, err := r.SearchMembers(orgID, repository.MemberFilter{Limit: -1})
+	return members, err
+}
+
+func (r *fakeOrgRepo) SearchMembers(orgID string, filter repository.MemberFilter) ([]model.OrganizationMember, int64, error) {
+	var members []model.OrganizationMember
+	for _, member := range r.members {
+		if member.OrganizationID != orgID {
+			continue
+		}
+		found := *member
+		if user, err := r.users.FindByID(member.UserID); err == nil {
+			found.User = *user
+		}
+		if filter.Email != "" && !strings.EqualFold(found.User.Email, filter.Email) {
+			continue
+		}
+		if filter.ExternalID != "" && stringValue(found.ExternalID) != filter.ExternalID {
+			continue
+		}
+		if filter.Role != "" && found.Role != filter.Role {
+			continue
+		}
+		members = append(members, found)
+	}
+	return members, int64(len(members)), nil
+}
+
+func (r *fakeOrgRepo) FindOrganizationIDs(userID string) ([]string, error) {
+	var ids []string
+	for _, member := range r.members {
+		if member.UserID == userID {
+			ids = append(ids, member.OrganizationID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *fakeOrgRepo) AddMember(member *model.OrganizationMember) (bool, error) {
+	if r.member(member.OrganizationID, member.UserID) != nil {
+		return false, nil
+	}
+	stored := *member
+	stored.User = model.User{}
+	stored.JoinedAt = time.Now()
+	r.members = append(r.members, &stored)
+	return true, nil
+}
+
+func (r *fakeOrgRepo) UpdateMember(member *model.OrganizationMember) error {
+	if stored := r.member(member.OrganizationID, member.UserID); stored != nil {
+		stored.Role = member.Role
+		stored.ExternalID = member.ExternalID
+		stored.Managed = member.Managed
+		stored.Provisioned = member.Provisioned
+	}
+	return nil
+}
+
+func (r *fakeOrgRepo) UpdateMemberRole(orgID, userID, role string) error {
+	if stored := r.member(orgID, userID); stored != nil {
+		stored.Role = role
+	}
+	return nil
+}
+
+func (r *fakeOrgRepo) RemoveMember(orgID, userID string) error {
+	for i, member := range r.members {
+		if member.OrganizationID == orgID && member.UserID == userID {
+			r.members = append(r.members[:i], r.members[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *fakeOrgRepo) CountOwners(orgID string) (int64, error) {
+	owners, _, err := r.SearchMembers(orgID, repository.MemberFilter{Role: model.OrgRoleOwner})
+	return int64(len(owners)), err
+}
+
+func (r *fakeOrgRepo) CreateInvitation(invitation *model.OrganizationInvitation) error {
+	if invitation.ID == "" {
+		invitation.ID = uuid.NewString()
+	}
+	stored := *invitation
+	r.invitations = append(r.invitations, &stored)
+	return nil
+}
+
+func (r *fakeOrgRepo) FindInvitationByTokenHash(tokenHash string) (*model.OrganizationInvitation, error) {
+	for _, invitation := range r.invitations {
+		if invitation.TokenHash == tokenHash {
+			found := *invitation
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeOrgRepo) AcceptInvitation(invitation *model.OrganizationInvitation, userID string) error {
+	for _, stored := range r.invitations {
+		if stored.ID == invitation.ID && stored.AcceptedAt == nil {
+			now := time.Now()
+			stored.AcceptedAt = &now
+			invitation.AcceptedAt = &now
+			_, err := r.AddMember(&model.OrganizationMember{OrganizationID: invitation.OrganizationID, UserID: userID, Role: invitation.Role})
+			return err
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *fakeOrgRepo) SetSCIMToken(orgID string, tokenHash *string) error {
+	if org, ok := r.orgs[orgID]; ok {
+		org.SCIMTokenHash = tokenHash
+	}
+	return nil
+}
+
+type fakeAudit struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (a *fakeAudit) Record(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, entry)
+}
+
+func (a *fakeAudit) Search(req AuditQuery) (*AuditEventList, error) {
+	panic("fakeAudit.Search is not implemented")
+}
+
+func (a *fakeAudit) ExportCSV(req AuditQuery, w io.Writer) error {
+	panic("fakeAudit.ExportCSV is not implemented")
+}
+
+// actions returns the recorded actions in order
+func (a *fakeAudit) actions() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	actions := make([]string, len(a.entries))
+	for i, entry := range a.entries {
+		actions[i] = entry.Action
+	}
+	return actions
+}
+
+// last returns the most recent entry with action, or nil
+func (a *fakeAudit) last(action string) *AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := len(a.entries) - 1; i >= 0; i-- {
+		if a.entries[i].Action == action {
+			entry := a.entries[i]
+			return &entry
+		}
+	}
+	return nil
+}
+
+// testAuth bundles an auth service with the fakes behind it
+type testAuth struct {
+	*authService
+	users     *fakeUserRepo
+	sessionDB *fakeSessionRepo
+	codes     *fakeCodeRepo
+	mfa       *fakeMFARepo
+	passkeys  *fakePasskeyRepo
+	identity  *fakeIdentityRepo
+	tokens    *fakeAccessTokenRepo
+	auditLog  *fakeAudit
+}
+
+func newTestAuth(users ...*model.User) *testAuth {
+	t := &testAuth{
+		users:     newFakeUserRepo(users...),
+		sessionDB: newFakeSessionRepo(),
+		codes:     &fakeCodeRepo{},
+		passkeys:  &fakePasskeyRepo{},
+		identity:  &fakeIdentityRepo{},
+		tokens:    &fakeAccessTokenRepo{},
+		auditLog:  &fakeAudit{},
+	}
+	t.mfa = &fakeMFARepo{users: t.users, recoveryCodes: make(map[string][]string)}
+	t.authService = &authService{
+		userRepo:        t.users,
+		sessionRepo:     t.sessionDB,
+		codeRepo:        t.codes,
+		mfaRepo:         t.mfa,
+		passkeyRepo:     t.passkeys,
+		identityRepo:    t.identity,
+		accessTokenRepo: t.tokens,
+		audit:           t.auditLog,
+		jwtSecret:       "test-secret",
+		keys:            util.NewHMACKeyRing("test-secret"),
+		sessions:        newSessionCache(sessionCacheTTL),
+		limiter:         newAttemptLimiter(nil),
+	}
+	return t
+}
+
+// enableMFA turns on 2FA for the user and returns the TOTP secret
+func (t *testAuth) enableMFA(userID string) string {
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		panic(err)
+	}
+	t.mfa.UpdateSecret(userID, &secret, true)
+	return secret
+}
+
+// activeUser returns a verified, active member with a password
+func activeUser(email string) *model.User {
+	hash, err := util.HashPassword("correct horse")
+	if err != nil {
+		panic(err)
+	}
+	return &model.User{
+		ID:           uuid.NewString(),
+		Email:        email,
+		FullName:     "Test User",
+		PasswordHash: hash,
+		UserType:     model.RoleMember,
+		IsActive:     true,
+		IsVerified:   true,
+		LoginType:    model.LoginTypeCredential,
+	}
+}
@@ -0,0 +1,733 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+)
+
+const (
+	orgInvitationTTL  = 7 * 24 * time.Hour
+	orgInvitationPath = "/invitations/accept"
+
+	// Prefix of the DNS TXT record that proves an organization owns its domain
+	domainVerificationPrefix = "berealtime-verification="
+)
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Email providers anyone can sign up with; claiming them would auto-join strangers.
+// Not exhaustive: a domain only takes effect after its DNS TXT record is verified.
+var publicEmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+	"yahoo.com":      true,
+	"yahoo.co.id":    true,
+	"outlook.com":    true,
+	"hotmail.com":    true,
+	"live.com":       true,
+	"icloud.com":     true,
+	"proton.me":      true,
+	"protonmail.com": true,
+}
+
+// OrganizationService manages organizations, their members and invitations
+type OrganizationService interface {
+	CreateOrganization(userID string, req CreateOrganizationRequest, client ClientInfo) (*model.Organization, error)
+	GetMyOrganizations(userID string) ([]repository.MembershipRecord, error)
+	GetOrganization(orgID, userID string) (*repository.MembershipRecord, error)
+	UpdateOrganization(orgID, userID string, req UpdateOrganizationRequest, client ClientInfo) (*model.Organization, error)
+	VerifyDomain(orgID, userID string, client ClientInfo) (*model.Organization, error)
+	GetMembers(orgID, userID string) ([]model.OrganizationMember, error)
+	UpdateMemberRole(orgID, actorID, memberID, role string, client ClientInfo) error
+	RemoveMember(orgID, actorID, memberID string, client ClientInfo) error
+	InviteMember(orgID, actorID string, req InviteMemberRequest, client ClientInfo) (*model.OrganizationInvitation, error)
+	GetInvitations(orgID, userID string) ([]model.OrganizationInvitation, error)
+	RevokeInvitation(orgID, actorID, invitationID string) error
+	AcceptInvitation(userID, token string, client ClientInfo) (*model.Organization, error)
+	CreateSCIMToken(orgID, actorID string, client ClientInfo) (string, error)
+	DisableSCIM(orgID, actorID string, client ClientInfo) error
+}
+
+type CreateOrganizationRequest struct {
+	Name   string  `json:"name" binding:"required,max=255"`
+	Slug   string  `json:"slug" binding:"omitempty,max=100"`
+	Domain *string `json:"domain,omitempty"`
+}
+
+// UpdateOrganizationRequest changes the name or auto-join domain. An empty domain turns auto-join off;
+// a new domain has to be verified again.
+type UpdateOrganizationRequest struct {
+	Name   *string `json:"name,omitempty" binding:"omitempty,max=255"`
+	Domain *string `json:"domain,omitempty"`
+}
+
+type InviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role"`
+}
+
+type organizationService struct {
+	orgRepo   repository.OrganizationRepository
+	userRepo  repository.UserRepository
+	audit     AuditService
+	rabbitMQ  *util.RabbitMQClient
+	config    *config.Config
+	lookupTXT func(domain string) ([]string, error)
+}
+
+func NewOrganizationService(orgRepo repository.OrganizationRepository, userRepo repository.UserRepository, audit AuditService, rabbitMQ *util.RabbitMQClient, cfg *config.Config) OrganizationService {
+	return &organizationService{
+		orgRepo:   orgRepo,
+		userRepo:  userRepo,
+		audit:     audit,
+		rabbitMQ:  rabbitMQ,
+		config:    cfg,
+		lookupTXT: net.LookupTXT,
+	}
+}
+
+// CreateOrganization creates an organization with the caller as its owner
+func (s *organizationService) CreateOrganization(userID string, req CreateOrganizationRequest, client ClientInfo) (*model.Organization, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("organization name is required")
+	}
+
+	slug, err := s.uniqueSlug(req.Slug, name)
+	if err != nil {
+		return nil, err
+	}
+
+	org := &model.Organization{
+		Name:        name,
+		Slug:        slug,
+		CreatedByID: user.ID,
+	}
+	if req.Domain != nil && strings.TrimSpace(*req.Domain) != "" {
+		domain, err := s.claimableDomain(user, *req.Domain, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := setUnverifiedDomain(org, domain); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.orgRepo.CreateWithOwner(org, user.ID); err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	s.recordOrgEvent(model.AuditOrgCreated, user.ID, org.ID, client, map[string]interface{}{"name": org.Name})
+	return org, nil
+}
+
+func (s *organizationService) GetMyOrganizations(userID string) ([]repository.MembershipRecord, error) {
+	memberships, err := s.orgRepo.FindMemberships(userID)
+	if err != nil {
+		return nil, errors.New("failed to fetch organizations")
+	}
+	return memberships, nil
+}
+
+// GetOrganization returns the organization with the caller's role in it
+func (s *organizationService) GetOrganization(orgID, userID string) (*repository.MembershipRecord, error) {
+	member, err := s.requireRole(orgID, userID, model.OrgRoleMember)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+
+	return &repository.MembershipRecord{
+		Organization: *org,
+		Role:         member.Role,
+		JoinedAt:     member.JoinedAt,
+	}, nil
+}
+
+// UpdateOrganization renames the organization or changes its auto-join domain
+func (s *organizationService) UpdateOrganization(orgID, userID string, req UpdateOrganizationRequest, client ClientInfo) (*model.Organization, error) {
+	if _, err := s.requireRole(orgID, userID, model.OrgRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+
+	changes := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, errors.New("organization name is required")
+		}
+		org.Name = name
+		changes["name"] = name
+	}
+
+	if req.Domain != nil {
+		if strings.TrimSpace(*req.Domain) == "" {
+			org.Domain = nil
+			org.DomainVerificationRecord = nil
+			org.DomainVerifiedAt = nil
+			changes["domain"] = nil
+		} else {
+			user, err := s.userRepo.FindByID(userID)
+			if err != nil {
+				return nil, errors.New("user not found")
+			}
+			domain, err := s.claimableDomain(user, *req.Domain, org.ID)
+			if err != nil {
+				return nil, err
+			}
+			if org.Domain == nil || *org.Domain != domain {
+				if err := setUnverifiedDomain(org, domain); err != nil {
+					return nil, err
+				}
+			}
+			changes["domain"] = domain
+		}
+	}
+
+	if err := s.orgRepo.Update(org); err != nil {
+		return nil, fmt.Errorf("failed to update organization: %w", err)
+	}
+
+	s.recordOrgEvent(model.AuditOrgUpdated, userID, org.ID, client, changes)
+	return org, nil
+}
+
+// VerifyDomain checks that the organization's domain publishes its
+// domain_verification_record as a DNS TXT record. Only then do users of the
+// domain join automatically and can SCIM adopt their existing accounts.
+func (s *organizationService) VerifyDomain(orgID, userID string, client ClientInfo) (*model.Organization, error) {
+	if _, err := s.requireRole(orgID, userID, model.OrgRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+	if org.Domain == nil || org.DomainVerificationRecord == nil {
+		return nil, errors.New("organization has no domain to verify")
+	}
+	if org.DomainVerified() {
+		return org, nil
+	}
+
+	records, err := s.lookupTXT(*org.Domain)
+	if err != nil {
+		log.Printf("TXT lookup for %s failed: %v", *org.Domain, err)
+	}
+	found := false
+	for _, record := range records {
+		if strings.TrimSpace(record) == *org.DomainVerificationRecord {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("TXT record %q not found on %s, DNS changes can take a while to appear", *org.DomainVerificationRecord, *org.Domain)
+	}
+
+	now := time.Now()
+	org.DomainVerifiedAt = &now
+	if err := s.orgRepo.Update(org); err != nil {
+		return nil, fmt.Errorf("failed to update organization: %w", err)
+	}
+
+	s.recordOrgEvent(model.AuditOrgDomainVerified, userID, org.ID, client, map[string]interface{}{"domain": *org.Domain})
+	s.addDomainMembers(org)
+	return org, nil
+}
+
+func (s *organizationService) GetMembers(orgID, userID string) ([]model.OrganizationMember, error) {
+	if _, err := s.requireRole(orgID, userID, model.OrgRoleMember); err != nil {
+		return nil, err
+	}
+
+	members, err := s.orgRepo.FindMembers(orgID)
+	if err != nil {
+		return nil, errors.New("failed to fetch members")
+	}
+	return members, nil
+}
+
+// UpdateMemberRole changes a member's role. Admins manage members and admins;
+// only owners can grant or take away ownership.
+func (s *organizationService) UpdateMemberRole(orgID, actorID, memberID, role string, client ClientInfo) error {
+	if !isOrgRole(role) {
+		return fmt.Errorf("role must be one of: %s", strings.Join(model.OrgRoles, ", "))
+	}
+
+	actor, err := s.requireRole(orgID, actorID, model.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	member, err := s.orgRepo.FindMember(orgID, memberID)
+	if err != nil {
+		return errors.New("member not found")
+	}
+	if member.Role == role {
+		return nil
+	}
+
+	if (role == model.OrgRoleOwner || member.Role == model.OrgRoleOwner) && actor.Role != model.OrgRoleOwner {
+		return errors.New("only owners can change ownership")
+	}
+	if member.Role == model.OrgRoleOwner {
+		if err := s.ensureAnotherOwner(orgID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.orgRepo.UpdateMemberRole(orgID, memberID, role); err != nil {
+		return fmt.Errorf("failed to update member: %w", err)
+	}
+
+	s.audit.Record(AuditEntry{
+		ActorID:    actorID,
+		Action:     model.AuditOrgRoleChanged,
+		TargetType: model.AuditTargetUser,
+		TargetID:   memberID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"organization_id": orgID, "from": member.Role, "to": role},
+	})
+	return nil
+}
+
+// RemoveMember removes a member. Members may remove themselves to leave the organization.
+func (s *organizationService) RemoveMember(orgID, actorID, memberID string, client ClientInfo) error {
+	member, err := s.orgRepo.FindMember(orgID, memberID)
+	if err != nil {
+		return errors.New("member not found")
+	}
+
+	if memberID != actorID {
+		actor, err := s.requireRole(orgID, actorID, model.OrgRoleAdmin)
+		if err != nil {
+			return err
+		}
+		if member.Role == model.OrgRoleOwner && actor.Role != model.OrgRoleOwner {
+			return errors.New("only owners can remove owners")
+		}
+	}
+	if member.Role == model.OrgRoleOwner {
+		if err := s.ensureAnotherOwner(orgID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.orgRepo.RemoveMember(orgID, memberID); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	s.audit.Record(AuditEntry{
+		ActorID:    actorID,
+		Action:     model.AuditOrgMemberRemoved,
+		TargetType: model.AuditTargetUser,
+		TargetID:   memberID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"organization_id": orgID},
+	})
+	return nil
+}
+
+// InviteMember emails an invitation link to join the organization
+func (s *organizationService) InviteMember(orgID, actorID string, req InviteMemberRequest, client ClientInfo) (*model.OrganizationInvitation, error) {
+	actor, err := s.requireRole(orgID, actorID, model.OrgRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	role := req.Role
+	if role == "" {
+		role = model.OrgRoleMember
+	}
+	if !isOrgRole(role) {
+		return nil, fmt.Errorf("role must be one of: %s", strings.Join(model.OrgRoles, ", "))
+	}
+	if role == model.OrgRoleOwner && actor.Role != model.OrgRoleOwner {
+		return nil, errors.New("only owners can invite owners")
+	}
+
+	org, err := s.orgRepo.FindByID(orgID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+	inviter, err := s.userRepo.FindByID(actorID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	// Registered invitees get the email in their own language, others in the inviter's
+	locale := inviter.Locale
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if existing, err := s.userRepo.FindByEmail(email); err == nil {
+		if _, err := s.orgRepo.FindMember(orgID, existing.ID); err == nil {
+			return nil, errors.New("user is already a member of this organization")
+		}
+		locale = existing.Locale
+	}
+
+	token, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invitation: %w", err)
+	}
+
+	invitation := &model.OrganizationInvitation{
+		OrganizationID: org.ID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      util.HashToken(token),
+		InvitedByID:    actorID,
+		ExpiresAt:      time.Now().Add(orgInvitationTTL),
+	}
+	if err := s.orgRepo.CreateInvitation(invitation); err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	s.queueEmail(util.EmailMessage{
+		To:     email,
+		Body:   s.invitationURL(token),
+		Type:   "org_invitation",
+		Locale: locale,
+		Data: map[string]string{
+			"organization": org.Name,
+			"inviter":      inviter.FullName,
+		},
+	})
+
+	s.recordOrgEvent(model.AuditOrgInvitationSent, actorID, org.ID, client, map[string]interface{}{"email": email, "role": role})
+	return invitation, nil
+}
+
+func (s *organizationService) GetInvitations(orgID, userID string) ([]model.OrganizationInvitation, error) {
+	if _, err := s.requireRole(orgID, userID, model.OrgRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	invitations, err := s.orgRepo.FindPendingInvitations(orgID)
+	if err != nil {
+		return nil, errors.New("failed to fetch invitations")
+	}
+	return invitations, nil
+}
+
+func (s *organizationService) RevokeInvitation(orgID, actorID, invitationID string) error {
+	if _, err := s.requireRole(orgID, actorID, model.OrgRoleAdmin); err != nil {
+		return err
+	}
+
+	invitation, err := s.orgRepo.FindInvitationByID(invitationID)
+	if err != nil || invitation.OrganizationID != orgID {
+		return errors.New("invitation not found")
+	}
+
+	return s.orgRepo.DeleteInvitation(invitation.ID)
+}
+
+// AcceptInvitation joins the organization from an invitation link. The
+// invitation only works for the account with the invited email address.
+func (s *organizationService) AcceptInvitation(userID, token string, client ClientInfo) (*model.Organization, error) {
+	invitation, err := s.orgRepo.FindInvitationByTokenHash(util.HashToken(token))
+	if err != nil || invitation.AcceptedAt != nil || invitation.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("invalid or expired invitation")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, errors.New("this invitation was sent to a different email address")
+	}
+
+	org, err := s.orgRepo.FindByID(invitation.OrganizationID)
+	if err != nil {
+		return nil, errors.New("organization not found")
+	}
+
+	if err := s.orgRepo.AcceptInvitation(invitation, user.ID); err != nil {
+		return nil, errors.New("invalid or expired invitation")
+	}
+
+	s.recordOrgEvent(model.AuditOrgMemberJoined, user.ID, org.ID, client, map[string]interface{}{"via": "invitation", "role": invitation.Role})
+	return org, nil
+}
+
+// CreateSCIMToken issues a new SCIM bearer token for the organization's
+// identity provider, replacing any previous one. The token is only shown once.
+func (s *organizationService) CreateSCIMToken(orgID, actorID string, client ClientInfo) (string, error) {
+	if _, err := s.requireRole(orgID, actorID, model.OrgRoleOwner); err != nil {
+		return "", err
+	}
+
+	secret, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := model.SCIMTokenPrefix + secret
+
+	tokenHash := util.HashToken(token)
+	if err := s.orgRepo.SetSCIMToken(orgID, &tokenHash); err != nil {
+		return "", fmt.Errorf("failed to save token: %w", err)
+	}
+
+	s.recordOrgEvent(model.AuditOrgSCIMEnabled, actorID, orgID, client, nil)
+	return token, nil
+}
+
+// DisableSCIM revokes the organization's SCIM token
+func (s *organizationService) DisableSCIM(orgID, actorID string, client ClientInfo) error {
+	if _, err := s.requireRole(orgID, actorID, model.OrgRoleOwner); err != nil {
+		return err
+	}
+
+	if err := s.orgRepo.SetSCIMToken(orgID, nil); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	s.recordOrgEvent(model.AuditOrgSCIMDisabled, actorID, orgID, client, nil)
+	return nil
+}
+
+// requireRole returns the caller's membership if they have at least minRole in the organization
+func (s *organizationService) requireRole(orgID, userID, minRole string) (*model.OrganizationMember, error) {
+	member, err := s.orgRepo.FindMember(orgID, userID)
+	if err != nil {
+		// Non-members cannot tell whether the organization exists
+		return nil, errors.New("organization not found")
+	}
+	if orgRoleRank(member.Role) < orgRoleRank(minRole) {
+		return nil, errors.New("you do not have permission to manage this organization")
+	}
+	return member, nil
+}
+
+func (s *organizationService) ensureAnotherOwner(orgID string) error {
+	owners, err := s.orgRepo.CountOwners(orgID)
+	if err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners <= 1 {
+		return errors.New("an organization needs at least one owner")
+	}
+	return nil
+}
+
+// uniqueSlug validates the requested slug, or derives a free one from the name
+func (s *organizationService) uniqueSlug(requested, name string) (string, error) {
+	if requested != "" {
+		slug := slugify(requested)
+		if slug != requested {
+			return "", errors.New("slug may only contain lowercase letters, digits and dashes")
+		}
+		if _, err := s.orgRepo.FindBySlug(slug); err == nil {
+			return "", errors.New("slug is already taken")
+		}
+		return slug, nil
+	}
+
+	base := slugify(name)
+	if base == "" {
+		base = "org"
+	}
+	slug := base
+	for i := 2; i < 100; i++ {
+		if _, err := s.orgRepo.FindBySlug(slug); err != nil {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	return "", errors.New("could not find a free slug, please choose one")
+}
+
+// claimableDomain checks that user may turn on auto-join for domain: it must
+// be their own verified email domain and not a public email provider
+func (s *organizationService) claimableDomain(user *model.User, domain, orgID string) (string, error) {
+	domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+	if domain == "" || !strings.Contains(domain, ".") {
+		return "", errors.New("invalid domain")
+	}
+	if publicEmailDomains[domain] {
+		return "", errors.New("public email domains cannot be used for auto-join")
+	}
+	if !user.IsVerified || emailDomain(user.Email) != domain {
+		return "", errors.New("you can only use the domain of your own verified email address")
+	}
+	if existing, err := s.orgRepo.FindByDomain(domain); err == nil && existing.ID != orgID {
+		return "", errors.New("domain is already used by another organization")
+	}
+	return domain, nil
+}
+
+// setUnverifiedDomain sets a newly claimed domain together with a fresh TXT
+// record to prove its ownership
+func setUnverifiedDomain(org *model.Organization, domain string) error {
+	token, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate domain verification: %w", err)
+	}
+	record := domainVerificationPrefix + token
+	org.Domain = &domain
+	org.DomainVerificationRecord = &record
+	org.DomainVerifiedAt = nil
+	return nil
+}
+
+// addDomainMembers adds existing verified users of the organization's verified domain
+func (s *organizationService) addDomainMembers(org *model.Organization) {
+	if !org.DomainVerified() {
+		return
+	}
+
+	users, _, err := s.userRepo.Search(repository.UserFilter{Query: "@" + *org.Domain, Limit: -1})
+	if err != nil {
+		log.Printf("Failed to find users for domain %s: %v", *org.Domain, err)
+		return
+	}
+
+	for _, user := range users {
+		if !user.IsVerified || emailDomain(user.Email) != *org.Domain {
+			continue
+		}
+		added, err := s.orgRepo.AddMember(&model.OrganizationMember{
+			OrganizationID: org.ID,
+			UserID:         user.ID,
+			Role:           model.OrgRoleMember,
+		})
+		if err != nil {
+			log.Printf("Failed to add %s to organization %s: %v", user.ID, org.ID, err)
+			continue
+		}
+		if added {
+			s.recordOrgEvent(model.AuditOrgMemberJoined, user.ID, org.ID, ClientInfo{}, map[string]interface{}{"via": "domain"})
+		}
+	}
+}
+
+func (s *organizationService) invitationURL(token string) string {
+	baseURL := "http://localhost:3000"
+	if s.config != nil {
+		baseURL = strings.TrimSuffix(s.config.ClientURL, "/")
+	}
+	return baseURL + orgInvitationPath + "?token=" + token
+}
+
+func (s *organizationService) recordOrgEvent(action, userID, orgID string, client ClientInfo, metadata map[string]interface{}) {
+	s.audit.Record(AuditEntry{
+		ActorID:    userID,
+		Action:     action,
+		TargetType: model.AuditTargetOrg,
+		TargetID:   orgID,
+		Client:     client,
+		Metadata:   metadata,
+	})
+}
+
+// queueEmail publishes an email to RabbitMQ, connecting first if the server started without it
+func (s *organizationService) queueEmail(msg util.EmailMessage) {
+	if s.rabbitMQ == nil && s.config != nil {
+		if client, err := util.NewRabbitMQClient(s.config); err == nil {
+			s.rabbitMQ = client
+		}
+	}
+	if s.rabbitMQ == nil {
+		log.Printf("Warning: RabbitMQ not available, %s email not sent for %s", msg.Type, msg.To)
+		return
+	}
+	if err := s.rabbitMQ.PublishEmail(msg); err != nil {
+		log.Printf("Failed to publish %s email to %s: %v", msg.Type, msg.To, err)
+	}
+}
+
+// autoJoinOrganizations adds a user with a freshly verified email to the
+// organization that verified its domain, if any
+func (s *authService) autoJoinOrganizations(user *model.User) {
+	if s.orgRepo == nil {
+		return
+	}
+	org, err := s.orgRepo.FindByDomain(emailDomain(user.Email))
+	if err != nil || !org.DomainVerified() {
+		return
+	}
+
+	added, err := s.orgRepo.AddMember(&model.OrganizationMember{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           model.OrgRoleMember,
+	})
+	if err != nil {
+		log.Printf("Failed to add %s to organization %s: %v", user.ID, org.ID, err)
+		return
+	}
+	if added {
+		s.audit.Record(AuditEntry{
+			ActorID:    user.ID,
+			Action:     model.AuditOrgMemberJoined,
+			TargetType: model.AuditTargetOrg,
+			TargetID:   org.ID,
+			Metadata:   map[string]interface{}{"via": "domain"},
+		})
+	}
+}
+
+// canAccessRoom reports whether the user may see, join and chat in the room.
+// Personal rooms are open to anyone with the link; organization rooms only to members.
+func canAccessRoom(orgRepo repository.OrganizationRepository, room *model.Room, userID string) bool {
+	if room.OrganizationID == nil {
+		return true
+	}
+	_, err := orgRepo.FindMember(*room.OrganizationID, userID)
+	return err == nil
+}
+
+func orgRoleRank(role string) int {
+	switch role {
+	case model.OrgRoleOwner:
+		return 3
+	case model.OrgRoleAdmin:
+		return 2
+	case model.OrgRoleMember:
+		return 1
+	}
+	return 0
+}
+
+func isOrgRole(role string) bool {
+	return orgRoleRank(role) > 0
+}
+
+func slugify(value string) string {
+	return strings.Trim(slugInvalidChars.ReplaceAllString(strings.ToLower(value), "-"), "-")
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
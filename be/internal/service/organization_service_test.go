@@ -0,0 +1,315 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+)
+
+type testOrgs struct {
+	*organizationService
+	users    *fakeUserRepo
+	orgs     *fakeOrgRepo
+	auditLog *fakeAudit
+	txt      map[string][]string
+}
+
+func newTestOrgs(users ...*model.User) *testOrgs {
+	t := &testOrgs{
+		users:    newFakeUserRepo(users...),
+		auditLog: &fakeAudit{},
+		txt:      make(map[string][]string),
+	}
+	t.orgs = newFakeOrgRepo(t.users)
+	t.organizationService = &organizationService{
+		orgRepo:  t.orgs,
+		userRepo: t.users,
+		audit:    t.auditLog,
+		lookupTXT: func(domain string) ([]string, error) {
+			records, ok := t.txt[domain]
+			if !ok {
+				return nil, errors.New("no such host")
+			}
+			return records, nil
+		},
+	}
+	return t
+}
+
+// addMember makes user a member of org with role
+func (t *testOrgs) addMember(orgID string, user *model.User, role string) {
+	t.orgs.AddMember(&model.OrganizationMember{OrganizationID: orgID, UserID: user.ID, Role: role})
+}
+
+func (t *testOrgs) role(orgID, userID string) string {
+	member, err := t.orgs.FindMember(orgID, userID)
+	if err != nil {
+		return ""
+	}
+	return member.Role
+}
+
+func TestCreateOrganizationDomainRules(t *testing.T) {
+	owner := activeUser("owner@acme.test")
+	gmail := activeUser("someone@gmail.com")
+	unverified := activeUser("new@acme.test")
+	unverified.IsVerified = false
+	orgs := newTestOrgs(owner, gmail, unverified)
+
+	domain := func(d string) *string { return &d }
+	tests := []struct {
+		name   string
+		user   *model.User
+		domain string
+	}{
+		{"public email provider", gmail, "gmail.com"},
+		{"someone else's domain", owner, "example.com"},
+		{"unverified email", unverified, "acme.test"},
+		{"not a domain", owner, "acme"},
+	}
+	for _, tt := range tests {
+		if _, err := orgs.CreateOrganization(tt.user.ID, CreateOrganizationRequest{Name: "Acme", Domain: domain(tt.domain)}, ClientInfo{}); err == nil {
+			t.Errorf("%s: domain %q was accepted", tt.name, tt.domain)
+		}
+	}
+
+	org, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Acme Inc", Domain: domain("@ACME.test")}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org.Slug != "acme-inc" || stringValue(org.Domain) != "acme.test" {
+		t.Errorf("org = %+v", org)
+	}
+	if org.DomainVerified() || org.DomainVerificationRecord == nil {
+		t.Error("a new domain must be verified before it takes effect")
+	}
+	if orgs.role(org.ID, owner.ID) != model.OrgRoleOwner {
+		t.Error("creator is not the owner")
+	}
+
+	// The same name gets a free slug, a taken slug is rejected
+	second, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Acme Inc"}, ClientInfo{})
+	if err != nil || second.Slug != "acme-inc-2" {
+		t.Errorf("second slug = %v, %v", second, err)
+	}
+	if _, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Other", Slug: "acme-inc"}, ClientInfo{}); err == nil {
+		t.Error("taken slug was accepted")
+	}
+	if _, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Other", Domain: domain("acme.test")}, ClientInfo{}); err == nil {
+		t.Error("domain of another organization was accepted")
+	}
+}
+
+func TestVerifyDomainAddsVerifiedUsers(t *testing.T) {
+	owner := activeUser("owner@acme.test")
+	colleague := activeUser("colleague@acme.test")
+	unverified := activeUser("pending@acme.test")
+	unverified.IsVerified = false
+	lookalike := activeUser("someone@notacme.test")
+	orgs := newTestOrgs(owner, colleague, unverified, lookalike)
+
+	domain := "acme.test"
+	org, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Acme", Domain: &domain}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := orgs.VerifyDomain(org.ID, colleague.ID, ClientInfo{}); err == nil {
+		t.Error("non-member verified the domain")
+	}
+	if _, err := orgs.VerifyDomain(org.ID, owner.ID, ClientInfo{}); err == nil {
+		t.Fatal("domain was verified without its TXT record")
+	}
+	if orgs.role(org.ID, colleague.ID) != "" {
+		t.Fatal("user joined through an unverified domain")
+	}
+
+	orgs.txt[domain] = []string{"v=spf1 -all", " " + *org.DomainVerificationRecord + " "}
+	verified, err := orgs.VerifyDomain(org.ID, owner.ID, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.DomainVerified() {
+		t.Fatal("domain is not verified")
+	}
+
+	if orgs.role(org.ID, colleague.ID) != model.OrgRoleMember {
+		t.Error("verified user of the domain did not join")
+	}
+	if orgs.role(org.ID, unverified.ID) != "" {
+		t.Error("user with an unverified email joined")
+	}
+	if orgs.role(org.ID, lookalike.ID) != "" {
+		t.Error("user of another domain joined")
+	}
+
+	// Users who verify their email later join too
+	auth := newTestAuth()
+	auth.orgRepo = orgs.orgs
+	orgs.users.users[unverified.ID].IsVerified = true
+	auth.autoJoinOrganizations(orgs.users.users[unverified.ID])
+	if orgs.role(org.ID, unverified.ID) != model.OrgRoleMember {
+		t.Error("user did not join after verifying their email")
+	}
+}
+
+func TestUpdateMemberRoleProtectsOwners(t *testing.T) {
+	owner := activeUser("owner@example.org")
+	admin := activeUser("admin@example.org")
+	member := activeUser("member@example.org")
+	orgs := newTestOrgs(owner, admin, member)
+	org, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Acme"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgs.addMember(org.ID, admin, model.OrgRoleAdmin)
+	orgs.addMember(org.ID, member, model.OrgRoleMember)
+
+	if err := orgs.UpdateMemberRole(org.ID, member.ID, member.ID, model.OrgRoleAdmin, ClientInfo{}); err == nil {
+		t.Error("member promoted themselves")
+	}
+	if err := orgs.UpdateMemberRole(org.ID, admin.ID, member.ID, model.OrgRoleOwner, ClientInfo{}); err == nil {
+		t.Error("admin granted ownership")
+	}
+	if err := orgs.UpdateMemberRole(org.ID, admin.ID, owner.ID, model.OrgRoleMember, ClientInfo{}); err == nil {
+		t.Error("admin demoted the owner")
+	}
+	if err := orgs.UpdateMemberRole(org.ID, admin.ID, member.ID, "superuser", ClientInfo{}); err == nil {
+		t.Error("unknown role was accepted")
+	}
+	if err := orgs.UpdateMemberRole(org.ID, owner.ID, owner.ID, model.OrgRoleAdmin, ClientInfo{}); err == nil {
+		t.Error("the last owner stepped down")
+	}
+
+	if err := orgs.UpdateMemberRole(org.ID, admin.ID, member.ID, model.OrgRoleAdmin, ClientInfo{}); err != nil {
+		t.Errorf("admin could not promote a member: %v", err)
+	}
+	if err := orgs.UpdateMemberRole(org.ID, owner.ID, admin.ID, model.OrgRoleOwner, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := orgs.UpdateMemberRole(org.ID, owner.ID, owner.ID, model.OrgRoleMember, ClientInfo{}); err != nil {
+		t.Errorf("owner could not step down with another owner left: %v", err)
+	}
+
+	entry := orgs.auditLog.last(model.AuditOrgRoleChanged)
+	if entry == nil || entry.Metadata["from"] != model.OrgRoleOwner || entry.Metadata["to"] != model.OrgRoleMember {
+		t.Errorf("audit entry = %+v", entry)
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	owner := activeUser("owner@example.org")
+	admin := activeUser("admin@example.org")
+	member := activeUser("member@example.org")
+	orgs := newTestOrgs(owner, admin, member)
+	org, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Acme"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgs.addMember(org.ID, admin, model.OrgRoleAdmin)
+	orgs.addMember(org.ID, member, model.OrgRoleMember)
+
+	if err := orgs.RemoveMember(org.ID, member.ID, admin.ID, ClientInfo{}); err == nil {
+		t.Error("member removed an admin")
+	}
+	if err := orgs.RemoveMember(org.ID, admin.ID, owner.ID, ClientInfo{}); err == nil {
+		t.Error("admin removed the owner")
+	}
+	if err := orgs.RemoveMember(org.ID, owner.ID, owner.ID, ClientInfo{}); err == nil {
+		t.Error("the last owner left")
+	}
+
+	if err := orgs.RemoveMember(org.ID, member.ID, member.ID, ClientInfo{}); err != nil {
+		t.Errorf("member could not leave: %v", err)
+	}
+	if err := orgs.RemoveMember(org.ID, owner.ID, admin.ID, ClientInfo{}); err != nil {
+		t.Errorf("owner could not remove an admin: %v", err)
+	}
+	if orgs.role(org.ID, member.ID) != "" || orgs.role(org.ID, admin.ID) != "" {
+		t.Error("members were not removed")
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	owner := activeUser("owner@example.org")
+	invitee := activeUser("invitee@example.org")
+	other := activeUser("other@example.org")
+	orgs := newTestOrgs(owner, invitee, other)
+	org, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Acme"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := orgs.InviteMember(org.ID, owner.ID, InviteMemberRequest{Email: owner.Email}, ClientInfo{}); err == nil {
+		t.Error("an existing member was invited")
+	}
+	if _, err := orgs.InviteMember(org.ID, owner.ID, InviteMemberRequest{Email: " Invitee@Example.org ", Role: model.OrgRoleAdmin}, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	invitation := orgs.orgs.invitations[0]
+	if invitation.Email != invitee.Email {
+		t.Errorf("invitation email = %q", invitation.Email)
+	}
+
+	// The link itself is only in the email, so plant a known token
+	token := "invitation-token"
+	invitation.TokenHash = util.HashToken(token)
+
+	if _, err := orgs.AcceptInvitation(invitee.ID, "wrong-token", ClientInfo{}); err == nil {
+		t.Error("unknown invitation was accepted")
+	}
+	if _, err := orgs.AcceptInvitation(other.ID, token, ClientInfo{}); err == nil {
+		t.Error("invitation was accepted by another account")
+	}
+	if _, err := orgs.AcceptInvitation(invitee.ID, token, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if orgs.role(org.ID, invitee.ID) != model.OrgRoleAdmin {
+		t.Error("invitee did not join with the invited role")
+	}
+	if _, err := orgs.AcceptInvitation(invitee.ID, token, ClientInfo{}); err == nil {
+		t.Error("invitation was accepted twice")
+	}
+
+	expired := &model.OrganizationInvitation{
+		OrganizationID: org.ID,
+		Email:          other.Email,
+		Role:           model.OrgRoleMember,
+		TokenHash:      util.HashToken("expired-token"),
+		ExpiresAt:      time.Now().Add(-time.Minute),
+	}
+	orgs.orgs.CreateInvitation(expired)
+	if _, err := orgs.AcceptInvitation(other.ID, "expired-token", ClientInfo{}); err == nil {
+		t.Error("expired invitation was accepted")
+	}
+}
+
+func TestOrganizationRoomsAreMembersOnly(t *testing.T) {
+	owner := activeUser("owner@example.org")
+	outsider := activeUser("outsider@example.org")
+	orgs := newTestOrgs(owner, outsider)
+	org, err := orgs.CreateOrganization(owner.ID, CreateOrganizationRequest{Name: "Acme"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	personal := &model.Room{ID: "personal"}
+	private := &model.Room{ID: "org", OrganizationID: &org.ID}
+	if !canAccessRoom(orgs.orgs, personal, outsider.ID) {
+		t.Error("personal room is not open to everyone with the link")
+	}
+	if !canAccessRoom(orgs.orgs, private, owner.ID) {
+		t.Error("member cannot access the organization's room")
+	}
+	if canAccessRoom(orgs.orgs, private, outsider.ID) {
+		t.Error("outsider can access the organization's room")
+	}
+
+	if _, err := orgs.GetOrganization(org.ID, outsider.ID); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("outsider sees the organization: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// pendingStore keeps short-lived, single-use state between the two steps of a
+// ceremony (e.g. a WebAuthn challenge). Entries expire after ttl.
+type pendingStore[T any] struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[string]pendingItem[T]
+}
+
+type pendingItem[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+func newPendingStore[T any](ttl time.Duration) *pendingStore[T] {
+	return &pendingStore[T]{
+		ttl:   ttl,
+		items: make(map[string]pendingItem[T]),
+	}
+}
+
+func (p *pendingStore[T]) put(key string, value T) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for k, item := range p.items {
+		if now.After(item.expiresAt) {
+			delete(p.items, k)
+		}
+	}
+	p.items[key] = pendingItem[T]{value: value, expiresAt: now.Add(p.ttl)}
+}
+
+// take returns and removes the entry, so each entry can be used only once
+func (p *pendingStore[T]) take(key string) (T, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	item, ok := p.items[key]
+	delete(p.items, key)
+	if !ok || time.Now().After(item.expiresAt) {
+		var zero T
+		return zero, false
+	}
+	return item.value, true
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+)
+
+type RetentionService interface {
+	GetPolicies() ([]model.RetentionPolicy, error)
+	SetPolicy(req RetentionPolicyRequest, adminID string, client ClientInfo) (*model.RetentionPolicy, error)
+	DeletePolicy(policyID, adminID string, client ClientInfo) error
+	GetPurgeLogs(limit, offset int) ([]model.RetentionPurgeLog, error)
+	PurgeExpiredMessages() (int64, error)
+}
+
+const (
+	defaultPurgeLogPageSize = 50
+	maxPurgeLogPageSize     = 500
+)
+
+type retentionService struct {
+	retentionRepo repository.RetentionRepository
+	roomRepo      repository.RoomRepository
+	auditService  AuditService
+	batchSize     int
+}
+
+// RetentionPolicyRequest creates or updates a policy. Omit room_id to configure the global policy.
+type RetentionPolicyRequest struct {
+	RoomID          *string `json:"room_id"`
+	RetentionDays   int     `json:"retention_days" binding:"min=0"`
+	LegalHold       bool    `json:"legal_hold"`
+	LegalHoldReason *string `json:"legal_hold_reason"`
+}
+
+func NewRetentionService(retentionRepo repository.RetentionRepository, roomRepo repository.RoomRepository, auditService AuditService, batchSize int) RetentionService {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &retentionService{
+		retentionRepo: retentionRepo,
+		roomRepo:      roomRepo,
+		auditService:  auditService,
+		batchSize:     batchSize,
+	}
+}
+
+func (s *retentionService) GetPolicies() ([]model.RetentionPolicy, error) {
+	policies, err := s.retentionRepo.FindAllPolicies()
+	if err != nil {
+		return nil, errors.New("failed to fetch retention policies")
+	}
+	return policies, nil
+}
+
+func (s *retentionService) SetPolicy(req RetentionPolicyRequest, adminID string, client ClientInfo) (*model.RetentionPolicy, error) {
+	if req.RoomID != nil && *req.RoomID == "" {
+		req.RoomID = nil
+	}
+
+	var policy *model.RetentionPolicy
+	if req.RoomID != nil {
+		if _, err := s.roomRepo.FindByID(*req.RoomID); err != nil {
+			return nil, errors.New("room not found")
+		}
+		policy, _ = s.retentionRepo.FindPolicyByRoomID(*req.RoomID)
+	} else {
+		policy, _ = s.retentionRepo.FindGlobalPolicy()
+	}
+
+	var old map[string]interface{}
+	if policy == nil {
+		policy = &model.RetentionPolicy{RoomID: req.RoomID}
+	} else {
+		old = retentionPolicyAuditValues(policy)
+	}
+
+	policy.RetentionDays = req.RetentionDays
+	policy.LegalHold = req.LegalHold
+	policy.LegalHoldReason = req.LegalHoldReason
+	if !req.LegalHold {
+		policy.LegalHoldReason = nil
+	}
+	policy.UpdatedByID = adminID
+
+	if err := s.retentionRepo.SavePolicy(policy); err != nil {
+		return nil, errors.New("failed to save retention policy")
+	}
+
+	s.auditService.Record(AuditEntry{
+		ActorID:    adminID,
+		Action:     model.AuditRetentionPolicySet,
+		TargetType: model.AuditTargetRetentionPolicy,
+		TargetID:   policy.ID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"old": old, "new": retentionPolicyAuditValues(policy)},
+	})
+
+	return policy, nil
+}
+
+func (s *retentionService) DeletePolicy(policyID, adminID string, client ClientInfo) error {
+	policy, err := s.retentionRepo.FindPolicyByID(policyID)
+	if err != nil {
+		return errors.New("retention policy not found")
+	}
+	if err := s.retentionRepo.DeletePolicy(policyID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(AuditEntry{
+		ActorID:    adminID,
+		Action:     model.AuditRetentionPolicyDeleted,
+		TargetType: model.AuditTargetRetentionPolicy,
+		TargetID:   policyID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"old": retentionPolicyAuditValues(policy), "new": nil},
+	})
+	return nil
+}
+
+// retentionPolicyAuditValues is the part of a policy recorded in the audit log
+// when it changes; "old" is nil for a new policy and "new" is nil after a delete
+func retentionPolicyAuditValues(policy *model.RetentionPolicy) map[string]interface{} {
+	return map[string]interface{}{
+		"room_id":           policy.RoomID,
+		"retention_days":    policy.RetentionDays,
+		"legal_hold":        policy.LegalHold,
+		"legal_hold_reason": policy.LegalHoldReason,
+	}
+}
+
+func (s *retentionService) GetPurgeLogs(limit, offset int) ([]model.RetentionPurgeLog, error) {
+	if limit <= 0 {
+		limit = defaultPurgeLogPageSize
+	}
+	if limit > maxPurgeLogPageSize {
+		limit = maxPurgeLogPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	logs, err := s.retentionRepo.FindPurgeLogs(limit, offset)
+	if err != nil {
+		return nil, errors.New("failed to fetch purge logs")
+	}
+	return logs, nil
+}
+
+// PurgeExpiredMessages applies every retention policy once and returns the number of deleted messages.
+// Room policies take precedence over the global policy; a legal hold exempts the room entirely.
+func (s *retentionService) PurgeExpiredMessages() (int64, error) {
+	policies, err := s.retentionRepo.FindAllPolicies()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var total int64
+	for _, policy := range policies {
+		if policy.LegalHold || policy.RetentionDays <= 0 {
+			continue
+		}
+
+		cutoff := now.AddDate(0, 0, -policy.RetentionDays)
+		var purged int64
+		if policy.RoomID != nil {
+			roomID := *policy.RoomID
+			purged, err = s.purge(&policy, cutoff, func() ([]model.ChatMessage, error) {
+				return s.retentionRepo.PurgeRoomMessages(roomID, cutoff, s.batchSize)
+			})
+		} else {
+			purged, err = s.purge(&policy, cutoff, func() ([]model.ChatMessage, error) {
+				return s.retentionRepo.PurgeUnscopedMessages(cutoff, s.batchSize)
+			})
+		}
+
+		total += purged
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// purge runs deleteBatch until nothing is left and writes one purge log per affected room
+func (s *retentionService) purge(policy *model.RetentionPolicy, cutoff time.Time, deleteBatch func() ([]model.ChatMessage, error)) (int64, error) {
+	logs := make(map[string]*model.RetentionPurgeLog)
+	var total int64
+	var batchErr error
+
+	for {
+		deleted, err := deleteBatch()
+		if err != nil {
+			batchErr = err
+			break
+		}
+
+		for _, msg := range deleted {
+			entry, ok := logs[msg.RoomID]
+			if !ok {
+				entry = &model.RetentionPurgeLog{
+					PolicyID:      policy.ID,
+					RoomID:        msg.RoomID,
+					RetentionDays: policy.RetentionDays,
+					Cutoff:        cutoff,
+				}
+				logs[msg.RoomID] = entry
+			}
+
+			createdAt := msg.CreatedAt
+			if entry.OldestMessageAt == nil || createdAt.Before(*entry.OldestMessageAt) {
+				entry.OldestMessageAt = &createdAt
+			}
+			if entry.NewestMessageAt == nil || createdAt.After(*entry.NewestMessageAt) {
+				entry.NewestMessageAt = &createdAt
+			}
+			entry.PurgedCount++
+		}
+		total += int64(len(deleted))
+
+		if len(deleted) < s.batchSize {
+			break
+		}
+	}
+
+	// Record what was purged even if a later batch failed
+	for _, entry := range logs {
+		if err := s.retentionRepo.CreatePurgeLog(entry); err != nil {
+			log.Printf("Failed to write retention purge log for room %s: %v", entry.RoomID, err)
+		}
+	}
+
+	return total, batchErr
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type fakeRetentionRepo struct {
+	repository.RetentionRepository
+	policies []model.RetentionPolicy
+	messages []model.ChatMessage
+	logs     []model.RetentionPurgeLog
+}
+
+func (r *fakeRetentionRepo) FindAllPolicies() ([]model.RetentionPolicy, error) {
+	return append([]model.RetentionPolicy(nil), r.policies...), nil
+}
+
+func (r *fakeRetentionRepo) PurgeRoomMessages(roomID string, before time.Time, limit int) ([]model.ChatMessage, error) {
+	return r.purge(limit, func(msg model.ChatMessage) bool {
+		return msg.RoomID == roomID && msg.CreatedAt.Before(before)
+	}), nil
+}
+
+func (r *fakeRetentionRepo) PurgeUnscopedMessages(before time.Time, limit int) ([]model.ChatMessage, error) {
+	return r.purge(limit, func(msg model.ChatMessage) bool {
+		for _, policy := range r.policies {
+			if policy.RoomID != nil && *policy.RoomID == msg.RoomID {
+				return false
+			}
+		}
+		return msg.CreatedAt.Before(before)
+	}), nil
+}
+
+// purge deletes up to limit matching messages, oldest first
+func (r *fakeRetentionRepo) purge(limit int, match func(model.ChatMessage) bool) []model.ChatMessage {
+	sort.Slice(r.messages, func(i, j int) bool { return r.messages[i].CreatedAt.Before(r.messages[j].CreatedAt) })
+	var deleted, kept []model.ChatMessage
+	for _, msg := range r.messages {
+		if len(deleted) < limit && match(msg) {
+			deleted = append(deleted, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	r.messages = kept
+	return deleted
+}
+
+func (r *fakeRetentionRepo) CreatePurgeLog(log *model.RetentionPurgeLog) error {
+	r.logs = append(r.logs, *log)
+	return nil
+}
+
+func (r *fakeRetentionRepo) addPolicy(roomID *string, days int, legalHold bool) {
+	r.policies = append(r.policies, model.RetentionPolicy{
+		ID:            uuid.NewString(),
+		RoomID:        roomID,
+		RetentionDays: days,
+		LegalHold:     legalHold,
+	})
+}
+
+func (r *fakeRetentionRepo) addMessage(roomID string, age time.Duration) {
+	r.messages = append(r.messages, model.ChatMessage{
+		ID:        uuid.NewString(),
+		RoomID:    roomID,
+		CreatedAt: time.Now().Add(-age),
+	})
+}
+
+// remaining counts the messages left in a room
+func (r *fakeRetentionRepo) remaining(roomID string) int {
+	n := 0
+	for _, msg := range r.messages {
+		if msg.RoomID == roomID {
+			n++
+		}
+	}
+	return n
+}
+
+const day = 24 * time.Hour
+
+func TestPurgeExpiredMessagesAppliesCutoffs(t *testing.T) {
+	repo := &fakeRetentionRepo{}
+	short, long, unscoped := "room-short", "room-long", "room-unscoped"
+	repo.addPolicy(nil, 30, false)
+	repo.addPolicy(&short, 7, false)
+	repo.addPolicy(&long, 90, false)
+
+	repo.addMessage(short, 8*day)
+	repo.addMessage(short, 6*day)
+	repo.addMessage(long, 60*day)
+	repo.addMessage(long, 91*day)
+	repo.addMessage(unscoped, 31*day)
+	repo.addMessage(unscoped, 29*day)
+
+	service := NewRetentionService(repo, nil, &fakeAudit{}, 10)
+	purged, err := service.PurgeExpiredMessages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 3 {
+		t.Errorf("purged %d messages, want 3", purged)
+	}
+
+	// A room policy overrides the global one in both directions
+	for room, want := range map[string]int{short: 1, long: 1, unscoped: 1} {
+		if got := repo.remaining(room); got != want {
+			t.Errorf("%s has %d messages left, want %d", room, got, want)
+		}
+	}
+	for _, msg := range repo.messages {
+		if msg.RoomID == long && msg.CreatedAt.Before(time.Now().Add(-90*day)) {
+			t.Error("message older than the room's retention was kept")
+		}
+	}
+}
+
+func TestPurgeExpiredMessagesSkipsLegalHoldAndKeepForever(t *testing.T) {
+	repo := &fakeRetentionRepo{}
+	held, forever := "room-held", "room-forever"
+	repo.addPolicy(nil, 1, false)
+	repo.addPolicy(&held, 1, true)
+	repo.addPolicy(&forever, 0, false)
+	repo.addMessage(held, 400*day)
+	repo.addMessage(forever, 400*day)
+
+	service := NewRetentionService(repo, nil, &fakeAudit{}, 10)
+	if _, err := service.PurgeExpiredMessages(); err != nil {
+		t.Fatal(err)
+	}
+	if repo.remaining(held) != 1 {
+		t.Error("message under legal hold was purged")
+	}
+	if repo.remaining(forever) != 1 {
+		t.Error("message of a room kept forever was purged by the global policy")
+	}
+	if len(repo.logs) != 0 {
+		t.Errorf("wrote %d purge logs, want none", len(repo.logs))
+	}
+}
+
+func TestPurgeExpiredMessagesLogsOncePerRoom(t *testing.T) {
+	repo := &fakeRetentionRepo{}
+	room := "room"
+	repo.addPolicy(&room, 7, false)
+	for i := 0; i < 5; i++ {
+		repo.addMessage(room, time.Duration(10+i)*day)
+	}
+	repo.addMessage(room, day)
+
+	service := NewRetentionService(repo, nil, &fakeAudit{}, 2)
+	purged, err := service.PurgeExpiredMessages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 5 || repo.remaining(room) != 1 {
+		t.Fatalf("purged %d, %d left; want 5 purged and 1 left", purged, repo.remaining(room))
+	}
+
+	// One log per room for the whole run, not one per batch
+	if len(repo.logs) != 1 {
+		t.Fatalf("wrote %d purge logs, want 1", len(repo.logs))
+	}
+	entry := repo.logs[0]
+	if entry.RoomID != room || entry.PurgedCount != 5 || entry.RetentionDays != 7 {
+		t.Errorf("purge log = %+v", entry)
+	}
+	if entry.OldestMessageAt == nil || entry.NewestMessageAt == nil || !entry.OldestMessageAt.Before(*entry.NewestMessageAt) {
+		t.Errorf("purge log range = %v - %v", entry.OldestMessageAt, entry.NewestMessageAt)
+	}
+	if !entry.NewestMessageAt.Before(entry.Cutoff) {
+		t.Error("purge log covers messages newer than the cutoff")
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"log"
+	"time"
+)
+
+type RetentionWorker struct {
+	retentionService RetentionService
+	interval         time.Duration
+	stop             chan struct{}
+}
+
+func NewRetentionWorker(retentionService RetentionService, interval time.Duration) *RetentionWorker {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &RetentionWorker{
+		retentionService: retentionService,
+		interval:         interval,
+		stop:             make(chan struct{}),
+	}
+}
+
+// Start runs a purge immediately and then on every interval until Stop is called
+func (w *RetentionWorker) Start() {
+	log.Printf("Retention worker started, purging every %v", w.interval)
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		w.run()
+		for {
+			select {
+			case <-ticker.C:
+				w.run()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (w *RetentionWorker) run() {
+	purged, err := w.retentionService.PurgeExpiredMessages()
+	if err != nil {
+		log.Printf("Retention purge failed after deleting %d messages: %v", purged, err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("Retention purge deleted %d chat messages", purged)
+	}
+}
+
+// Stop stops the retention worker
+func (w *RetentionWorker) Stop() {
+	log.Println("Stopping retention worker...")
+	close(w.stop)
+}
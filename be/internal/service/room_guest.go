@@ -0,0 +1,284 @@
+package service
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"yourapp/internal/model"
+	"yourapp/internal/util"
+
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+)
+
+const (
+	attemptGuestJoin = "guest_join"
+	guestSessionTTL  = 4 * time.Hour
+)
+
+var errGuestAccessUnavailable = errors.New("guest access is not available for this room")
+
+// GuestAccessRequest turns guest access on or off. Enabling creates an invite
+// link if the room has none yet; Passcode "" removes the passcode.
+type GuestAccessRequest struct {
+	Enabled      *bool   `json:"enabled" binding:"required"`
+	Passcode     *string `json:"passcode"`
+	RotateInvite bool    `json:"rotate_invite"`
+}
+
+type GuestAccessResponse struct {
+	Enabled     bool   `json:"enabled"`
+	HasPasscode bool   `json:"has_passcode"`
+	InviteURL   string `json:"invite_url,omitempty"` // only returned when a new invite is created
+}
+
+// GuestJoinRequest is sent by someone without an account. Either the invite
+// token from the invite link or the room passcode is required.
+type GuestJoinRequest struct {
+	DisplayName string `json:"display_name" binding:"required,max=64"`
+	Invite      string `json:"invite"`
+	Passcode    string `json:"passcode"`
+}
+
+type GuestJoinResponse struct {
+	Token      string          `json:"token"`
+	URL        string          `json:"url"`
+	Room       RoomResponse    `json:"room"`
+	Guest      model.RoomGuest `json:"guest"`
+	GuestToken string          `json:"guest_token"` // identifies the guest when leaving
+}
+
+// UpdateGuestAccess lets the room creator allow or block guests. Blocking also
+// disconnects the guests who are still in the call.
+func (s *roomService) UpdateGuestAccess(roomID, userID string, req GuestAccessRequest, client ClientInfo) (*GuestAccessResponse, error) {
+	room, err := s.roomRepo.FindByID(roomID)
+	if err != nil {
+		return nil, errors.New("room not found")
+	}
+	if room.CreatedByID != userID {
+		return nil, errors.New("unauthorized to change guest access for this room")
+	}
+
+	response := &GuestAccessResponse{Enabled: *req.Enabled}
+	if !*req.Enabled {
+		room.AllowGuests = false
+		room.GuestInviteHash = nil
+		room.GuestPasscodeHash = nil
+	} else {
+		room.AllowGuests = true
+		if room.GuestInviteHash == nil || req.RotateInvite {
+			invite, err := util.GenerateOpaqueToken()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate invite: %w", err)
+			}
+			inviteHash := util.HashToken(invite)
+			room.GuestInviteHash = &inviteHash
+			response.InviteURL = s.guestInviteURL(room.ID, invite)
+		}
+		if req.Passcode != nil {
+			passcode := strings.TrimSpace(*req.Passcode)
+			if passcode == "" {
+				room.GuestPasscodeHash = nil
+			} else {
+				if len(passcode) < 6 || len(passcode) > 64 {
+					return nil, errors.New("passcode must be 6-64 characters")
+				}
+				passcodeHash, err := util.HashPassword(passcode)
+				if err != nil {
+					return nil, fmt.Errorf("failed to hash passcode: %w", err)
+				}
+				room.GuestPasscodeHash = &passcodeHash
+			}
+		}
+	}
+	response.HasPasscode = room.GuestPasscodeHash != nil
+
+	if err := s.roomRepo.Update(room); err != nil {
+		return nil, errors.New("failed to update guest access")
+	}
+
+	if !room.AllowGuests {
+		if err := s.removeGuests(room.ID); err != nil {
+			log.Printf("Failed to remove guests from room %s: %v", room.ID, err)
+		}
+	}
+
+	s.recordRoomEvent(model.AuditRoomGuestAccess, userID, room.ID, client, map[string]interface{}{
+		"enabled":        room.AllowGuests,
+		"passcode":       response.HasPasscode,
+		"invite_created": response.InviteURL != "",
+	})
+	return response, nil
+}
+
+// JoinRoomAsGuest admits someone without an account who presents the room's
+// invite token or passcode. The guest gets a LiveKit token that can only
+// publish camera and microphone, and an identity that expires after a few hours.
+func (s *roomService) JoinRoomAsGuest(roomID string, req GuestJoinRequest, client ClientInfo) (*GuestJoinResponse, error) {
+	room, err := s.roomRepo.FindByIDWithParticipants(roomID)
+	if err != nil || !room.AllowGuests {
+		return nil, errGuestAccessUnavailable
+	}
+
+	// Wrong passcodes lock out the guest's IP for this room (and, after more, for
+	// every room) but never the room itself, so nobody can keep its guests out
+	limiterKey := room.ID + ":" + client.IPAddress
+	if err := s.limiter.check(attemptGuestJoin, limiterKey, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	via := ""
+	if req.Invite != "" && room.GuestInviteHash != nil &&
+		hmac.Equal([]byte(util.HashToken(req.Invite)), []byte(*room.GuestInviteHash)) {
+		via = "invite"
+	} else if req.Passcode != "" && room.GuestPasscodeHash != nil &&
+		util.CheckPasswordHash(strings.TrimSpace(req.Passcode), *room.GuestPasscodeHash) {
+		via = "passcode"
+	}
+	if via == "" {
+		s.limiter.fail(attemptGuestJoin, limiterKey, client.IPAddress)
+		return nil, errors.New("invalid invite or passcode")
+	}
+
+	if !room.IsActive {
+		return nil, errors.New("room is not active")
+	}
+
+	if room.MaxParticipants != nil {
+		count, _ := s.roomRepo.GetParticipantCount(roomID)
+		if count >= int64(*room.MaxParticipants) {
+			return nil, errors.New("room is full")
+		}
+	}
+
+	displayName := strings.TrimSpace(req.DisplayName)
+	if displayName == "" {
+		return nil, errors.New("display name is required")
+	}
+
+	guestToken, err := util.GenerateOpaqueToken()
+	if err != nil {
+		return nil, errors.New("failed to join room")
+	}
+	guest := &model.RoomGuest{
+		RoomID:      room.ID,
+		DisplayName: displayName,
+		TokenHash:   util.HashToken(guestToken),
+		IPAddress:   client.IPAddress,
+		ExpiresAt:   time.Now().Add(guestSessionTTL),
+		IsActive:    true,
+	}
+	if err := s.roomRepo.CreateGuest(guest); err != nil {
+		return nil, errors.New("failed to join room")
+	}
+
+	// Guests may talk and show video but not share their screen, send data
+	// messages or change how they appear to others
+	grant := &auth.VideoGrant{
+		RoomJoin: true,
+		Room:     room.ID,
+	}
+	grant.SetCanSubscribe(true)
+	grant.SetCanPublishSources([]livekit.TrackSource{livekit.TrackSource_CAMERA, livekit.TrackSource_MICROPHONE})
+	grant.SetCanPublishData(false)
+	grant.SetCanUpdateOwnMetadata(false)
+
+	at := auth.NewAccessToken(s.cfg.LiveKitAPIKey, s.cfg.LiveKitAPISecret)
+	at.AddGrant(grant).
+		SetIdentity(guest.Identity()).
+		SetName(displayName).
+		SetMetadata(`{"guest":true}`).
+		SetValidFor(guestSessionTTL)
+
+	token, err := at.ToJWT()
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	s.recordRoomEvent(model.AuditRoomGuestJoined, "", room.ID, client, map[string]interface{}{
+		"guest_id":     guest.ID,
+		"display_name": displayName,
+		"via":          via,
+	})
+
+	participantCount, _ := s.roomRepo.GetParticipantCount(room.ID)
+	roomResponse := s.roomToResponse(room)
+	roomResponse.ParticipantCount = participantCount
+
+	return &GuestJoinResponse{
+		Token:      token,
+		URL:        s.cfg.LiveKitURL,
+		Room:       *roomResponse,
+		Guest:      *guest,
+		GuestToken: guestToken,
+	}, nil
+}
+
+// LeaveRoomAsGuest ends a guest's visit, identified by the guest token from joining
+func (s *roomService) LeaveRoomAsGuest(roomID, guestToken string, client ClientInfo) error {
+	guest, err := s.roomRepo.FindGuestByTokenHash(util.HashToken(guestToken))
+	if err != nil || guest.RoomID != roomID {
+		return errors.New("guest not found")
+	}
+
+	if err := s.roomRepo.RemoveGuest(guest.ID); err != nil {
+		return errors.New("failed to leave room")
+	}
+	s.recordRoomEvent(model.AuditRoomLeft, "", roomID, client, map[string]interface{}{"guest_id": guest.ID})
+
+	s.deleteRoomIfEmpty(roomID, "", client)
+	return nil
+}
+
+// kickGuest disconnects a guest still in the room
+func (s *roomService) kickGuest(roomID, guestID string, actor Actor, client ClientInfo) error {
+	guest, err := s.roomRepo.FindGuest(roomID, guestID)
+	if err != nil || !guest.IsActive || !guest.ExpiresAt.After(time.Now()) {
+		return errors.New("user is not in this room")
+	}
+
+	if err := s.roomRepo.RemoveGuest(guest.ID); err != nil {
+		return errors.New("failed to kick participant")
+	}
+	if err := s.removeLiveKitParticipant(roomID, guest.Identity()); err != nil {
+		log.Printf("Failed to disconnect guest %s from LiveKit room %s: %v", guest.ID, roomID, err)
+	}
+
+	s.recordRoomEvent(model.AuditParticipantKicked, actor.UserID, roomID, client, map[string]interface{}{
+		"guest_id":     guest.ID,
+		"display_name": guest.DisplayName,
+	})
+	return nil
+}
+
+// removeGuests disconnects every guest still in the room
+func (s *roomService) removeGuests(roomID string) error {
+	guests, err := s.roomRepo.FindActiveGuests(roomID)
+	if err != nil {
+		return err
+	}
+	if err := s.roomRepo.RemoveGuests(roomID); err != nil {
+		return err
+	}
+
+	for _, guest := range guests {
+		if err := s.removeLiveKitParticipant(roomID, guest.Identity()); err != nil {
+			log.Printf("Failed to disconnect guest %s from LiveKit room %s: %v", guest.ID, roomID, err)
+		}
+	}
+	return nil
+}
+
+// guestInviteURL returns the frontend page guests open to join the room
+func (s *roomService) guestInviteURL(roomID, invite string) string {
+	baseURL := ""
+	if s.cfg != nil {
+		baseURL = strings.TrimSuffix(s.cfg.ClientURL, "/")
+	}
+	return fmt.Sprintf("%s/rooms/%s/guest?invite=%s", baseURL, roomID, url.QueryEscape(invite))
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeGuestRoomRepo serves the rooms and guests JoinRoomAsGuest works with
+type fakeGuestRoomRepo struct {
+	repository.RoomRepository
+	rooms  map[string]*model.Room
+	guests []model.RoomGuest
+}
+
+func (r *fakeGuestRoomRepo) FindByIDWithParticipants(id string) (*model.Room, error) {
+	room, ok := r.rooms[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *room
+	return &found, nil
+}
+
+func (r *fakeGuestRoomRepo) GetParticipantCount(roomID string) (int64, error) {
+	var count int64
+	for _, guest := range r.guests {
+		if guest.RoomID == roomID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeGuestRoomRepo) CreateGuest(guest *model.RoomGuest) error {
+	guest.ID = uuid.NewString()
+	r.guests = append(r.guests, *guest)
+	return nil
+}
+
+// newGuestRoom returns a room open to guests with the invite token and passcode "1234"
+func newGuestRoom(id, invite string) *model.Room {
+	inviteHash := util.HashToken(invite)
+	passcodeHash, err := util.HashPassword("1234")
+	if err != nil {
+		panic(err)
+	}
+	return &model.Room{
+		ID:                id,
+		Name:              "Standup",
+		IsActive:          true,
+		AllowGuests:       true,
+		GuestInviteHash:   &inviteHash,
+		GuestPasscodeHash: &passcodeHash,
+	}
+}
+
+func newTestGuestRooms(rooms ...*model.Room) (*roomService, *fakeGuestRoomRepo) {
+	repo := &fakeGuestRoomRepo{rooms: make(map[string]*model.Room)}
+	for _, room := range rooms {
+		repo.rooms[room.ID] = room
+	}
+	return &roomService{
+		roomRepo: repo,
+		audit:    &fakeAudit{},
+		cfg:      &config.Config{LiveKitAPIKey: "key", LiveKitAPISecret: "livekit-test-secret-of-32-bytes!"},
+		limiter:  newAttemptLimiter(nil),
+	}, repo
+}
+
+func TestJoinRoomAsGuest(t *testing.T) {
+	closed := newGuestRoom("closed", "closed-invite")
+	closed.AllowGuests = false
+	rooms, repo := newTestGuestRooms(newGuestRoom("room", "invite"), closed)
+	client := ClientInfo{IPAddress: "203.0.113.1"}
+
+	if _, err := rooms.JoinRoomAsGuest("closed", GuestJoinRequest{DisplayName: "Guest", Invite: "closed-invite"}, client); !errors.Is(err, errGuestAccessUnavailable) {
+		t.Errorf("room without guest access: error %v", err)
+	}
+	if _, err := rooms.JoinRoomAsGuest("room", GuestJoinRequest{DisplayName: "Guest", Passcode: "0000"}, client); err == nil {
+		t.Error("wrong passcode was accepted")
+	}
+	if _, err := rooms.JoinRoomAsGuest("room", GuestJoinRequest{DisplayName: "Guest", Invite: "closed-invite"}, client); err == nil {
+		t.Error("another room's invite was accepted")
+	}
+
+	for _, req := range []GuestJoinRequest{
+		{DisplayName: "Invited", Invite: "invite"},
+		{DisplayName: "With passcode", Passcode: " 1234 "},
+	} {
+		resp, err := rooms.JoinRoomAsGuest("room", req, client)
+		if err != nil {
+			t.Fatalf("%s: %v", req.DisplayName, err)
+		}
+		if resp.Token == "" || resp.GuestToken == "" || resp.Guest.DisplayName != req.DisplayName {
+			t.Errorf("%s: response = %+v", req.DisplayName, resp)
+		}
+	}
+	if len(repo.guests) != 2 || repo.guests[0].TokenHash == "" || repo.guests[0].IPAddress != client.IPAddress {
+		t.Errorf("guests = %+v", repo.guests)
+	}
+}
+
+func TestGuestJoinLockoutIsPerRoomAndIP(t *testing.T) {
+	rooms, _ := newTestGuestRooms(newGuestRoom("room", "invite"), newGuestRoom("other", "other-invite"))
+	attacker := ClientInfo{IPAddress: "198.51.100.7"}
+
+	for i := 0; i < defaultMaxAttempts; i++ {
+		rooms.JoinRoomAsGuest("room", GuestJoinRequest{DisplayName: "x", Passcode: "0000"}, attacker)
+	}
+	var tooMany *TooManyAttemptsError
+	if _, err := rooms.JoinRoomAsGuest("room", GuestJoinRequest{DisplayName: "x", Invite: "invite"}, attacker); !errors.As(err, &tooMany) {
+		t.Errorf("guessing IP after %d failures: error %v, want a lockout", defaultMaxAttempts, err)
+	}
+
+	// The guessing locks out only its own IP for this room
+	if _, err := rooms.JoinRoomAsGuest("room", GuestJoinRequest{DisplayName: "Guest", Invite: "invite"}, ClientInfo{IPAddress: "203.0.113.1"}); err != nil {
+		t.Errorf("guest from another IP was locked out: %v", err)
+	}
+	if _, err := rooms.JoinRoomAsGuest("other", GuestJoinRequest{DisplayName: "x", Invite: "other-invite"}, attacker); err != nil {
+		t.Errorf("guessing IP was locked out of another room: %v", err)
+	}
+}
@@ -1,37 +1,64 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
 	"time"
 	"yourapp/internal/config"
 	"yourapp/internal/model"
 	"yourapp/internal/repository"
 
 	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	"github.com/twitchtv/twirp"
 )
 
 type RoomService interface {
 	CreateRoom(req CreateRoomRequest) (*RoomResponse, error)
-	CreateRoomWithUser(req CreateRoomRequest, userID string) (*RoomResponse, error)
-	GetRoomByID(roomID string) (*RoomResponse, error)
+	CreateRoomWithUser(req CreateRoomRequest, userID string, client ClientInfo) (*RoomResponse, error)
+	GetRoomByID(roomID, userID string) (*RoomResponse, error)
 	GetRoomsByUser(userID string) ([]RoomResponse, error)
-	GetAllRooms() ([]RoomResponse, error)
-	JoinRoom(roomID, userID string) (*JoinRoomResponse, error)
-	LeaveRoom(roomID, userID string) error
-	DeleteRoom(roomID, userID string) error
+	GetVisibleRooms(userID string, req ListRoomsRequest) ([]RoomResponse, error)
+	JoinRoom(roomID, userID string, client ClientInfo) (*JoinRoomResponse, error)
+	LeaveRoom(roomID, userID string, client ClientInfo) error
+	DeleteRoom(roomID, userID string, client ClientInfo) error
+	KickParticipant(roomID, targetUserID string, actor Actor, client ClientInfo) error
+	GetParticipants(roomID string) ([]repository.RoomParticipantRecord, error)
+	CloseRoom(roomID, actorID string, client ClientInfo) error
+	DisconnectUser(userID, reason string) error
+	UpdateGuestAccess(roomID, userID string, req GuestAccessRequest, client ClientInfo) (*GuestAccessResponse, error)
+	JoinRoomAsGuest(roomID string, req GuestJoinRequest, client ClientInfo) (*GuestJoinResponse, error)
+	LeaveRoomAsGuest(roomID, guestToken string, client ClientInfo) error
+}
+
+// Actor is the signed-in user performing an action, with their role
+type Actor struct {
+	UserID string
+	Role   string
 }
 
 type roomService struct {
 	roomRepo repository.RoomRepository
 	userRepo repository.UserRepository
+	orgRepo  repository.OrganizationRepository
+	audit    AuditService
 	cfg      *config.Config
+	limiter  *attemptLimiter
 }
 
-func NewRoomService(roomRepo repository.RoomRepository, userRepo repository.UserRepository, cfg *config.Config) RoomService {
+func NewRoomService(roomRepo repository.RoomRepository, userRepo repository.UserRepository, orgRepo repository.OrganizationRepository, audit AuditService, cfg *config.Config) RoomService {
 	return &roomService{
 		roomRepo: roomRepo,
 		userRepo: userRepo,
+		orgRepo:  orgRepo,
+		audit:    audit,
 		cfg:      cfg,
+		limiter:  newAttemptLimiter(cfg),
 	}
 }
 
@@ -39,6 +66,14 @@ type CreateRoomRequest struct {
 	Name            string  `json:"name" binding:"required"`
 	Description     *string `json:"description"`
 	MaxParticipants *int    `json:"max_participants"`
+	OrganizationID  *string `json:"organization_id"` // nil creates a personal room
+}
+
+// ListRoomsRequest filters the room list. Without OrganizationID it covers the
+// caller's personal rooms and the rooms of every organization they belong to.
+type ListRoomsRequest struct {
+	Query          string `form:"q"`
+	OrganizationID string `form:"org_id"`
 }
 
 type RoomResponse struct {
@@ -47,7 +82,9 @@ type RoomResponse struct {
 	Description      *string   `json:"description,omitempty"`
 	CreatedByID      string    `json:"created_by_id"`
 	CreatedByName    string    `json:"created_by_name"`
+	OrganizationID   *string   `json:"organization_id,omitempty"`
 	IsActive         bool      `json:"is_active"`
+	AllowGuests      bool      `json:"allow_guests"`
 	MaxParticipants  *int      `json:"max_participants,omitempty"`
 	ParticipantCount int64     `json:"participant_count"`
 	CreatedAt        time.Time `json:"created_at"`
@@ -63,7 +100,7 @@ func (s *roomService) CreateRoom(req CreateRoomRequest) (*RoomResponse, error) {
 	return nil, errors.New("use CreateRoomWithUser instead")
 }
 
-func (s *roomService) CreateRoomWithUser(req CreateRoomRequest, userID string) (*RoomResponse, error) {
+func (s *roomService) CreateRoomWithUser(req CreateRoomRequest, userID string, client ClientInfo) (*RoomResponse, error) {
 	room := &model.Room{
 		Name:            req.Name,
 		Description:     req.Description,
@@ -72,16 +109,29 @@ func (s *roomService) CreateRoomWithUser(req CreateRoomRequest, userID string) (
 		IsActive:        true,
 	}
 
+	if req.OrganizationID != nil && *req.OrganizationID != "" {
+		if _, err := s.orgRepo.FindMember(*req.OrganizationID, userID); err != nil {
+			return nil, errors.New("organization not found")
+		}
+		room.OrganizationID = req.OrganizationID
+	}
+
 	if err := s.roomRepo.Create(room); err != nil {
 		return nil, errors.New("failed to create room")
 	}
 
+	metadata := map[string]interface{}{"name": room.Name}
+	if room.OrganizationID != nil {
+		metadata["organization_id"] = *room.OrganizationID
+	}
+	s.recordRoomEvent(model.AuditRoomCreated, userID, room.ID, client, metadata)
+
 	return s.roomToResponse(room), nil
 }
 
-func (s *roomService) GetRoomByID(roomID string) (*RoomResponse, error) {
+func (s *roomService) GetRoomByID(roomID, userID string) (*RoomResponse, error) {
 	room, err := s.roomRepo.FindByIDWithParticipants(roomID)
-	if err != nil {
+	if err != nil || !canAccessRoom(s.orgRepo, room, userID) {
 		return nil, errors.New("room not found")
 	}
 
@@ -108,8 +158,24 @@ func (s *roomService) GetRoomsByUser(userID string) ([]RoomResponse, error) {
 	return responses, nil
 }
 
-func (s *roomService) GetAllRooms() ([]RoomResponse, error) {
-	rooms, err := s.roomRepo.FindAll()
+// GetVisibleRooms lists the rooms the user can see: their personal rooms and
+// the rooms of their organizations, or only one organization's rooms if requested
+func (s *roomService) GetVisibleRooms(userID string, req ListRoomsRequest) ([]RoomResponse, error) {
+	orgIDs, err := s.orgRepo.FindOrganizationIDs(userID)
+	if err != nil {
+		return nil, errors.New("failed to fetch rooms")
+	}
+
+	ownerID := userID
+	if req.OrganizationID != "" {
+		if !slices.Contains(orgIDs, req.OrganizationID) {
+			return nil, errors.New("organization not found")
+		}
+		ownerID = ""
+		orgIDs = []string{req.OrganizationID}
+	}
+
+	rooms, err := s.roomRepo.FindVisible(ownerID, orgIDs, strings.TrimSpace(req.Query))
 	if err != nil {
 		return nil, errors.New("failed to fetch rooms")
 	}
@@ -124,10 +190,10 @@ func (s *roomService) GetAllRooms() ([]RoomResponse, error) {
 	return responses, nil
 }
 
-func (s *roomService) JoinRoom(roomID, userID string) (*JoinRoomResponse, error) {
+func (s *roomService) JoinRoom(roomID, userID string, client ClientInfo) (*JoinRoomResponse, error) {
 	// Verify room exists
 	room, err := s.roomRepo.FindByID(roomID)
-	if err != nil {
+	if err != nil || !canAccessRoom(s.orgRepo, room, userID) {
 		return nil, errors.New("room not found")
 	}
 
@@ -161,14 +227,8 @@ func (s *roomService) JoinRoom(roomID, userID string) (*JoinRoomResponse, error)
 		Room:     roomID,
 	}
 
-	// Use user email or ID as identity
-	identity := user.Email
-	if user.Username != nil && *user.Username != "" {
-		identity = *user.Username
-	}
-
 	at.AddGrant(grant).
-		SetIdentity(identity).
+		SetIdentity(liveKitIdentity(user)).
 		SetValidFor(time.Hour * 24)
 
 	token, err := at.ToJWT()
@@ -176,8 +236,10 @@ func (s *roomService) JoinRoom(roomID, userID string) (*JoinRoomResponse, error)
 		return nil, errors.New("failed to generate token")
 	}
 
+	s.recordRoomEvent(model.AuditRoomJoined, userID, roomID, client, nil)
+
 	// Get room response
-	roomResponse, _ := s.GetRoomByID(roomID)
+	roomResponse, _ := s.GetRoomByID(roomID, userID)
 
 	return &JoinRoomResponse{
 		Token: token,
@@ -186,7 +248,7 @@ func (s *roomService) JoinRoom(roomID, userID string) (*JoinRoomResponse, error)
 	}, nil
 }
 
-func (s *roomService) LeaveRoom(roomID, userID string) error {
+func (s *roomService) LeaveRoom(roomID, userID string, client ClientInfo) error {
 	// Verify room exists
 	_, err := s.roomRepo.FindByID(roomID)
 	if err != nil {
@@ -197,12 +259,19 @@ func (s *roomService) LeaveRoom(roomID, userID string) error {
 	if err := s.roomRepo.RemoveParticipant(roomID, userID); err != nil {
 		return errors.New("failed to leave room")
 	}
+	s.recordRoomEvent(model.AuditRoomLeft, userID, roomID, client, nil)
+
+	s.deleteRoomIfEmpty(roomID, userID, client)
+	return nil
+}
 
+// deleteRoomIfEmpty auto-deletes a room once the last user or guest has left
+func (s *roomService) deleteRoomIfEmpty(roomID, userID string, client ClientInfo) {
 	// Check if room has no active participants left, then auto-delete
 	count, err := s.roomRepo.GetParticipantCount(roomID)
 	if err != nil {
 		// Continue even if count check fails
-		return nil
+		return
 	}
 
 	// Auto-delete room if no participants left
@@ -210,14 +279,13 @@ func (s *roomService) LeaveRoom(roomID, userID string) error {
 		if err := s.roomRepo.Delete(roomID); err != nil {
 			// Log error but don't fail the leave operation
 			// The room will be cleaned up later
-			return nil
+			return
 		}
+		s.recordRoomEvent(model.AuditRoomDeleted, userID, roomID, client, map[string]interface{}{"reason": "last_participant_left"})
 	}
-
-	return nil
 }
 
-func (s *roomService) DeleteRoom(roomID, userID string) error {
+func (s *roomService) DeleteRoom(roomID, userID string, client ClientInfo) error {
 	room, err := s.roomRepo.FindByID(roomID)
 	if err != nil {
 		return errors.New("room not found")
@@ -228,7 +296,190 @@ func (s *roomService) DeleteRoom(roomID, userID string) error {
 		return errors.New("unauthorized to delete this room")
 	}
 
-	return s.roomRepo.Delete(roomID)
+	if err := s.roomRepo.Delete(roomID); err != nil {
+		return err
+	}
+
+	s.recordRoomEvent(model.AuditRoomDeleted, userID, roomID, client, map[string]interface{}{"name": room.Name})
+	return nil
+}
+
+// KickParticipant removes a user or guest from a room and disconnects them from
+// the call. The room creator, moderators and admins may kick.
+func (s *roomService) KickParticipant(roomID, targetUserID string, actor Actor, client ClientInfo) error {
+	room, err := s.roomRepo.FindByID(roomID)
+	if err != nil {
+		return errors.New("room not found")
+	}
+
+	if room.CreatedByID != actor.UserID && !model.RoleAllowed(actor.Role, model.RoleModerator) {
+		return errors.New("unauthorized to kick participants from this room")
+	}
+	if targetUserID == actor.UserID {
+		return errors.New("you cannot kick yourself, leave the room instead")
+	}
+
+	active, err := s.roomRepo.IsParticipant(roomID, targetUserID)
+	if err != nil || !active {
+		return s.kickGuest(roomID, targetUserID, actor, client)
+	}
+
+	if err := s.roomRepo.RemoveParticipant(roomID, targetUserID); err != nil {
+		return errors.New("failed to kick participant")
+	}
+
+	if target, err := s.userRepo.FindByID(targetUserID); err == nil {
+		if err := s.removeLiveKitParticipant(roomID, liveKitIdentity(target)); err != nil {
+			log.Printf("Failed to disconnect %s from LiveKit room %s: %v", targetUserID, roomID, err)
+		}
+	}
+
+	s.audit.Record(AuditEntry{
+		ActorID:    actor.UserID,
+		Action:     model.AuditParticipantKicked,
+		TargetType: model.AuditTargetUser,
+		TargetID:   targetUserID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"room_id": roomID},
+	})
+	return nil
+}
+
+// GetParticipants lists everyone who has joined a room, for moderators
+func (s *roomService) GetParticipants(roomID string) ([]repository.RoomParticipantRecord, error) {
+	if _, err := s.roomRepo.FindByID(roomID); err != nil {
+		return nil, errors.New("room not found")
+	}
+
+	participants, err := s.roomRepo.FindParticipants(roomID)
+	if err != nil {
+		return nil, errors.New("failed to fetch participants")
+	}
+	return participants, nil
+}
+
+// CloseRoom force-closes a room: nobody can join it anymore and everyone
+// still in the LiveKit call is disconnected
+func (s *roomService) CloseRoom(roomID, actorID string, client ClientInfo) error {
+	room, err := s.roomRepo.FindByID(roomID)
+	if err != nil {
+		return errors.New("room not found")
+	}
+
+	if err := s.roomRepo.Close(room.ID); err != nil {
+		return errors.New("failed to close room")
+	}
+
+	if err := s.deleteLiveKitRoom(room.ID); err != nil {
+		// The room is closed for us either way; LiveKit ends it once it is empty
+		log.Printf("Failed to end LiveKit room %s: %v", room.ID, err)
+	}
+
+	s.audit.Record(AuditEntry{
+		ActorID:    actorID,
+		Action:     model.AuditRoomClosed,
+		TargetType: model.AuditTargetRoom,
+		TargetID:   room.ID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"name": room.Name},
+	})
+	return nil
+}
+
+// DisconnectUser takes the user out of every room they are in, e.g. when the account is deactivated
+func (s *roomService) DisconnectUser(userID, reason string) error {
+	roomIDs, err := s.roomRepo.FindJoinedRoomIDs(userID)
+	if err != nil {
+		return fmt.Errorf("failed to find rooms: %w", err)
+	}
+	if len(roomIDs) == 0 {
+		return nil
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	for _, roomID := range roomIDs {
+		if err := s.roomRepo.RemoveParticipant(roomID, userID); err != nil {
+			return fmt.Errorf("failed to remove participant: %w", err)
+		}
+		if err := s.removeLiveKitParticipant(roomID, liveKitIdentity(user)); err != nil {
+			log.Printf("Failed to disconnect %s from LiveKit room %s: %v", userID, roomID, err)
+		}
+		s.recordRoomEvent(model.AuditRoomLeft, userID, roomID, ClientInfo{}, map[string]interface{}{"reason": reason})
+	}
+	return nil
+}
+
+// deleteLiveKitRoom ends the call on the LiveKit server, disconnecting all participants
+func (s *roomService) deleteLiveKitRoom(roomID string) error {
+	return s.callLiveKit(roomID, func(ctx context.Context, client livekit.RoomService) error {
+		_, err := client.DeleteRoom(ctx, &livekit.DeleteRoomRequest{Room: roomID})
+		return err
+	})
+}
+
+// removeLiveKitParticipant disconnects one participant from the call
+func (s *roomService) removeLiveKitParticipant(roomID, identity string) error {
+	return s.callLiveKit(roomID, func(ctx context.Context, client livekit.RoomService) error {
+		_, err := client.RemoveParticipant(ctx, &livekit.RoomParticipantIdentity{Room: roomID, Identity: identity})
+		return err
+	})
+}
+
+// callLiveKit calls the LiveKit server API with an admin token for the room
+func (s *roomService) callLiveKit(roomID string, call func(ctx context.Context, client livekit.RoomService) error) error {
+	if s.cfg == nil || s.cfg.LiveKitAPIURL == "" {
+		return nil
+	}
+
+	at := auth.NewAccessToken(s.cfg.LiveKitAPIKey, s.cfg.LiveKitAPISecret)
+	at.AddGrant(&auth.VideoGrant{RoomCreate: true, RoomAdmin: true, Room: roomID}).
+		SetValidFor(time.Minute)
+	token, err := at.ToJWT()
+	if err != nil {
+		return err
+	}
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer "+token)
+	ctx, err := twirp.WithHTTPRequestHeaders(context.Background(), header)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	client := livekit.NewRoomServiceProtobufClient(strings.TrimSuffix(s.cfg.LiveKitAPIURL, "/"), http.DefaultClient)
+	err = call(ctx, client)
+
+	// The room or participant is not in a call (anymore)
+	var twirpErr twirp.Error
+	if errors.As(err, &twirpErr) && twirpErr.Code() == twirp.NotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *roomService) recordRoomEvent(action, userID, roomID string, client ClientInfo, metadata map[string]interface{}) {
+	s.audit.Record(AuditEntry{
+		ActorID:    userID,
+		Action:     action,
+		TargetType: model.AuditTargetRoom,
+		TargetID:   roomID,
+		Client:     client,
+		Metadata:   metadata,
+	})
+}
+
+// liveKitIdentity is the participant identity a user joins calls with
+func liveKitIdentity(user *model.User) string {
+	if user.Username != nil && *user.Username != "" {
+		return *user.Username
+	}
+	return user.Email
 }
 
 func (s *roomService) roomToResponse(room *model.Room) *RoomResponse {
@@ -238,7 +489,9 @@ func (s *roomService) roomToResponse(room *model.Room) *RoomResponse {
 		Description:     room.Description,
 		CreatedByID:     room.CreatedByID,
 		CreatedByName:   room.CreatedBy.FullName,
+		OrganizationID:  room.OrganizationID,
 		IsActive:        room.IsActive,
+		AllowGuests:     room.AllowGuests,
 		MaxParticipants: room.MaxParticipants,
 		CreatedAt:       room.CreatedAt,
 	}
@@ -0,0 +1,1003 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+	"yourapp/internal/repository"
+	"yourapp/internal/util"
+)
+
+// SCIM 2.0 schema URNs (RFC 7643, RFC 7644)
+const (
+	SCIMSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+var (
+	scimFilterPattern       = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9._]*)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+	scimMemberFilterPattern = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+)
+
+// SCIMError is a SCIM protocol error together with the HTTP status it is sent with
+type SCIMError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func scimError(status int, scimType, detail string) error {
+	return &SCIMError{Status: status, ScimType: scimType, Detail: detail}
+}
+
+var (
+	errOutsideOrgDomain = scimError(http.StatusBadRequest, "invalidValue", "userName must be an email address at the organization's verified domain")
+	errOwnerRole        = scimError(http.StatusForbidden, "mutability", "the owner role cannot be changed through SCIM")
+)
+
+// SCIMService provisions organization members from an identity provider.
+// Users are the organization's members, keyed by email (userName); groups are
+// the organization roles.
+type SCIMService interface {
+	Authenticate(token string) (*model.Organization, error)
+	ListUsers(org *model.Organization, req SCIMListRequest) (*SCIMListResponse, error)
+	GetUser(org *model.Organization, userID string) (*SCIMUser, error)
+	CreateUser(org *model.Organization, in SCIMUser, client ClientInfo) (*SCIMUser, error)
+	ReplaceUser(org *model.Organization, userID string, in SCIMUser, client ClientInfo) (*SCIMUser, error)
+	PatchUser(org *model.Organization, userID string, req SCIMPatchRequest, client ClientInfo) (*SCIMUser, error)
+	DeleteUser(org *model.Organization, userID string, client ClientInfo) error
+	ListGroups(org *model.Organization, req SCIMListRequest) (*SCIMListResponse, error)
+	GetGroup(org *model.Organization, groupID string) (*SCIMGroup, error)
+	CreateGroup(org *model.Organization, in SCIMGroup, client ClientInfo) (*SCIMGroup, error)
+	PatchGroup(org *model.Organization, groupID string, req SCIMPatchRequest, client ClientInfo) (*SCIMGroup, error)
+}
+
+type SCIMListRequest struct {
+	Filter     string `form:"filter"`
+	StartIndex int    `form:"startIndex"`
+	Count      *int   `form:"count"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type SCIMUser struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"`
+	Name        *SCIMName       `json:"name,omitempty"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Emails      []SCIMEmail     `json:"emails,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+	Groups      []SCIMMemberRef `json:"groups,omitempty"`
+	Meta        *SCIMMeta       `json:"meta,omitempty"`
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMMemberRef points from a group to a user or from a user to a group
+type SCIMMemberRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type SCIMGroup struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	DisplayName string          `json:"displayName"`
+	Members     []SCIMMemberRef `json:"members,omitempty"`
+	Meta        *SCIMMeta       `json:"meta,omitempty"`
+}
+
+type SCIMMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type scimService struct {
+	orgRepo     repository.OrganizationRepository
+	userRepo    repository.UserRepository
+	authService AuthService
+	roomService RoomService
+	audit       AuditService
+	config      *config.Config
+}
+
+func NewSCIMService(orgRepo repository.OrganizationRepository, userRepo repository.UserRepository, authService AuthService, roomService RoomService, audit AuditService, cfg *config.Config) SCIMService {
+	return &scimService{
+		orgRepo:     orgRepo,
+		userRepo:    userRepo,
+		authService: authService,
+		roomService: roomService,
+		audit:       audit,
+		config:      cfg,
+	}
+}
+
+// Authenticate returns the organization a SCIM bearer token belongs to
+func (s *scimService) Authenticate(token string) (*model.Organization, error) {
+	if !strings.HasPrefix(token, model.SCIMTokenPrefix) {
+		return nil, scimError(http.StatusUnauthorized, "", "invalid SCIM token")
+	}
+	org, err := s.orgRepo.FindBySCIMTokenHash(util.HashToken(token))
+	if err != nil {
+		return nil, scimError(http.StatusUnauthorized, "", "invalid SCIM token")
+	}
+	return org, nil
+}
+
+// ListUsers lists the organization's members, optionally filtered by
+// userName, emails.value or externalId
+func (s *scimService) ListUsers(org *model.Organization, req SCIMListRequest) (*SCIMListResponse, error) {
+	filter := repository.MemberFilter{}
+	if req.Filter != "" {
+		attr, value, err := parseSCIMFilter(req.Filter)
+		if err != nil {
+			return nil, err
+		}
+		switch attr {
+		case "username", "emails.value", "emails":
+			filter.Email = value
+		case "externalid":
+			filter.ExternalID = value
+		default:
+			return nil, scimError(http.StatusBadRequest, "invalidFilter", "filtering is supported on userName and externalId only")
+		}
+	}
+
+	startIndex, count := scimPage(req)
+	filter.Offset = startIndex - 1
+	filter.Limit = count
+
+	members, total, err := s.orgRepo.SearchMembers(org.ID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	users := make([]SCIMUser, len(members))
+	for i := range members {
+		users[i] = *s.toSCIMUser(&members[i])
+	}
+
+	return &SCIMListResponse{
+		Schemas:      []string{SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(users),
+		Resources:    users,
+	}, nil
+}
+
+func (s *scimService) GetUser(org *model.Organization, userID string) (*SCIMUser, error) {
+	member, err := s.findMember(org, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(member), nil
+}
+
+// CreateUser provisions a new account and adds it to the organization. The
+// email has to be at the organization's DNS-verified domain; an existing
+// account is adopted only when that email is verified. SCIM never changes an
+// adopted account's email.
+func (s *scimService) CreateUser(org *model.Organization, in SCIMUser, client ClientInfo) (*SCIMUser, error) {
+	email, err := scimEmail(in.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if !orgDomainEmail(org, email) {
+		return nil, errOutsideOrgDomain
+	}
+
+	provisioned := false
+	user, err := s.userRepo.FindByEmail(email)
+	if err == nil {
+		if _, err := s.orgRepo.FindMember(org.ID, user.ID); err == nil {
+			return nil, scimError(http.StatusConflict, "uniqueness", "user already exists")
+		}
+		if !orgOwnsDomain(org, user) {
+			return nil, scimError(http.StatusConflict, "uniqueness", "an account with this email already exists outside the organization")
+		}
+	} else {
+		user = &model.User{
+			Email:      email,
+			FullName:   scimFullName(in, email),
+			UserType:   model.RoleMember,
+			IsActive:   true,
+			IsVerified: true,
+			LoginType:  model.LoginTypeSCIM,
+		}
+		if err := s.userRepo.Create(user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		provisioned = true
+	}
+
+	member := &model.OrganizationMember{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           model.OrgRoleMember,
+		Managed:        true,
+		Provisioned:    provisioned,
+	}
+	if in.ExternalID != "" {
+		member.ExternalID = &in.ExternalID
+	}
+	if _, err := s.orgRepo.AddMember(member); err != nil {
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+	member.User = *user
+
+	s.audit.Record(AuditEntry{
+		Action:     model.AuditSCIMUserProvisioned,
+		TargetType: model.AuditTargetUser,
+		TargetID:   user.ID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"organization_id": org.ID, "email": user.Email},
+	})
+
+	// Adopted accounts also take the name and status from the identity provider
+	if err := s.applyUser(org, member, in, client); err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(member), nil
+}
+
+// ReplaceUser overwrites the user's attributes with the provider's copy (PUT)
+func (s *scimService) ReplaceUser(org *model.Organization, userID string, in SCIMUser, client ClientInfo) (*SCIMUser, error) {
+	member, err := s.findManagedMember(org, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyUser(org, member, in, client); err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(member), nil
+}
+
+// PatchUser applies PATCH operations to the user's current representation
+func (s *scimService) PatchUser(org *model.Organization, userID string, req SCIMPatchRequest, client ClientInfo) (*SCIMUser, error) {
+	member, err := s.findManagedMember(org, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := s.toSCIMUser(member)
+	if err := patchSCIMUser(user, req.Operations); err != nil {
+		return nil, err
+	}
+
+	if err := s.applyUser(org, member, *user, client); err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(member), nil
+}
+
+// DeleteUser deprovisions the user: the account is deactivated, signed out,
+// taken out of its rooms and removed from the organization
+func (s *scimService) DeleteUser(org *model.Organization, userID string, client ClientInfo) error {
+	member, err := s.findManagedMember(org, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureOwnerRemains(org, member); err != nil {
+		return err
+	}
+
+	if err := s.setActive(org, member, false, client); err != nil {
+		return err
+	}
+	if err := s.orgRepo.RemoveMember(org.ID, member.UserID); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	s.audit.Record(AuditEntry{
+		Action:     model.AuditSCIMUserDeprovisioned,
+		TargetType: model.AuditTargetUser,
+		TargetID:   member.UserID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"organization_id": org.ID, "email": member.User.Email},
+	})
+	return nil
+}
+
+// ListGroups lists the organization roles as groups, optionally filtered by displayName
+func (s *scimService) ListGroups(org *model.Organization, req SCIMListRequest) (*SCIMListResponse, error) {
+	roles := model.OrgRoles
+	if req.Filter != "" {
+		attr, value, err := parseSCIMFilter(req.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if attr != "displayname" {
+			return nil, scimError(http.StatusBadRequest, "invalidFilter", "filtering is supported on displayName only")
+		}
+		roles = nil
+		if isOrgRole(strings.ToLower(value)) {
+			roles = []string{strings.ToLower(value)}
+		}
+	}
+
+	startIndex, count := scimPage(req)
+	groups := []SCIMGroup{}
+	for i := startIndex - 1; i < len(roles) && len(groups) < count; i++ {
+		group, err := s.toSCIMGroup(org, roles[i])
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+
+	return &SCIMListResponse{
+		Schemas:      []string{SCIMSchemaListResponse},
+		TotalResults: int64(len(roles)),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(groups),
+		Resources:    groups,
+	}, nil
+}
+
+func (s *scimService) GetGroup(org *model.Organization, groupID string) (*SCIMGroup, error) {
+	if !isOrgRole(groupID) {
+		return nil, scimError(http.StatusNotFound, "", "group not found")
+	}
+	return s.toSCIMGroup(org, groupID)
+}
+
+// CreateGroup maps a pushed group onto the organization role of the same
+// name and gives its members that role. Other group names are rejected.
+func (s *scimService) CreateGroup(org *model.Organization, in SCIMGroup, client ClientInfo) (*SCIMGroup, error) {
+	role := strings.ToLower(strings.TrimSpace(in.DisplayName))
+	if !isOrgRole(role) {
+		return nil, scimError(http.StatusBadRequest, "invalidValue",
+			fmt.Sprintf("displayName must be one of: %s", strings.Join(model.OrgRoles, ", ")))
+	}
+	if role == model.OrgRoleOwner && len(in.Members) > 0 {
+		return nil, errOwnerRole
+	}
+
+	for _, ref := range in.Members {
+		if err := s.setRole(org, ref.Value, role, client); err != nil {
+			return nil, err
+		}
+	}
+	return s.toSCIMGroup(org, role)
+}
+
+// PatchGroup adds members to a role group or takes them out of it. Members
+// taken out of a group go back to the plain member role.
+func (s *scimService) PatchGroup(org *model.Organization, groupID string, req SCIMPatchRequest, client ClientInfo) (*SCIMGroup, error) {
+	if !isOrgRole(groupID) {
+		return nil, scimError(http.StatusNotFound, "", "group not found")
+	}
+	if groupID == model.OrgRoleOwner {
+		return nil, errOwnerRole
+	}
+	role := groupID
+
+	for _, op := range req.Operations {
+		path := strings.TrimSpace(op.Path)
+		switch strings.ToLower(op.Op) {
+		case "add":
+			if !strings.EqualFold(path, "members") {
+				return nil, scimError(http.StatusBadRequest, "invalidPath", "only members can be added to a group")
+			}
+			refs, err := decodeSCIMMembers(op.Value)
+			if err != nil {
+				return nil, err
+			}
+			for _, ref := range refs {
+				if err := s.setRole(org, ref.Value, role, client); err != nil {
+					return nil, err
+				}
+			}
+
+		case "remove":
+			var userIDs []string
+			if match := scimMemberFilterPattern.FindStringSubmatch(path); match != nil {
+				userIDs = []string{match[1]}
+			} else if strings.EqualFold(path, "members") {
+				refs, err := decodeSCIMMembers(op.Value)
+				if err != nil {
+					return nil, err
+				}
+				if len(op.Value) == 0 {
+					if refs, err = s.roleMembers(org, role); err != nil {
+						return nil, err
+					}
+				}
+				for _, ref := range refs {
+					userIDs = append(userIDs, ref.Value)
+				}
+			} else {
+				return nil, scimError(http.StatusBadRequest, "invalidPath", "only members can be removed from a group")
+			}
+			for _, userID := range userIDs {
+				if err := s.leaveRole(org, userID, role, client); err != nil {
+					return nil, err
+				}
+			}
+
+		case "replace":
+			var refs []SCIMMemberRef
+			switch {
+			case strings.EqualFold(path, "members"):
+				decoded, err := decodeSCIMMembers(op.Value)
+				if err != nil {
+					return nil, err
+				}
+				refs = decoded
+			case path == "" || strings.EqualFold(path, "displayName"):
+				var group SCIMGroup
+				if path == "" {
+					if err := json.Unmarshal(op.Value, &group); err != nil {
+						return nil, scimError(http.StatusBadRequest, "invalidValue", "invalid group")
+					}
+				} else if err := json.Unmarshal(op.Value, &group.DisplayName); err != nil {
+					return nil, scimError(http.StatusBadRequest, "invalidValue", "invalid displayName")
+				}
+				if group.DisplayName != "" && !strings.EqualFold(group.DisplayName, role) {
+					return nil, scimError(http.StatusBadRequest, "mutability", "groups are organization roles and cannot be renamed")
+				}
+				if group.Members == nil {
+					continue
+				}
+				refs = group.Members
+			default:
+				return nil, scimError(http.StatusBadRequest, "invalidPath", "unsupported path "+path)
+			}
+			if err := s.replaceRoleMembers(org, role, refs, client); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, scimError(http.StatusBadRequest, "invalidSyntax", "unsupported operation "+op.Op)
+		}
+	}
+
+	return s.toSCIMGroup(org, role)
+}
+
+// applyUser stores the provider's view of the user: email, name, external id and status
+func (s *scimService) applyUser(org *model.Organization, member *model.OrganizationMember, in SCIMUser, client ClientInfo) error {
+	user := &member.User
+	changes := map[string]interface{}{}
+	fields := map[string]interface{}{}
+
+	email, err := scimEmail(in.UserName)
+	if err != nil {
+		return err
+	}
+	if email != strings.ToLower(user.Email) {
+		// Moving an adopted account to another address would hand it to whoever controls that address
+		if !member.Provisioned {
+			return scimError(http.StatusBadRequest, "mutability", "userName of an account not created through SCIM cannot be changed")
+		}
+		if !orgDomainEmail(org, email) {
+			return errOutsideOrgDomain
+		}
+		if existing, _ := s.userRepo.FindByEmail(email); existing != nil {
+			return scimError(http.StatusConflict, "uniqueness", "userName is already taken")
+		}
+		fields["email"] = email
+		fields["is_verified"] = true
+		changes["email"] = email
+	}
+
+	if hasSCIMName(in) {
+		if name := scimFullName(in, email); name != user.FullName {
+			fields["full_name"] = name
+			changes["full_name"] = name
+		}
+	}
+
+	if len(fields) > 0 {
+		if err := s.userRepo.UpdateFields(user.ID, fields); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if updated, err := s.userRepo.FindByID(user.ID); err == nil {
+			member.User = *updated
+		}
+	}
+
+	externalID := stringPtrOrNil(in.ExternalID)
+	if stringValue(externalID) != stringValue(member.ExternalID) {
+		member.ExternalID = externalID
+		if err := s.orgRepo.UpdateMember(member); err != nil {
+			return fmt.Errorf("failed to update member: %w", err)
+		}
+		changes["external_id"] = in.ExternalID
+	}
+
+	if len(changes) > 0 {
+		changes["organization_id"] = org.ID
+		s.audit.Record(AuditEntry{
+			Action:     model.AuditSCIMUserUpdated,
+			TargetType: model.AuditTargetUser,
+			TargetID:   user.ID,
+			Client:     client,
+			Metadata:   changes,
+		})
+	}
+
+	if in.Active != nil {
+		return s.setActive(org, member, *in.Active, client)
+	}
+	return nil
+}
+
+// setActive deactivates or reactivates the account. Deactivated users are
+// signed out and removed from every room they are in.
+func (s *scimService) setActive(org *model.Organization, member *model.OrganizationMember, active bool, client ClientInfo) error {
+	if member.User.IsActive == active {
+		return nil
+	}
+
+	user, err := s.authService.SetProvisionedUserActive(org.ID, member.UserID, active, client)
+	if errors.Is(err, errDeactivatedElsewhere) {
+		return scimError(http.StatusForbidden, "mutability", "the account was deactivated outside this identity provider and cannot be reactivated through SCIM")
+	}
+	if err != nil {
+		return err
+	}
+	member.User = *user
+
+	if !active {
+		if err := s.roomService.DisconnectUser(member.UserID, "account_deactivated"); err != nil {
+			log.Printf("Failed to remove deactivated user %s from rooms: %v", member.UserID, err)
+		}
+	}
+	return nil
+}
+
+// setRole gives a managed member role. Owners are only made and unmade in
+// the app, so SCIM neither grants the owner role nor changes an owner's role.
+func (s *scimService) setRole(org *model.Organization, userID, role string, client ClientInfo) error {
+	member, err := s.findMember(org, userID)
+	if err != nil {
+		return scimError(http.StatusBadRequest, "invalidValue", "user "+userID+" is not a member of the organization")
+	}
+	if member.Role == role {
+		return nil
+	}
+	if role == model.OrgRoleOwner || member.Role == model.OrgRoleOwner {
+		return errOwnerRole
+	}
+	if !s.isManaged(org, member) {
+		return scimError(http.StatusForbidden, "mutability", "user "+userID+" is not managed by this organization")
+	}
+
+	if err := s.orgRepo.UpdateMemberRole(org.ID, userID, role); err != nil {
+		return fmt.Errorf("failed to update member: %w", err)
+	}
+
+	s.audit.Record(AuditEntry{
+		Action:     model.AuditOrgRoleChanged,
+		TargetType: model.AuditTargetUser,
+		TargetID:   userID,
+		Client:     client,
+		Metadata:   map[string]interface{}{"organization_id": org.ID, "from": member.Role, "to": role, "via": "scim"},
+	})
+	return nil
+}
+
+// leaveRole takes the user out of a role group; everyone stays in the member
+// group. Members the organization does not manage keep their role.
+func (s *scimService) leaveRole(org *model.Organization, userID, role string, client ClientInfo) error {
+	if role == model.OrgRoleMember {
+		return nil
+	}
+	member, err := s.findMember(org, userID)
+	if err != nil || member.Role != role || !s.isManaged(org, member) {
+		return nil
+	}
+	return s.setRole(org, userID, model.OrgRoleMember, client)
+}
+
+// replaceRoleMembers makes refs the managed members of the role group
+func (s *scimService) replaceRoleMembers(org *model.Organization, role string, refs []SCIMMemberRef, client ClientInfo) error {
+	keep := map[string]bool{}
+	for _, ref := range refs {
+		if err := s.setRole(org, ref.Value, role, client); err != nil {
+			return err
+		}
+		keep[ref.Value] = true
+	}
+
+	current, err := s.roleMembers(org, role)
+	if err != nil {
+		return err
+	}
+	for _, ref := range current {
+		if !keep[ref.Value] {
+			if err := s.leaveRole(org, ref.Value, role, client); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ensureOwnerRemains refuses changes that would leave the organization without an owner
+func (s *scimService) ensureOwnerRemains(org *model.Organization, member *model.OrganizationMember) error {
+	if member.Role != model.OrgRoleOwner {
+		return nil
+	}
+	owners, err := s.orgRepo.CountOwners(org.ID)
+	if err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners <= 1 {
+		return scimError(http.StatusBadRequest, "mutability", "the organization's last owner cannot be removed")
+	}
+	return nil
+}
+
+func (s *scimService) findMember(org *model.Organization, userID string) (*model.OrganizationMember, error) {
+	member, err := s.orgRepo.FindMember(org.ID, userID)
+	if err != nil {
+		return nil, scimError(http.StatusNotFound, "", "user not found")
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, scimError(http.StatusNotFound, "", "user not found")
+	}
+	member.User = *user
+	return member, nil
+}
+
+// findManagedMember returns a member the identity provider may change: an
+// account it created, or one it adopted whose verified email is still at the
+// organization's verified domain. Members who joined by invitation or through
+// auto-join are never managed.
+func (s *scimService) findManagedMember(org *model.Organization, userID string) (*model.OrganizationMember, error) {
+	member, err := s.findMember(org, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.isManaged(org, member) {
+		return nil, scimError(http.StatusForbidden, "", "user is not managed by this organization")
+	}
+	return member, nil
+}
+
+// isManaged reports whether the identity provider may change member, see findManagedMember
+func (s *scimService) isManaged(org *model.Organization, member *model.OrganizationMember) bool {
+	return member.Managed && (member.Provisioned || orgOwnsDomain(org, &member.User))
+}
+
+func (s *scimService) roleMembers(org *model.Organization, role string) ([]SCIMMemberRef, error) {
+	members, _, err := s.orgRepo.SearchMembers(org.ID, repository.MemberFilter{Role: role, Limit: -1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch members: %w", err)
+	}
+
+	refs := make([]SCIMMemberRef, len(members))
+	for i, member := range members {
+		refs[i] = SCIMMemberRef{
+			Value:   member.UserID,
+			Display: member.User.Email,
+			Ref:     s.location("Users", member.UserID),
+		}
+	}
+	return refs, nil
+}
+
+func (s *scimService) toSCIMUser(member *model.OrganizationMember) *SCIMUser {
+	user := &member.User
+	givenName, familyName, _ := strings.Cut(user.FullName, " ")
+	active := user.IsActive
+
+	return &SCIMUser{
+		Schemas:    []string{SCIMSchemaUser},
+		ID:         user.ID,
+		ExternalID: stringValue(member.ExternalID),
+		UserName:   user.Email,
+		Name: &SCIMName{
+			Formatted:  user.FullName,
+			GivenName:  givenName,
+			FamilyName: familyName,
+		},
+		DisplayName: user.FullName,
+		Emails:      []SCIMEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Groups:      []SCIMMemberRef{{Value: member.Role, Display: member.Role, Ref: s.location("Groups", member.Role)}},
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     s.location("Users", user.ID),
+		},
+	}
+}
+
+func (s *scimService) toSCIMGroup(org *model.Organization, role string) (*SCIMGroup, error) {
+	members, err := s.roleMembers(org, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SCIMGroup{
+		Schemas:     []string{SCIMSchemaGroup},
+		ID:          role,
+		DisplayName: role,
+		Members:     members,
+		Meta: &SCIMMeta{
+			ResourceType: "Group",
+			Location:     s.location("Groups", role),
+		},
+	}, nil
+}
+
+func (s *scimService) location(resource, id string) string {
+	baseURL := "http://localhost:5000"
+	if s.config != nil {
+		baseURL = strings.TrimSuffix(s.config.PublicURL, "/")
+	}
+	return baseURL + "/scim/v2/" + resource + "/" + id
+}
+
+// patchSCIMUser applies PATCH operations to user. Attributes this server does
+// not store (phone numbers, addresses, ...) are accepted and ignored.
+func patchSCIMUser(user *SCIMUser, ops []SCIMPatchOperation) error {
+	nameChanged, displayNameSet := false, false
+
+	for _, op := range ops {
+		operation := strings.ToLower(op.Op)
+		if operation != "add" && operation != "replace" && operation != "remove" {
+			return scimError(http.StatusBadRequest, "invalidSyntax", "unsupported operation "+op.Op)
+		}
+
+		attrs := map[string]json.RawMessage{}
+		switch {
+		case op.Path != "":
+			attrs[op.Path] = op.Value
+			if operation == "remove" {
+				attrs[op.Path] = nil
+			}
+		case operation == "remove":
+			return scimError(http.StatusBadRequest, "noTarget", "remove needs a path")
+		default:
+			if err := json.Unmarshal(op.Value, &attrs); err != nil {
+				return scimError(http.StatusBadRequest, "invalidValue", "value must be an object when no path is given")
+			}
+		}
+
+		for attr, value := range attrs {
+			switch strings.ToLower(attr) {
+			case "displayname":
+				displayNameSet = true
+			case "name", "name.givenname", "name.familyname", "name.formatted":
+				nameChanged = true
+			}
+			if err := setSCIMUserAttr(user, attr, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	// A new given or family name replaces the display name unless that was set as well
+	if nameChanged && !displayNameSet {
+		user.DisplayName = ""
+	}
+	return nil
+}
+
+// setSCIMUserAttr sets one attribute; a nil value removes it
+func setSCIMUserAttr(user *SCIMUser, attr string, value json.RawMessage) error {
+	var str string
+	if value != nil && !strings.EqualFold(attr, "active") && !strings.EqualFold(attr, "name") {
+		if err := json.Unmarshal(value, &str); err != nil {
+			// Attributes we do not store may hold any JSON
+			str = ""
+		}
+	}
+
+	switch strings.ToLower(attr) {
+	case "active":
+		if value == nil {
+			return scimError(http.StatusBadRequest, "mutability", "active cannot be removed")
+		}
+		active, err := parseSCIMBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = &active
+	case "username":
+		if value == nil {
+			return scimError(http.StatusBadRequest, "mutability", "userName cannot be removed")
+		}
+		user.UserName = str
+	case "displayname":
+		user.DisplayName = str
+	case "externalid":
+		user.ExternalID = str
+	case "name":
+		user.Name = nil
+		if value != nil {
+			var name SCIMName
+			if err := json.Unmarshal(value, &name); err != nil {
+				return scimError(http.StatusBadRequest, "invalidValue", "invalid name")
+			}
+			user.Name = &name
+		}
+	case "name.givenname", "name.familyname", "name.formatted":
+		if user.Name == nil {
+			user.Name = &SCIMName{}
+		}
+		switch strings.ToLower(attr) {
+		case "name.givenname":
+			user.Name.GivenName = str
+		case "name.familyname":
+			user.Name.FamilyName = str
+		default:
+			user.Name.Formatted = str
+		}
+		if !strings.EqualFold(attr, "name.formatted") {
+			user.Name.Formatted = strings.TrimSpace(user.Name.GivenName + " " + user.Name.FamilyName)
+		}
+	}
+	return nil
+}
+
+// parseSCIMBool accepts JSON booleans and the "True"/"False" strings some providers send
+func parseSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		if parsed, err := strconv.ParseBool(str); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, scimError(http.StatusBadRequest, "invalidValue", "active must be a boolean")
+}
+
+// parseSCIMFilter parses the only filter form providers need for lookups:
+// `attribute eq "value"`. The attribute is returned in lower case.
+func parseSCIMFilter(filter string) (string, string, error) {
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", scimError(http.StatusBadRequest, "invalidFilter", `only filters of the form attribute eq "value" are supported`)
+	}
+	value, err := strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		value = match[2]
+	}
+	return strings.ToLower(match[1]), value, nil
+}
+
+func decodeSCIMMembers(value json.RawMessage) ([]SCIMMemberRef, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	var refs []SCIMMemberRef
+	if err := json.Unmarshal(value, &refs); err != nil {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "members must be a list of {\"value\": userId}")
+	}
+	return refs, nil
+}
+
+// scimPage returns the 1-based start index and page size of a list request
+func scimPage(req SCIMListRequest) (int, int) {
+	startIndex := req.StartIndex
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := scimDefaultCount
+	if req.Count != nil {
+		count = *req.Count
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+// scimEmail validates userName, which has to be the user's email address
+func scimEmail(userName string) (string, error) {
+	email := strings.ToLower(strings.TrimSpace(userName))
+	if email == "" {
+		return "", scimError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return "", scimError(http.StatusBadRequest, "invalidValue", "userName must be an email address")
+	}
+	return email, nil
+}
+
+func hasSCIMName(in SCIMUser) bool {
+	return in.DisplayName != "" || (in.Name != nil && (in.Name.Formatted != "" || in.Name.GivenName != "" || in.Name.FamilyName != ""))
+}
+
+// scimFullName picks the best full name from a SCIM user, falling back to the email's local part
+func scimFullName(in SCIMUser, email string) string {
+	if in.DisplayName != "" {
+		return in.DisplayName
+	}
+	if in.Name != nil {
+		if in.Name.Formatted != "" {
+			return in.Name.Formatted
+		}
+		if name := strings.TrimSpace(in.Name.GivenName + " " + in.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return local
+}
+
+// orgOwnsDomain reports whether the user's verified email is at the organization's verified domain
+func orgOwnsDomain(org *model.Organization, user *model.User) bool {
+	return user.IsVerified && orgDomainEmail(org, user.Email)
+}
+
+// orgDomainEmail reports whether email is at the organization's verified domain
+func orgDomainEmail(org *model.Organization, email string) bool {
+	return org.DomainVerified() && emailDomain(email) == *org.Domain
+}
+
+func stringPtrOrNil(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
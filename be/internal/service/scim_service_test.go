@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"yourapp/internal/config"
+	"yourapp/internal/model"
+)
+
+// fakeRoomService records the users DisconnectUser was called for; anything else panics
+type fakeRoomService struct {
+	RoomService
+	disconnected []string
+}
+
+func (f *fakeRoomService) DisconnectUser(userID, reason string) error {
+	f.disconnected = append(f.disconnected, userID)
+	return nil
+}
+
+type testSCIM struct {
+	*scimService
+	auth  *testAuth
+	orgs  *fakeOrgRepo
+	rooms *fakeRoomService
+	org   *model.Organization
+}
+
+// newTestSCIM sets up an organization with the verified domain acme.test
+func newTestSCIM(users ...*model.User) *testSCIM {
+	auth := newTestAuth(users...)
+	domain := "acme.test"
+	now := time.Now()
+	t := &testSCIM{
+		auth:  auth,
+		orgs:  newFakeOrgRepo(auth.users),
+		rooms: &fakeRoomService{},
+		org:   &model.Organization{ID: "org", Name: "Acme", Domain: &domain, DomainVerifiedAt: &now},
+	}
+	t.orgs.orgs[t.org.ID] = t.org
+	t.scimService = &scimService{
+		orgRepo:     t.orgs,
+		userRepo:    auth.users,
+		authService: auth.authService,
+		roomService: t.rooms,
+		audit:       auth.auditLog,
+		config:      &config.Config{},
+	}
+	return t
+}
+
+func (t *testSCIM) addMember(user *model.User, role string, managed bool) {
+	t.orgs.AddMember(&model.OrganizationMember{OrganizationID: t.org.ID, UserID: user.ID, Role: role, Managed: managed})
+}
+
+func (t *testSCIM) role(userID string) string {
+	member, err := t.orgs.FindMember(t.org.ID, userID)
+	if err != nil {
+		return ""
+	}
+	return member.Role
+}
+
+func scimStatus(err error) (int, string) {
+	var scimErr *SCIMError
+	if !errors.As(err, &scimErr) {
+		return 0, ""
+	}
+	return scimErr.Status, scimErr.ScimType
+}
+
+func TestSCIMUserNameMustBeAtTheOrganizationDomain(t *testing.T) {
+	scim := newTestSCIM()
+
+	for _, userName := range []string{"someone@gmail.com", "someone@sub.acme.test"} {
+		_, err := scim.CreateUser(scim.org, SCIMUser{UserName: userName}, ClientInfo{})
+		if status, scimType := scimStatus(err); status != http.StatusBadRequest || scimType != "invalidValue" {
+			t.Errorf("creating %s: error %v, want 400 invalidValue", userName, err)
+		}
+		if _, err := scim.auth.users.FindByEmail(userName); err == nil {
+			t.Errorf("account %s was created", userName)
+		}
+	}
+
+	created, err := scim.CreateUser(scim.org, SCIMUser{UserName: "jane@acme.test"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := scim.auth.users.users[created.ID]; !user.IsVerified || user.LoginType != model.LoginTypeSCIM {
+		t.Errorf("provisioned user = %+v", user)
+	}
+
+	_, err = scim.PatchUser(scim.org, created.ID, SCIMPatchRequest{Operations: []SCIMPatchOperation{
+		{Op: "replace", Path: "userName", Value: []byte(`"jane@evil.example"`)},
+	}}, ClientInfo{})
+	if status, scimType := scimStatus(err); status != http.StatusBadRequest || scimType != "invalidValue" {
+		t.Errorf("moving to another domain: error %v, want 400 invalidValue", err)
+	}
+	if email := scim.auth.users.users[created.ID].Email; email != "jane@acme.test" {
+		t.Errorf("email = %s, want it unchanged", email)
+	}
+
+	if _, err := scim.ReplaceUser(scim.org, created.ID, SCIMUser{UserName: "jane.doe@acme.test"}, ClientInfo{}); err != nil {
+		t.Errorf("renaming within the domain: %v", err)
+	}
+
+	// Without a verified domain nothing can be provisioned
+	scim.org.DomainVerifiedAt = nil
+	if _, err := scim.CreateUser(scim.org, SCIMUser{UserName: "john@acme.test"}, ClientInfo{}); err == nil {
+		t.Error("user was provisioned for an unverified domain")
+	}
+}
+
+func TestSCIMReactivatesOnlyAccountsItDeactivated(t *testing.T) {
+	admin := activeUser("admin@example.org")
+	admin.UserType = model.RoleAdmin
+	scim := newTestSCIM(admin)
+
+	created, err := scim.CreateUser(scim.org, SCIMUser{UserName: "jane@acme.test"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := func(value bool) *bool { return &value }
+
+	if _, err := scim.ReplaceUser(scim.org, created.ID, SCIMUser{UserName: "jane@acme.test", Active: active(false)}, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	user := scim.auth.users.users[created.ID]
+	if user.IsActive || stringValue(user.DeactivatedBy) != model.DeactivatedBySCIM(scim.org.ID) {
+		t.Errorf("deactivated user: active %v, deactivated by %q", user.IsActive, stringValue(user.DeactivatedBy))
+	}
+	if len(scim.rooms.disconnected) != 1 || scim.rooms.disconnected[0] != created.ID {
+		t.Errorf("disconnected = %v, want the deactivated user", scim.rooms.disconnected)
+	}
+
+	if _, err := scim.ReplaceUser(scim.org, created.ID, SCIMUser{UserName: "jane@acme.test", Active: active(true)}, ClientInfo{}); err != nil {
+		t.Fatalf("reactivating an account SCIM deactivated: %v", err)
+	}
+	if user := scim.auth.users.users[created.ID]; !user.IsActive || user.DeactivatedBy != nil {
+		t.Errorf("reactivated user: active %v, deactivated by %q", user.IsActive, stringValue(user.DeactivatedBy))
+	}
+
+	// An admin's deactivation sticks, however the provider reports the user
+	if _, err := scim.auth.SetUserActive(admin.ID, created.ID, false, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = scim.ReplaceUser(scim.org, created.ID, SCIMUser{UserName: "jane@acme.test", Active: active(true)}, ClientInfo{})
+	if status, scimType := scimStatus(err); status != http.StatusForbidden || scimType != "mutability" {
+		t.Errorf("reactivating an account an admin deactivated: error %v, want 403 mutability", err)
+	}
+	if user := scim.auth.users.users[created.ID]; user.IsActive || stringValue(user.DeactivatedBy) != model.DeactivatedByAdmin(admin.ID) {
+		t.Errorf("user after the rejected reactivation: active %v, deactivated by %q", user.IsActive, stringValue(user.DeactivatedBy))
+	}
+
+	// Another organization's provider cannot undo this one's deactivation either
+	if _, err := scim.auth.SetUserActive(admin.ID, created.ID, true, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scim.auth.SetProvisionedUserActive(scim.org.ID, created.ID, false, ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scim.auth.SetProvisionedUserActive("other-org", created.ID, true, ClientInfo{}); !errors.Is(err, errDeactivatedElsewhere) {
+		t.Errorf("reactivation by another organization: error %v", err)
+	}
+}
+
+func TestSCIMRoleChangesLeaveOwnersAndUnmanagedMembersAlone(t *testing.T) {
+	owner := activeUser("owner@acme.test")
+	invited := activeUser("invited@acme.test")
+	scim := newTestSCIM(owner, invited)
+	scim.addMember(owner, model.OrgRoleOwner, true)
+	scim.addMember(invited, model.OrgRoleAdmin, false)
+
+	created, err := scim.CreateUser(scim.org, SCIMUser{UserName: "jane@acme.test"}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(userID string) SCIMPatchRequest {
+		return SCIMPatchRequest{Operations: []SCIMPatchOperation{
+			{Op: "add", Path: "members", Value: []byte(`[{"value":"` + userID + `"}]`)},
+		}}
+	}
+
+	if _, err := scim.PatchGroup(scim.org, model.OrgRoleOwner, add(created.ID), ClientInfo{}); err == nil {
+		t.Error("owner group was changed through SCIM")
+	}
+	if _, err := scim.CreateGroup(scim.org, SCIMGroup{DisplayName: "owner", Members: []SCIMMemberRef{{Value: created.ID}}}, ClientInfo{}); err == nil {
+		t.Error("owner group was created with members through SCIM")
+	}
+	_, err = scim.PatchGroup(scim.org, model.OrgRoleAdmin, add(owner.ID), ClientInfo{})
+	if status, scimType := scimStatus(err); status != http.StatusForbidden || scimType != "mutability" {
+		t.Errorf("demoting the owner: error %v, want 403 mutability", err)
+	}
+	_, err = scim.PatchGroup(scim.org, model.OrgRoleMember, add(invited.ID), ClientInfo{})
+	if status, _ := scimStatus(err); status != http.StatusForbidden {
+		t.Errorf("changing an invited member: error %v, want 403", err)
+	}
+
+	if _, err := scim.PatchGroup(scim.org, model.OrgRoleAdmin, add(created.ID), ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if role := scim.role(created.ID); role != model.OrgRoleAdmin {
+		t.Errorf("provisioned member role = %q, want admin", role)
+	}
+
+	// Replacing the admin group with nobody demotes only the managed admin
+	_, err = scim.PatchGroup(scim.org, model.OrgRoleAdmin, SCIMPatchRequest{Operations: []SCIMPatchOperation{
+		{Op: "replace", Path: "members", Value: []byte(`[]`)},
+	}}, ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := scim.role(created.ID); role != model.OrgRoleMember {
+		t.Errorf("provisioned member role = %q, want member", role)
+	}
+	if role := scim.role(invited.ID); role != model.OrgRoleAdmin {
+		t.Errorf("invited member role = %q, want admin", role)
+	}
+	if role := scim.role(owner.ID); role != model.OrgRoleOwner {
+		t.Errorf("owner role = %q, want owner", role)
+	}
+}
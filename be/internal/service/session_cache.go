@@ -0,0 +1,65 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// sessionCache remembers whether sessions are revoked so AuthMiddleware does not
+// need a database lookup on every request. Active results are cached briefly;
+// revoked results are kept until any access token of the session has expired.
+type sessionCache struct {
+	mu        sync.Mutex
+	activeTTL time.Duration
+	entries   map[string]sessionCacheEntry
+	lastPrune time.Time
+}
+
+type sessionCacheEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+func newSessionCache(activeTTL time.Duration) *sessionCache {
+	return &sessionCache{
+		activeTTL: activeTTL,
+		entries:   make(map[string]sessionCacheEntry),
+		lastPrune: time.Now(),
+	}
+}
+
+// get returns the cached revocation state and whether it was found
+func (c *sessionCache) get(sessionID string) (revoked bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastPrune) > c.activeTTL {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	entry, found := c.entries[sessionID]
+	if !found || now.After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.revoked, true
+}
+
+func (c *sessionCache) setActive(sessionID string) {
+	c.set(sessionID, sessionCacheEntry{revoked: false, expiresAt: time.Now().Add(c.activeTTL)})
+}
+
+func (c *sessionCache) setRevoked(sessionID string) {
+	c.set(sessionID, sessionCacheEntry{revoked: true, expiresAt: time.Now().Add(accessTokenTTL)})
+}
+
+func (c *sessionCache) set(sessionID string, entry sessionCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[sessionID] = entry
+}
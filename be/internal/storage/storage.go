@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"yourapp/internal/config"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// Storage stores user uploads under slash-separated keys like "avatars/<user>/<file>".
+// Local disk is the default; other backends (S3, GCS, ...) implement the same interface.
+type Storage interface {
+	// Put writes the content at key, replacing any existing file
+	Put(key string, content io.Reader, contentType string) error
+	// Open returns the content at key, ErrNotFound if it does not exist
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the file at key; deleting a missing file is not an error
+	Delete(key string) error
+	// URL returns the public URL the file at key is served from
+	URL(key string) string
+}
+
+// New creates the storage backend selected by STORAGE_DRIVER
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageDriver {
+	case "", "local":
+		return NewLocalStorage(cfg.UploadDir, cfg.UploadURL)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
+
+// cleanKey rejects keys that could escape the storage root
+func cleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(key, "/")
+	if key == "" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,234 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// cborPair is one map entry for cborEncode; a slice of pairs keeps the
+// encoded key order stable
+type cborPair struct {
+	key   interface{}
+	value interface{}
+}
+
+type cborMap []cborPair
+
+// cborEncode is the test counterpart of DecodeCBOR, used to build
+// attestation objects and COSE keys for the software authenticator
+func cborEncode(v interface{}) []byte {
+	var buf bytes.Buffer
+	writeCBOR(&buf, v)
+	return buf.Bytes()
+}
+
+func writeCBOR(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case int:
+		writeCBORInt(buf, int64(v))
+	case int64:
+		writeCBORInt(buf, v)
+	case []byte:
+		writeCBORHead(buf, 2, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		writeCBORHead(buf, 4, uint64(len(v)))
+		for _, item := range v {
+			writeCBOR(buf, item)
+		}
+	case cborMap:
+		writeCBORHead(buf, 5, uint64(len(v)))
+		for _, pair := range v {
+			writeCBOR(buf, pair.key)
+			writeCBOR(buf, pair.value)
+		}
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case nil:
+		buf.WriteByte(0xf6)
+	default:
+		panic("cborEncode: unsupported type")
+	}
+}
+
+func writeCBORInt(buf *bytes.Buffer, n int64) {
+	if n < 0 {
+		writeCBORHead(buf, 1, uint64(-1-n))
+		return
+	}
+	writeCBORHead(buf, 0, uint64(n))
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= 0xff:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= 0xffffffff:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	// Encodings from RFC 8949 appendix A
+	tests := []struct {
+		name string
+		hex  string
+		want interface{}
+	}{
+		{"zero", "00", int64(0)},
+		{"small int", "17", int64(23)},
+		{"one byte int", "1818", int64(24)},
+		{"two byte int", "1903e8", int64(1000)},
+		{"four byte int", "1a000f4240", int64(1000000)},
+		{"eight byte int", "1b000000e8d4a51000", int64(1000000000000)},
+		{"negative", "20", int64(-1)},
+		{"negative two bytes", "3903e7", int64(-1000)},
+		{"false", "f4", false},
+		{"true", "f5", true},
+		{"null", "f6", nil},
+		{"half float", "f93c00", float64(1)},
+		{"single float", "fa47c35000", float64(100000)},
+		{"double float", "fb3ff199999999999a", 1.1},
+		{"empty bytes", "40", []byte{}},
+		{"bytes", "4401020304", []byte{1, 2, 3, 4}},
+		{"text", "6449455446", "IETF"},
+		{"utf-8 text", "62c3bc", "ü"},
+		{"array", "83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"nested array", "8301820203820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"map", "a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"text key map", "a26161016162820203", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"tag is skipped", "c11a514b67b0", int64(1363896240)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := DecodeCBOR(mustHex(t, tt.hex))
+			if err != nil {
+				t.Fatalf("DecodeCBOR(%s) error: %v", tt.hex, err)
+			}
+			if len(rest) != 0 {
+				t.Errorf("DecodeCBOR(%s) left %d bytes", tt.hex, len(rest))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeCBOR(%s) = %#v, want %#v", tt.hex, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORReturnsRemainingBytes(t *testing.T) {
+	got, rest, err := DecodeCBOR(mustHex(t, "0102ff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != int64(1) || !bytes.Equal(rest, []byte{0x02, 0xff}) {
+		t.Errorf("got %v with rest %x, want 1 with rest 02ff", got, rest)
+	}
+}
+
+func TestDecodeCBORRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{"empty", ""},
+		{"indefinite length bytes", "5f42010243030405ff"},
+		{"indefinite length array", "9f0102ff"},
+		{"reserved length info", "1c"},
+		{"unsupported simple value", "f0"},
+		{"float map key", "a1f93c0001"},
+		{"array map key", "a1800102"},
+		{"integer overflow", "1bffffffffffffffff"},
+		{"negative overflow", "3bffffffffffffffff"},
+		{"byte string longer than data", "5bffffffffffffffff00"},
+		{"array longer than data", "9bffffffffffffffff00"},
+		{"map longer than data", "bbffffffffffffffff00"},
+		{"nesting too deep", "818181818181818181818181818181818181818100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := DecodeCBOR(mustHex(t, tt.hex)); err == nil {
+				t.Errorf("DecodeCBOR(%s) succeeded, want error", tt.hex)
+			}
+		})
+	}
+}
+
+// Every proper prefix of a valid item must fail cleanly instead of panicking
+// or returning a partial value
+func TestDecodeCBORTruncated(t *testing.T) {
+	items := [][]byte{
+		mustHex(t, "1b000000e8d4a51000"),
+		mustHex(t, "fb3ff199999999999a"),
+		mustHex(t, "a26161016162820203"),
+		cborEncode(cborMap{
+			{"fmt", "none"},
+			{"attStmt", cborMap{}},
+			{"authData", bytes.Repeat([]byte{0xab}, 300)},
+		}),
+		cborEncode(cborMap{
+			{1, 2}, {3, COSEAlgES256}, {-1, 1},
+			{-2, bytes.Repeat([]byte{1}, 32)},
+			{-3, bytes.Repeat([]byte{2}, 32)},
+		}),
+	}
+
+	for _, item := range items {
+		if _, rest, err := DecodeCBOR(item); err != nil || len(rest) != 0 {
+			t.Fatalf("DecodeCBOR(%x) = rest %x, error %v", item, rest, err)
+		}
+		for n := 0; n < len(item); n++ {
+			if _, _, err := DecodeCBOR(item[:n]); err == nil {
+				t.Errorf("DecodeCBOR(%x) of truncated %x succeeded", item[:n], item)
+			}
+		}
+	}
+}
+
+func FuzzDecodeCBOR(f *testing.F) {
+	f.Add(mustHex(f, "a26161016162820203"))
+	f.Add(mustHex(f, "8301820203820405"))
+	f.Add(mustHex(f, "fb3ff199999999999a"))
+	f.Add(mustHex(f, "5bffffffffffffffff00"))
+	f.Add(cborEncode(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", []byte{1, 2, 3}}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, rest, err := DecodeCBOR(data)
+		if err == nil && len(rest) > len(data) {
+			t.Fatalf("rest is longer than the input")
+		}
+		// Attestation parsing sits on top of the decoder and must not panic either
+		ParseAuthenticatorData(data)
+		ParseCOSEKey(data)
+	})
+}
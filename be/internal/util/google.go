@@ -0,0 +1,77 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultGoogleJWKSURL is where Google publishes the keys that sign its ID tokens
+const DefaultGoogleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// GoogleIDTokenClaims are the claims we use from a verified Google ID token
+type GoogleIDTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+// GoogleIDTokenVerifier verifies ID tokens issued by Google Sign-In
+type GoogleIDTokenVerifier struct {
+	clientID string
+	keys     *JWKSCache
+}
+
+func NewGoogleIDTokenVerifier(clientID, jwksURL string) *GoogleIDTokenVerifier {
+	if jwksURL == "" {
+		jwksURL = DefaultGoogleJWKSURL
+	}
+	return &GoogleIDTokenVerifier{
+		clientID: clientID,
+		keys:     NewJWKSCache(jwksURL),
+	}
+}
+
+// Verify checks the token signature, audience, issuer and expiry and
+// returns its claims. Tokens without a verified email are rejected.
+func (v *GoogleIDTokenVerifier) Verify(idToken string) (*GoogleIDTokenClaims, error) {
+	if v.clientID == "" {
+		return nil, errors.New("google sign-in is not configured")
+	}
+
+	claims := &GoogleIDTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, v.keys.Keyfunc,
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(v.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid google ID token: %w", err)
+	}
+
+	validIssuer := false
+	for _, issuer := range googleIssuers {
+		if claims.Issuer == issuer {
+			validIssuer = true
+			break
+		}
+	}
+	if !validIssuer {
+		return nil, errors.New("invalid google ID token: unexpected issuer")
+	}
+
+	if claims.Subject == "" || claims.Email == "" {
+		return nil, errors.New("invalid google ID token: missing subject or email")
+	}
+	if !claims.EmailVerified {
+		return nil, errors.New("google account email is not verified")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,245 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testGoogleClientID = "client-123.apps.googleusercontent.com"
+	testGoogleKeyID    = "google-key-1"
+)
+
+// fakeGoogleJWKS serves the public half of key as Google's JWKS endpoint
+func fakeGoogleJWKS(t *testing.T, key *rsa.PrivateKey) (*httptest.Server, *int32) {
+	t.Helper()
+	jwk, err := NewJSONWebKey(testGoogleKeyID, "RS256", &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []JSONWebKey{jwk}})
+	}))
+	t.Cleanup(server.Close)
+	return server, &fetches
+}
+
+func validGoogleClaims() *GoogleIDTokenClaims {
+	now := time.Now()
+	return &GoogleIDTokenClaims{
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Name:          "Test User",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://accounts.google.com",
+			Subject:   "1234567890",
+			Audience:  jwt.ClaimStrings{testGoogleClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+func signGoogleToken(t *testing.T, key *rsa.PrivateKey, kid string, claims *GoogleIDTokenClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestGoogleIDTokenVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr string
+	}{
+		{
+			name: "valid token",
+			token: func() string {
+				return signGoogleToken(t, key, testGoogleKeyID, validGoogleClaims())
+			},
+		},
+		{
+			name: "issuer without scheme",
+			token: func() string {
+				claims := validGoogleClaims()
+				claims.Issuer = "accounts.google.com"
+				return signGoogleToken(t, key, testGoogleKeyID, claims)
+			},
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := validGoogleClaims()
+				claims.Audience = jwt.ClaimStrings{"someone-else.apps.googleusercontent.com"}
+				return signGoogleToken(t, key, testGoogleKeyID, claims)
+			},
+			wantErr: "audience",
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := validGoogleClaims()
+				claims.Issuer = "https://evil.example.com"
+				return signGoogleToken(t, key, testGoogleKeyID, claims)
+			},
+			wantErr: "unexpected issuer",
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := validGoogleClaims()
+				claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Hour))
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+				return signGoogleToken(t, key, testGoogleKeyID, claims)
+			},
+			wantErr: "expired",
+		},
+		{
+			name: "missing expiry",
+			token: func() string {
+				claims := validGoogleClaims()
+				claims.ExpiresAt = nil
+				return signGoogleToken(t, key, testGoogleKeyID, claims)
+			},
+			wantErr: "exp",
+		},
+		{
+			name: "email not verified",
+			token: func() string {
+				claims := validGoogleClaims()
+				claims.EmailVerified = false
+				return signGoogleToken(t, key, testGoogleKeyID, claims)
+			},
+			wantErr: "not verified",
+		},
+		{
+			name: "missing email",
+			token: func() string {
+				claims := validGoogleClaims()
+				claims.Email = ""
+				return signGoogleToken(t, key, testGoogleKeyID, claims)
+			},
+			wantErr: "missing subject or email",
+		},
+		{
+			name: "unknown key ID",
+			token: func() string {
+				return signGoogleToken(t, key, "rotated-away", validGoogleClaims())
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name: "no key ID",
+			token: func() string {
+				return signGoogleToken(t, key, "", validGoogleClaims())
+			},
+			wantErr: "no key ID",
+		},
+		{
+			name: "signed with another key",
+			token: func() string {
+				return signGoogleToken(t, otherKey, testGoogleKeyID, validGoogleClaims())
+			},
+			wantErr: "signature",
+		},
+		{
+			name: "HMAC signed with the public key",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, validGoogleClaims())
+				token.Header["kid"] = testGoogleKeyID
+				signed, err := token.SignedString(key.PublicKey.N.Bytes())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: "signing method",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := fakeGoogleJWKS(t, key)
+			verifier := NewGoogleIDTokenVerifier(testGoogleClientID, server.URL)
+
+			claims, err := verifier.Verify(tt.token())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify failed: %v", err)
+				}
+				if claims.Email != "user@example.com" || claims.Subject != "1234567890" {
+					t.Errorf("claims = %+v", claims)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGoogleIDTokenVerifierCachesKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, fetches := fakeGoogleJWKS(t, key)
+	verifier := NewGoogleIDTokenVerifier(testGoogleClientID, server.URL)
+
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.Verify(signGoogleToken(t, key, testGoogleKeyID, validGoogleClaims())); err != nil {
+			t.Fatalf("Verify %d failed: %v", i+1, err)
+		}
+	}
+	// Unknown key IDs may refetch, but not more than once a minute
+	for i := 0; i < 3; i++ {
+		verifier.Verify(signGoogleToken(t, key, "unknown", validGoogleClaims()))
+	}
+
+	if n := atomic.LoadInt32(fetches); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
+
+func TestGoogleIDTokenVerifierWithoutClientID(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := fakeGoogleJWKS(t, key)
+
+	verifier := NewGoogleIDTokenVerifier("", server.URL)
+	if _, err := verifier.Verify(signGoogleToken(t, key, testGoogleKeyID, validGoogleClaims())); err == nil {
+		t.Error("Verify succeeded without a configured client ID")
+	}
+}
@@ -0,0 +1,340 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// byteOrder is satisfied by binary.LittleEndian and binary.BigEndian
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// exifTIFF builds a TIFF header with one IFD holding the given entries.
+// Each entry is tag, type, count and a value that fits in the entry.
+func exifTIFF(order byteOrder, entries [][4]uint32) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	buf.Write(order.AppendUint16(nil, 42))
+	buf.Write(order.AppendUint32(nil, 8))
+	buf.Write(order.AppendUint16(nil, uint16(len(entries))))
+	for _, e := range entries {
+		buf.Write(order.AppendUint16(nil, uint16(e[0])))
+		buf.Write(order.AppendUint16(nil, uint16(e[1])))
+		buf.Write(order.AppendUint32(nil, e[2]))
+		value := order.AppendUint16(nil, uint16(e[3]))
+		buf.Write(append(value, 0, 0))
+	}
+	buf.Write([]byte{0, 0, 0, 0}) // no next IFD
+	return buf.Bytes()
+}
+
+func orientationEntry(value uint32) [4]uint32 {
+	return [4]uint32{0x0112, 3, 1, value}
+}
+
+// jpegSegment wraps payload in a marker segment with its length field
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func exifSegment(tiff []byte) []byte {
+	return jpegSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// testJPEG encodes a w x h image and inserts the given segments after SOI
+func testJPEG(t *testing.T, w, h int, segments ...[]byte) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 0, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	out := append([]byte{}, encoded[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, encoded[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	valid := exifTIFF(be, [][4]uint32{orientationEntry(6)})
+
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"little endian", exifTIFF(le, [][4]uint32{orientationEntry(3)}), 3},
+		{"big endian", exifTIFF(be, [][4]uint32{orientationEntry(6)}), 6},
+		{"after other tags", exifTIFF(le, [][4]uint32{{0x010F, 2, 4, 0}, {0x0110, 2, 4, 0}, orientationEntry(8)}), 8},
+		{"normal", exifTIFF(le, [][4]uint32{orientationEntry(1)}), 1},
+		{"no orientation tag", exifTIFF(le, [][4]uint32{{0x010F, 2, 4, 0}}), 1},
+		{"no entries", exifTIFF(le, nil), 1},
+		{"orientation zero", exifTIFF(le, [][4]uint32{orientationEntry(0)}), 1},
+		{"orientation out of range", exifTIFF(le, [][4]uint32{orientationEntry(9)}), 1},
+		{"orientation as LONG", exifTIFF(le, [][4]uint32{{0x0112, 4, 1, 6}}), 1},
+		{"unknown byte order", append([]byte("XX"), valid[2:]...), 1},
+		{"empty", nil, 1},
+		{"shorter than header", valid[:7], 1},
+		{"IFD count truncated", valid[:9], 1},
+		{"entry truncated", valid[:10+11], 1},
+		{"IFD offset past end", func() []byte {
+			tiff := append([]byte{}, valid...)
+			be.PutUint32(tiff[4:], 0xFFFFFFF0)
+			return tiff
+		}(), 1},
+		{"entry count past end", func() []byte {
+			tiff := exifTIFF(be, [][4]uint32{{0x010F, 2, 4, 0}})
+			be.PutUint16(tiff[8:], 0xFFFF)
+			return tiff
+		}(), 1},
+		{"entries read before count runs past end", func() []byte {
+			tiff := append([]byte{}, valid...)
+			be.PutUint16(tiff[8:], 0xFFFF)
+			return tiff
+		}(), 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.tiff); got != tt.want {
+				t.Errorf("exifOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	rotated := exifSegment(exifTIFF(binary.BigEndian, [][4]uint32{orientationEntry(6)}))
+	app0 := jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+	withExif := testJPEG(t, 8, 8, rotated)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"exif orientation", withExif, 6},
+		{"exif after JFIF segment", testJPEG(t, 8, 8, app0, rotated), 6},
+		{"no exif", testJPEG(t, 8, 8), 1},
+		{"APP1 that is not exif", testJPEG(t, 8, 8, jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00"))), 1},
+		{"exif segment without TIFF data", testJPEG(t, 8, 8, exifSegment(nil)), 1},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+		{"only SOI", []byte{0xFF, 0xD8}, 1},
+		{"truncated before segment length", withExif[:5], 1},
+		{"truncated inside exif segment", withExif[:20], 1},
+		{"segment length below minimum", append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}, withExif[2:]...), 1},
+		{"garbage instead of marker", append([]byte{0xFF, 0xD8, 0x00, 0xE1}, withExif[2:]...), 1},
+		{"exif after start of scan", func() []byte {
+			sos := jpegSegment(0xDA, []byte{0x01, 0x01, 0x00, 0x00, 0x3F, 0x00})
+			return append(append([]byte{0xFF, 0xD8}, sos...), rotated...)
+		}(), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeImageAppliesOrientation(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		segment := exifSegment(exifTIFF(binary.LittleEndian, [][4]uint32{orientationEntry(uint32(orientation))}))
+		img, err := DecodeImage(testJPEG(t, 40, 20, segment), 1, 100)
+		if err != nil {
+			t.Fatalf("orientation %d: %v", orientation, err)
+		}
+
+		wantW, wantH := 40, 20
+		if orientation >= 5 {
+			wantW, wantH = 20, 40
+		}
+		if b := img.Bounds(); b.Dx() != wantW || b.Dy() != wantH {
+			t.Errorf("orientation %d: decoded %dx%d, want %dx%d", orientation, b.Dx(), b.Dy(), wantW, wantH)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// 2x1 image: red on the left, blue on the right
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		want        [][]color.RGBA // rows of the upright image
+	}{
+		{1, [][]color.RGBA{{red, blue}}},
+		{2, [][]color.RGBA{{blue, red}}},
+		{3, [][]color.RGBA{{blue, red}}},
+		{4, [][]color.RGBA{{red, blue}}},
+		{5, [][]color.RGBA{{red}, {blue}}},
+		{6, [][]color.RGBA{{red}, {blue}}},
+		{7, [][]color.RGBA{{blue}, {red}}},
+		{8, [][]color.RGBA{{blue}, {red}}},
+	}
+
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		if b := got.Bounds(); b.Dy() != len(tt.want) || b.Dx() != len(tt.want[0]) {
+			t.Errorf("orientation %d: got %dx%d", tt.orientation, b.Dx(), b.Dy())
+			continue
+		}
+		for y, row := range tt.want {
+			for x, want := range row {
+				if c := color.RGBAModel.Convert(got.At(x, y)).(color.RGBA); c != want {
+					t.Errorf("orientation %d: pixel (%d,%d) = %v, want %v", tt.orientation, x, y, c, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeImageChecksFormatAndDimensions(t *testing.T) {
+	var pngData, gifData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 64, 32)))
+	gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 64, 64), color.Palette{color.Black, color.White}), nil)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"png", pngData.Bytes(), false},
+		{"jpeg", testJPEG(t, 64, 64), false},
+		{"gif", gifData.Bytes(), true},
+		{"not an image", []byte("hello"), true},
+		{"too large", testJPEG(t, 257, 64), true},
+		{"too small", testJPEG(t, 64, 15), true},
+		{"truncated", testJPEG(t, 64, 64)[:200], true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeImage(tt.data, 16, 256)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodeImage error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSquareThumbnails(t *testing.T) {
+	// 300x100: red, green and blue thirds. The square crop keeps the green middle.
+	img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 100 {
+				c = color.RGBA{0, 255, 0, 255}
+			}
+			if x >= 200 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	sizes := []int{32, 64, 128, 256}
+	thumbs := SquareThumbnails(img, sizes)
+	if len(thumbs) != len(sizes) {
+		t.Fatalf("got %d thumbnails, want %d", len(thumbs), len(sizes))
+	}
+	for _, size := range sizes {
+		thumb := thumbs[size]
+		if b := thumb.Bounds(); b.Dx() != size || b.Dy() != size {
+			t.Errorf("thumbnail %d is %dx%d", size, b.Dx(), b.Dy())
+			continue
+		}
+		for _, p := range []image.Point{{0, 0}, {size - 1, size - 1}, {size / 2, size / 2}} {
+			if c := thumb.RGBAAt(p.X, p.Y); c != (color.RGBA{0, 255, 0, 255}) {
+				t.Errorf("thumbnail %d pixel %v = %v, want green", size, p, c)
+			}
+		}
+	}
+
+	// A portrait image is cropped around its vertical center as well
+	if thumb := SquareThumbnail(image.NewRGBA(image.Rect(0, 0, 90, 400)), 48); thumb.Bounds().Dx() != 48 || thumb.Bounds().Dy() != 48 {
+		t.Errorf("portrait thumbnail is %v", thumb.Bounds())
+	}
+}
+
+func TestSquareThumbnailFlattensTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10)) // fully transparent
+	thumb := SquareThumbnail(img, 4)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if c := thumb.RGBAAt(x, y); c != (color.RGBA{255, 255, 255, 255}) {
+				t.Fatalf("pixel (%d,%d) = %v, want white", x, y, c)
+			}
+		}
+	}
+}
+
+func TestSquareThumbnailAveragesPixels(t *testing.T) {
+	// Alternating black and white columns average to grey when halved
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.RGBA{0, 0, 0, 255}
+			if x%2 == 1 {
+				c = color.RGBA{254, 254, 254, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	thumb := SquareThumbnail(img, 2)
+	if c := thumb.RGBAAt(0, 0); c != (color.RGBA{127, 127, 127, 255}) {
+		t.Errorf("pixel = %v, want grey", c)
+	}
+}
+
+func TestEncodeJPEGStripsExif(t *testing.T) {
+	segment := exifSegment(exifTIFF(binary.BigEndian, [][4]uint32{orientationEntry(6), {0x8825, 4, 1, 0}}))
+	img, err := DecodeImage(testJPEG(t, 32, 32, segment), 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := EncodeJPEG(img, 85)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("Exif\x00\x00")) {
+		t.Error("re-encoded JPEG still contains EXIF data")
+	}
+	if jpegOrientation(out) != 1 {
+		t.Error("re-encoded JPEG still has an orientation")
+	}
+}
@@ -7,55 +7,96 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token types carried in the "typ" claim
+const (
+	TokenTypeAccess = "access"
+	TokenTypeReset  = "reset"
+	TokenTypeMFA    = "mfa_challenge"
+	TokenTypeMagic  = "magic_link"
+	TokenTypeVerify = "verify_email"
+)
+
 type JWTClaims struct {
-	UserID   string `json:"userId"`
-	Email    string `json:"email"`
-	UserType string `json:"role"`
+	UserID    string `json:"userId"`
+	Email     string `json:"email"`
+	UserType  string `json:"role"`
+	TokenType string `json:"typ"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token
-func GenerateToken(userID, email, userType, secret string, expiresIn time.Duration) (string, error) {
-	claims := JWTClaims{
-		UserID:   userID,
-		Email:    email,
-		UserType: userType,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "yourapp",
-			Subject:   userID,
-		},
+// GenerateToken generates a JWT token signed with the key ring's current key
+func GenerateToken(claims JWTClaims, keys *KeyRing, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Issuer:    "yourapp",
+		Subject:   claims.UserID,
+		ID:        claims.ID,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.Sign(claims)
 }
 
-// GenerateAccessToken generates an access token (15 minutes)
-func GenerateAccessToken(userID, email, userType, secret string) (string, error) {
-	return GenerateToken(userID, email, userType, secret, 15*time.Minute)
+// GenerateAccessToken generates an access token (15 minutes) bound to a session
+func GenerateAccessToken(userID, email, userType, sessionID string, keys *KeyRing) (string, error) {
+	return GenerateToken(JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		UserType:  userType,
+		TokenType: TokenTypeAccess,
+		SessionID: sessionID,
+	}, keys, 15*time.Minute)
 }
 
-// GenerateRefreshToken generates a refresh token (7 days)
-func GenerateRefreshToken(userID, email, userType, secret string) (string, error) {
-	return GenerateToken(userID, email, userType, secret, 7*24*time.Hour)
+// GenerateResetPasswordToken generates a reset password token (1 hour)
+func GenerateResetPasswordToken(userID, email string, keys *KeyRing) (string, error) {
+	return GenerateToken(JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		UserType:  "reset",
+		TokenType: TokenTypeReset,
+	}, keys, 1*time.Hour)
 }
 
-// GenerateResetPasswordToken generates a reset password token (1 hour)
-func GenerateResetPasswordToken(userID, email, secret string) (string, error) {
-	return GenerateToken(userID, email, "reset", secret, 1*time.Hour)
+// GenerateMFAChallengeToken generates a short-lived token proving the password step of a login (5 minutes)
+func GenerateMFAChallengeToken(userID, email string, keys *KeyRing) (string, error) {
+	return GenerateToken(JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		TokenType: TokenTypeMFA,
+	}, keys, 5*time.Minute)
 }
 
-// ValidateToken validates a JWT token
-func ValidateToken(tokenString, secret string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
+// GenerateMagicLinkToken generates a passwordless login token (10 minutes).
+// secret is the one-time code that makes the link single use.
+func GenerateMagicLinkToken(userID, email, secret string, keys *KeyRing) (string, error) {
+	claims := JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		TokenType: TokenTypeMagic,
+	}
+	claims.ID = secret
+	return GenerateToken(claims, keys, 10*time.Minute)
+}
+
+// GenerateEmailVerificationToken generates the token of an email verification link (24 hours)
+func GenerateEmailVerificationToken(userID, email string, keys *KeyRing) (string, error) {
+	return GenerateToken(JWTClaims{
+		UserID:    userID,
+		Email:     email,
+		TokenType: TokenTypeVerify,
+	}, keys, 24*time.Hour)
+}
+
+// validateToken validates a JWT token against the key ring. It is unexported
+// on purpose: a token accepted without its "typ" would let e.g. an MFA
+// challenge or a magic link (skipping its nonce and single-use checks) be
+// redeemed somewhere else, so callers go through ValidateTokenType.
+func validateToken(tokenString string, keys *KeyRing) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
 
 	if err != nil {
 		return nil, err
@@ -67,3 +108,17 @@ func ValidateToken(tokenString, secret string) (*JWTClaims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// ValidateTokenType validates a JWT token and checks that it has the expected "typ" claim
+func ValidateTokenType(tokenString string, keys *KeyRing, tokenType string) (*JWTClaims, error) {
+	claims, err := validateToken(tokenString, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType != tokenType {
+		return nil, errors.New("unexpected token type")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTokenTypeRejectsOtherTypes(t *testing.T) {
+	keys := NewHMACKeyRing("test-secret")
+
+	generators := map[string]func() (string, error){
+		TokenTypeAccess: func() (string, error) {
+			return GenerateAccessToken("user-1", "a@example.com", "member", "session-1", keys)
+		},
+		TokenTypeReset:  func() (string, error) { return GenerateResetPasswordToken("user-1", "a@example.com", keys) },
+		TokenTypeMFA:    func() (string, error) { return GenerateMFAChallengeToken("user-1", "a@example.com", keys) },
+		TokenTypeMagic:  func() (string, error) { return GenerateMagicLinkToken("user-1", "a@example.com", "secret", keys) },
+		TokenTypeVerify: func() (string, error) { return GenerateEmailVerificationToken("user-1", "a@example.com", keys) },
+	}
+
+	for issued, generate := range generators {
+		token, err := generate()
+		if err != nil {
+			t.Fatalf("generating %s token: %v", issued, err)
+		}
+		for expected := range generators {
+			claims, err := ValidateTokenType(token, keys, expected)
+			if issued == expected {
+				if err != nil || claims.TokenType != issued {
+					t.Errorf("%s token rejected as %s: %v", issued, expected, err)
+				}
+				continue
+			}
+			if err == nil {
+				t.Errorf("%s token accepted as %s", issued, expected)
+			}
+		}
+	}
+}
+
+func TestValidateTokenTypeRejectsExpiredAndForeignTokens(t *testing.T) {
+	keys := NewHMACKeyRing("test-secret")
+
+	expired, err := GenerateToken(JWTClaims{UserID: "user-1", TokenType: TokenTypeVerify}, keys, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateTokenType(expired, keys, TokenTypeVerify); err == nil {
+		t.Error("expired token accepted")
+	}
+
+	foreign, err := GenerateEmailVerificationToken("user-1", "a@example.com", NewHMACKeyRing("other-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateTokenType(foreign, keys, TokenTypeVerify); err == nil {
+		t.Error("token signed with another key accepted")
+	}
+}
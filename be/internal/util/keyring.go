@@ -0,0 +1,438 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT signing algorithms for asymmetric keys
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	keyManifestFile       = "keys.json"
+	keyRingReloadInterval = 30 * time.Second
+	keyRingMinForceReload = 5 * time.Second
+	rsaKeyBits            = 2048
+)
+
+// SigningKeyInfo is one entry of the key manifest (keys.json) in JWT_KEYS_DIR
+type SigningKeyInfo struct {
+	Kid        string    `json:"kid"`
+	Alg        string    `json:"alg"`
+	File       string    `json:"file"`
+	CreatedAt  time.Time `json:"created_at"`
+	ActiveFrom time.Time `json:"active_from"` // signing starts here; the key is published in the JWKS before that
+}
+
+type keyManifest struct {
+	Keys []SigningKeyInfo `json:"keys"`
+}
+
+type signingKey struct {
+	info    SigningKeyInfo
+	private crypto.Signer
+	public  crypto.PublicKey
+	method  jwt.SigningMethod
+}
+
+// KeyRing signs and verifies JWTs. With a key directory it signs with the
+// newest active RS256/EdDSA key, puts its kid in the header and verifies with
+// every key in the manifest, so older tokens stay valid after a rotation.
+// Without one it falls back to HS256 with the shared JWT secret.
+type KeyRing struct {
+	dir        string
+	hmacSecret []byte
+	acceptHMAC bool
+
+	mu          sync.RWMutex
+	keys        map[string]*signingKey
+	ordered     []*signingKey // by ActiveFrom, oldest first
+	manifestMod time.Time
+	lastCheck   time.Time
+}
+
+// NewHMACKeyRing signs and verifies HS256 tokens with a shared secret only
+func NewHMACKeyRing(secret string) *KeyRing {
+	return &KeyRing{hmacSecret: []byte(secret), acceptHMAC: true, keys: make(map[string]*signingKey)}
+}
+
+// LoadKeyRing loads the signing keys in dir, creating a first key with alg
+// if the directory has none yet. acceptHMAC keeps HS256 tokens signed with
+// hmacSecret valid, e.g. while migrating away from the shared secret.
+func LoadKeyRing(dir, alg, hmacSecret string, acceptHMAC bool) (*KeyRing, error) {
+	if dir == "" {
+		return NewHMACKeyRing(hmacSecret), nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, keyManifestFile)); errors.Is(err, os.ErrNotExist) {
+		if _, err := RotateSigningKey(dir, alg, 0); err != nil {
+			return nil, fmt.Errorf("failed to create first signing key: %w", err)
+		}
+	}
+
+	ring := &KeyRing{
+		dir:        dir,
+		hmacSecret: []byte(hmacSecret),
+		acceptHMAC: acceptHMAC,
+		keys:       make(map[string]*signingKey),
+	}
+	if err := ring.reload(); err != nil {
+		return nil, err
+	}
+	if len(ring.ordered) == 0 {
+		return nil, fmt.Errorf("no signing keys in %s", dir)
+	}
+	return ring, nil
+}
+
+// Sign signs claims with the current key
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	k.maybeReload(false)
+
+	key := k.current()
+	if key == nil {
+		if len(k.hmacSecret) == 0 {
+			return "", errors.New("no signing key available")
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.info.Kid
+	return token.SignedString(key.private)
+}
+
+// Keyfunc resolves the verification key of a token by its kid header
+func (k *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && k.hmacAllowed() {
+			return k.hmacSecret, nil
+		}
+		return nil, errors.New("token has no key ID")
+	}
+
+	key := k.lookup(kid)
+	if key == nil {
+		// Possibly rotated in by another instance
+		k.maybeReload(true)
+		if key = k.lookup(kid); key == nil {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	// The algorithm must match the key, never whatever the token claims
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// ValidMethods lists the algorithms this key ring accepts
+func (k *KeyRing) ValidMethods() []string {
+	methods := []string{AlgRS256, AlgEdDSA}
+	if k.hmacAllowed() {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+// JWKS returns the public verification keys, including keys that will start signing soon
+func (k *KeyRing) JWKS() []JSONWebKey {
+	k.maybeReload(false)
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]JSONWebKey, 0, len(k.ordered))
+	for _, key := range k.ordered {
+		jwk, err := NewJSONWebKey(key.info.Kid, key.info.Alg, key.public)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return keys
+}
+
+func (k *KeyRing) hmacAllowed() bool {
+	if len(k.hmacSecret) == 0 {
+		return false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.acceptHMAC || len(k.ordered) == 0
+}
+
+func (k *KeyRing) current() *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(k.ordered) - 1; i >= 0; i-- {
+		if !k.ordered[i].info.ActiveFrom.After(now) {
+			return k.ordered[i]
+		}
+	}
+	return nil
+}
+
+func (k *KeyRing) lookup(kid string) *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[kid]
+}
+
+// maybeReload re-reads the manifest when it changed on disk
+func (k *KeyRing) maybeReload(force bool) {
+	if k.dir == "" {
+		return
+	}
+
+	k.mu.RLock()
+	since := time.Since(k.lastCheck)
+	k.mu.RUnlock()
+	if since < keyRingReloadInterval && (!force || since < keyRingMinForceReload) {
+		return
+	}
+
+	if err := k.reload(); err != nil {
+		// Keep using the keys we have
+		log.Printf("Failed to reload signing keys: %v", err)
+	}
+}
+
+func (k *KeyRing) reload() error {
+	k.mu.Lock()
+	k.lastCheck = time.Now()
+	k.mu.Unlock()
+
+	stat, err := os.Stat(filepath.Join(k.dir, keyManifestFile))
+	if err != nil {
+		return err
+	}
+
+	k.mu.RLock()
+	unchanged := stat.ModTime().Equal(k.manifestMod) && len(k.ordered) > 0
+	k.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	manifest, err := readKeyManifest(k.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(manifest.Keys))
+	ordered := make([]*signingKey, 0, len(manifest.Keys))
+	for _, info := range manifest.Keys {
+		key, err := loadSigningKey(k.dir, info)
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %w", info.Kid, err)
+		}
+		keys[info.Kid] = key
+		ordered = append(ordered, key)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.ordered = ordered
+	k.manifestMod = stat.ModTime()
+	k.mu.Unlock()
+	return nil
+}
+
+func loadSigningKey(dir string, info SigningKeyInfo) (*signingKey, error) {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.Base(info.File)))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM file")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{info: info}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if info.Alg != AlgRS256 {
+			return nil, fmt.Errorf("RSA key cannot be used for %s", info.Alg)
+		}
+		key.private, key.public, key.method = private, &private.PublicKey, jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		if info.Alg != AlgEdDSA {
+			return nil, fmt.Errorf("Ed25519 key cannot be used for %s", info.Alg)
+		}
+		key.private, key.public, key.method = private, private.Public(), jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
+
+// RotateSigningKey adds a new signing key to dir. It is published right away
+// but only starts signing after activateAfter, giving services that cache the
+// JWKS time to fetch it. Older keys stay valid for verification until pruned.
+func RotateSigningKey(dir, alg string, activateAfter time.Duration) (*SigningKeyInfo, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	var private crypto.Signer
+	switch alg {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q, use %s or %s", alg, AlgRS256, AlgEdDSA)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := readKeyManifest(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	suffix, err := rand.Int(rand.Reader, big.NewInt(1<<32))
+	if err != nil {
+		return nil, err
+	}
+	info := SigningKeyInfo{
+		Kid:        fmt.Sprintf("%s-%08x", now.Format("20060102T150405"), suffix.Int64()),
+		Alg:        alg,
+		CreatedAt:  now,
+		ActiveFrom: now,
+	}
+	// The very first key has to sign immediately
+	if len(manifest.Keys) > 0 {
+		info.ActiveFrom = now.Add(activateAfter)
+	}
+	info.File = info.Kid + ".pem"
+
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, info.File), pemData, 0o600); err != nil {
+		return nil, err
+	}
+
+	manifest.Keys = append(manifest.Keys, info)
+	if err := writeKeyManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ListSigningKeys returns the keys in dir, oldest first
+func ListSigningKeys(dir string) ([]SigningKeyInfo, error) {
+	manifest, err := readKeyManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Keys, nil
+}
+
+// PruneSigningKeys removes keys that were replaced by a newer active key more
+// than olderThan ago. olderThan must exceed the lifetime of the longest-lived
+// token, otherwise tokens signed with the removed key stop validating.
+func PruneSigningKeys(dir string, olderThan time.Duration) ([]SigningKeyInfo, error) {
+	manifest, err := readKeyManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var kept, pruned []SigningKeyInfo
+	for i, info := range manifest.Keys {
+		// A key stops signing once the next key becomes active
+		replaced := i+1 < len(manifest.Keys) && now.Sub(manifest.Keys[i+1].ActiveFrom) > olderThan
+		if replaced {
+			pruned = append(pruned, info)
+		} else {
+			kept = append(kept, info)
+		}
+	}
+
+	manifest.Keys = kept
+	if err := writeKeyManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+	for _, info := range pruned {
+		os.Remove(filepath.Join(dir, filepath.Base(info.File)))
+	}
+	return pruned, nil
+}
+
+func readKeyManifest(dir string) (keyManifest, error) {
+	var manifest keyManifest
+	data, err := os.ReadFile(filepath.Join(dir, keyManifestFile))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid key manifest: %w", err)
+	}
+	sort.SliceStable(manifest.Keys, func(i, j int) bool {
+		return manifest.Keys[i].ActiveFrom.Before(manifest.Keys[j].ActiveFrom)
+	})
+	return manifest, nil
+}
+
+// writeKeyManifest replaces the manifest atomically so running servers never read half a file
+func writeKeyManifest(dir string, manifest keyManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".keys-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, keyManifestFile))
+}
@@ -0,0 +1,169 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"yourapp/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LimiterStore keeps attempt counters and lockouts for brute-force protection.
+// The in-memory store works for a single instance; use Redis when running several.
+type LimiterStore interface {
+	// Increment adds one to the counter at key and returns the new value.
+	// The counter expires window after its first increment.
+	Increment(key string, window time.Duration) (int64, error)
+	// Reset deletes the counter at key
+	Reset(key string) error
+	// Lock blocks key for ttl
+	Lock(key string, ttl time.Duration) error
+	// LockedFor returns how long key stays locked, zero if it is not locked
+	LockedFor(key string) (time.Duration, error)
+}
+
+type memoryLimiterStore struct {
+	mu        sync.Mutex
+	counters  map[string]memoryCounter
+	locks     map[string]time.Time
+	lastSweep time.Time
+}
+
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// NewMemoryLimiterStore creates a process-local limiter store
+func NewMemoryLimiterStore() LimiterStore {
+	return &memoryLimiterStore{
+		counters: make(map[string]memoryCounter),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *memoryLimiterStore) Increment(key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	counter, ok := s.counters[key]
+	if !ok || now.After(counter.expiresAt) {
+		counter = memoryCounter{expiresAt: now.Add(window)}
+	}
+	counter.count++
+	s.counters[key] = counter
+	return counter.count, nil
+}
+
+func (s *memoryLimiterStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+	return nil
+}
+
+func (s *memoryLimiterStore) Lock(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *memoryLimiterStore) LockedFor(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	remaining := time.Until(until)
+	if remaining <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+// sweep drops expired entries at most once a minute so the maps don't grow forever
+func (s *memoryLimiterStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, counter := range s.counters {
+		if now.After(counter.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+	for key, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+type redisLimiterStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisLimiterStore connects to the Redis server from the config
+func NewRedisLimiterStore(cfg *config.Config) (LimiterStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%s", cfg.RedisHost, cfg.RedisPort),
+		Password: cfg.RedisPassword,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &redisLimiterStore{client: client, prefix: "limiter:"}, nil
+}
+
+func (s *redisLimiterStore) Increment(key string, window time.Duration) (int64, error) {
+	ctx := context.Background()
+	key = s.prefix + key
+
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	// NX: only the first increment starts the window
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (s *redisLimiterStore) Reset(key string) error {
+	return s.client.Del(context.Background(), s.prefix+key).Err()
+}
+
+func (s *redisLimiterStore) Lock(key string, ttl time.Duration) error {
+	return s.client.Set(context.Background(), s.prefix+"lock:"+key, 1, ttl).Err()
+}
+
+func (s *redisLimiterStore) LockedFor(key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(context.Background(), s.prefix+"lock:"+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		// -2: no lock, -1: no expiry (never set by us)
+		return 0, nil
+	}
+	return ttl, nil
+}
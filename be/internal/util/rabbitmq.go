@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
 	"yourapp/internal/config"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -16,11 +18,16 @@ type RabbitMQClient struct {
 	config  *config.Config
 }
 
+// EmailMessage is queued for the email worker, which renders the template of
+// Type in the recipient's Locale. The subject comes from the template.
 type EmailMessage struct {
-	To      string `json:"to"`
-	Subject string `json:"subject"`
-	Body    string `json:"body"`
-	Type    string `json:"type"` // "otp", "reset_password", "verification"
+	To     string `json:"to"`
+	Body   string `json:"body"`
+	Type   string `json:"type"` // "otp", "email_change", "email_changed", "reset_password", "verification", "welcome", "data_export", "account_deletion", "org_invitation", "magic_link"
+	Locale string `json:"locale,omitempty"`
+
+	// Data carries extra template values for emails that need more than Body
+	Data map[string]string `json:"data,omitempty"`
 }
 
 const (
@@ -47,56 +54,17 @@ func NewRabbitMQClient(cfg *config.Config) (*RabbitMQClient, error) {
 		return nil, fmt.Errorf("failed to open channel: %w", err)
 	}
 
-	// Declare exchange
-	err = channel.ExchangeDeclare(
-		EmailExchange, // name
-		"direct",      // type
-		true,          // durable
-		false,         // auto-deleted
-		false,         // internal
-		false,         // no-wait
-		nil,           // arguments
-	)
-	if err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare exchange: %w", err)
-	}
-
-	// Declare queue
-	_, err = channel.QueueDeclare(
-		EmailQueueName, // name
-		true,           // durable
-		false,          // delete when unused
-		false,          // exclusive
-		false,          // no-wait
-		nil,            // arguments
-	)
-	if err != nil {
-		channel.Close()
-		conn.Close()
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+	client := &RabbitMQClient{
+		conn:    conn,
+		channel: channel,
+		config:  cfg,
 	}
-
-	// Bind queue to exchange
-	err = channel.QueueBind(
-		EmailQueueName, // queue name
-		"email",        // routing key
-		EmailExchange,  // exchange
-		false,
-		nil,
-	)
-	if err != nil {
+	if err := client.setupChannel(channel); err != nil {
 		channel.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to bind queue: %w", err)
+		return nil, err
 	}
-
-	return &RabbitMQClient{
-		conn:    conn,
-		channel: channel,
-		config:  cfg,
-	}, nil
+	return client, nil
 }
 
 // ensureConnection ensures the RabbitMQ connection and channel are open
@@ -173,7 +141,7 @@ func (r *RabbitMQClient) reconnect() error {
 	return nil
 }
 
-// setupChannel sets up exchange, queue, and binding
+// setupChannel sets up exchange, queue, binding, and the retry and dead letter queues
 func (r *RabbitMQClient) setupChannel(channel *amqp.Channel) error {
 	// Declare exchange
 	if err := channel.ExchangeDeclare(
@@ -211,7 +179,7 @@ func (r *RabbitMQClient) setupChannel(channel *amqp.Channel) error {
 		return fmt.Errorf("failed to bind queue: %w", err)
 	}
 
-	return nil
+	return setupRetryQueues(channel)
 }
 
 // PublishEmail publishes an email message to RabbitMQ
@@ -234,6 +202,8 @@ func (r *RabbitMQClient) PublishEmail(message EmailMessage) error {
 		amqp.Publishing{
 			ContentType:  "application/json",
 			Body:         body,
+			MessageId:    uuid.NewString(), // identifies the email if it ends up in the dead letter queue
+			Timestamp:    time.Now(),
 			DeliveryMode: amqp.Persistent, // Make message persistent
 		},
 	)
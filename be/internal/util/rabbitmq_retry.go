@@ -0,0 +1,263 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// EmailDeadLetterQueue holds emails that failed permanently or too often,
+	// until an admin replays them
+	EmailDeadLetterQueue  = "email_dead_letter"
+	emailRetryQueuePrefix = "email_retry_"
+
+	headerEmailAttempts  = "x-email-attempts"
+	headerEmailLastError = "x-email-last-error"
+	headerEmailPermanent = "x-email-permanent"
+	headerEmailFailedAt  = "x-email-failed-at"
+)
+
+// EmailRetryDelays is how long a failed email waits before each retry. Every
+// delay has its own queue whose TTL sends messages back to the email queue;
+// the last delay is used for all further retries.
+var EmailRetryDelays = []time.Duration{10 * time.Second, time.Minute, 10 * time.Minute, time.Hour}
+
+// DeadLetter is an email in the dead letter queue
+type DeadLetter struct {
+	ID        string        `json:"id"`
+	Message   *EmailMessage `json:"message,omitempty"`
+	RawBody   string        `json:"raw_body,omitempty"` // set, redacted, when the body is not a valid email message
+	Attempts  int           `json:"attempts"`
+	LastError string        `json:"last_error"`
+	Permanent bool          `json:"permanent"`
+	FailedAt  *time.Time    `json:"failed_at,omitempty"`
+}
+
+// redactedBody replaces email bodies that are not safe to show in the dead
+// letter listing
+const redactedBody = "[redacted]"
+
+// deadLetterPlainBodies lists the email types whose body holds no secret. The
+// others carry OTPs, reset codes or links that sign someone in, so only replay
+// gets to see them.
+var deadLetterPlainBodies = map[string]bool{
+	"welcome":          true,
+	"account_deletion": true, // the scheduled deletion date
+}
+
+type DeadLetterList struct {
+	DeadLetters []DeadLetter `json:"dead_letters"`
+	Total       int          `json:"total"`
+}
+
+func emailRetryQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s%ds", emailRetryQueuePrefix, int(delay.Seconds()))
+}
+
+// setupRetryQueues declares the retry queues and the dead letter queue
+func setupRetryQueues(channel *amqp.Channel) error {
+	for _, delay := range EmailRetryDelays {
+		if _, err := channel.QueueDeclare(
+			emailRetryQueue(delay), // name
+			true,                   // durable
+			false,                  // delete when unused
+			false,                  // exclusive
+			false,                  // no-wait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    EmailExchange,
+				"x-dead-letter-routing-key": "email",
+			},
+		); err != nil {
+			return fmt.Errorf("failed to declare retry queue: %w", err)
+		}
+	}
+
+	if _, err := channel.QueueDeclare(
+		EmailDeadLetterQueue, // name
+		true,                 // durable
+		false,                // delete when unused
+		false,                // exclusive
+		false,                // no-wait
+		nil,                  // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare dead letter queue: %w", err)
+	}
+	return nil
+}
+
+// EmailAttempts returns how often the delivered email has already failed
+func EmailAttempts(msg amqp.Delivery) int {
+	switch n := msg.Headers[headerEmailAttempts].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// RetryEmail moves a failed email to the retry queue for its attempt count and
+// returns the delay before it is delivered again
+func (r *RabbitMQClient) RetryEmail(msg amqp.Delivery, attempts int, cause error) (time.Duration, error) {
+	delay := EmailRetryDelays[min(attempts, len(EmailRetryDelays))-1]
+	return delay, r.republish("", emailRetryQueue(delay), msg, failureHeaders(msg, attempts, cause, false))
+}
+
+// DeadLetterEmail moves an email that will not be retried to the dead letter queue
+func (r *RabbitMQClient) DeadLetterEmail(msg amqp.Delivery, attempts int, cause error, permanent bool) error {
+	return r.republish("", EmailDeadLetterQueue, msg, failureHeaders(msg, attempts, cause, permanent))
+}
+
+func failureHeaders(msg amqp.Delivery, attempts int, cause error, permanent bool) amqp.Table {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	headers[headerEmailAttempts] = int32(attempts)
+	headers[headerEmailLastError] = cause.Error()
+	headers[headerEmailPermanent] = permanent
+	headers[headerEmailFailedAt] = time.Now().UTC().Format(time.RFC3339)
+	return headers
+}
+
+func (r *RabbitMQClient) republish(exchange, routingKey string, msg amqp.Delivery, headers amqp.Table) error {
+	if err := r.ensureConnection(); err != nil {
+		return fmt.Errorf("connection error: %w", err)
+	}
+
+	messageID := msg.MessageId
+	if messageID == "" {
+		messageID = uuid.NewString()
+	}
+
+	return r.channel.Publish(exchange, routingKey, false, false, amqp.Publishing{
+		ContentType:  msg.ContentType,
+		Body:         msg.Body,
+		Headers:      headers,
+		MessageId:    messageID,
+		Timestamp:    msg.Timestamp,
+		DeliveryMode: amqp.Persistent,
+	})
+}
+
+// DeadLetters returns up to limit dead letters without removing them. They
+// are read on a separate channel and return to the queue when it closes.
+func (r *RabbitMQClient) DeadLetters(limit int) (*DeadLetterList, error) {
+	channel, total, err := r.deadLetterChannel()
+	if err != nil {
+		return nil, err
+	}
+	defer channel.Close()
+
+	list := &DeadLetterList{DeadLetters: []DeadLetter{}, Total: total}
+	for len(list.DeadLetters) < min(limit, total) {
+		msg, ok, err := channel.Get(EmailDeadLetterQueue, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		if !ok {
+			break
+		}
+		list.DeadLetters = append(list.DeadLetters, toDeadLetter(msg))
+	}
+	return list, nil
+}
+
+// ReplayDeadLetters sends the dead letters with the given IDs, or all of them
+// when ids is empty, back to the email queue with a fresh attempt count
+func (r *RabbitMQClient) ReplayDeadLetters(ids []string) (int, error) {
+	channel, total, err := r.deadLetterChannel()
+	if err != nil {
+		return 0, err
+	}
+	// Closing the channel returns the dead letters that were not replayed
+	defer channel.Close()
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	replayed := 0
+	for i := 0; i < total; i++ {
+		msg, ok, err := channel.Get(EmailDeadLetterQueue, false)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		if !ok {
+			break
+		}
+		if len(wanted) > 0 && !wanted[msg.MessageId] {
+			continue
+		}
+
+		err = channel.Publish(EmailExchange, "email", false, false, amqp.Publishing{
+			ContentType:  msg.ContentType,
+			Body:         msg.Body,
+			MessageId:    msg.MessageId,
+			Timestamp:    msg.Timestamp,
+			DeliveryMode: amqp.Persistent,
+		})
+		if err != nil {
+			return replayed, fmt.Errorf("failed to replay dead letter: %w", err)
+		}
+		if err := msg.Ack(false); err != nil {
+			return replayed, fmt.Errorf("failed to replay dead letter: %w", err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// deadLetterChannel opens a channel for reading the dead letter queue and
+// returns how many messages it holds
+func (r *RabbitMQClient) deadLetterChannel() (*amqp.Channel, int, error) {
+	if err := r.ensureConnection(); err != nil {
+		return nil, 0, fmt.Errorf("connection error: %w", err)
+	}
+
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open channel: %w", err)
+	}
+	queue, err := channel.QueueDeclarePassive(EmailDeadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		channel.Close()
+		return nil, 0, fmt.Errorf("failed to inspect dead letter queue: %w", err)
+	}
+	return channel, queue.Messages, nil
+}
+
+func toDeadLetter(msg amqp.Delivery) DeadLetter {
+	deadLetter := DeadLetter{
+		ID:       msg.MessageId,
+		Attempts: EmailAttempts(msg),
+	}
+	deadLetter.LastError, _ = msg.Headers[headerEmailLastError].(string)
+	deadLetter.Permanent, _ = msg.Headers[headerEmailPermanent].(bool)
+	if failedAt, ok := msg.Headers[headerEmailFailedAt].(string); ok {
+		if t, err := time.Parse(time.RFC3339, failedAt); err == nil {
+			deadLetter.FailedAt = &t
+		}
+	}
+
+	// The queued message keeps the full body for replay; only the listing is redacted
+	var message EmailMessage
+	if err := json.Unmarshal(msg.Body, &message); err == nil {
+		if !deadLetterPlainBodies[message.Type] {
+			message.Body = redactedBody
+		}
+		deadLetter.Message = &message
+	} else {
+		// Without a type there is no telling what the body holds
+		deadLetter.RawBody = redactedBody
+	}
+	return deadLetter
+}
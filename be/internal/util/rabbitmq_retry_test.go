@@ -0,0 +1,90 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func deadLetterDelivery(t *testing.T, message EmailMessage) amqp.Delivery {
+	t.Helper()
+	body, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{
+		MessageId: "msg-1",
+		Body:      body,
+		Headers: amqp.Table{
+			headerEmailAttempts:  int32(5),
+			headerEmailLastError: "smtp: 550 no such user",
+			headerEmailPermanent: true,
+			headerEmailFailedAt:  "2024-05-01T02:30:00Z",
+		},
+	}
+}
+
+func TestToDeadLetterRedactsSecrets(t *testing.T) {
+	tests := []struct {
+		message EmailMessage
+		redact  bool
+	}{
+		{EmailMessage{Type: "otp", Body: "123456"}, true},
+		{EmailMessage{Type: "email_change", Body: "123456"}, true},
+		{EmailMessage{Type: "reset_password", Body: "123456"}, true},
+		{EmailMessage{Type: "verification", Body: "123456"}, true},
+		{EmailMessage{Type: "magic_link", Body: "https://app.example.com/magic?token=secret"}, true},
+		{EmailMessage{Type: "data_export", Body: "https://app.example.com/exports/download?token=secret"}, true},
+		{EmailMessage{Type: "org_invitation", Body: "https://app.example.com/invitations/secret", Data: map[string]string{"organization": "Acme"}}, true},
+		{EmailMessage{Type: "something_new", Body: "secret"}, true},
+		{EmailMessage{Type: "welcome", Body: "Budi"}, false},
+		{EmailMessage{Type: "account_deletion", Body: "2024-05-31T00:00:00Z"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message.Type, func(t *testing.T) {
+			tt.message.To = "user@example.org"
+			msg := deadLetterDelivery(t, tt.message)
+			original := string(msg.Body)
+
+			deadLetter := toDeadLetter(msg)
+			if deadLetter.Message == nil {
+				t.Fatal("message was not decoded")
+			}
+			want := tt.message.Body
+			if tt.redact {
+				want = redactedBody
+			}
+			if deadLetter.Message.Body != want {
+				t.Errorf("Body = %q, want %q", deadLetter.Message.Body, want)
+			}
+			if deadLetter.Message.To != tt.message.To || deadLetter.Message.Type != tt.message.Type ||
+				deadLetter.Message.Data["organization"] != tt.message.Data["organization"] {
+				t.Errorf("Message = %+v", deadLetter.Message)
+			}
+			if string(msg.Body) != original {
+				t.Error("the delivery body was changed, replay would send the redacted body")
+			}
+		})
+	}
+}
+
+func TestToDeadLetterReadsHeaders(t *testing.T) {
+	msg := deadLetterDelivery(t, EmailMessage{To: "user@example.org", Type: "otp", Body: "123456"})
+	deadLetter := toDeadLetter(msg)
+
+	if deadLetter.ID != "msg-1" || deadLetter.Attempts != 5 || !deadLetter.Permanent ||
+		deadLetter.LastError != "smtp: 550 no such user" || deadLetter.FailedAt == nil ||
+		deadLetter.FailedAt.Format(time.RFC3339) != "2024-05-01T02:30:00Z" {
+		t.Errorf("DeadLetter = %+v", deadLetter)
+	}
+}
+
+func TestToDeadLetterRedactsInvalidBody(t *testing.T) {
+	deadLetter := toDeadLetter(amqp.Delivery{MessageId: "msg-1", Body: []byte(`{"to": "user@example.org", "body": "123456"`)})
+	if deadLetter.Message != nil || deadLetter.RawBody != redactedBody {
+		t.Errorf("DeadLetter = %+v", deadLetter)
+	}
+}
@@ -0,0 +1,287 @@
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// WebAuthn authenticator data flags
+const (
+	webAuthnFlagUserPresent  = 0x01
+	webAuthnFlagUserVerified = 0x04
+	webAuthnFlagAttestedData = 0x40
+)
+
+// COSE algorithm identifiers supported for passkeys
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+// WebAuthnRelyingParty holds the values every ceremony is checked against
+type WebAuthnRelyingParty struct {
+	ID      string
+	Origins []string
+}
+
+// WebAuthnCredential is the result of a successful registration ceremony
+type WebAuthnCredential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key as sent by the authenticator
+	SignCount uint32
+	AAGUID    []byte
+}
+
+// AuthenticatorData is the parsed authData structure
+type AuthenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+type webAuthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// DecodeBase64URL decodes base64url with or without padding, as sent by browsers
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// VerifyWebAuthnRegistration checks a navigator.credentials.create() response.
+// Attestation statements are not verified: we request "none" attestation and
+// trust the key because the user registered it while signed in.
+func VerifyWebAuthnRegistration(rp WebAuthnRelyingParty, challenge string, clientDataJSON, attestationObject []byte, requireUserVerification bool) (*WebAuthnCredential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := DecodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authData")
+	}
+
+	authData, err := ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(authData, requireUserVerification); err != nil {
+		return nil, err
+	}
+	if authData.CredentialID == nil {
+		return nil, errors.New("authenticator did not return a credential")
+	}
+
+	// Make sure the key is usable before storing it
+	if _, _, err := ParseCOSEKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnCredential{
+		ID:        authData.CredentialID,
+		PublicKey: authData.PublicKey,
+		SignCount: authData.SignCount,
+		AAGUID:    authData.AAGUID,
+	}, nil
+}
+
+// VerifyWebAuthnAssertion checks a navigator.credentials.get() response against a stored key
+// and returns the authenticator's new signature counter.
+func VerifyWebAuthnAssertion(rp WebAuthnRelyingParty, challenge string, publicKey []byte, storedSignCount uint32, clientDataJSON, rawAuthData, signature []byte, requireUserVerification bool) (uint32, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(authData, requireUserVerification); err != nil {
+		return 0, err
+	}
+
+	key, alg, err := ParseCOSEKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(key, alg, signed, signature); err != nil {
+		return 0, err
+	}
+
+	// A counter that does not increase means the authenticator may have been cloned.
+	// Authenticators that do not implement counters always report zero.
+	if (authData.SignCount != 0 || storedSignCount != 0) && authData.SignCount <= storedSignCount {
+		return 0, errors.New("signature counter did not increase, possible cloned authenticator")
+	}
+
+	return authData.SignCount, nil
+}
+
+// ParseAuthenticatorData parses the binary authenticator data structure
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	authData := &AuthenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if authData.Flags&webAuthnFlagAttestedData != 0 {
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		authData.AAGUID = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("credential ID truncated")
+		}
+		authData.CredentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		// The COSE key is followed by optional extensions, so decode it to find its length
+		_, after, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		authData.PublicKey = rest[:len(rest)-len(after)]
+	}
+
+	return authData, nil
+}
+
+// ParseCOSEKey converts a COSE_Key into a Go public key and its algorithm
+func ParseCOSEKey(data []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := DecodeCBOR(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid COSE key: %w", err)
+	}
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("invalid COSE key")
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("unsupported EC2 key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, 0, errors.New("EC2 key is not on curve")
+		}
+		return key, alg, nil
+	case kty == 1 && alg == COSEAlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("unsupported OKP key")
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("unsupported RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported COSE key type %d / algorithm %d", kty, alg)
+}
+
+func verifyCOSESignature(key crypto.PublicKey, alg int64, signed, signature []byte) error {
+	switch alg {
+	case COSEAlgES256:
+		digest := sha256.Sum256(signed)
+		if !ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], signature) {
+			return errors.New("invalid signature")
+		}
+	case COSEAlgEdDSA:
+		if !ed25519.Verify(key.(ed25519.PublicKey), signed, signature) {
+			return errors.New("invalid signature")
+		}
+	case COSEAlgRS256:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("unsupported signature algorithm")
+	}
+	return nil
+}
+
+func (rp WebAuthnRelyingParty) checkClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var clientData webAuthnClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return errors.New("invalid client data")
+	}
+
+	if clientData.Type != ceremony {
+		return errors.New("unexpected ceremony type")
+	}
+	if clientData.Challenge != challenge {
+		return errors.New("challenge mismatch")
+	}
+
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return errors.New("origin not allowed")
+}
+
+func (rp WebAuthnRelyingParty) checkAuthenticatorData(authData *AuthenticatorData, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return errors.New("relying party ID mismatch")
+	}
+	if authData.Flags&webAuthnFlagUserPresent == 0 {
+		return errors.New("user presence required")
+	}
+	if requireUserVerification && authData.Flags&webAuthnFlagUserVerified == 0 {
+		return errors.New("user verification required")
+	}
+	return nil
+}
@@ -0,0 +1,392 @@
+package util
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+var testRP = WebAuthnRelyingParty{ID: testRPID, Origins: []string{testOrigin}}
+
+// softAuthenticator plays the browser and authenticator side of the WebAuthn
+// ceremonies with an in-memory key
+type softAuthenticator struct {
+	t            *testing.T
+	alg          int64
+	credentialID []byte
+	ecKey        *ecdsa.PrivateKey
+	edKey        ed25519.PrivateKey
+	signCount    uint32
+	rpID         string
+	flags        byte
+}
+
+func newSoftAuthenticator(t *testing.T, alg int64) *softAuthenticator {
+	t.Helper()
+	a := &softAuthenticator{
+		t:            t,
+		alg:          alg,
+		credentialID: make([]byte, 16),
+		rpID:         testRPID,
+		flags:        webAuthnFlagUserPresent | webAuthnFlagUserVerified,
+	}
+	rand.Read(a.credentialID)
+
+	var err error
+	switch alg {
+	case COSEAlgES256:
+		a.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case COSEAlgEdDSA:
+		_, a.edKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	if a.alg == COSEAlgEdDSA {
+		return cborEncode(cborMap{
+			{1, 1}, {3, COSEAlgEdDSA}, {-1, 6},
+			{-2, []byte(a.edKey.Public().(ed25519.PublicKey))},
+		})
+	}
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.ecKey.X.FillBytes(x)
+	a.ecKey.Y.FillBytes(y)
+	return cborEncode(cborMap{
+		{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, x}, {-3, y},
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func testClientData(t *testing.T, ceremony, challenge, origin string) []byte {
+	t.Helper()
+	data, err := json.Marshal(webAuthnClientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// register returns the clientDataJSON and attestation object of navigator.credentials.create()
+func (a *softAuthenticator) register(challenge string) ([]byte, []byte) {
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, a.coseKey()...)
+
+	attestation := cborEncode(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", a.authData(a.flags|webAuthnFlagAttestedData, attested)},
+	})
+	return testClientData(a.t, "webauthn.create", challenge, testOrigin), attestation
+}
+
+// login returns the clientDataJSON, authenticator data and signature of navigator.credentials.get()
+func (a *softAuthenticator) login(challenge string) ([]byte, []byte, []byte) {
+	a.signCount++
+	clientData := testClientData(a.t, "webauthn.get", challenge, testOrigin)
+	authData := a.authData(a.flags, nil)
+	return clientData, authData, a.sign(authData, clientData)
+}
+
+func (a *softAuthenticator) sign(authData, clientData []byte) []byte {
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	if a.alg == COSEAlgEdDSA {
+		return ed25519.Sign(a.edKey, signed)
+	}
+	digest := sha256.Sum256(signed)
+	signature, err := ecdsa.SignASN1(rand.Reader, a.ecKey, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return signature
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		alg  int64
+	}{
+		{"ES256", COSEAlgES256},
+		{"EdDSA", COSEAlgEdDSA},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := newSoftAuthenticator(t, tt.alg)
+
+			clientData, attestation := authenticator.register("registration-challenge")
+			credential, err := VerifyWebAuthnRegistration(testRP, "registration-challenge", clientData, attestation, true)
+			if err != nil {
+				t.Fatalf("registration failed: %v", err)
+			}
+			if !bytes.Equal(credential.ID, authenticator.credentialID) {
+				t.Errorf("credential ID = %x, want %x", credential.ID, authenticator.credentialID)
+			}
+			if _, alg, err := ParseCOSEKey(credential.PublicKey); err != nil || alg != tt.alg {
+				t.Fatalf("stored key has algorithm %d (error %v), want %d", alg, err, tt.alg)
+			}
+
+			storedCount := credential.SignCount
+			for i := 0; i < 3; i++ {
+				challenge := "login-challenge-" + string(rune('a'+i))
+				clientData, authData, signature := authenticator.login(challenge)
+				signCount, err := VerifyWebAuthnAssertion(testRP, challenge, credential.PublicKey, storedCount, clientData, authData, signature, true)
+				if err != nil {
+					t.Fatalf("login %d failed: %v", i+1, err)
+				}
+				if signCount != authenticator.signCount {
+					t.Errorf("login %d returned sign count %d, want %d", i+1, signCount, authenticator.signCount)
+				}
+				storedCount = signCount
+			}
+		})
+	}
+}
+
+func TestWebAuthnRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(a *softAuthenticator, clientData, attestation []byte) ([]byte, []byte)
+		wantErr string
+	}{
+		{
+			name: "RP ID hash mismatch",
+			modify: func(a *softAuthenticator, _, _ []byte) ([]byte, []byte) {
+				a.rpID = "evil.example"
+				return a.register("challenge")
+			},
+			wantErr: "relying party ID mismatch",
+		},
+		{
+			name: "user not verified",
+			modify: func(a *softAuthenticator, _, _ []byte) ([]byte, []byte) {
+				a.flags = webAuthnFlagUserPresent
+				return a.register("challenge")
+			},
+			wantErr: "user verification required",
+		},
+		{
+			name: "user not present",
+			modify: func(a *softAuthenticator, _, _ []byte) ([]byte, []byte) {
+				a.flags = webAuthnFlagUserVerified
+				return a.register("challenge")
+			},
+			wantErr: "user presence required",
+		},
+		{
+			name: "other challenge",
+			modify: func(a *softAuthenticator, _, attestation []byte) ([]byte, []byte) {
+				return testClientData(a.t, "webauthn.create", "other", testOrigin), attestation
+			},
+			wantErr: "challenge mismatch",
+		},
+		{
+			name: "other origin",
+			modify: func(a *softAuthenticator, _, attestation []byte) ([]byte, []byte) {
+				return testClientData(a.t, "webauthn.create", "challenge", "https://evil.example"), attestation
+			},
+			wantErr: "origin not allowed",
+		},
+		{
+			name: "login ceremony",
+			modify: func(a *softAuthenticator, _, attestation []byte) ([]byte, []byte) {
+				return testClientData(a.t, "webauthn.get", "challenge", testOrigin), attestation
+			},
+			wantErr: "unexpected ceremony type",
+		},
+		{
+			name: "truncated attestation object",
+			modify: func(a *softAuthenticator, clientData, attestation []byte) ([]byte, []byte) {
+				return clientData, attestation[:len(attestation)-10]
+			},
+			wantErr: "invalid attestation object",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := newSoftAuthenticator(t, COSEAlgES256)
+			clientData, attestation := authenticator.register("challenge")
+			clientData, attestation = tt.modify(authenticator, clientData, attestation)
+
+			_, err := VerifyWebAuthnRegistration(testRP, "challenge", clientData, attestation, true)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebAuthnRegistrationWithoutUserVerification(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, COSEAlgES256)
+	authenticator.flags = webAuthnFlagUserPresent
+
+	clientData, attestation := authenticator.register("challenge")
+	if _, err := VerifyWebAuthnRegistration(testRP, "challenge", clientData, attestation, false); err != nil {
+		t.Errorf("registration without required UV failed: %v", err)
+	}
+}
+
+func TestWebAuthnAssertionRejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		storedCount uint32
+		prepare     func(a *softAuthenticator)
+		modify      func(a *softAuthenticator, clientData, authData, signature []byte) ([]byte, []byte, []byte)
+		wantErr     string
+	}{
+		{
+			name:    "RP ID hash mismatch",
+			prepare: func(a *softAuthenticator) { a.rpID = "evil.example" },
+			wantErr: "relying party ID mismatch",
+		},
+		{
+			name:    "user not verified",
+			prepare: func(a *softAuthenticator) { a.flags = webAuthnFlagUserPresent },
+			wantErr: "user verification required",
+		},
+		{
+			name:        "sign count regression",
+			storedCount: 10,
+			prepare:     func(a *softAuthenticator) { a.signCount = 4 },
+			wantErr:     "signature counter did not increase",
+		},
+		{
+			name:        "sign count replayed",
+			storedCount: 5,
+			prepare:     func(a *softAuthenticator) { a.signCount = 4 },
+			wantErr:     "signature counter did not increase",
+		},
+		{
+			name:        "counter dropped to zero",
+			storedCount: 5,
+			prepare:     func(a *softAuthenticator) { a.signCount = 0xffffffff }, // wraps to 0 on login
+			wantErr:     "signature counter did not increase",
+		},
+		{
+			name: "tampered authenticator data",
+			modify: func(a *softAuthenticator, clientData, authData, signature []byte) ([]byte, []byte, []byte) {
+				authData[36]++
+				return clientData, authData, signature
+			},
+			wantErr: "invalid signature",
+		},
+		{
+			name: "signature over other client data",
+			modify: func(a *softAuthenticator, _, authData, signature []byte) ([]byte, []byte, []byte) {
+				other := testClientData(a.t, "webauthn.get", "challenge", testOrigin)
+				other = append(other[:len(other)-1], []byte(`,"crossOrigin":false}`)...)
+				return other, authData, signature
+			},
+			wantErr: "invalid signature",
+		},
+		{
+			name: "registration ceremony",
+			modify: func(a *softAuthenticator, _, authData, _ []byte) ([]byte, []byte, []byte) {
+				clientData := testClientData(a.t, "webauthn.create", "challenge", testOrigin)
+				return clientData, authData, a.sign(authData, clientData)
+			},
+			wantErr: "unexpected ceremony type",
+		},
+		{
+			name: "truncated authenticator data",
+			modify: func(a *softAuthenticator, clientData, authData, signature []byte) ([]byte, []byte, []byte) {
+				return clientData, authData[:36], signature
+			},
+			wantErr: "authenticator data too short",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := newSoftAuthenticator(t, COSEAlgES256)
+			clientData, attestation := authenticator.register("registration")
+			credential, err := VerifyWebAuthnRegistration(testRP, "registration", clientData, attestation, true)
+			if err != nil {
+				t.Fatalf("registration failed: %v", err)
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(authenticator)
+			}
+			clientData, authData, signature := authenticator.login("challenge")
+			if tt.modify != nil {
+				clientData, authData, signature = tt.modify(authenticator, clientData, authData, signature)
+			}
+
+			_, err = VerifyWebAuthnAssertion(testRP, "challenge", credential.PublicKey, tt.storedCount, clientData, authData, signature, true)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Authenticators without a counter report zero on every login
+func TestWebAuthnAssertionWithoutCounter(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, COSEAlgEdDSA)
+	clientData, attestation := authenticator.register("registration")
+	credential, err := VerifyWebAuthnRegistration(testRP, "registration", clientData, attestation, true)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		clientData := testClientData(t, "webauthn.get", "challenge", testOrigin)
+		authData := authenticator.authData(authenticator.flags, nil)
+		signature := authenticator.sign(authData, clientData)
+		if _, err := VerifyWebAuthnAssertion(testRP, "challenge", credential.PublicKey, 0, clientData, authData, signature, true); err != nil {
+			t.Fatalf("login %d failed: %v", i+1, err)
+		}
+	}
+}
+
+func TestParseCOSEKeyRejectsInvalidKeys(t *testing.T) {
+	point := make([]byte, 32)
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"not a map", cborEncode([]interface{}{1, 2})},
+		{"unknown algorithm", cborEncode(cborMap{{1, 2}, {3, -36}})},
+		{"wrong curve", cborEncode(cborMap{{1, 2}, {3, COSEAlgES256}, {-1, 2}, {-2, point}, {-3, point}})},
+		{"point not on curve", cborEncode(cborMap{{1, 2}, {3, COSEAlgES256}, {-1, 1}, {-2, point}, {-3, point}})},
+		{"short Ed25519 key", cborEncode(cborMap{{1, 1}, {3, COSEAlgEdDSA}, {-1, 6}, {-2, point[:31]}})},
+		{"short RSA modulus", cborEncode(cborMap{{1, 3}, {3, COSEAlgRS256}, {-1, point}, {-2, []byte{1, 0, 1}}})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseCOSEKey(tt.key); err == nil {
+				t.Error("ParseCOSEKey succeeded, want error")
+			}
+		})
+	}
+}
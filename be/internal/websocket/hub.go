@@ -27,7 +27,7 @@ type Hub struct {
 type Message struct {
 	RoomID  string      `json:"room_id"`
 	UserID  string      `json:"user_id"`
-	Type    string      `json:"type"` // "message", "user_joined", "user_left"
+	Type    string      `json:"type"` // "message", "user_joined", "user_left", "message_deleted", "room_closed"
 	Payload interface{} `json:"payload"`
 }
 
@@ -126,11 +126,9 @@ export const authOptions: NextAuthOptions = {
       // Handle Google OAuth
       if (account?.provider === "google") {
         try {
+          // The backend verifies the Google-signed ID token itself
           const authResponse = await api.googleOAuth({
-            email: user.email!,
-            full_name: user.name || user.email!.split("@")[0],
-            profile_photo: user.image || "",
-            google_id: account.providerAccountId,
+            id_token: account.id_token!,
           });
 
           // Store the tokens in the user object for the JWT callback
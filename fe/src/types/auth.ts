@@ -86,8 +86,5 @@ export interface VerifyResetPasswordResponse {
 }
 
 export interface GoogleOAuthRequest {
-  email: string;
-  full_name: string;
-  profile_photo: string;
-  google_id: string;
+  id_token: string;
 }